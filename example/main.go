@@ -25,11 +25,16 @@ func main() {
 	//Host5 and host6 respectively
 	c.TargetWWNs = []string{"10000000c9a02834", "10000000c9a02835"}
 	c.Lun = "1"
-	dp, err := fibrechannel.Attach(c, &fibrechannel.OSioHandler{})
+	c.VolumeName = "example"
+	client := fibrechannel.NewClient(&fibrechannel.OSioHandler{})
+	dp, err := client.Attach(c)
 	glog.Infof("Path is: %s\n", dp)
 	if err != nil {
 		glog.Errorf("Error from Connect: %s\n", err)
 	}
 
-	fibrechannel.Detach(dp, &fibrechannel.OSioHandler{})
+	client.Detach(c.VolumeName, dp)
+	for _, r := range client.History() {
+		glog.Infof("%s %s took %v: %v\n", r.Operation, r.VolumeName, r.Duration, r.Err)
+	}
 }
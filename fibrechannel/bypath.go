@@ -0,0 +1,154 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+//FCPath is a parsed /dev/disk/by-path name of a fibre channel disk such as
+//pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-0, or on s390 with older udev versions
+//ccw-0.0.1234-zfcp-0x500507630b0b0a2b:0x4010400000000000. Bus is the path to the HBA, which
+//BusSegments splits. Partition is empty for the whole disk.
+type FCPath struct {
+	Bus       string
+	WWN       string
+	Lun       string
+	Partition string
+}
+
+//BusSegment is one device on the path to the HBA, e.g. pci-0000:41:00.0 or ccw-0.0.1234. Type is
+//empty for a part of the bus that doesn't start with one of ByPathBusTypes.
+type BusSegment struct {
+	Type    string
+	Address string
+}
+
+//ByPathBusTypes are the buses udev's path_id names in by-path entries. Platforms whose udev rules
+//name other buses add them, so the HBA address can be told apart on them too.
+var ByPathBusTypes = []string{"pci", "platform", "acpi", "ccw", "ccwgroup", "ap", "xen", "vmbus", "usb", "bcma", "scm"}
+
+// ParseFCPath parses a /dev/disk/by-path entry name, it fails for anything but an fc disk or partition
+func ParseFCPath(name string) (FCPath, error) {
+	var p FCPath
+	var rest string
+	if i := strings.Index(name, "-fc-0x"); i >= 0 {
+		p.Bus, rest = name[:i], name[i+len("-fc-0x"):]
+	} else if strings.HasPrefix(name, "fc-0x") {
+		// an HBA without a parent bus udev knows
+		rest = name[len("fc-0x"):]
+	} else if i := strings.Index(name, "-zfcp-0x"); i >= 0 {
+		p.Bus = name[:i]
+		// wwpn:lun
+		rest = strings.Replace(name[i+len("-zfcp-0x"):], ":", "-lun-", 1)
+	} else {
+		return p, fmt.Errorf("%s is not a fibre channel path", name)
+	}
+
+	j := strings.Index(rest, "-lun-")
+	if j <= 0 {
+		return p, fmt.Errorf("%s has no wwn and lun", name)
+	}
+	p.WWN = wwn.Normalize(rest[:j])
+	p.Lun = rest[j+len("-lun-"):]
+
+	if k := strings.Index(p.Lun, "-part"); k >= 0 {
+		p.Partition = p.Lun[k+len("-part"):]
+		p.Lun = p.Lun[:k]
+	}
+	if p.Lun == "" {
+		return p, fmt.Errorf("%s has no lun", name)
+	}
+	return p, nil
+}
+
+// BusSegments splits Bus into the devices on the path to the HBA, e.g.
+// platform-fe200000.pcie-pci-0000:01:00.0 into the platform device and the pci HBA
+func (p FCPath) BusSegments() []BusSegment {
+	var segments []BusSegment
+	bus := p.Bus
+	for bus != "" {
+		typ := busType(bus)
+		if typ == "" {
+			return append(segments, BusSegment{Address: bus})
+		}
+		rest := bus[len(typ)+1:]
+		end := len(rest)
+		for i := 0; i < len(rest); i++ {
+			if rest[i] == '-' && busType(rest[i+1:]) != "" {
+				end = i
+				break
+			}
+		}
+		segments = append(segments, BusSegment{Type: typ, Address: rest[:end]})
+		if end == len(rest) {
+			break
+		}
+		bus = rest[end+1:]
+	}
+	return segments
+}
+
+// Adapter returns the HBA the path goes through, the last of its bus segments
+func (p FCPath) Adapter() BusSegment {
+	segments := p.BusSegments()
+	if len(segments) == 0 {
+		return BusSegment{}
+	}
+	return segments[len(segments)-1]
+}
+
+// busType returns the longest of ByPathBusTypes that bus starts with, followed by a dash
+func busType(bus string) string {
+	found := ""
+	for _, t := range ByPathBusTypes {
+		if len(t) > len(found) && strings.HasPrefix(bus, t+"-") {
+			found = t
+		}
+	}
+	return found
+}
+
+// Matches reports whether the path is the whole disk for wwn and lun
+func (p FCPath) Matches(targetWWN, lun string) bool {
+	return p.Partition == "" && wwn.Equal(p.WWN, targetWWN) && sameLun(p.Lun, lun)
+}
+
+// sameLun compares the lun of a by-path name with a connector's lun numerically so "01" and "1"
+// match but "1" and "10" don't, and the hex form udev uses for luns 256 and up matches the
+// array's number
+func sameLun(pathLun, lun string) bool {
+	x, err1 := scsi.ParseByPathLUN(pathLun)
+	y, err2 := scsi.KernelLUN(lun)
+	if err1 != nil || err2 != nil {
+		return pathLun == lun
+	}
+	return x == y
+}
+
+// kernelLun returns lun as the kernel numbers it in H:C:T:L addresses, or lun if it doesn't parse
+func kernelLun(lun string) string {
+	n, err := scsi.KernelLUN(lun)
+	if err != nil {
+		return lun
+	}
+	return strconv.FormatUint(n, 10)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFCPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected FCPath
+		invalid  bool
+	}{
+		{"pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-0", FCPath{Bus: "pci-0000:41:00.0", WWN: "500a0981891b8dc5", Lun: "0"}, false},
+		{"pci-0000:41:00.0-fc-0x500A0981891B8DC5-lun-12-part3", FCPath{Bus: "pci-0000:41:00.0", WWN: "500a0981891b8dc5", Lun: "12", Partition: "3"}, false},
+		{"pci-0000:00:1f.2-ata-1", FCPath{}, true},
+		{"pci-0000:41:00.0-fc-0x500a0981891b8dc5", FCPath{}, true},
+		{"pci-0000:41:00.0-fc-0x-lun-1", FCPath{}, true},
+		{"ccw-0.0.1234-fc-0x500507630b0b0a2b-lun-0x4010400000000000", FCPath{Bus: "ccw-0.0.1234", WWN: "500507630b0b0a2b", Lun: "0x4010400000000000"}, false},
+		{"ccw-0.0.1234-zfcp-0x500507630b0b0a2b:0x4010400000000000-part1", FCPath{Bus: "ccw-0.0.1234", WWN: "500507630b0b0a2b", Lun: "0x4010400000000000", Partition: "1"}, false},
+		{"platform-fe200000.pcie-pci-0000:01:00.0-fc-0x500a0981891b8dc5-lun-3", FCPath{Bus: "platform-fe200000.pcie-pci-0000:01:00.0", WWN: "500a0981891b8dc5", Lun: "3"}, false},
+		{"fc-0x500a0981891b8dc5-lun-3", FCPath{WWN: "500a0981891b8dc5", Lun: "3"}, false},
+		{"ccw-0.0.1234-zfcp-0x500507630b0b0a2b", FCPath{}, true},
+	}
+	for _, test := range tests {
+		p, err := ParseFCPath(test.name)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil || p != test.expected {
+			t.Errorf("%s: expected %+v, got %+v, %v", test.name, test.expected, p, err)
+		}
+	}
+}
+
+func TestFCPathBusSegments(t *testing.T) {
+	tests := []struct {
+		bus      string
+		expected []BusSegment
+	}{
+		{"pci-0000:41:00.0", []BusSegment{{"pci", "0000:41:00.0"}}},
+		{"ccw-0.0.1234", []BusSegment{{"ccw", "0.0.1234"}}},
+		{"platform-fe200000.pcie-pci-0000:01:00.0", []BusSegment{{"platform", "fe200000.pcie"}, {"pci", "0000:01:00.0"}}},
+		{"platform-soc-fc-host", []BusSegment{{"platform", "soc-fc-host"}}},
+		{"ccwgroup-0.0.f500", []BusSegment{{"ccwgroup", "0.0.f500"}}},
+		{"vendorbus-3", []BusSegment{{"", "vendorbus-3"}}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		p := FCPath{Bus: test.bus}
+		if segments := p.BusSegments(); !reflect.DeepEqual(segments, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.bus, test.expected, segments)
+		}
+	}
+
+	// a platform with its own bus type registers it
+	defer func(types []string) { ByPathBusTypes = types }(ByPathBusTypes)
+	ByPathBusTypes = append(ByPathBusTypes, "vendorbus")
+	p := FCPath{Bus: "vendorbus-3-pci-0000:01:00.0"}
+	if adapter := p.Adapter(); adapter != (BusSegment{"pci", "0000:01:00.0"}) {
+		t.Errorf("unexpected adapter %+v", adapter)
+	}
+	if segments := p.BusSegments(); len(segments) != 2 || segments[0] != (BusSegment{"vendorbus", "3"}) {
+		t.Errorf("unexpected segments %+v", segments)
+	}
+}
+
+func TestFCPathMatchesLun(t *testing.T) {
+	names := []string{
+		"pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1",
+		"pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1-part1",
+		"pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-10",
+		"pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-11",
+		"pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-100",
+		"pci-0000:41:00.0-fc-0x500a0981891b8dc50-lun-1",
+		"pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-0x4100000000000000",
+	}
+	tests := []struct {
+		lun      string
+		expected []bool
+	}{
+		{"1", []bool{true, false, false, false, false, false, false}},
+		{"01", []bool{true, false, false, false, false, false, false}},
+		{"10", []bool{false, false, true, false, false, false, false}},
+		{"11", []bool{false, false, false, true, false, false, false}},
+		{"100", []bool{false, false, false, false, true, false, false}},
+		{"256", []bool{false, false, false, false, false, false, true}},
+		{"16640", []bool{false, false, false, false, false, false, true}},
+		{"0", []bool{false, false, false, false, false, false, false}},
+	}
+	for _, test := range tests {
+		for i, name := range names {
+			p, err := ParseFCPath(name)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+			if matched := p.Matches("500a0981891b8dc5", test.lun); matched != test.expected[i] {
+				t.Errorf("lun %s, %s: expected %v, got %v", test.lun, name, test.expected[i], matched)
+			}
+			if matched := p.Matches("50:0A:09:81:89:1B:8D:C5", test.lun); matched != test.expected[i] {
+				t.Errorf("lun %s, %s: expected %v for the colon separated wwn, got %v", test.lun, name, test.expected[i], matched)
+			}
+		}
+	}
+}
+
+func TestFindDiskExactLun(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-10"] = "/dev/sdc"
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.files["/dev/sdb"] = ""
+	fs.files["/dev/sdc"] = ""
+	fs.files["/sys/block/sdb/size"] = "2097152"
+
+	if disk, _ := findDisk("500a0981891b8dc5", "1", fs); disk != "/dev/sdb" {
+		t.Errorf("expected /dev/sdb, got %s", disk)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+const (
+	// multipathdPidFile exists while multipathd runs
+	multipathdPidFile = "/run/multipathd.pid"
+	// dmControl is the node the device-mapper ioctls are sent to
+	dmControl = "/dev/mapper/control"
+)
+
+//Capabilities lists the kernel features the library found on this node. Features are probed in
+//sysfs where the kernel exposes them, so backports in distribution kernels (RHEL, SLES) are
+//recognized, and derived from the kernel version only where there is nothing to probe.
+type Capabilities struct {
+	KernelRelease string
+	KernelMajor   int
+	KernelMinor   int
+	// TargetedScan: the fc transport reports the scsi target ids a "c t l" scan string needs,
+	// without them TargetedRescan scans nothing and WithTargetedRescan scans every lun
+	TargetedScan bool
+	// IssueLIP: fc_host ports can be asked to re-login with issue_lip, without it
+	// WithDriverRebind goes straight to the rebind
+	IssueLIP bool
+	// FCHostStatistics: fc_host ports have a statistics directory, without it DiagnoseFabricLogin
+	// reports no link error counters
+	FCHostStatistics bool
+	// Multipathd: multipathd is running and assembles the maps
+	Multipathd bool
+	// DMMultipath: device-mapper takes ioctls and the dm-multipath target is loaded, so
+	// WithMultipathFallback can create maps itself. Those maps are basic: no path checker
+	// reinstates failed paths, all paths share one round-robin group whatever their ALUA state
+	// and paths appearing later are not added.
+	DMMultipath bool
+}
+
+// DetectCapabilities probes the running kernel
+func DetectCapabilities(io ioHandler) (caps Capabilities, err error) {
+	defer recoverPanic("DetectCapabilities", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	caps.KernelRelease = sysfs.ReadAttr("/proc/sys/kernel/osrelease", io)
+	if caps.KernelRelease == "" {
+		return caps, fmt.Errorf("fc: unable to read the kernel release")
+	}
+	caps.KernelMajor, caps.KernelMinor = parseKernelRelease(caps.KernelRelease)
+
+	caps.TargetedScan = targetedScan(io)
+	if hosts, err := io.ReadDir(sysfs.DefaultLayout.FCHosts()); err == nil && len(hosts) > 0 {
+		caps.IssueLIP = canIssueLIP(hosts[0].Name(), io)
+		caps.FCHostStatistics = hasFCHostStatistics(hosts[0].Name(), io)
+	}
+	caps.Multipathd = multipathdRunning(io)
+	caps.DMMultipath = dmMultipathLoaded(io)
+	return caps, nil
+}
+
+// targetedScan reports whether the fc transport names the scsi targets of the remote ports,
+// through fc_transport or the remote ports' scsi_target_id, as Capabilities.TargetedScan reports it
+func targetedScan(io ioHandler) bool {
+	if targets, err := io.ReadDir(sysfs.DefaultLayout.FCTransport()); err == nil && len(targets) > 0 {
+		return true
+	}
+	ports, err := io.ReadDir(sysfs.DefaultLayout.FCRemotePorts())
+	if err != nil || len(ports) == 0 {
+		return false
+	}
+	_, err = io.Lstat(path.Join(sysfs.DefaultLayout.FCRemotePort(ports[0].Name()), "scsi_target_id"))
+	return err == nil
+}
+
+// canIssueLIP reports whether the fc_host port host can be asked to re-login
+func canIssueLIP(host string, io ioHandler) bool {
+	_, err := io.Lstat(path.Join(sysfs.DefaultLayout.FCHost(host), "issue_lip"))
+	return err == nil
+}
+
+// hasFCHostStatistics reports whether the fc_host port host counts its link errors
+func hasFCHostStatistics(host string, io ioHandler) bool {
+	_, err := io.Lstat(path.Join(sysfs.DefaultLayout.FCHost(host), "statistics"))
+	return err == nil
+}
+
+// multipathdRunning reports whether multipathd runs to answer the commands sent over its socket.
+// The operations check it before they talk to multipathd, as Capabilities.Multipathd reports it.
+func multipathdRunning(io ioHandler) bool {
+	_, err := io.Lstat(multipathdPidFile)
+	return err == nil
+}
+
+// dmIoctls reports whether the device-mapper ioctls can be sent, the operations check it before
+// they send one
+func dmIoctls(io ioHandler) bool {
+	_, err := io.Lstat(dmControl)
+	return err == nil
+}
+
+// dmMultipathLoaded reports whether device-mapper can create multipath maps without multipathd, as
+// Capabilities.DMMultipath reports it
+func dmMultipathLoaded(io ioHandler) bool {
+	_, err := io.Lstat(sysfs.DefaultLayout.Path("module/dm_multipath"))
+	return err == nil && dmIoctls(io)
+}
+
+// String reports the capabilities in one line for logs
+func (caps Capabilities) String() string {
+	return fmt.Sprintf("kernel=%s targetedScan=%v issueLIP=%v fcHostStatistics=%v multipathd=%v dmMultipath=%v",
+		caps.KernelRelease, caps.TargetedScan, caps.IssueLIP, caps.FCHostStatistics, caps.Multipathd, caps.DMMultipath)
+}
+
+// parseKernelRelease returns major and minor of a release such as 3.10.0-1160.el7.x86_64
+func parseKernelRelease(release string) (int, int) {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0
+	}
+	major, _ := strconv.Atoi(parts[0])
+	minor, _ := strconv.Atoi(strings.TrimFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	return major, minor
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	tests := []struct {
+		release      string
+		major, minor int
+	}{
+		{"3.10.0-1160.el7.x86_64", 3, 10},
+		{"4.18.0-348.el8.x86_64", 4, 18},
+		{"5.15.0-91-generic", 5, 15},
+		{"3.12.49-11-default", 3, 12},
+	}
+	for _, test := range tests {
+		fs := newFakeHBAs()
+		fs.files["/proc/sys/kernel/osrelease"] = test.release + "\n"
+		fs.files["/sys/class/fc_host/host5/issue_lip"] = ""
+		fs.files["/sys/class/fc_remote_ports/rport-5:0-0/scsi_target_id"] = "0\n"
+
+		caps, err := DetectCapabilities(fs)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.release, err)
+		}
+		if caps.KernelMajor != test.major || caps.KernelMinor != test.minor || !caps.IssueLIP || !caps.TargetedScan || caps.FCHostStatistics {
+			t.Errorf("%s: unexpected capabilities %s", test.release, caps)
+		}
+	}
+
+	fs := newFakeHBAs()
+	fs.files["/proc/sys/kernel/osrelease"] = "5.15.0-91-generic\n"
+	fs.files["/sys/module/dm_multipath/refcnt"] = "0\n"
+	if caps, _ := DetectCapabilities(fs); caps.DMMultipath {
+		t.Errorf("expected no dm-multipath without the device-mapper control node, got %s", caps)
+	}
+	fs.files["/dev/mapper/control"] = ""
+	if caps, _ := DetectCapabilities(fs); caps.Multipathd || !caps.DMMultipath {
+		t.Errorf("expected dm-multipath without multipathd, got %s", caps)
+	}
+
+	if _, err := DetectCapabilities(newFakeSysfs()); err == nil {
+		t.Error("expected an error without a kernel release")
+	}
+}
@@ -0,0 +1,398 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+//Client runs Attach and Detach for a long-lived node plugin that issues them concurrently.
+//
+//Concurrency contract: a Client may be used from any number of goroutines. Operations on the
+//same volume name are serialized, operations on different volumes run in parallel except for
+//scsi rescans, which never overlap. Internally the locks below are only ever acquired in this
+//order, and a lock is never requested while a later one in the list is held:
+//  1. the per-volume lock, held for a whole operation. AttachMulti holds those of all its volumes,
+//     acquired in the order of the volume names.
+//  2. the host scan lock, held only while scan files are being written
+//  3. the cache, journal, history and load locks, held only while the attached-device cache, the
+//     journal of completed operations, the history of operations or the Load is read or updated
+//
+//The lock protecting the per-volume lock table is internal to it and held for map access only.
+//Nothing blocking (sysfs io, waiting, callbacks) happens under locks 2 and 3 other than the scan
+//writes themselves, so nested operations can't deadlock.
+type Client struct {
+	io       ioHandler
+	defaults []Option
+	volumes  *keyMutex
+	scanMu   sync.Mutex
+
+	cacheMu sync.Mutex
+	cache   map[string]string
+	wwids   map[string]string
+	journal *journal
+	history *history
+	load    loadCounter
+}
+
+// NewClient returns a Client doing its io through io, nil means the OS. opts apply to every
+// operation of the Client, before the options passed to the operation itself.
+func NewClient(io ioHandler, opts ...Option) *Client {
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	return &Client{
+		io:       io,
+		defaults: opts,
+		volumes:  newKeyMutex(),
+		cache:    map[string]string{},
+		wwids:    map[string]string{},
+		journal:  newJournal(maxJournalEntries),
+		history:  newHistory(maxHistoryEntries),
+	}
+}
+
+// Attach is Attach serialized per c.VolumeName
+func (cl *Client) Attach(c Connector, opts ...Option) (string, error) {
+	return cl.AttachContext(context.Background(), c, opts...)
+}
+
+// AttachContext is Attach giving up when ctx is done, e.g. when the CSI call's deadline passed.
+// The device search and waits stop at the next check of ctx, a running rescan is not interrupted.
+func (cl *Client) AttachContext(ctx context.Context, c Connector, opts ...Option) (string, error) {
+	defer cl.enter("attach", 1, func() func() { return cl.volumes.lock(c.VolumeName) })()
+
+	o := cl.options(opts)
+	o.ctx = ctx
+	if devicePath, ok := cl.journal.lookup("attach", c.VolumeName, o.operationID); ok {
+		glog.Infof("fc: attach %s already completed, returning %s", o.operationID, devicePath)
+		return devicePath, nil
+	}
+	start := o.clock.Now()
+	devicePath, err := attach(c, cl.io, o)
+	if err == nil {
+		if err = cl.claim(c.VolumeName, devicePath, getDeviceInfo(devicePath, cl.io).WWID); err != nil {
+			glog.Errorf("fc: %v", err)
+		}
+	}
+	cl.record("attach", c, devicePath, o, start, err)
+	if err != nil {
+		return "", err
+	}
+	cl.journal.record("attach", c.VolumeName, o.operationID, devicePath)
+	return devicePath, nil
+}
+
+// AttachDevice is AttachDevice serialized per c.VolumeName
+func (cl *Client) AttachDevice(c Connector, opts ...Option) (DeviceInfo, error) {
+	return cl.AttachDeviceContext(context.Background(), c, opts...)
+}
+
+// AttachDeviceContext is AttachDevice giving up when ctx is done, like AttachContext
+func (cl *Client) AttachDeviceContext(ctx context.Context, c Connector, opts ...Option) (DeviceInfo, error) {
+	var discovered []DiscoveredPath
+	var targets []TargetStatus
+	devicePath, err := cl.AttachContext(ctx, c, append(append([]Option{}, opts...), WithDiscoveredPaths(&discovered), WithTargetStatus(&targets))...)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	info := getDeviceInfo(devicePath, cl.io)
+	info.Shared = cl.options(opts).shared
+	info.Discovered = discovered
+	info.Targets = targets
+	return info, nil
+}
+
+// AttachMulti is AttachMulti serialized per volume name. It holds the locks of all volumes of cs,
+// taken in the order of their names, and ignores WithOperationID.
+func (cl *Client) AttachMulti(cs []Connector, opts ...Option) ([]AttachResult, error) {
+	return cl.AttachMultiContext(context.Background(), cs, opts...)
+}
+
+// AttachMultiContext is AttachMulti giving up when ctx is done, like AttachContext
+func (cl *Client) AttachMultiContext(ctx context.Context, cs []Connector, opts ...Option) ([]AttachResult, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, c := range cs {
+		if !seen[c.VolumeName] {
+			seen[c.VolumeName] = true
+			names = append(names, c.VolumeName)
+		}
+	}
+	sort.Strings(names)
+	defer cl.enter("attach", len(names), func() func() {
+		var unlocks []func()
+		for _, name := range names {
+			unlocks = append(unlocks, cl.volumes.lock(name))
+		}
+		return func() {
+			for i := len(unlocks) - 1; i >= 0; i-- {
+				unlocks[i]()
+			}
+		}
+	})()
+
+	volumeOptions := func() *options {
+		o := cl.options(opts)
+		o.ctx = ctx
+		return o
+	}
+	o := volumeOptions()
+	start := o.clock.Now()
+	results, err := attachMulti(cs, cl.io, volumeOptions)
+	if results == nil {
+		return nil, err
+	}
+	for i, r := range results {
+		if r.Err == nil {
+			if err := cl.claim(r.VolumeName, r.DevicePath, getDeviceInfo(r.DevicePath, cl.io).WWID); err != nil {
+				glog.Errorf("fc: %v", err)
+				results[i] = AttachResult{VolumeName: r.VolumeName, Err: err}
+			}
+		}
+		cl.record("attach", cs[i], r.DevicePath, o, start, results[i].Err)
+	}
+	return results, attachMultiErr(results)
+}
+
+// claim records devicePath and wwid as attached for volumeName, unless another volume already
+// holds them: the array reused a WWID or two publish contexts point at the same LUN, and handing
+// out the device again would mount one volume's data for another
+func (cl *Client) claim(volumeName, devicePath, wwid string) error {
+	cl.cacheMu.Lock()
+	defer cl.cacheMu.Unlock()
+	if err := cl.conflict(volumeName, devicePath, wwid); err != nil {
+		return err
+	}
+	cl.cache[volumeName] = devicePath
+	cl.wwids[volumeName] = wwid
+	return nil
+}
+
+// checkClaim fails attach with a ConflictError as soon as it found the device, before the device
+// is verified and the attach hook runs for it
+func (cl *Client) checkClaim(volumeName, devicePath string) error {
+	wwid := getDeviceInfo(devicePath, cl.io).WWID
+	cl.cacheMu.Lock()
+	defer cl.cacheMu.Unlock()
+	return cl.conflict(volumeName, devicePath, wwid)
+}
+
+// conflict returns the ConflictError of devicePath and wwid for volumeName, if another volume
+// holds them. cacheMu must be held.
+func (cl *Client) conflict(volumeName, devicePath, wwid string) error {
+	for other, otherPath := range cl.cache {
+		if other == volumeName {
+			continue
+		}
+		if otherPath == devicePath || (wwid != "" && cl.wwids[other] == wwid) {
+			return &ConflictError{VolumeName: volumeName, ClaimedBy: other, DevicePath: devicePath, WWID: wwid}
+		}
+	}
+	return nil
+}
+
+// Restore claims the volumes of connector files SaveConnector wrote, e.g. those in the staging
+// paths of the volumes staged on the node, when the plugin starts. A restarted Client then still
+// refuses to attach one of their devices for another volume. Volumes none of whose devices is
+// left are skipped. Files that can't be loaded or whose device another of them claimed are
+// reported together, the others are claimed regardless.
+func (cl *Client) Restore(filenames ...string) error {
+	return cl.RestoreContext(context.Background(), filenames...)
+}
+
+// RestoreContext is Restore giving up when ctx is done, the files not restored by then are
+// reported as failed
+func (cl *Client) RestoreContext(ctx context.Context, filenames ...string) error {
+	var failed []string
+	for _, filename := range filenames {
+		if err := ctx.Err(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", filename, err))
+			continue
+		}
+		if err := cl.restore(filename); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", filename, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("fc: failed to restore %d of %d connectors: %s", len(failed), len(filenames), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (cl *Client) restore(filename string) error {
+	c, err := LoadConnector(filename, cl.io)
+	if err != nil {
+		return err
+	}
+	defer cl.volumes.lock(c.VolumeName)()
+
+	devicePath := resolveConnector(c, cl.io)
+	if devicePath == "" {
+		glog.Infof("fc: no device of volume %s left, not restoring it", c.VolumeName)
+		return nil
+	}
+	return cl.claim(c.VolumeName, devicePath, getDeviceInfo(devicePath, cl.io).WWID)
+}
+
+//ConflictError is returned by Client.Attach when the device it found is already attached for
+//another volume
+type ConflictError struct {
+	VolumeName string
+	ClaimedBy  string
+	DevicePath string
+	WWID       string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("fc: %s (wwid %s) found for volume %s is already attached for volume %s", e.DevicePath, e.WWID, e.VolumeName, e.ClaimedBy)
+}
+
+// Prefetch is Prefetch with rescans serialized against the Client's other operations
+func (cl *Client) Prefetch(c Connector, opts ...Option) error {
+	return cl.PrefetchContext(context.Background(), c, opts...)
+}
+
+// PrefetchContext is Prefetch giving up when ctx is done, like AttachContext
+func (cl *Client) PrefetchContext(ctx context.Context, c Connector, opts ...Option) error {
+	defer cl.enter("prefetch", 1, func() func() { return cl.volumes.lock(c.VolumeName) })()
+
+	o := cl.options(opts)
+	o.ctx = ctx
+	start := o.clock.Now()
+	err := prefetch(c, cl.io, o)
+	cl.record("prefetch", c, "", o, start, err)
+	return err
+}
+
+// Detach is Detach serialized per volumeName, the volume the device was attached for
+func (cl *Client) Detach(volumeName, devicePath string, opts ...Option) error {
+	return cl.DetachContext(context.Background(), volumeName, devicePath, opts...)
+}
+
+// DetachContext is Detach giving up when ctx is done. Once the removal of the volume's devices
+// started it is completed regardless, as a half removed volume is worse than a late answer.
+func (cl *Client) DetachContext(ctx context.Context, volumeName, devicePath string, opts ...Option) error {
+	return cl.runDetach(ctx, Connector{VolumeName: volumeName}, devicePath, opts, func(o *options) error {
+		return detach(devicePath, cl.io, o)
+	})
+}
+
+// DetachVolume is DetachVolume serialized per c.VolumeName
+func (cl *Client) DetachVolume(c Connector, opts ...Option) error {
+	return cl.DetachVolumeContext(context.Background(), c, opts...)
+}
+
+// DetachVolumeContext is DetachVolume giving up when ctx is done, like DetachContext
+func (cl *Client) DetachVolumeContext(ctx context.Context, c Connector, opts ...Option) error {
+	return cl.runDetach(ctx, c, "", opts, func(o *options) error {
+		return detachVolume(c, cl.io, o)
+	})
+}
+
+// runDetach runs detachFn for the volume of c, devicePath if the caller gave one, with the Client's
+// serialization, journal, history and attached-device cache
+func (cl *Client) runDetach(ctx context.Context, c Connector, devicePath string, opts []Option, detachFn func(*options) error) error {
+	volumeName := c.VolumeName
+	defer cl.enter("detach", 1, func() func() { return cl.volumes.lock(volumeName) })()
+
+	o := cl.options(opts)
+	o.ctx = ctx
+	o.summary.volume, o.labels = volumeName, c.Labels
+	if _, ok := cl.journal.lookup("detach", volumeName, o.operationID); ok {
+		glog.Infof("fc: detach %s already completed", o.operationID)
+		return nil
+	}
+	if o.wwid == "" {
+		cl.cacheMu.Lock()
+		o.wwid = cl.wwids[volumeName]
+		cl.cacheMu.Unlock()
+	}
+	start := o.clock.Now()
+	err := detachFn(o)
+	if o.dryRun == nil {
+		cl.record("detach", c, devicePath, o, start, err)
+	}
+	if err == nil && o.dryRun == nil {
+		cl.cacheMu.Lock()
+		delete(cl.cache, volumeName)
+		delete(cl.wwids, volumeName)
+		cl.cacheMu.Unlock()
+		cl.journal.forget("attach", volumeName)
+		cl.journal.record("detach", volumeName, o.operationID, devicePath)
+	}
+	return err
+}
+
+// AttachedDevice returns the device path this Client attached for volumeName and hasn't detached since
+func (cl *Client) AttachedDevice(volumeName string) (string, bool) {
+	cl.cacheMu.Lock()
+	defer cl.cacheMu.Unlock()
+	devicePath, ok := cl.cache[volumeName]
+	return devicePath, ok
+}
+
+// options applies the caller's options and the Client's own settings
+func (cl *Client) options(opts []Option) *options {
+	o := newOptions(append(append([]Option{}, cl.defaults...), opts...))
+	o.scanLock = &cl.scanMu
+	o.checkClaim = cl.checkClaim
+	return o
+}
+
+// keyMutex is a set of mutexes created on demand per key
+type keyMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyMutex() *keyMutex {
+	return &keyMutex{locks: map[string]*refMutex{}}
+}
+
+// lock blocks until key is available and returns the function releasing it
+func (km *keyMutex) lock(key string) func() {
+	km.mu.Lock()
+	m, ok := km.locks[key]
+	if !ok {
+		m = &refMutex{}
+		km.locks[key] = m
+	}
+	m.refs++
+	km.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+		km.mu.Lock()
+		m.refs--
+		if m.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
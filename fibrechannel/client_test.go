@@ -0,0 +1,280 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyIOHandler records how many goroutines are inside EvalSymlinks at once
+type concurrencyIOHandler struct {
+	fakeIOHandler
+	mu       sync.Mutex
+	inflight int
+	max      int
+}
+
+func (handler *concurrencyIOHandler) EvalSymlinks(path string) (string, error) {
+	handler.mu.Lock()
+	handler.inflight++
+	if handler.inflight > handler.max {
+		handler.max = handler.inflight
+	}
+	handler.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	handler.mu.Lock()
+	handler.inflight--
+	handler.mu.Unlock()
+	return "/dev/sda", nil
+}
+
+func TestClientSerializesVolume(t *testing.T) {
+	io := &concurrencyIOHandler{}
+	client := NewClient(io)
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Attach(c)
+		}()
+	}
+	wg.Wait()
+	if io.max != 1 {
+		t.Errorf("expected operations on one volume to be serialized, saw %d at once", io.max)
+	}
+	if devicePath, ok := client.AttachedDevice("vol"); !ok || devicePath == "" {
+		t.Errorf("expected vol to be cached as attached")
+	}
+}
+
+func TestClientNestedOperationsDontDeadlock(t *testing.T) {
+	client := NewClient(&fakeIOHandler{})
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c := Connector{VolumeName: fmt.Sprintf("vol%d", i%3), TargetWWNs: []string{"500a0981891b8dc5"}, Lun: fmt.Sprint(i % 2)}
+				switch i % 4 {
+				case 0:
+					client.Attach(c)
+				case 1:
+					client.Detach(c.VolumeName, "/dev/sda")
+				case 2:
+					client.Prefetch(c)
+				case 3:
+					client.AttachedDevice(c.VolumeName)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("concurrent attach/detach/prefetch deadlocked")
+	}
+	if len(client.volumes.locks) != 0 {
+		t.Errorf("expected all volume locks to be released, %d left", len(client.volumes.locks))
+	}
+}
+
+func TestClientOperationID(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.files["/dev/sdb"] = ""
+	fs.files["/sys/block/sdb/size"] = "2097152"
+	client := NewClient(fs)
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+
+	devicePath, err := client.Attach(c, WithOperationID("op-1"))
+	if err != nil || devicePath != "/dev/sdb" {
+		t.Fatalf("unexpected result %q, %v", devicePath, err)
+	}
+
+	// a retry with the same id returns the recorded result without searching again
+	delete(fs.links, "/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1")
+	if devicePath, err := client.Attach(c, WithOperationID("op-1")); err != nil || devicePath != "/dev/sdb" {
+		t.Errorf("expected the recorded /dev/sdb, got %q, %v", devicePath, err)
+	}
+	if _, err := client.Attach(c, WithOperationID("op-2")); err == nil {
+		t.Error("expected a new operation id to search again and fail")
+	}
+	other := Connector{VolumeName: "other", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+	if _, err := client.Attach(other, WithOperationID("op-1")); err == nil {
+		t.Error("expected the id of another volume's attach to search again and fail")
+	}
+}
+
+func TestClientAttachConflict(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-2"] = "/dev/sdc"
+	fs.files["/dev/sdb"] = ""
+	fs.files["/dev/sdc"] = ""
+	// the array reused the wwid of lun 1 for lun 2
+	fs.files["/sys/block/sdb/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+	fs.files["/sys/block/sdc/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+	client := NewClient(fs)
+
+	if _, err := client.Attach(Connector{VolumeName: "vol1", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// attaching the same volume again is fine
+	if _, err := client.Attach(Connector{VolumeName: "vol1", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, lun := range []string{"1", "2"} {
+		_, err := client.Attach(Connector{VolumeName: "vol2", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: lun})
+		if conflict, ok := err.(*ConflictError); !ok || conflict.ClaimedBy != "vol1" {
+			t.Errorf("lun %s: expected a conflict with vol1, got %v", lun, err)
+		}
+	}
+	if _, ok := client.AttachedDevice("vol2"); ok {
+		t.Error("expected vol2 not to be recorded as attached")
+	}
+
+	// the attach hook doesn't run for a device another volume holds
+	hooked := false
+	hook := WithAttachHook(func(Connector, DeviceInfo) error { hooked = true; return nil }, HookErrorFails)
+	if _, err := client.Attach(Connector{VolumeName: "vol2", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "2"}, hook); err == nil || hooked {
+		t.Errorf("expected the conflict to be found before the hook, got %v, hook run %v", err, hooked)
+	}
+
+	// a restarted Client restores the claims from the connector files of the staged volumes
+	if err := SaveConnector("/staging/vol1/fc.json", Connector{VolumeName: "vol1", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}, fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs.files["/staging/vol1/fc.json"] = fs.writes["/staging/vol1/fc.json"]
+	restarted := NewClient(fs)
+	if err := restarted.Restore("/staging/vol1/fc.json", "/staging/missing/fc.json"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected the missing file to be reported, got %v", err)
+	}
+	if devicePath, ok := restarted.AttachedDevice("vol1"); !ok || devicePath != "/dev/sdb" {
+		t.Errorf("expected vol1 to be restored, got %q %v", devicePath, ok)
+	}
+	if _, err := restarted.Attach(Connector{VolumeName: "vol2", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "2"}); err == nil {
+		t.Error("expected a conflict with the restored vol1")
+	}
+}
+
+func TestClientContextCanceled(t *testing.T) {
+	client := NewClient(&fakeIOHandler{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	if _, err := client.AttachContext(ctx, c); err != context.Canceled {
+		t.Errorf("expected the canceled context to stop attach, got %v", err)
+	}
+	hooked := false
+	hook := WithDetachHook(func(DeviceInfo) error { hooked = true; return nil }, HookErrorFails)
+	if err := client.DetachContext(ctx, "vol", "/dev/sda", hook); err != context.Canceled {
+		t.Errorf("expected the canceled context to stop detach, got %v", err)
+	}
+	if hooked {
+		t.Error("expected the detach hook not to run for a canceled detach")
+	}
+}
+
+func TestJournalEviction(t *testing.T) {
+	j := newJournal(2)
+	j.record("attach", "vol", "a", "/dev/sda")
+	j.record("attach", "vol", "b", "/dev/sdb")
+	j.record("attach", "vol", "c", "/dev/sdc")
+	if _, ok := j.lookup("attach", "vol", "a"); ok {
+		t.Error("expected the oldest entry to be evicted")
+	}
+	if result, ok := j.lookup("attach", "vol", "c"); !ok || result != "/dev/sdc" {
+		t.Errorf("expected /dev/sdc, got %q", result)
+	}
+	if _, ok := j.lookup("detach", "vol", "c"); ok {
+		t.Error("expected operations to be journaled per kind")
+	}
+	if _, ok := j.lookup("attach", "other", "c"); ok {
+		t.Error("expected operations to be journaled per volume")
+	}
+
+	j.record("attach", "other", "d", "/dev/sdd")
+	j.forget("attach", "vol")
+	if _, ok := j.lookup("attach", "vol", "c"); ok {
+		t.Error("expected the volume's attaches to be forgotten")
+	}
+	if _, ok := j.lookup("attach", "other", "d"); !ok {
+		t.Error("expected the attaches of other volumes to be kept")
+	}
+}
+
+// blockingIOHandler blocks every EvalSymlinks until release is closed
+type blockingIOHandler struct {
+	fakeIOHandler
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (handler *blockingIOHandler) EvalSymlinks(path string) (string, error) {
+	select {
+	case handler.entered <- struct{}{}:
+	default:
+	}
+	<-handler.release
+	return "/dev/sda", nil
+}
+
+func TestClientLoad(t *testing.T) {
+	io := &blockingIOHandler{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	client := NewClient(io)
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+
+	var wg sync.WaitGroup
+	run := func(op func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			op()
+		}()
+	}
+	run(func() { client.Attach(c) })
+	<-io.entered
+	run(func() { client.Detach("vol", "/dev/sda") })
+	run(func() { client.Prefetch(c) })
+	deadline := time.Now().Add(10 * time.Second)
+	for client.Load().Waiting != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if load := client.Load(); load != (Load{Attaches: 1, Waiting: 2}) || load.Running() != 1 {
+		t.Errorf("expected 1 attach running and 2 operations waiting, got %+v", load)
+	}
+
+	close(io.release)
+	wg.Wait()
+	if load := client.Load(); load != (Load{}) {
+		t.Errorf("expected an idle client, got %+v", load)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+//FieldError is a problem with one Connector field. Field is the field's name, with the index for
+//list entries, e.g. TargetWWNs[1].
+type FieldError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+//ConnectorError lists every problem Validate found with a Connector. errors.Is matches it against
+//ErrInvalidConnector.
+type ConnectorError struct {
+	VolumeName string
+	Fields     []FieldError
+}
+
+func (e *ConnectorError) Error() string {
+	var problems []string
+	for _, f := range e.Fields {
+		problems = append(problems, f.Error())
+	}
+	return fmt.Sprintf("fc: invalid connector for volume %s: %s", e.VolumeName, strings.Join(problems, "; "))
+}
+
+func (e *ConnectorError) Unwrap() error {
+	return ErrInvalidConnector
+}
+
+// Validate checks c before any device is looked for, so malformed publish contexts fail with the
+// field at fault instead of a later "no fc disk found". A volume is identified either by
+// TargetWWNs with a Lun or by WWIDs. When both are given the WWIDs only pick among the devices
+// found through the targets.
+func (c Connector) Validate() error {
+	var fields []FieldError
+	invalid := func(field, value, reason string) {
+		fields = append(fields, FieldError{Field: field, Value: value, Reason: reason})
+	}
+
+	if len(c.TargetWWNs) == 0 && len(c.WWIDs) == 0 {
+		invalid("TargetWWNs", "", "either TargetWWNs or WWIDs is required")
+	}
+	for i, name := range c.TargetWWNs {
+		if !wwn.Valid(name) {
+			invalid(fmt.Sprintf("TargetWWNs[%d]", i), name, "not a WWN of 16 hex digits, optionally separated by colons or dashes")
+		} else if wwn.Placeholder(name) {
+			invalid(fmt.Sprintf("TargetWWNs[%d]", i), name, "all zeros or all ones, not the port name of a target")
+		}
+	}
+	if len(c.TargetWWNs) != 0 {
+		if c.Lun == "" {
+			invalid("Lun", c.Lun, "required with TargetWWNs")
+		} else if _, err := scsi.KernelLUN(c.Lun); err != nil {
+			invalid("Lun", c.Lun, "neither a decimal LUN number nor an 8 byte SAM LUN such as 0x4001000000000000")
+		}
+	} else if c.Lun != "" {
+		invalid("Lun", c.Lun, "only used with TargetWWNs")
+	}
+	for i, wwid := range c.WWIDs {
+		if strings.TrimSpace(wwid) == "" {
+			invalid(fmt.Sprintf("WWIDs[%d]", i), wwid, "empty")
+		} else if !wwn.ValidIdentifier(wwid) {
+			invalid(fmt.Sprintf("WWIDs[%d]", i), wwid, "not a valid NAA or EUI-64 identifier")
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ConnectorError{VolumeName: c.VolumeName, Fields: fields}
+}
+
+// uniqueTargetWWNs returns c's TargetWWNs without the repetitions of a name, in whatever spelling
+func (c Connector) uniqueTargetWWNs() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range c.TargetWWNs {
+		if !seen[wwn.Normalize(name)] {
+			seen[wwn.Normalize(name)] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
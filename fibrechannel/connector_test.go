@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConnectorValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		connector Connector
+		fields    []string
+	}{
+		{"target and lun", Connector{TargetWWNs: []string{"500a0981891b8dc5", "0x500A0981891B8DC6"}, Lun: "0"}, nil},
+		{"wwids", Connector{WWIDs: []string{"3600508b400105e210000900000490000"}}, nil},
+		{"target with wwids", Connector{TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1", WWIDs: []string{"3600508b400105e210000900000490000"}}, nil},
+		{"empty", Connector{}, []string{"TargetWWNs"}},
+		{"bad wwn and lun", Connector{TargetWWNs: []string{"500a0981891b8dc5", "500a0981891b8dcZ"}, Lun: "-1"}, []string{"TargetWWNs[1]", "Lun"}},
+		{"colon separated wwn", Connector{TargetWWNs: []string{"50:0A:09:81:89:1B:8D:C5"}, Lun: "0"}, nil},
+		{"large lun", Connector{TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "16384"}, nil},
+		{"sam lun", Connector{TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0x4001000000000000"}, nil},
+		{"missing lun", Connector{TargetWWNs: []string{"500a0981891b8dc5"}}, []string{"Lun"}},
+		{"lun without target", Connector{WWIDs: []string{"3600508b400105e210000900000490000"}, Lun: "0"}, []string{"Lun"}},
+		{"empty wwid", Connector{WWIDs: []string{" "}}, []string{"WWIDs[0]"}},
+		{"naa and eui identifiers", Connector{WWIDs: []string{"naa.600A098038303053453F463045727A44", "eui.0025385b71b0f9a2"}}, nil},
+		{"bad identifiers", Connector{WWIDs: []string{"naa.600a0980383030", "eui.0025385b71b0f9zz"}}, []string{"WWIDs[0]", "WWIDs[1]"}},
+		{"placeholder wwns", Connector{TargetWWNs: []string{"0000000000000000", "500a0981891b8dc5", "ff:ff:ff:ff:ff:ff:ff:ff"}, Lun: "0"}, []string{"TargetWWNs[0]", "TargetWWNs[2]"}},
+	}
+	for _, test := range tests {
+		err := test.connector.Validate()
+		if len(test.fields) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		var cerr *ConnectorError
+		if !errors.As(err, &cerr) || !errors.Is(err, ErrInvalidConnector) {
+			t.Errorf("%s: expected a ConnectorError, got %v", test.name, err)
+			continue
+		}
+		if len(cerr.Fields) != len(test.fields) {
+			t.Errorf("%s: expected problems with %v, got %v", test.name, test.fields, err)
+			continue
+		}
+		for i, field := range test.fields {
+			if cerr.Fields[i].Field != field {
+				t.Errorf("%s: expected a problem with %s, got %v", test.name, field, cerr.Fields[i])
+			}
+		}
+	}
+}
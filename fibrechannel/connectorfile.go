@@ -0,0 +1,110 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// connectorFileVersion is the version of the format SaveConnector writes. LoadConnector reads
+// every version up to it, a format change that older releases can't read bumps it.
+const connectorFileVersion = 1
+
+// connectorFile is the JSON document SaveConnector writes
+type connectorFile struct {
+	Version          int               `json:"version"`
+	VolumeName       string            `json:"volumeName"`
+	TargetWWNs       []string          `json:"targetWWNs,omitempty"`
+	Lun              string            `json:"lun,omitempty"`
+	WWIDs            []string          `json:"wwids,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	TargetPortGroups []uint16          `json:"targetPortGroups,omitempty"`
+}
+
+// SaveConnector writes c to filename as versioned JSON, so a node plugin can record at
+// NodeStageVolume what it attached, e.g. in the staging path, and find the volume's devices again
+// with LoadConnector and DetachVolume at NodeUnstageVolume, after a plugin restart too. Adding the
+// WWID of the attached device (DeviceInfo.WWID) to c.WWIDs lets the detach find the volume by it
+// when its by-path links are gone. c must be valid. The file is written next to filename and
+// renamed over it, so a crash or full disk leaves the previous file rather than a truncated one.
+func SaveConnector(filename string, c Connector, io ioHandler) (err error) {
+	defer recoverPanic("SaveConnector", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(connectorFile{
+		Version:          connectorFileVersion,
+		VolumeName:       c.VolumeName,
+		TargetWWNs:       c.TargetWWNs,
+		Lun:              c.Lun,
+		WWIDs:            c.WWIDs,
+		Labels:           c.Labels,
+		TargetPortGroups: c.TargetPortGroups,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := io.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		io.Remove(tmp)
+		return err
+	}
+	if err := io.Rename(tmp, filename); err != nil {
+		io.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// LoadConnector reads the Connector SaveConnector wrote to filename. The error of a missing file
+// is returned as is, for callers to tell with os.IsNotExist that there is nothing to clean up. A
+// file written by a later release in a format this one doesn't know fails instead of being read
+// partially.
+func LoadConnector(filename string, io ioHandler) (c Connector, err error) {
+	defer recoverPanic("LoadConnector", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	data, err := io.ReadFile(filename)
+	if err != nil {
+		return Connector{}, err
+	}
+	var f connectorFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Connector{}, fmt.Errorf("fc: invalid connector file %s: %v", filename, err)
+	}
+	if f.Version < 1 || f.Version > connectorFileVersion {
+		return Connector{}, fmt.Errorf("fc: connector file %s has version %d, only versions 1 to %d are supported", filename, f.Version, connectorFileVersion)
+	}
+	c = Connector{
+		VolumeName:       f.VolumeName,
+		TargetWWNs:       f.TargetWWNs,
+		Lun:              f.Lun,
+		WWIDs:            f.WWIDs,
+		Labels:           f.Labels,
+		TargetPortGroups: f.TargetPortGroups,
+	}
+	if err := c.Validate(); err != nil {
+		return Connector{}, errorf(ErrInvalidConnector, "fc: connector file %s: %v", filename, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSaveConnector(t *testing.T) {
+	fs := newFakeSysfs()
+	file := "/var/lib/kubelet/plugins/kubernetes.io/csi/fc/staging/vol/fc.json"
+	c := Connector{
+		VolumeName:       "vol",
+		TargetWWNs:       []string{"500a0981891b8dc5", "500a0981891b8dc6"},
+		Lun:              "1",
+		WWIDs:            []string{"3600a098038303053453f463045727a44"},
+		Labels:           map[string]string{"pv": "pvc-1"},
+		TargetPortGroups: []uint16{1},
+	}
+	if err := SaveConnector(file, c, fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(fs.writes[file], `"version": 1`) {
+		t.Errorf("expected a versioned file, got %s", fs.writes[file])
+	}
+
+	fs.files[file] = fs.writes[file]
+	loaded, err := LoadConnector(file, fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, c) {
+		t.Errorf("expected %+v, got %+v", c, loaded)
+	}
+
+	if err := SaveConnector(file, Connector{VolumeName: "bad"}, fs); !errors.Is(err, ErrInvalidConnector) {
+		t.Errorf("expected ErrInvalidConnector, got %v", err)
+	}
+
+	// a failed write leaves the previous file alone
+	fs.writes = map[string]string{}
+	full := &fullDisk{fakeSysfs: fs}
+	if err := SaveConnector(file, Connector{VolumeName: "vol2", WWIDs: c.WWIDs}, full); err == nil {
+		t.Error("expected the failed write to be reported")
+	}
+	if loaded, err := LoadConnector(file, fs); err != nil || loaded.VolumeName != "vol" || len(fs.writes) != 0 {
+		t.Errorf("expected the previous file to be left, got %+v, %v, writes %v", loaded, err, fs.writes)
+	}
+}
+
+// fullDisk fails every write with ENOSPC
+type fullDisk struct {
+	*fakeSysfs
+}
+
+func (fs *fullDisk) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	fs.fakeSysfs.WriteFile(filename, data[:len(data)/2], perm)
+	return &os.PathError{Op: "write", Path: filename, Err: syscall.ENOSPC}
+}
+
+func (fs *fullDisk) Remove(name string) error {
+	delete(fs.writes, name)
+	return nil
+}
+
+func TestLoadConnectorErrors(t *testing.T) {
+	fs := newFakeSysfs()
+	if _, err := LoadConnector("/missing.json", fs); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file to be reported as such, got %v", err)
+	}
+	tests := map[string]string{
+		"version 2":  `{"version": 2, "volumeName": "vol", "wwids": ["3600a098038303053453f463045727a44"]}`,
+		"no version": `{"volumeName": "vol", "wwids": ["3600a098038303053453f463045727a44"]}`,
+		"truncated":  `{"version": 1, "volumeName": "vol", "wwi`,
+		"invalid":    `{"version": 1, "volumeName": "vol"}`,
+	}
+	for name, content := range tests {
+		fs.files["/fc.json"] = content
+		if _, err := LoadConnector("/fc.json", fs); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	fs.files["/fc.json"] = tests["invalid"]
+	if _, err := LoadConnector("/fc.json", fs); !errors.Is(err, ErrInvalidConnector) {
+		t.Errorf("expected ErrInvalidConnector, got %v", err)
+	}
+}
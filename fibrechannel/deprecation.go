@@ -0,0 +1,38 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+//WarnDeprecatedCalls makes the package level Attach and Detach log, once per process each, which
+//Client call replaces them. It is off by default.
+var WarnDeprecatedCalls = false
+
+var deprecationWarned sync.Map
+
+func warnDeprecated(function, replacement string) {
+	if !WarnDeprecatedCalls {
+		return
+	}
+	if _, warned := deprecationWarned.LoadOrStore(function, true); warned {
+		return
+	}
+	glog.Warningf("fc: deprecated call=%s replacement=%q", "fibrechannel."+function, "fibrechannel."+replacement)
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+func TestWarnDeprecatedOnce(t *testing.T) {
+	defer func(warn bool) { WarnDeprecatedCalls = warn }(WarnDeprecatedCalls)
+
+	WarnDeprecatedCalls = false
+	warnDeprecated("TestFunction", "NewClient(io).TestFunction()")
+	if _, warned := deprecationWarned.Load("TestFunction"); warned {
+		t.Error("expected no warning while WarnDeprecatedCalls is off")
+	}
+
+	WarnDeprecatedCalls = true
+	warnDeprecated("TestFunction", "NewClient(io).TestFunction()")
+	warnDeprecated("TestFunction", "NewClient(io).TestFunction()")
+	if _, warned := deprecationWarned.Load("TestFunction"); !warned {
+		t.Error("expected the warning to be recorded")
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"path"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//DeviceInfo describes an attached device. DevicePath is what Attach returns, a multipath map or a
+//single path, MapName the device mapper name of a map (e.g. mpatha). Paths holds the sd device of
+//every path and HCTLs their H:C:T:L addresses in the same order, "" where sysfs has none. WWID is
+//the kernel's form as found in sysfs and Size is in bytes. Shared is set for volumes attached
+//with WithSharedVolume. Discovered lists every device Attach found for the volume, see
+//WithDiscoveredPaths, and Targets through which of the Connector's targets, see WithTargetStatus.
+type DeviceInfo struct {
+	DevicePath string
+	Multipath  bool
+	MapName    string
+	Paths      []string
+	HCTLs      []string
+	WWID       string
+	Size       int64
+	Shared     bool
+	Discovered []DiscoveredPath
+	Targets    []TargetStatus
+}
+
+// getDeviceInfo collects what sysfs knows about devicePath
+func getDeviceInfo(devicePath string, io ioHandler) DeviceInfo {
+	info := DeviceInfo{DevicePath: devicePath}
+	dev := path.Base(devicePath)
+	if strings.HasPrefix(dev, "dm-") {
+		info.Multipath = true
+		info.MapName = sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "dm/name"), io)
+		info.Paths = FindSlaveDevicesOnMultipath(devicePath, io)
+	} else {
+		info.Paths = []string{devicePath}
+	}
+	for _, p := range info.Paths {
+		hctl, _ := scsi.DeviceHCTL(path.Base(p), io)
+		info.HCTLs = append(info.HCTLs, hctl)
+	}
+	if len(info.Paths) > 0 {
+		info.WWID = sysfs.ReadAttr(sysfs.DefaultLayout.Block(path.Base(info.Paths[0]), "device/wwid"), io)
+	}
+	info.Size = scsi.DeviceSize(dev, io)
+	return info
+}
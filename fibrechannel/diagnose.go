@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"github.com/golang/glog"
+)
+
+//DiagnosticReport summarizes the node's Fibre Channel state for troubleshooting. Logins explains
+//the ports that aren't logged into the fabric.
+type DiagnosticReport struct {
+	Capabilities Capabilities
+	HBAs         []HBA
+	Logins       []LoginDiagnosis
+	Slots        []EnclosureSlot
+	Warnings     []string
+}
+
+// Diagnose collects the local HBAs and any known problems with them
+func Diagnose(io ioHandler) (report *DiagnosticReport, err error) {
+	defer recoverPanic("Diagnose", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	hbas, err := GetHBAs(io)
+	if err != nil {
+		return nil, err
+	}
+	report = &DiagnosticReport{HBAs: hbas}
+	if report.Capabilities, err = DetectCapabilities(io); err != nil {
+		report.Warnings = append(report.Warnings, err.Error())
+	}
+	report.Warnings = append(report.Warnings, CheckHBAVersions(hbas, KnownBadHBAVersions)...)
+	for _, hba := range hbas {
+		if hba.PortState != "Online" {
+			d := diagnoseLogin(hba, io)
+			report.Logins = append(report.Logins, d)
+			report.Warnings = append(report.Warnings, d.String())
+		}
+	}
+	report.Slots = enclosureSlots(io)
+	return report, nil
+}
+
+// logHBAWarnings logs known-bad HBA combinations, these explain failures we can't detect otherwise.
+// It returns the warnings it logged.
+func logHBAWarnings(io ioHandler) []string {
+	hbas, err := GetHBAs(io)
+	if err != nil {
+		return nil
+	}
+	warnings := CheckHBAVersions(hbas, KnownBadHBAVersions)
+	for _, w := range warnings {
+		glog.Warningf("fc: %s", w)
+	}
+	return warnings
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// candidate is a device found during discovery together with its devicemapper parent, if any,
+// and the /dev/disk link and target port it was found through
+type candidate struct {
+	disk   string
+	dm     string
+	hctl   string
+	wwid   string
+	link   string
+	target string
+}
+
+//DiscoveredPath is one device discovery matched to a volume: the /dev/disk link it was found
+//through, the sd device the link resolves to, the device's H:C:T:L address and target port, and
+//the multipath map it belongs to, "" for a single path
+type DiscoveredPath struct {
+	Link      string
+	Device    string
+	HCTL      string
+	TargetWWN string
+	Map       string
+}
+
+// WithDiscoveredPaths stores every device Attach found for the volume in paths, not only the one
+// it returns, so drivers can check the volume's redundancy and log its paths
+func WithDiscoveredPaths(paths *[]DiscoveredPath) Option {
+	return func(o *options) {
+		o.discovered = paths
+	}
+}
+
+//TargetStatus tells whether discovery found a volume through one of its Connector's TargetWWNs.
+//Visible is set if the node sees the target port at all, Found if the volume was found behind it.
+//A target that isn't visible points at zoning, one that is visible but without the volume at LUN
+//masking on the array.
+type TargetStatus struct {
+	TargetWWN string
+	Visible   bool
+	Found     bool
+}
+
+// WithTargetStatus stores through which of the connector's targets Attach found the volume in
+// targets. Attach warns, and sends an FCTargetsMissing event, when the volume is found through
+// some of them only, so masking or zoning mistakes show up as reduced redundancy right away.
+func WithTargetStatus(targets *[]TargetStatus) Option {
+	return func(o *options) {
+		o.targets = targets
+	}
+}
+
+// reportPaths logs every device found for the volume and hands them to the caller, if it asked
+func (o *options) reportPaths(c Connector, candidates []candidate, io ioHandler) {
+	var paths []DiscoveredPath
+	for _, c := range candidates {
+		p := DiscoveredPath{Link: c.link, Device: c.disk, HCTL: c.hctl, TargetWWN: c.target, Map: c.dm}
+		if p.TargetWWN == "" && c.hctl != "" {
+			p.TargetWWN = wwn.Normalize(scsi.TargetPortName(c.hctl, io))
+		}
+		glog.Infof("fc: found %s (%s) through %s, target %s, map %q", p.Device, p.HCTL, p.Link, p.TargetWWN, p.Map)
+		paths = append(paths, p)
+	}
+	if o.discovered != nil {
+		*o.discovered = paths
+	}
+	o.reportTargets(c, paths, io)
+}
+
+// reportTargets warns about the targets of c the volume wasn't found through and hands the
+// status of every target to the caller, if it asked
+func (o *options) reportTargets(c Connector, paths []DiscoveredPath, io ioHandler) {
+	var targets []TargetStatus
+	var missing []string
+	for _, targetWWN := range c.TargetWWNs {
+		status := TargetStatus{TargetWWN: wwn.Normalize(targetWWN)}
+		for _, p := range paths {
+			if wwn.Equal(p.TargetWWN, targetWWN) {
+				status.Found = true
+			}
+		}
+		status.Visible = status.Found || len(scsi.FindTargets(targetWWN, io)) > 0
+		switch {
+		case !status.Visible:
+			missing = append(missing, status.TargetWWN+" (not visible)")
+		case !status.Found:
+			missing = append(missing, status.TargetWWN+" (no LUN "+c.Lun+")")
+		}
+		targets = append(targets, status)
+	}
+	if o.targets != nil {
+		*o.targets = targets
+	}
+	if len(missing) > 0 && len(missing) < len(targets) {
+		glog.Warningf("fc: volume %s found through %d of %d targets, missing %s", c.VolumeName, len(targets)-len(missing), len(targets), strings.Join(missing, ", "))
+		o.event(EventTypeWarning, ReasonTargetsMissing, "volume %s found through %d of %d targets, missing %s", c.VolumeName, len(targets)-len(missing), len(targets), strings.Join(missing, ", "))
+	}
+}
+
+func newCandidate(disk, dm string, io ioHandler) candidate {
+	dev := path.Base(disk)
+	c := candidate{
+		disk: disk,
+		dm:   dm,
+		wwid: sysfs.ReadAttrRetry(sysfs.DefaultLayout.Block(dev, "device/wwid"), io),
+	}
+	c.hctl, _ = scsi.DeviceHCTL(dev, io)
+	return c
+}
+
+// notVolume reports whether c is an array controller pseudo device or not a disk at all, e.g. a
+// tape drive behind the same target, neither of which is ever the volume
+func (c candidate) notVolume(io ioHandler) bool {
+	if c.hctl == "" {
+		return false
+	}
+	if scsi.IsControllerLUN(c.hctl, io) {
+		glog.Infof("fc: skipping %s (%s), it is an array controller device", c.disk, c.hctl)
+		return true
+	}
+	if !scsi.IsDisk(c.hctl, io) {
+		glog.Infof("fc: skipping %s (%s), it is scsi device type %d, not a disk", c.disk, c.hctl, scsi.DeviceType(c.hctl, io))
+		return true
+	}
+	return false
+}
+
+func hasMultipath(candidates []candidate) bool {
+	for _, c := range candidates {
+		if c.dm != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// selectCandidate picks the device Attach returns when discovery found several, so the same node
+// state always yields the same devicePath whatever order directories are read in. The order is:
+//  1. devices with a multipath parent before bare sd devices
+//  2. devices whose wwid matches one of wwids before the rest
+//  3. the lowest H:C:T:L address
+func selectCandidate(candidates []candidate, wwids []string) candidate {
+	sorted := make([]candidate, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if (a.dm != "") != (b.dm != "") {
+			return a.dm != ""
+		}
+		if am, bm := matchesAnyWWID(a.wwid, wwids), matchesAnyWWID(b.wwid, wwids); am != bm {
+			return am
+		}
+		return scsi.LessHCTL(a.hctl, b.hctl)
+	})
+	return sorted[0]
+}
+
+func matchesAnyWWID(sysfsWWID string, wwids []string) bool {
+	for _, wwid := range wwids {
+		if wwn.SameWWID(sysfsWWID, wwid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectCandidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []candidate
+		wwids      []string
+		expected   string
+	}{
+		{
+			name: "multipath first",
+			candidates: []candidate{
+				{disk: "/dev/sdb", hctl: "5:0:0:1"},
+				{disk: "/dev/sdc", dm: "/dev/dm-1", hctl: "6:0:0:1"},
+			},
+			expected: "/dev/sdc",
+		},
+		{
+			name: "matching wwid first",
+			candidates: []candidate{
+				{disk: "/dev/sdb", hctl: "5:0:0:1", wwid: "naa.600a098038303053453f463045727a44"},
+				{disk: "/dev/sdc", hctl: "6:0:0:1", wwid: "naa.600a098038303053453f463045727a45"},
+			},
+			wwids:    []string{"3600a098038303053453f463045727a45"},
+			expected: "/dev/sdc",
+		},
+		{
+			name: "lowest hctl",
+			candidates: []candidate{
+				{disk: "/dev/sdd", hctl: "10:0:0:1"},
+				{disk: "/dev/sdc", hctl: "6:0:1:1"},
+				{disk: "/dev/sdb", hctl: "6:0:0:1"},
+				{disk: "/dev/sde"},
+			},
+			expected: "/dev/sdb",
+		},
+	}
+	for _, test := range tests {
+		if best := selectCandidate(test.candidates, test.wwids); best.disk != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, best.disk)
+		}
+		// the result must not depend on the order candidates were found in
+		reversed := make([]candidate, len(test.candidates))
+		for i, c := range test.candidates {
+			reversed[len(test.candidates)-1-i] = c
+		}
+		if best := selectCandidate(reversed, test.wwids); best.disk != test.expected {
+			t.Errorf("%s (reversed): expected %s, got %s", test.name, test.expected, best.disk)
+		}
+	}
+}
+
+func TestDiscoveredPaths(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.links["/dev/disk/by-path/pci-0000:41:00.1-fc-0x500a0981891b8dc6-lun-1"] = "/dev/sdc"
+	for _, dev := range []string{"sdb", "sdc"} {
+		fs.files["/dev/"+dev] = ""
+		fs.files["/sys/block/"+dev+"/size"] = "2097152"
+	}
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5", "500A0981891B8DC6"}, Lun: "1"}
+
+	info, err := AttachDevice(c, fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []DiscoveredPath{
+		{Link: "/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1", Device: "/dev/sdb", TargetWWN: "500a0981891b8dc5"},
+		{Link: "/dev/disk/by-path/pci-0000:41:00.1-fc-0x500a0981891b8dc6-lun-1", Device: "/dev/sdc", TargetWWN: "500a0981891b8dc6"},
+	}
+	if info.DevicePath != "/dev/sdb" || !reflect.DeepEqual(info.Discovered, expected) {
+		t.Errorf("expected %s with paths %+v, got %+v", "/dev/sdb", expected, info)
+	}
+}
+
+func TestTargetStatus(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.links["/dev/disk/by-path/pci-0000:41:00.1-fc-0x500a0981891b8dc6-lun-1"] = "/dev/sdc"
+	for _, dev := range []string{"sdb", "sdc"} {
+		fs.files["/dev/"+dev] = ""
+		fs.files["/sys/block/"+dev+"/size"] = "2097152"
+	}
+	// the node sees the third target, the array doesn't map the LUN to it
+	fs.files["/sys/class/fc_transport/target6:0:2/port_name"] = "0x500a0981891b8dc7\n"
+	c := Connector{VolumeName: "vol", Lun: "1",
+		TargetWWNs: []string{"500a0981891b8dc5", "500A0981891B8DC6", "50:0a:09:81:89:1b:8d:c5", "500a0981891b8dc7", "500a0981891b8dc8"}}
+
+	var events []recordedEvent
+	info, err := AttachDevice(c, fs, WithEvents(recordEvents(&events)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(info.Discovered) != 2 {
+		t.Errorf("expected the repeated target to be searched once, got %+v", info.Discovered)
+	}
+	expected := []TargetStatus{
+		{TargetWWN: "500a0981891b8dc5", Visible: true, Found: true},
+		{TargetWWN: "500a0981891b8dc6", Visible: true, Found: true},
+		{TargetWWN: "500a0981891b8dc7", Visible: true},
+		{TargetWWN: "500a0981891b8dc8"},
+	}
+	if !reflect.DeepEqual(info.Targets, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info.Targets)
+	}
+	if len(events) != 1 || events[0].reason != ReasonTargetsMissing ||
+		!strings.Contains(events[0].message, "found through 2 of 4 targets, missing 500a0981891b8dc7 (no LUN 1), 500a0981891b8dc8 (not visible)") {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//VolumeStats are the I/O counters device-mapper keeps for the multipath map of a volume once
+//EnableVolumeStats set them up. Areas holds the counters of each area in the order of the map's
+//sectors, Total their sums, with Start and Length covering the whole region.
+type VolumeStats struct {
+	Map    string
+	Region int
+	Total  multipath.IOStats
+	Areas  []multipath.IOStats
+}
+
+// EnableVolumeStats makes device-mapper count the I/O of the multipath map at devicePath, split
+// into areas equal areas of the volume, e.g. to tell hot spots apart on per-volume dashboards.
+// Unlike /sys/block/dm-N/stat the counters can be split by area and are kept per region, so
+// other dm-stats users of the map don't disturb them. A map already counted keeps its region.
+// The counters go away with the map, Detach needs no cleanup.
+func EnableVolumeStats(devicePath string, areas int, io ioHandler) (err error) {
+	defer recoverPanic("EnableVolumeStats", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	name, err := statsMap(devicePath, io)
+	if err != nil {
+		return err
+	}
+	regions, err := multipath.StatsRegions(name)
+	if err != nil {
+		return err
+	}
+	if len(regions) > 0 {
+		return nil
+	}
+	region, err := multipath.CreateStatsRegion(name, areas)
+	if err != nil {
+		return err
+	}
+	glog.Infof("fc: counting the I/O of %s (%s) in dm-stats region %d", devicePath, name, region)
+	return nil
+}
+
+// GetVolumeStats returns the counters EnableVolumeStats set up for the multipath map at devicePath
+func GetVolumeStats(devicePath string, io ioHandler) (stats VolumeStats, err error) {
+	defer recoverPanic("GetVolumeStats", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	name, err := statsMap(devicePath, io)
+	if err != nil {
+		return VolumeStats{}, err
+	}
+	regions, err := multipath.StatsRegions(name)
+	if err != nil {
+		return VolumeStats{}, err
+	}
+	if len(regions) == 0 {
+		return VolumeStats{}, fmt.Errorf("fc: the I/O of %s is not counted, see EnableVolumeStats", devicePath)
+	}
+	stats = VolumeStats{Map: name, Region: regions[0]}
+	if stats.Areas, err = multipath.PrintStats(name, stats.Region); err != nil {
+		return VolumeStats{}, err
+	}
+	for i, a := range stats.Areas {
+		if i == 0 {
+			stats.Total.Start = a.Start
+		}
+		stats.Total.Length += a.Length
+		stats.Total.Reads += a.Reads
+		stats.Total.ReadsMerged += a.ReadsMerged
+		stats.Total.SectorsRead += a.SectorsRead
+		stats.Total.ReadMillis += a.ReadMillis
+		stats.Total.Writes += a.Writes
+		stats.Total.WritesMerged += a.WritesMerged
+		stats.Total.SectorsWritten += a.SectorsWritten
+		stats.Total.WriteMillis += a.WriteMillis
+		stats.Total.InFlight += a.InFlight
+		stats.Total.IOMillis += a.IOMillis
+		stats.Total.WeightedIOMillis += a.WeightedIOMillis
+	}
+	return stats, nil
+}
+
+// DisableVolumeStats stops counting the I/O of the multipath map at devicePath
+func DisableVolumeStats(devicePath string, io ioHandler) (err error) {
+	defer recoverPanic("DisableVolumeStats", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	name, err := statsMap(devicePath, io)
+	if err != nil {
+		return err
+	}
+	regions, err := multipath.StatsRegions(name)
+	if err != nil {
+		return err
+	}
+	for _, region := range regions {
+		if err := multipath.DeleteStatsRegion(name, region); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statsMap returns the device-mapper name of the multipath map at devicePath
+func statsMap(devicePath string, io ioHandler) (string, error) {
+	dm, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(path.Base(dm), "dm-") {
+		return "", errorf(ErrNoMultipathDevice, "fc: %s is not a multipath device", devicePath)
+	}
+	name := sysfs.ReadAttr(sysfs.DefaultLayout.Block(path.Base(dm), "dm/name"), io)
+	if name == "" {
+		return "", fmt.Errorf("fc: name of map %s unknown", devicePath)
+	}
+	return name, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+)
+
+func TestVolumeStats(t *testing.T) {
+	defer func(m func(string, string) (string, error)) { multipath.Message = m }(multipath.Message)
+	var regions []string
+	multipath.Message = func(name, msg string) (string, error) {
+		if name != "mpatha" {
+			t.Errorf("message %q sent to %s", msg, name)
+		}
+		switch {
+		case strings.HasPrefix(msg, "@stats_create"):
+			regions = append(regions, "0: 0+2097152 1048576 csi-lib-fc -")
+			return "0", nil
+		case strings.HasPrefix(msg, "@stats_list"):
+			return strings.Join(regions, "\n"), nil
+		case msg == "@stats_print 0":
+			return "0+1048576 10 0 80 3 4 1 32 2 0 5 5 0 0 0 0\n1048576+1048576 2 0 16 1 0 0 0 0 1 1 1 0 0 0 0\n", nil
+		case msg == "@stats_delete 0":
+			regions = nil
+			return "", nil
+		}
+		t.Errorf("unexpected message %q", msg)
+		return "", nil
+	}
+	fs := mapFixture()
+
+	if _, err := GetVolumeStats("/dev/mapper/mpatha", fs); err == nil {
+		t.Error("expected an error before the stats are enabled")
+	}
+	for i := 0; i < 2; i++ {
+		if err := EnableVolumeStats("/dev/mapper/mpatha", 2, fs); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(regions) != 1 {
+		t.Errorf("expected a single region, got %q", regions)
+	}
+	stats, err := GetVolumeStats("/dev/mapper/mpatha", fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Map != "mpatha" || len(stats.Areas) != 2 || stats.Total.Length != 2097152 || stats.Total.Reads != 12 ||
+		stats.Total.SectorsRead != 96 || stats.Total.Writes != 4 || stats.Total.InFlight != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if err := DisableVolumeStats("/dev/mapper/mpatha", fs); err != nil || len(regions) != 0 {
+		t.Errorf("expected the region to be deleted, got %q %v", regions, err)
+	}
+
+	fs.files["/dev/sdb"] = ""
+	if err := EnableVolumeStats("/dev/sdb", 1, fs); !errors.Is(err, ErrNoMultipathDevice) {
+		t.Errorf("expected ErrNoMultipathDevice, got %v", err)
+	}
+}
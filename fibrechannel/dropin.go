@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+)
+
+// WithMultipathDropIn makes Attach and Prefetch write content to the multipathd configuration
+// drop-in multipath.ConfDir/<name>.conf before they look for the volume, so multipathd assembles
+// its map with it, e.g. an alias, a blacklist exception or per-volume settings. A drop-in
+// multipathd doesn't take is rolled back and fails the operation. Detach with the same name
+// removes the drop-in once the volume's devices are gone, content is ignored there.
+func WithMultipathDropIn(name string, content []byte) Option {
+	return func(o *options) {
+		o.dropInName, o.dropIn = name, content
+	}
+}
+
+// writeDropIn writes the operation's multipathd drop-in, if any
+func (o *options) writeDropIn(io ioHandler) error {
+	if o.dropInName == "" {
+		return nil
+	}
+	glog.Infof("fc: writing multipathd drop-in %s", o.dropInName)
+	return multipath.WriteDropIn(o.dropInName, o.dropIn, io)
+}
+
+// removeDropIn removes the operation's multipathd drop-in, if any
+func (o *options) removeDropIn(io ioHandler) error {
+	if o.dropInName == "" {
+		return nil
+	}
+	glog.Infof("fc: removing multipathd drop-in %s", o.dropInName)
+	return multipath.RemoveDropIn(o.dropInName, io)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"path"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//EnclosureSlot locates a scsi device in a SES enclosure, as the kernel's enclosure class reports
+//it, so a failing path can be traced to a physical slot. Enclosure is the enclosure's H:C:T:L
+//address and EnclosureID its logical identifier, Component the slot's name in sysfs and Slot its
+//number. Status is the slot's SES status, e.g. OK or critical.
+type EnclosureSlot struct {
+	HCTL        string
+	Devices     []string
+	Enclosure   string
+	EnclosureID string
+	Component   string
+	Slot        string
+	Status      string
+}
+
+// enclosureSlots returns the slot of every scsi device in an enclosure, nothing when the node has
+// no SES enclosures or the ses driver isn't loaded
+func enclosureSlots(io ioHandler) []EnclosureSlot {
+	var slots []EnclosureSlot
+	enclosures, err := io.ReadDir(sysfs.DefaultLayout.Enclosures())
+	if err != nil {
+		return nil
+	}
+	for _, e := range enclosures {
+		dir := sysfs.DefaultLayout.Enclosure(e.Name())
+		components, err := io.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, c := range components {
+			device, err := io.EvalSymlinks(path.Join(dir, c.Name(), "device"))
+			if err != nil {
+				// an empty slot or one of the enclosure's own attributes
+				continue
+			}
+			hctl := path.Base(device)
+			if _, ok := scsi.ParseHCTL(hctl); !ok {
+				continue
+			}
+			slot := EnclosureSlot{
+				HCTL:        hctl,
+				Enclosure:   e.Name(),
+				EnclosureID: sysfs.ReadAttr(path.Join(dir, "id"), io),
+				Component:   c.Name(),
+				Slot:        sysfs.ReadAttr(path.Join(dir, c.Name(), "slot"), io),
+				Status:      sysfs.ReadAttr(path.Join(dir, c.Name(), "status"), io),
+			}
+			for _, dev := range scsi.BlockDevices(hctl, io) {
+				slot.Devices = append(slot.Devices, "/dev/"+dev)
+			}
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+func TestDiagnoseEnclosureSlots(t *testing.T) {
+	fs := newFakeHBAs()
+	fs.files["/sys/class/enclosure/5:0:1:0/id"] = "0x500a0981891b8dff\n"
+	fs.links["/sys/class/enclosure/5:0:1:0/Slot 03/device"] = "/sys/devices/pci0000:40/0000:40:01.0/host5/rport-5:0-1/target5:0:1/5:0:1:3"
+	fs.files["/sys/class/enclosure/5:0:1:0/Slot 03/slot"] = "3\n"
+	fs.files["/sys/class/enclosure/5:0:1:0/Slot 03/status"] = "critical\n"
+	fs.files["/sys/class/enclosure/5:0:1:0/Slot 04/slot"] = "4\n"
+	fs.files["/sys/bus/scsi/devices/5:0:1:3/block/sdf/dev"] = "8:80\n"
+
+	report, err := Diagnose(fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Slots) != 1 {
+		t.Fatalf("expected the occupied slot only, got %+v", report.Slots)
+	}
+	slot := report.Slots[0]
+	if slot.HCTL != "5:0:1:3" || slot.EnclosureID != "0x500a0981891b8dff" || slot.Slot != "3" || slot.Status != "critical" ||
+		len(slot.Devices) != 1 || slot.Devices[0] != "/dev/sdf" {
+		t.Errorf("unexpected slot %+v", slot)
+	}
+}
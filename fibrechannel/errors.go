@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Errors the operations return for the failures drivers handle differently, e.g. ErrDiskNotFound
+// as NOT_FOUND and ErrDeviceBusy as retryable. Check for them with errors.Is, the returned error
+// usually carries more detail.
+var (
+	// ErrDiskNotFound means no device matches the connector, even after a rescan
+	ErrDiskNotFound = errors.New("no fc disk found")
+	// ErrNoMultipathDevice means a device that should be a multipath map isn't one
+	ErrNoMultipathDevice = errors.New("fc: not a multipath device")
+	// ErrInvalidConnector means the connector can't identify a volume
+	ErrInvalidConnector = errors.New("fc: invalid connector")
+	// ErrNoFCHosts means the node has no fc hosts, it isn't connected to any fabric
+	ErrNoFCHosts = errors.New("fc: no fc hosts")
+	// ErrDeviceBusy means a device is in use or still being set up or removed, a later retry may succeed
+	ErrDeviceBusy = errors.New("fc: device busy")
+	// ErrIdentityMismatch means a device found for the volume reports the identity of another LUN
+	ErrIdentityMismatch = errors.New("fc: device identity mismatch")
+	// ErrSizeMismatch means the paths of a multipath map report different sizes
+	ErrSizeMismatch = errors.New("fc: path size mismatch")
+)
+
+// kindError is an error with its own message that errors.Is matches against one of the errors above
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+// errorf formats an error matching kind
+func errorf(kind error, format string, args ...interface{}) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+// isBusy reports whether err is the kernel refusing an operation on a device in use
+func isBusy(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || errors.Is(err, ErrDeviceBusy)
+}
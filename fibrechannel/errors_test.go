@@ -0,0 +1,59 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAttachErrors(t *testing.T) {
+	if _, err := Attach(Connector{VolumeName: "fakeVol"}, newFakeSysfs()); !errors.Is(err, ErrInvalidConnector) {
+		t.Errorf("expected ErrInvalidConnector, got %v", err)
+	}
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	if _, err := Attach(c, newFakeSysfs()); !errors.Is(err, ErrDiskNotFound) || err.Error() != "no fc disk found" {
+		t.Errorf("expected ErrDiskNotFound, got %v", err)
+	}
+}
+
+func TestFailWithoutFCHosts(t *testing.T) {
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	fs := &scanCountingSysfs{fakeSysfs: newFakeSysfs()}
+	fs.files["/sys/class/scsi_host/host0/proc_name"] = "ahci\n"
+	if _, err := Attach(c, fs, WithFailWithoutFCHosts()); !errors.Is(err, ErrNoFCHosts) {
+		t.Errorf("expected ErrNoFCHosts, got %v", err)
+	}
+	if fs.scans != 0 {
+		t.Errorf("expected no rescan, got %d", fs.scans)
+	}
+
+	fs.files["/sys/class/fc_host/host5/port_name"] = "0x10000090fa1b2c3d\n"
+	if _, err := Attach(c, fs, WithFailWithoutFCHosts()); !errors.Is(err, ErrDiskNotFound) {
+		t.Errorf("expected ErrDiskNotFound with an fc host, got %v", err)
+	}
+}
+
+func TestMonitorMultipathNotAMap(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-id/wwn-0x600a098038303053453f463045727a44"] = "/dev/sdb"
+	_, err := MonitorMultipath(context.Background(), "/dev/disk/by-id/wwn-0x600a098038303053453f463045727a44", time.Second, fs)
+	if !errors.Is(err, ErrNoMultipathDevice) {
+		t.Errorf("expected ErrNoMultipathDevice, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// Event types, the same as Kubernetes uses
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
+)
+
+// Event reasons
+const (
+	ReasonAttachFailed         = "FCAttachFailed"
+	ReasonPathDown             = "FCPathDown"
+	ReasonHBAWarning           = "FCHBAWarning"
+	ReasonDetachFailed         = "FCDetachFailed"
+	ReasonCleanupFailed        = "FCCleanupFailed"
+	ReasonDeregistrationFailed = "FCDeregistrationFailed"
+	ReasonSlowPathFailed       = "FCSlowPathFailed"
+	ReasonDriverRebound        = "FCDriverRebound"
+	ReasonTargetsMissing       = "FCTargetsMissing"
+	ReasonFilesystemRepaired   = "FCFilesystemRepaired"
+)
+
+//EventSink receives the conditions of an operation users should see, e.g. to record them as
+//Kubernetes Events on the PVC or Pod so they show up in kubectl describe instead of node logs
+//only. With client-go it wraps a record.EventRecorder and the object the events belong to, e.g.
+//func(t, reason, msg string) { recorder.Event(pvc, t, reason, msg) }.
+type EventSink func(eventType, reason, message string)
+
+// WithEvents sends the operation's warnings and failures to sink
+func WithEvents(sink EventSink) Option {
+	return func(o *options) {
+		o.events = sink
+	}
+}
+
+// event sends an event to the operation's sink, if it has one
+func (o *options) event(eventType, reason, format string, args ...interface{}) {
+	if o.events == nil {
+		return
+	}
+	o.events(eventType, reason, fmt.Sprintf(format, args...))
+}
+
+// eventPathsDown sends a warning for every path of devicePath the kernel doesn't consider usable
+func (o *options) eventPathsDown(devicePath string, io ioHandler) {
+	if o.events == nil {
+		return
+	}
+	for _, p := range getDeviceInfo(devicePath, io).Paths {
+		state := sysfs.ReadAttr(sysfs.DefaultLayout.Block(path.Base(p), "device/state"), io)
+		if pathFailed(state) {
+			o.event(EventTypeWarning, ReasonPathDown, "path %s of %s is %s", p, devicePath, state)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+type recordedEvent struct {
+	eventType, reason, message string
+}
+
+func recordEvents(events *[]recordedEvent) EventSink {
+	return func(eventType, reason, message string) {
+		*events = append(*events, recordedEvent{eventType, reason, message})
+	}
+}
+
+func TestEventsOnDetachFailure(t *testing.T) {
+	fs := &failingDeleteSysfs{fakeSysfs: newFakeSysfs(), failures: map[string]bool{"sdc": true}}
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.files["/sys/block/sdc/dev"] = "8:32\n"
+
+	var events []recordedEvent
+	if err := Detach("/dev/mapper/mpatha", fs, WithEvents(recordEvents(&events))); err == nil {
+		t.Fatal("expected the failed delete of sdc to be reported")
+	}
+	if len(events) != 2 || events[0].reason != ReasonCleanupFailed || events[1].reason != ReasonDetachFailed {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	for _, e := range events {
+		if e.eventType != EventTypeWarning {
+			t.Errorf("expected a warning, got %+v", e)
+		}
+	}
+}
+
+func TestEventsOnAttach(t *testing.T) {
+	fakeConnector := Connector{
+		VolumeName: "fakeVol",
+		TargetWWNs: []string{"500a0981891b8dc5"},
+		Lun:        "0",
+	}
+	var events []recordedEvent
+	if _, err := Attach(fakeConnector, &fakeIOHandler{}, WithEvents(recordEvents(&events))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events for a healthy attach, got %+v", events)
+	}
+
+	events = nil
+	if _, err := Attach(Connector{VolumeName: "fakeVol"}, newFakeSysfs(), WithEvents(recordEvents(&events))); err == nil {
+		t.Fatal("expected the attach to fail")
+	}
+	if len(events) != 1 || events[0].reason != ReasonAttachFailed {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestEventPathsDown(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.files["/sys/block/sdb/device/state"] = "running\n"
+	fs.files["/sys/block/sdc/device/state"] = "offline\n"
+
+	var events []recordedEvent
+	o := newOptions([]Option{WithEvents(recordEvents(&events))})
+	o.eventPathsDown("/dev/dm-0", fs)
+	if len(events) != 1 || events[0].reason != ReasonPathDown || events[0].message != "path /dev/sdc of /dev/dm-0 is offline" {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"path"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+// ExpandVolume makes the node see the new size of a volume grown on the array, as CSI's
+// NodeExpandVolume needs before the filesystem is grown: every path is rescanned so the kernel
+// reads the LUN's capacity again, then the map is resized with ResizeMultipathDevice. devicePath
+// is the device Attach returned, when it is "" the device is resolved from c as DetachVolume does.
+// It returns the volume's size in bytes, and a *SizeMismatchError if the paths still disagree on
+// it after the rescan, e.g. because one of them is down.
+func ExpandVolume(c Connector, devicePath string, io ioHandler, opts ...Option) (size int64, err error) {
+	defer recoverPanic("ExpandVolume", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	if o := newOptions(opts); o.invalid != nil {
+		return 0, o.invalid
+	}
+	if devicePath == "" {
+		if err := c.Validate(); err != nil {
+			return 0, err
+		}
+		if devicePath = resolveConnector(c, io); devicePath == "" {
+			return 0, errorf(ErrDiskNotFound, "fc: no device of volume %s found to expand", c.VolumeName)
+		}
+	}
+	dev, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return 0, err
+	}
+	info := getDeviceInfo(dev, io)
+	for _, p := range info.Paths {
+		if err := scsi.RescanDevice(path.Base(p), io); err != nil {
+			glog.Warningf("fc: rescan of %s failed: %v", p, err)
+		}
+	}
+	if info.Multipath {
+		if size, err = ResizeMultipathDevice(dev, io, opts...); err != nil {
+			return 0, err
+		}
+	} else {
+		size = scsi.DeviceSize(path.Base(dev), io)
+	}
+	glog.Infof("fc: %s of volume %s is %d bytes", devicePath, c.VolumeName, size)
+	return size, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+)
+
+// expandSysfs grows a path to newSize sectors when it is rescanned
+type expandSysfs struct {
+	*fakeSysfs
+	newSize string
+}
+
+func (fs expandSysfs) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	if strings.HasSuffix(filename, "/device/rescan") {
+		fs.files[strings.TrimSuffix(filename, "/device/rescan")+"/size"] = fs.newSize
+	}
+	return fs.fakeSysfs.WriteFile(filename, data, perm)
+}
+
+func TestExpandVolume(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	fs := mapFixture()
+	fs.files["/dev/sdb"] = ""
+	fs.files["/dev/sdc"] = ""
+	fs.files["/dev/dm-0"] = ""
+	for _, dev := range []string{"dm-0", "sdb", "sdc"} {
+		fs.files["/sys/block/"+dev+"/size"] = "2097152"
+	}
+	var commands []string
+	multipath.Command = func(args ...string) (string, error) {
+		commands = append(commands, strings.Join(args, " "))
+		fs.files["/sys/block/dm-0/size"] = "4194304"
+		return "ok\n", nil
+	}
+
+	size, err := ExpandVolume(Connector{VolumeName: "vol"}, "/dev/mapper/mpatha", expandSysfs{fs, "4194304"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size != 2147483648 {
+		t.Errorf("expected 2147483648 bytes, got %d", size)
+	}
+	if fs.writes["/sys/block/sdb/device/rescan"] != "1" || fs.writes["/sys/block/sdc/device/rescan"] != "1" {
+		t.Errorf("expected both paths to be rescanned, got %v", fs.writes)
+	}
+	if len(commands) != 1 || commands[0] != "resize map mpatha" {
+		t.Errorf("unexpected multipathd commands %q", commands)
+	}
+
+	// a path that didn't see the new size keeps the map as it is
+	commands = nil
+	fs.files["/sys/block/sdc/size"] = "2097152"
+	delete(fs.links, "/sys/block/dm-0/slaves/sdb")
+	fs.links["/sys/block/dm-0/slaves/sdd"] = "../../sdd"
+	fs.files["/sys/block/sdd/size"] = "2097152"
+	grown := expandSysfs{fs, "6291456"}
+	if _, err := ExpandVolume(Connector{VolumeName: "vol"}, "/dev/dm-0", sizeOf{grown, "sdd"}); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("expected ErrSizeMismatch, got %v", err)
+	}
+	if len(commands) != 0 {
+		t.Errorf("expected the map not to be resized, got %q", commands)
+	}
+
+	// a single path found through the connector
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.files["/sys/block/sdb/size"] = "2097152"
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+	if size, err := ExpandVolume(c, "", expandSysfs{fs, "8388608"}); err != nil || size != 4294967296 {
+		t.Errorf("expected 4294967296 bytes, got %d %v", size, err)
+	}
+}
+
+// sizeOf is fs with the rescan of the path dev not taking effect
+type sizeOf struct {
+	expandSysfs
+	dev string
+}
+
+func (fs sizeOf) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	if filename == "/sys/block/"+fs.dev+"/device/rescan" {
+		return fs.fakeSysfs.WriteFile(filename, data, perm)
+	}
+	return fs.expandSysfs.WriteFile(filename, data, perm)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// Causes of a host port not logged into the fabric
+const (
+	// LoginCauseNoLink is a port without a physical link, a cabling, SFP or switch port problem
+	LoginCauseNoLink = "NoLink"
+	// LoginCauseRejected is a port with a link whose fabric login didn't complete, typically
+	// fabric security: FC-SP authentication or port binding on the switch
+	LoginCauseRejected = "LoginRejected"
+	// LoginCauseOffline is a port taken offline on the node
+	LoginCauseOffline = "Offline"
+)
+
+// linkErrorCounters are the fc_host statistics counting errors on the physical link, as the fc
+// transport names them
+var linkErrorCounters = []string{
+	"link_failure_count",
+	"loss_of_sync_count",
+	"loss_of_signal_count",
+	"prim_seq_protocol_err_count",
+	"invalid_tx_word_count",
+	"invalid_crc_count",
+}
+
+//LoginDiagnosis explains why a host port isn't logged into the fabric. Cause is one of the
+//LoginCause constants and Hint what to check. Statistics are the non-zero link error and
+//authentication counters of the port the diagnosis is based on.
+type LoginDiagnosis struct {
+	Host       string
+	PortState  string
+	Speed      string
+	Cause      string
+	Hint       string
+	Statistics map[string]uint64
+}
+
+func (d LoginDiagnosis) String() string {
+	return fmt.Sprintf("%s is %s: %s", d.Host, d.PortState, d.Hint)
+}
+
+// DiagnoseFabricLogins explains every local fc port that isn't Online. A port without a link is
+// told apart from one whose link came up but whose login the fabric refused, so a fabric security
+// misconfiguration isn't chased as a cabling problem and vice versa.
+func DiagnoseFabricLogins(io ioHandler) (diagnoses []LoginDiagnosis, err error) {
+	defer recoverPanic("DiagnoseFabricLogins", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	hbas, err := GetHBAs(io)
+	if err != nil {
+		return nil, err
+	}
+	for _, hba := range hbas {
+		if hba.PortState == "Online" {
+			continue
+		}
+		diagnoses = append(diagnoses, diagnoseLogin(hba, io))
+	}
+	return diagnoses, nil
+}
+
+func diagnoseLogin(hba HBA, io ioHandler) LoginDiagnosis {
+	d := LoginDiagnosis{Host: hba.Host, PortState: hba.PortState, Speed: hba.Speed, Statistics: loginStatistics(hba.Host, io)}
+	var linkErrors, authFailures []string
+	for name, count := range d.Statistics {
+		if strings.Contains(name, "auth") {
+			authFailures = append(authFailures, fmt.Sprintf("%s %d", name, count))
+		} else {
+			linkErrors = append(linkErrors, fmt.Sprintf("%s %d", name, count))
+		}
+	}
+	sort.Strings(linkErrors)
+	sort.Strings(authFailures)
+
+	linkUp := hba.Speed != "" && !strings.EqualFold(hba.Speed, "unknown")
+	switch {
+	case hba.PortState == "Offline":
+		d.Cause = LoginCauseOffline
+		d.Hint = "the port was taken offline on the node, bring it back with EnableHostPort or the HBA's tools"
+	case linkUp || len(authFailures) > 0:
+		d.Cause = LoginCauseRejected
+		d.Hint = fmt.Sprintf("the link is up at %s but the fabric login didn't complete, check the switch port's FC-SP authentication (DH-CHAP secrets and policy), port security and WWPN binding", hba.Speed)
+		if len(authFailures) > 0 {
+			d.Hint = fmt.Sprintf("the fabric refused the login after authentication failures (%s), check the DH-CHAP secrets and authentication policy of the HBA and the switch port", strings.Join(authFailures, ", "))
+		}
+	default:
+		d.Cause = LoginCauseNoLink
+		d.Hint = "the port has no link, check the cable, the SFPs on both ends and that the switch port is enabled"
+		if len(linkErrors) > 0 {
+			d.Hint += fmt.Sprintf(", the link errors counted (%s) point at a damaged cable or SFP", strings.Join(linkErrors, ", "))
+		}
+	}
+	return d
+}
+
+// loginStatistics returns the non-zero link error counters of host and any authentication
+// counters its driver exposes. Counters are hex, all ones means the driver doesn't count.
+func loginStatistics(host string, io ioHandler) map[string]uint64 {
+	stats := map[string]uint64{}
+	if !hasFCHostStatistics(host, io) {
+		return stats
+	}
+	dir := path.Join(sysfs.DefaultLayout.FCHost(host), "statistics")
+	_, d := driverFor(host, io)
+	names := append([]string{}, d.linkErrorStatistics()...)
+	if files, err := io.ReadDir(dir); err == nil {
+		for _, f := range files {
+			if strings.Contains(f.Name(), "auth") {
+				names = append(names, f.Name())
+			}
+		}
+	}
+	for _, name := range names {
+		count, err := strconv.ParseUint(sysfs.ReadAttr(path.Join(dir, name), io), 0, 64)
+		if err != nil || count == 0 || count == ^uint64(0) {
+			continue
+		}
+		stats[name] = count
+	}
+	return stats
+}
+
+// withLoginHints adds the diagnosis of the ports not logged into the fabric to err, when a
+// volume wasn't found
+func withLoginHints(err error, io ioHandler) error {
+	hbas, herr := GetHBAs(io)
+	if herr != nil {
+		return err
+	}
+	var hints []string
+	for _, hba := range hbas {
+		if hba.PortState != "Online" {
+			hints = append(hints, diagnoseLogin(hba, io).String())
+		}
+	}
+	if len(hints) == 0 {
+		return err
+	}
+	return errorf(ErrDiskNotFound, "%v; %s", err, strings.Join(hints, "; "))
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func loginFixture() *fakeSysfs {
+	fs := newFakeSysfs()
+	host := func(name, state, speed string) {
+		fs.files["/sys/class/fc_host/"+name+"/port_state"] = state + "\n"
+		fs.files["/sys/class/fc_host/"+name+"/speed"] = speed + "\n"
+		fs.files["/sys/class/fc_host/"+name+"/statistics/link_failure_count"] = "0x0\n"
+	}
+	host("host1", "Online", "16 Gbit")
+	// no light
+	host("host2", "Linkdown", "unknown")
+	fs.files["/sys/class/fc_host/host2/statistics/loss_of_signal_count"] = "0x3\n"
+	fs.files["/sys/class/fc_host/host2/statistics/invalid_crc_count"] = "0xffffffffffffffff\n"
+	// the link came up, the switch refused the login
+	host("host3", "Linkdown", "16 Gbit")
+	// the driver counts authentication failures
+	host("host4", "Linkdown", "unknown")
+	fs.files["/sys/class/fc_host/host4/statistics/auth_reject_count"] = "0x2\n"
+	host("host5", "Offline", "unknown")
+	return fs
+}
+
+func TestDiagnoseFabricLogins(t *testing.T) {
+	diagnoses, err := DiagnoseFabricLogins(loginFixture())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"host2": LoginCauseNoLink,
+		"host3": LoginCauseRejected,
+		"host4": LoginCauseRejected,
+		"host5": LoginCauseOffline,
+	}
+	if len(diagnoses) != len(expected) {
+		t.Fatalf("expected the 4 ports not online to be diagnosed, got %+v", diagnoses)
+	}
+	for _, d := range diagnoses {
+		if d.Cause != expected[d.Host] {
+			t.Errorf("%s: expected %s, got %+v", d.Host, expected[d.Host], d)
+		}
+	}
+	if d := diagnoses[0]; len(d.Statistics) != 1 || d.Statistics["loss_of_signal_count"] != 3 || !strings.Contains(d.Hint, "loss_of_signal_count 3") {
+		t.Errorf("expected the signal losses of host2 to be reported, got %+v", d)
+	}
+	if d := diagnoses[2]; !strings.Contains(d.Hint, "auth_reject_count 2") {
+		t.Errorf("expected the authentication failures of host4 in the hint, got %q", d.Hint)
+	}
+
+	report, err := Diagnose(loginFixture())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Logins) != 4 || len(report.Warnings) < 4 {
+		t.Errorf("expected the login diagnoses in the report, got %+v", report)
+	}
+}
+
+func TestAttachFailureHasLoginHints(t *testing.T) {
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+	_, err := Attach(c, loginFixture(), WithoutRescan())
+	if !errors.Is(err, ErrDiskNotFound) {
+		t.Fatalf("expected ErrDiskNotFound, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "host3 is Linkdown: the link is up at 16 Gbit") {
+		t.Errorf("expected the login diagnosis in the error, got %v", err)
+	}
+}
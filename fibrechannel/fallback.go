@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"path"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// WithMultipathFallback lets Attach create a multipath map itself when it finds several paths to
+// the volume but no map because multipathd isn't running, e.g. on appliance or edge images
+// without multipath-tools that still need redundancy. Capabilities.DMMultipath tells whether the
+// node can and lists what such a map lacks compared to one managed by multipathd.
+func WithMultipathFallback() Option {
+	return func(o *options) {
+		o.multipathFallback = true
+	}
+}
+
+// fallbackMap creates a map over the candidates sharing best's wwid and returns it, "" if there
+// is a single path only, multipathd runs and will create the map itself or the creation failed
+func fallbackMap(best candidate, candidates []candidate, io ioHandler) string {
+	if best.wwid == "" {
+		return ""
+	}
+	if multipathdRunning(io) {
+		return ""
+	}
+	var devices []string
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if c.dm != "" || c.wwid != best.wwid || seen[c.disk] {
+			continue
+		}
+		seen[c.disk] = true
+		if majMin := sysfs.ReadAttr(sysfs.DefaultLayout.Block(path.Base(c.disk), "dev"), io); majMin != "" {
+			devices = append(devices, majMin)
+		}
+	}
+	if len(devices) < 2 {
+		return ""
+	}
+	if !dmMultipathLoaded(io) {
+		glog.Warningf("fc: neither multipathd nor dm-multipath is available to create a map over %v, using %s", devices, best.disk)
+		return ""
+	}
+	id := wwn.SCSIID(best.wwid)
+	sectors := scsi.DeviceSize(path.Base(best.disk), io) / 512
+	dm, err := multipath.CreateMap(id, multipath.UUIDPrefix+id, sectors, devices)
+	if err != nil {
+		glog.Warningf("fc: unable to create a multipath map over %v, using %s: %v", devices, best.disk, err)
+		return ""
+	}
+	glog.Infof("fc: multipathd not running, created multipath map %s (%s) over %v", dm, id, devices)
+	return dm
+}
@@ -16,31 +16,44 @@ limitations under the License.
 package fibrechannel
 
 import (
+	"errors"
 	"fmt"
 	"github.com/golang/glog"
 	"io/ioutil"
 	"os"
 
-	"errors"
-	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
 )
 
 type ioHandler interface {
-	ReadDir(dirname string) ([]os.FileInfo, error)
-	Lstat(name string) (os.FileInfo, error)
-	EvalSymlinks(path string) (string, error)
-	WriteFile(filename string, data []byte, perm os.FileMode) error
+	sysfs.IO
 }
 
-//Connector provides a struct to hold all of the needed parameters to make our Fibre Channel connection
+//Connector provides a struct to hold all of the needed parameters to make our Fibre Channel connection.
+//Labels are opaque to the library (e.g. PV name, storage class, array id), they're attached to the
+//log lines and reports an operation produces so its behaviour can be sliced by them. Lun is the
+//array's LUN number, LUNs from 256 on are addressed with SAM-3 flat space addressing as the kernel
+//does. The 8 byte SAM LUN (e.g. 0x4001000000000000) selects any other addressing. WWIDs are spelled
+//as scsi_id and multipath do (3600a...) or as array APIs report them (naa.600A..., eui.0025...).
+//RescanStrategy, when set, overrides the one of the operation for this volume; SaveConnector
+//doesn't save it. TargetPortGroups are the ALUA target port groups the array prefers for the
+//volume, e.g. the controller owning a snapshot or clone on an active-passive array, as its publish
+//context reports them. The readiness checks of Attach verify the paths through them first.
 type Connector struct {
-	VolumeName string
-	TargetWWNs []string
-	Lun        string
-	WWIDs      []string
-	io         ioHandler
+	VolumeName       string
+	TargetWWNs       []string
+	Lun              string
+	WWIDs            []string
+	Labels           map[string]string
+	TargetPortGroups []uint16
+	RescanStrategy   RescanStrategy
+	io               ioHandler
 }
 
 //OSioHandler is a wrapper that includes all the necessary io functions used for (Should be used as default io handler)
@@ -66,128 +79,173 @@ func (handler *OSioHandler) WriteFile(filename string, data []byte, perm os.File
 	return ioutil.WriteFile(filename, data, perm)
 }
 
-// FindMultipathDeviceForDevice given a device name like /dev/sdx, find the devicemapper parent
-func FindMultipathDeviceForDevice(device string, io ioHandler) (string, error) {
-	disk, err := findDeviceForPath(device, io)
-	if err != nil {
-		return "", err
-	}
-	sysPath := "/sys/block/"
-	if dirs, err2 := io.ReadDir(sysPath); err2 == nil {
-		for _, f := range dirs {
-			name := f.Name()
-			if strings.HasPrefix(name, "dm-") {
-				if _, err1 := io.Lstat(sysPath + name + "/slaves/" + disk); err1 == nil {
-					return "/dev/" + name, nil
-				}
-			}
-		}
-	} else {
-		return "", err2
-	}
+//ReadFile calls ReadFile from ioutil package
+func (handler *OSioHandler) ReadFile(filename string) ([]byte, error) {
+	return ioutil.ReadFile(filename)
+}
 
-	return "", nil
+//Remove calls Remove from os package
+func (handler *OSioHandler) Remove(name string) error {
+	return os.Remove(name)
 }
 
-// findDeviceForPath Find the underlaying disk for a linked path such as /dev/disk/by-path/XXXX or /dev/mapper/XXXX
-// will return sdX or hdX etc, if /dev/sdX is passed in then sdX will be returned
-func findDeviceForPath(path string, io ioHandler) (string, error) {
-	devicePath, err := io.EvalSymlinks(path)
-	if err != nil {
-		return "", err
-	}
-	// if path /dev/hdX split into "", "dev", "hdX" then we will
-	// return just the last part
-	parts := strings.Split(devicePath, "/")
-	if len(parts) == 3 && strings.HasPrefix(parts[1], "dev") {
-		return parts[2], nil
-	}
-	return "", errors.New("Illegal path for device " + devicePath)
+//Rename calls Rename from os package
+func (handler *OSioHandler) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
 }
 
-func scsiHostRescan(io ioHandler) {
-	scsiPath := "/sys/class/scsi_host/"
-	if dirs, err := io.ReadDir(scsiPath); err == nil {
-		for _, f := range dirs {
-			name := scsiPath + f.Name() + "/scan"
-			data := []byte("- - -")
-			io.WriteFile(name, data, 0666)
-		}
-	}
+// FindMultipathDeviceForDevice given a device name like /dev/sdx, find the devicemapper parent
+func FindMultipathDeviceForDevice(device string, io ioHandler) (dm string, err error) {
+	defer recoverPanic("FindMultipathDeviceForDevice", &err)
+
+	return multipath.FindParent(device, io)
 }
 
-func searchDisk(c Connector, io ioHandler) (string, error) {
-	var diskIds []string
-	var disk string
-	var dm string
+func searchDisk(c Connector, io ioHandler, o *options) (string, error) {
+	var candidates []candidate
 
-	if len(c.TargetWWNs) != 0 {
-		diskIds = c.TargetWWNs
-	} else {
-		diskIds = c.WWIDs
+	if o.invalid != nil {
+		return "", o.invalid
+	}
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	if targets := c.uniqueTargetWWNs(); len(targets) < len(c.TargetWWNs) {
+		glog.Warningf("fc: ignoring %d repeated TargetWWNs of volume %s", len(c.TargetWWNs)-len(targets), c.VolumeName)
+		c.TargetWWNs = targets
+	}
+	if err := o.writeDropIn(io); err != nil {
+		return "", err
+	}
+	if err := o.checkFCHosts(io); err != nil {
+		return "", err
 	}
 
-	rescaned := false
-	// two-phase search:
-	// first phase, search existing device path, if a multipath dm is found, exit loop
-	// otherwise, in second phase, rescan scsi bus and search again, return with any findings
+	rescans := 0
+	deadline := o.clock.Now().Add(o.timeout)
+	// search existing device paths first, if a multipath dm is found, exit loop
+	// otherwise rescan the scsi bus and search again, up to o.maxRescans times while nothing is
+	// found, and return with any findings
 	for true {
-
-		for _, diskID := range diskIds {
-			if len(c.TargetWWNs) != 0 {
-				disk, dm = findDisk(diskID, c.Lun, io)
-			} else {
-				disk, dm = findDiskWWIDs(diskID, io)
-			}
-			// if multipath device is found, break
-			if dm != "" {
-
-				break
-			}
+		if err := o.ctx.Err(); err != nil {
+			return "", err
+		}
+		start := o.clock.Now()
+		candidates = findCandidates(c, io)
+		start = o.since(&o.phases.Discovery, start)
+		waited, err := awaitTeardown(o.ctx, candidates, io, o.clock, o.deviceGone)
+		o.since(&o.phases.DeviceWait, start)
+		if err != nil {
+			return "", err
+		}
+		if waited {
+			// what was found belonged to the previous attachment, search again
+			continue
 		}
 		// if a dm is found, exit loop
-		if rescaned || dm != "" {
+		if hasMultipath(candidates) || (rescans > 0 && len(candidates) > 0) || rescans >= o.maxRescans {
 			break
 		}
-		// rescan and search again
-		// rescan scsi bus
-		scsiHostRescan(io)
-		rescaned = true
+		if o.timeout > 0 && !o.clock.Now().Before(deadline) {
+			return "", errorf(ErrDiskNotFound, "no fc disk found within %v", o.timeout)
+		}
+		// rescan scsi bus and search again
+		rescans++
+		o.summary.rescans++
+		if err := o.rescanAndWait(c, io, deadline); err != nil {
+			return "", err
+		}
+	}
+	if len(candidates) == 0 && o.driverRebind {
+		candidates = o.recoverDiscovery(c, io, deadline)
 	}
 	// if no disk matches input wwn and lun, exit
-	if disk == "" && dm == "" {
-		return "", fmt.Errorf("no fc disk found")
+	if len(candidates) == 0 {
+		return "", ErrDiskNotFound
 	}
+	if !hasMultipath(candidates) && o.pathWait() > 0 {
+		candidates = awaitMultipath(c, candidates, io, o)
+	}
+
+	o.reportPaths(c, candidates, io)
+	o.summary.paths = len(candidates)
 
 	// if multipath devicemapper device is found, use it; otherwise use raw disk
-	if dm != "" {
-		return dm, nil
+	best := selectCandidate(candidates, c.WWIDs)
+	if best.dm != "" {
+		return best.dm, nil
+	}
+	if o.multipathFallback {
+		if dm := fallbackMap(best, candidates, io); dm != "" {
+			return dm, nil
+		}
 	}
 
-	return disk, nil
+	return best.disk, nil
+}
+
+// findCandidates returns every device matching the connector's target wwns and lun, or its wwids
+func findCandidates(c Connector, io ioHandler) []candidate {
+	var candidates []candidate
+	if len(c.TargetWWNs) != 0 {
+		for _, wwn := range c.TargetWWNs {
+			candidates = append(candidates, findDiskCandidates(wwn, c.Lun, io)...)
+		}
+	} else {
+		for _, wwid := range c.WWIDs {
+			candidates = append(candidates, findDiskWWIDCandidates(wwid, io)...)
+		}
+	}
+	return candidates
 }
 
 // given a wwn and lun, find the device and associated devicemapper parent
 func findDisk(wwn, lun string, io ioHandler) (string, string) {
-	FcPath := "-fc-0x" + wwn + "-lun-" + lun
+	candidates := findDiskCandidates(wwn, lun, io)
+	if len(candidates) == 0 {
+		return "", ""
+	}
+	best := selectCandidate(candidates, nil)
+	return best.disk, best.dm
+}
+
+// findDiskCandidates returns every by-path device for a wwn and lun with its devicemapper parent
+func findDiskCandidates(wwn, lun string, io ioHandler) []candidate {
+	var candidates []candidate
 	DevPath := "/dev/disk/by-path/"
 	if dirs, err := io.ReadDir(DevPath); err == nil {
 		for _, f := range dirs {
 			name := f.Name()
-			if strings.Contains(name, FcPath) {
+			if p, err := ParseFCPath(name); err == nil && p.Matches(wwn, lun) {
 				if disk, err1 := io.EvalSymlinks(DevPath + name); err1 == nil {
+					disk = crossCheckDisk(wwn, lun, disk, io)
+					if !verifyTargetPort(disk, wwn, io) {
+						continue
+					}
 					if dm, err2 := FindMultipathDeviceForDevice(disk, io); err2 == nil {
-						return disk, dm
+						if cand := newCandidate(disk, dm, io); !cand.notVolume(io) {
+							cand.link, cand.target = DevPath+name, p.WWN
+							candidates = append(candidates, cand)
+						}
 					}
 				}
 			}
 		}
 	}
-	return "", ""
+	return candidates
 }
 
 // given a wwid, find the device and associated devicemapper parent
 func findDiskWWIDs(wwid string, io ioHandler) (string, string) {
+	candidates := findDiskWWIDCandidates(wwid, io)
+	if len(candidates) == 0 {
+		return "", ""
+	}
+	return candidates[0].disk, candidates[0].dm
+}
+
+// findDiskWWIDCandidates returns the by-id device for a wwid with its devicemapper parent
+func findDiskWWIDCandidates(wwid string, io ioHandler) []candidate {
 	// Example wwid format:
 	//   3600508b400105e210000900000490000
 	//   <VENDOR NAME> <IDENTIFIER NUMBER>
@@ -197,7 +255,7 @@ func findDiskWWIDs(wwid string, io ioHandler) (string, string) {
 	// The wwid could contain white space and it will be replaced
 	// underscore when wwid is exposed under /dev/by-id.
 
-	FcPath := "scsi-" + wwid
+	FcPath := "scsi-" + wwn.FromIdentifier(wwid)
 	DevID := "/dev/disk/by-id/"
 	if dirs, err := io.ReadDir(DevID); err == nil {
 		for _, f := range dirs {
@@ -206,92 +264,235 @@ func findDiskWWIDs(wwid string, io ioHandler) (string, string) {
 				disk, err := io.EvalSymlinks(DevID + name)
 				if err != nil {
 					glog.Errorf("fc: failed to find a corresponding disk from symlink[%s], error %v", DevID+name, err)
-					return "", ""
+					return nil
 				}
-				if dm, err1 := FindMultipathDeviceForDevice(disk, io); err1 != nil {
-					return disk, dm
+				if dm, err1 := FindMultipathDeviceForDevice(disk, io); err1 == nil {
+					if cand := newCandidate(disk, dm, io); !cand.notVolume(io) {
+						cand.link = DevID + name
+						return []candidate{cand}
+					}
 				}
 			}
 		}
 	}
 	glog.Errorf("fc: failed to find a disk [%s]", DevID+FcPath)
-	return "", ""
+	return nil
 }
 
-// Attach attempts to attach a fc volume to a node using the provided Connector info
-func Attach(c Connector, io ioHandler) (string, error) {
+// Attach attempts to attach a fc volume to a node using the provided Connector info.
+// When several devices match, a multipath device is preferred over a single path, then a device
+// whose WWID is listed in the Connector, then the one with the lowest H:C:T:L address.
+func Attach(c Connector, io ioHandler, opts ...Option) (string, error) {
+	warnDeprecated("Attach", "NewClient(io).Attach(c, opts...)")
+	return attach(c, io, newOptions(opts))
+}
+
+func attach(c Connector, io ioHandler, o *options) (devicePath string, err error) {
+	// deferred first to see the error of a recovered panic
+	defer func(start time.Time) {
+		o.summary.device = devicePath
+		o.logSummary("attach", start, err)
+	}(o.clock.Now())
+	defer recoverPanic("Attach", &err)
+
 	if io == nil {
 		io = &OSioHandler{}
 	}
-
-	glog.Infof("Attaching fibre channel volume")
-	devicePath, err := searchDisk(c, io)
+	o.labels = c.Labels
+	o.summary.volume = c.VolumeName
+	defer o.finishTimings(o.clock.Now())
+	defer o.finishAudit(o.startAudit(io), io)
+
+	glog.Infof("Attaching fibre channel volume %s%s", c.VolumeName, formatLabels(c.Labels))
+	for _, w := range logHBAWarnings(io) {
+		o.event(EventTypeWarning, ReasonHBAWarning, "%s", w)
+	}
+	devicePath, err = searchDisk(c, io, o)
 
 	if err != nil {
+		if errors.Is(err, ErrDiskNotFound) {
+			err = withLoginHints(err, io)
+		}
 		glog.Infof("unable to find disk given WWNN or WWIDs")
+		o.event(EventTypeWarning, ReasonAttachFailed, "attach of volume %s failed: %v", c.VolumeName, err)
+		return "", err
+	}
+	if o.checkClaim != nil {
+		if err := o.checkClaim(c.VolumeName, devicePath); err != nil {
+			o.event(EventTypeWarning, ReasonAttachFailed, "attach of volume %s failed: %v", c.VolumeName, err)
+			return "", err
+		}
+	}
+	o.eventPathsDown(devicePath, io)
+	if err := o.checkMinPaths(devicePath, io); err != nil {
+		o.event(EventTypeWarning, ReasonAttachFailed, "attach of volume %s failed: %v", c.VolumeName, err)
+		return "", err
+	}
+	if err := o.checkReady(c, devicePath, io); err != nil {
+		o.event(EventTypeWarning, ReasonAttachFailed, "attach of volume %s failed: %v", c.VolumeName, err)
+		return "", err
+	}
+	if err := o.checkIdentity(c, devicePath, io); err != nil {
+		o.event(EventTypeWarning, ReasonAttachFailed, "attach of volume %s failed: %v", c.VolumeName, err)
+		return "", err
+	}
+	if err := o.runAttachHook(c, devicePath, io); err != nil {
 		return "", err
 	}
 
 	return devicePath, nil
 }
 
-// Detach performs a detach operation on a volume
-func Detach(devicePath string, io ioHandler) error {
+// AttachDevice is Attach returning what is known about the attached device rather than its path
+// only, for drivers that persist it at stage time and check it again at unstage.
+func AttachDevice(c Connector, io ioHandler, opts ...Option) (info DeviceInfo, err error) {
+	defer recoverPanic("AttachDevice", &err)
+
 	if io == nil {
 		io = &OSioHandler{}
 	}
+	var discovered []DiscoveredPath
+	var targets []TargetStatus
+	o := newOptions(append(append([]Option{}, opts...), WithDiscoveredPaths(&discovered), WithTargetStatus(&targets)))
+	devicePath, err := attach(c, io, o)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	info = getDeviceInfo(devicePath, io)
+	info.Shared = o.shared
+	info.Discovered = discovered
+	info.Targets = targets
+	return info, nil
+}
 
-	glog.Infof("Detaching fibre channel volume")
-	var devices []string
-	dstPath, err := io.EvalSymlinks(devicePath)
+// Prefetch performs the same discovery as Attach, including the scsi rescan that lets multipathd
+// assemble the map, without handing a device to anyone. Schedulers and drivers can use it to warm
+// up paths on candidate nodes ahead of pod placement so the later Attach finds everything in place.
+func Prefetch(c Connector, io ioHandler, opts ...Option) error {
+	return prefetch(c, io, newOptions(opts))
+}
+
+func prefetch(c Connector, io ioHandler, o *options) (err error) {
+	defer recoverPanic("Prefetch", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
 
+	glog.Infof("Prefetching fibre channel volume %s%s", c.VolumeName, formatLabels(c.Labels))
+	devicePath, err := searchDisk(c, io, o)
 	if err != nil {
+		glog.Infof("unable to prefetch disk given WWNN or WWIDs")
 		return err
 	}
+	glog.Infof("fc: prefetched %s", devicePath)
+	return nil
+}
 
-	if strings.HasPrefix(dstPath, "/dev/dm-") {
-		devices = FindSlaveDevicesOnMultipath(dstPath, io)
-	} else {
-		// Add single devicepath to devices
-		devices = append(devices, dstPath)
+// Detach performs a detach operation on a volume
+func Detach(devicePath string, io ioHandler, opts ...Option) error {
+	warnDeprecated("Detach", "NewClient(io).Detach(volumeName, devicePath, opts...)")
+	return detach(devicePath, io, newOptions(opts))
+}
+
+func detach(devicePath string, io ioHandler, o *options) (err error) {
+	defer func(start time.Time) {
+		if o.dryRun == nil {
+			o.logSummary("detach", start, err)
+		}
+	}(o.clock.Now())
+	defer recoverPanic("Detach", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
 	}
+	defer o.finishAudit(o.startAudit(io), io)
+
+	glog.Infof("Detaching fibre channel volume")
+	o.summary.device = devicePath
+	// until the devices are removed the result reports them remaining, so a refused, failed or
+	// canceled detach is never mistaken for a complete one
+	o.setDetachResult(DetachResult{Remaining: []string{devicePath}})
+	devicePath, gone, err := resolveDetachPath(devicePath, io, o)
+	if err != nil {
+		return err
+	}
+	if gone {
+		o.setDetachResult(DetachResult{})
+		return o.removeDropIn(io)
+	}
+	plan, err := planDetach(devicePath, io)
+	if err != nil {
+		return err
+	}
+	o.setDetachResult(DetachResult{Remaining: plannedDevices(plan)})
+	o.summary.device, o.summary.paths = plan.DevicePath, len(plan.Devices)
+	dstPath, devices := plan.DevicePath, plan.Devices
 
 	glog.Infof("fc: DetachDisk devicePath: %v, dstPath: %v, devices: %v", devicePath, dstPath, devices)
 
-	var lastErr error
+	err = o.checkDetachAllowed(plan, io)
+	if o.dryRun != nil {
+		if err != nil {
+			plan.Refused = err.Error()
+		}
+		*o.dryRun = plan
+		glog.Infof("fc: dry run, not detaching %s: %+v", dstPath, plan)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	// past this point the volume is torn down completely, a half removed volume helps nobody, and
+	// the detach hook only runs for a detach that goes ahead
+	if err := o.ctx.Err(); err != nil {
+		return err
+	}
+	if err := o.runDetachHook(dstPath, io); err != nil {
+		return err
+	}
+	if err := o.flushBuffers(plan); err != nil {
+		glog.Errorf("%v", err)
+		o.event(EventTypeWarning, ReasonDetachFailed, "%v", err)
+		return err
+	}
+	o.deregisterKey(dstPath, devices)
+	if err := o.flushMap(plan, io); err != nil {
+		glog.Errorf("%v", err)
+		o.setDetachResult(DetachResult{Remaining: remainingDevices(plan, io)})
+		o.event(EventTypeWarning, ReasonDetachFailed, "%v", err)
+		return err
+	}
 
+	var result DetachResult
 	for _, device := range devices {
 		err := detachFCDisk(device, io)
 		if err != nil {
 			glog.Errorf("fc: detachFCDisk failed. device: %v err: %v", device, err)
-			lastErr = fmt.Errorf("fc: detachFCDisk failed. device: %v err: %v", device, err)
 		}
+		result.Devices = append(result.Devices, DeviceResult{Device: device, Err: err})
 	}
+	result.Remaining = remainingDevices(plan, io)
+	o.setDetachResult(result)
 
-	if lastErr != nil {
-		glog.Errorf("fc: last error occurred during detach disk:\n%v", lastErr)
-		return lastErr
+	if len(result.Remaining) != 0 {
+		o.event(EventTypeWarning, ReasonCleanupFailed, "devices %v of %s are still present after detach", result.Remaining, dstPath)
+	}
+	if err := result.err(); err != nil {
+		glog.Errorf("fc: errors occurred during detach disk:\n%v", err)
+		o.event(EventTypeWarning, ReasonDetachFailed, "%v", err)
+		return err
+	}
+	if err := o.removeDropIn(io); err != nil {
+		o.event(EventTypeWarning, ReasonDetachFailed, "%v", err)
+		return err
 	}
-
 	return nil
 }
 
 //FindSlaveDevicesOnMultipath returns all slaves on the multipath device given the device path
 func FindSlaveDevicesOnMultipath(dm string, io ioHandler) []string {
-	var devices []string
-	// Split path /dev/dm-1 into "", "dev", "dm-1"
-	parts := strings.Split(dm, "/")
-	if len(parts) != 3 || !strings.HasPrefix(parts[1], "dev") {
-		return devices
-	}
-	disk := parts[2]
-	slavesPath := path.Join("/sys/block/", disk, "/slaves/")
-	if files, err := io.ReadDir(slavesPath); err == nil {
-		for _, f := range files {
-			devices = append(devices, path.Join("/dev/", f.Name()))
-		}
-	}
-	return devices
+	return multipath.Slaves(dm, io)
 }
 
 // detachFCDisk removes scsi device file such as /dev/sdX from the node.
@@ -302,14 +503,13 @@ func detachFCDisk(devicePath string, io ioHandler) error {
 	}
 	arr := strings.Split(devicePath, "/")
 	dev := arr[len(arr)-1]
-	removeFromScsiSubsystem(dev, io)
-	return nil
+	return removeFromScsiSubsystem(dev, io)
 }
 
 // Removes a scsi device based upon /dev/sdX name
-func removeFromScsiSubsystem(deviceName string, io ioHandler) {
-	fileName := "/sys/block/" + deviceName + "/device/delete"
+func removeFromScsiSubsystem(deviceName string, io ioHandler) error {
+	fileName := sysfs.DefaultLayout.Block(deviceName, "device/delete")
 	glog.Infof("fc: remove device from scsi-subsystem: path: %s", fileName)
 	data := []byte("1")
-	io.WriteFile(fileName, data, 0666)
+	return io.WriteFile(fileName, data, 0666)
 }
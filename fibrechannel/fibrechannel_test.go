@@ -17,6 +17,9 @@ package fibrechannel
 
 import (
 	"os"
+	"path"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -83,6 +86,141 @@ func (handler *fakeIOHandler) WriteFile(filename string, data []byte, perm os.Fi
 	return nil
 }
 
+func (handler *fakeIOHandler) ReadFile(filename string) ([]byte, error) {
+	return nil, os.ErrNotExist
+}
+
+func (handler *fakeIOHandler) Remove(name string) error {
+	return os.ErrNotExist
+}
+
+func (handler *fakeIOHandler) Rename(oldpath, newpath string) error {
+	return nil
+}
+
+// fakeSysfs is an in-memory io handler: files holds regular file contents,
+// links holds symlinks and directories are implied by the paths of both.
+type fakeSysfs struct {
+	files  map[string]string
+	links  map[string]string
+	writes map[string]string
+}
+
+func newFakeSysfs() *fakeSysfs {
+	return &fakeSysfs{
+		files:  map[string]string{},
+		links:  map[string]string{},
+		writes: map[string]string{},
+	}
+}
+
+func (fs *fakeSysfs) exists(name string) bool {
+	name = path.Clean(name)
+	if _, ok := fs.files[name]; ok {
+		return true
+	}
+	if _, ok := fs.links[name]; ok {
+		return true
+	}
+	return len(fs.children(name)) > 0
+}
+
+func (fs *fakeSysfs) children(dirname string) []string {
+	prefix := path.Clean(dirname) + "/"
+	seen := map[string]bool{}
+	var names []string
+	add := func(p string) {
+		if !strings.HasPrefix(p, prefix) {
+			return
+		}
+		name := strings.SplitN(strings.TrimPrefix(p, prefix), "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for p := range fs.files {
+		add(p)
+	}
+	for p := range fs.links {
+		add(p)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fs *fakeSysfs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	names := fs.children(dirname)
+	if len(names) == 0 {
+		return nil, &os.PathError{Op: "open", Path: dirname, Err: os.ErrNotExist}
+	}
+	var infos []os.FileInfo
+	for _, name := range names {
+		infos = append(infos, &fakeFileInfo{name: name})
+	}
+	return infos, nil
+}
+
+func (fs *fakeSysfs) Lstat(name string) (os.FileInfo, error) {
+	if !fs.exists(name) {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return &fakeFileInfo{name: path.Base(name)}, nil
+}
+
+func (fs *fakeSysfs) EvalSymlinks(name string) (string, error) {
+	name = path.Clean(name)
+	if target, ok := fs.links[name]; ok {
+		return target, nil
+	}
+	if !fs.exists(name) {
+		return "", &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return name, nil
+}
+
+func (fs *fakeSysfs) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	fs.writes[filename] = string(data)
+	return nil
+}
+
+func (fs *fakeSysfs) ReadFile(filename string) ([]byte, error) {
+	if data, ok := fs.files[path.Clean(filename)]; ok {
+		return []byte(data), nil
+	}
+	return nil, &os.PathError{Op: "open", Path: filename, Err: os.ErrNotExist}
+}
+
+func (fs *fakeSysfs) Remove(name string) error {
+	name = path.Clean(name)
+	_, file := fs.files[name]
+	_, link := fs.links[name]
+	if !file && !link {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(fs.files, name)
+	delete(fs.links, name)
+	return nil
+}
+
+// Rename moves a file or what was written to it
+func (fs *fakeSysfs) Rename(oldpath, newpath string) error {
+	data, written := fs.writes[oldpath]
+	content, file := fs.files[path.Clean(oldpath)]
+	if !written && !file {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if written {
+		delete(fs.writes, oldpath)
+		fs.writes[newpath] = data
+	}
+	if file {
+		delete(fs.files, path.Clean(oldpath))
+		fs.files[path.Clean(newpath)] = content
+	}
+	return nil
+}
+
 func TestSearchDisk(t *testing.T) {
 	fakeConnector := Connector{
 		VolumeName: "fakeVol",
@@ -90,7 +228,7 @@ func TestSearchDisk(t *testing.T) {
 		Lun:        "0",
 	}
 
-	devicePath, error := searchDisk(fakeConnector, &fakeIOHandler{})
+	devicePath, error := searchDisk(fakeConnector, &fakeIOHandler{}, newOptions(nil))
 
 	if devicePath == "" || error != nil {
 		t.Errorf("no fc disk found")
@@ -114,3 +252,19 @@ func TestInvalidWWID(t *testing.T) {
 		t.Error("Found a disk with WWID that does not Exist")
 	}
 }
+
+func TestPrefetch(t *testing.T) {
+	fakeConnector := Connector{
+		VolumeName: "fakeVol",
+		TargetWWNs: []string{"500a0981891b8dc5"},
+		Lun:        "0",
+	}
+	if err := Prefetch(fakeConnector, &fakeIOHandler{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	fakeConnector.Lun = "1"
+	if err := Prefetch(fakeConnector, &fakeIOHandler{}); err == nil {
+		t.Error("expected an error for a missing lun")
+	}
+}
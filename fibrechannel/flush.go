@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// flushTimeout is how long Detach waits for the buffers of a device to be flushed by default
+const flushTimeout = 10 * time.Second
+
+// WithoutBufferFlush skips flushing the buffers of the volume's devices before Detach removes
+// them, for callers that unmounted the volume cleanly and have nothing left to write, or that
+// would rather lose what is buffered than keep a volume whose paths are dead
+func WithoutBufferFlush() Option {
+	return func(o *options) {
+		o.skipFlush = true
+	}
+}
+
+// flushBuffers writes what is still buffered for the map and paths of plan to the array before
+// they are removed, as blockdev --flushbufs does. A flush that fails, or doesn't finish within the
+// DetachFlush timeout, e.g. on a dead path, fails the detach with ErrDeviceBusy before anything is
+// removed: deleting the devices would drop the writes still buffered. Callers that accept that
+// pass WithoutBufferFlush. A device that is gone already has nothing buffered. A flush that hangs
+// in the kernel leaves its goroutine behind until it returns.
+func (o *options) flushBuffers(plan DetachPlan) error {
+	if o.skipFlush {
+		return nil
+	}
+	devices := plan.Devices
+	if plan.Map != "" {
+		devices = append([]string{plan.Map}, devices...)
+	}
+	// a goroutine left behind by a hung flush must not read the var again
+	flush := scsi.FlushBuffers
+	for _, device := range devices {
+		done := make(chan error, 1)
+		go func(device string) {
+			done <- flush(device)
+		}(device)
+		var timeout <-chan time.Time
+		if o.detachFlush > 0 {
+			timeout = o.clock.After(o.detachFlush)
+		}
+		select {
+		case err := <-done:
+			if err != nil && !os.IsNotExist(err) {
+				return errorf(ErrDeviceBusy, "fc: unable to flush the buffers of %s: %v", device, err)
+			}
+		case <-timeout:
+			return errorf(ErrDeviceBusy, "fc: flushing the buffers of %s did not finish within %v", device, o.detachFlush)
+		}
+	}
+	return nil
+}
+
+// flushMap removes the multipath map of plan and waits for it to go away before its paths are
+// deleted. Deleting the paths first leaves a map without paths behind, with a stale /dev/mapper
+// entry that queues the I/O sent to it. A map whose name can't be read is left to the path removal
+// as before, a map that can't be removed fails the detach with its paths untouched.
+func (o *options) flushMap(plan DetachPlan, io ioHandler) error {
+	if plan.Map == "" {
+		return nil
+	}
+	dm := path.Base(plan.Map)
+	name := sysfs.ReadAttr(sysfs.DefaultLayout.Block(dm, "dm/name"), io)
+	if name == "" {
+		glog.Warningf("fc: name of map %s unknown, removing its paths without flushing it", plan.Map)
+		return nil
+	}
+	glog.Infof("fc: flushing multipath map %s (%s)", name, plan.Map)
+	flush := multipath.FlushMap
+	if !multipathdRunning(io) {
+		// a map multipathd doesn't manage is removed through device-mapper directly
+		flush = multipath.RemoveMap
+	}
+	if err := flush(name); err != nil {
+		return errorf(ErrDeviceBusy, "fc: unable to flush multipath map %s of %s: %v", name, plan.Map, err)
+	}
+
+	deadline := o.clock.Now().Add(o.deviceGone)
+	err := poll.Until(o.ctx, o.clock, teardownPollInterval, func() (bool, error) {
+		if _, err := io.Lstat(sysfs.DefaultLayout.Block(dm)); err != nil {
+			return true, nil
+		}
+		if !o.clock.Now().Before(deadline) {
+			return false, errTimeout
+		}
+		return false, nil
+	})
+	if err == errTimeout {
+		return errorf(ErrDeviceBusy, "fc: multipath map %s (%s) still present %v after it was flushed", name, plan.Map, o.deviceGone)
+	}
+	return err
+}
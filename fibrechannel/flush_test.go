@@ -0,0 +1,161 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+func mapFixture() *fakeSysfs {
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.files["/sys/block/dm-0/dm/name"] = "mpatha\n"
+	fs.files["/run/multipathd.pid"] = "1234\n"
+	return fs
+}
+
+func TestDetachFlushesMap(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	defer func(remove func(string) error) { multipath.RemoveMap = remove }(multipath.RemoveMap)
+	multipath.RemoveMap = func(name string) error { return errors.New("device or resource busy") }
+
+	fs := mapFixture()
+	var commands []string
+	multipath.Command = func(args ...string) (string, error) {
+		commands = append(commands, strings.Join(args, " "))
+		if len(fs.writes) != 0 {
+			t.Errorf("paths deleted before the map was flushed: %v", fs.writes)
+		}
+		// the map and its slaves directory go away with it
+		for name := range fs.links {
+			if strings.HasPrefix(name, "/sys/block/dm-0/") {
+				delete(fs.links, name)
+			}
+		}
+		delete(fs.files, "/sys/block/dm-0/dm/name")
+		return "ok\n", nil
+	}
+	if err := Detach("/dev/mapper/mpatha", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commands) != 1 || commands[0] != "del map mpatha" {
+		t.Errorf("unexpected multipathd commands %q", commands)
+	}
+	if fs.writes["/sys/block/sdb/device/delete"] != "1" || fs.writes["/sys/block/sdc/device/delete"] != "1" {
+		t.Errorf("expected both paths to be deleted, got %v", fs.writes)
+	}
+
+	// the map is open, neither multipathd nor device-mapper removes it and the paths stay
+	fs = mapFixture()
+	multipath.Command = func(args ...string) (string, error) {
+		return "fail\n", errors.New("multipathd rejected the command")
+	}
+	var result DetachResult
+	var events []recordedEvent
+	err := Detach("/dev/mapper/mpatha", fs, WithDetachResult(&result), WithEvents(recordEvents(&events)))
+	if !errors.Is(err, ErrDeviceBusy) {
+		t.Fatalf("expected ErrDeviceBusy, got %v", err)
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("expected the paths of the busy map to be kept, got %v", fs.writes)
+	}
+	if len(result.Remaining) != 1 || result.Remaining[0] != "/dev/dm-0" || len(events) != 1 || events[0].reason != ReasonDetachFailed {
+		t.Errorf("unexpected result %+v and events %+v", result, events)
+	}
+
+	// without multipathd the map is removed through device-mapper only
+	fs = mapFixture()
+	delete(fs.files, "/run/multipathd.pid")
+	commands = nil
+	var removed []string
+	multipath.RemoveMap = func(name string) error {
+		removed = append(removed, name)
+		for name := range fs.links {
+			if strings.HasPrefix(name, "/sys/block/dm-0/") {
+				delete(fs.links, name)
+			}
+		}
+		delete(fs.files, "/sys/block/dm-0/dm/name")
+		return nil
+	}
+	if err := Detach("/dev/mapper/mpatha", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commands) != 0 || len(removed) != 1 || removed[0] != "mpatha" {
+		t.Errorf("expected only device-mapper to remove mpatha, got commands %q and removals %q", commands, removed)
+	}
+}
+
+func TestDetachFlushesBuffers(t *testing.T) {
+	defer func(flush func(string) error) { scsi.FlushBuffers = flush }(scsi.FlushBuffers)
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	var flushed []string
+	scsi.FlushBuffers = func(device string) error {
+		if len(fs.writes) != 0 {
+			t.Errorf("%s flushed after devices were deleted: %v", device, fs.writes)
+		}
+		flushed = append(flushed, device)
+		if device == "/dev/sdc" {
+			return errors.New("input/output error")
+		}
+		return nil
+	}
+	var result DetachResult
+	err := Detach("/dev/mapper/mpatha", fs, WithDetachResult(&result))
+	if !errors.Is(err, ErrDeviceBusy) {
+		t.Fatalf("expected the failed flush to fail with ErrDeviceBusy, got %v", err)
+	}
+	if strings.Join(flushed, " ") != "/dev/dm-0 /dev/sdb /dev/sdc" {
+		t.Errorf("expected the map and then its paths to be flushed, got %v", flushed)
+	}
+	if len(fs.writes) != 0 || result.Complete() {
+		t.Errorf("expected a failed flush to keep the devices, got %v %+v", fs.writes, result)
+	}
+
+	flushed = nil
+	if err := Detach("/dev/mapper/mpatha", fs, WithoutBufferFlush()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(flushed) != 0 || len(fs.writes) != 2 {
+		t.Errorf("expected the devices to be deleted without a flush, got %v %v", flushed, fs.writes)
+	}
+
+	// a flush hanging on a dead path fails the detach once DetachFlush passed
+	hang := make(chan struct{})
+	scsi.FlushBuffers = func(device string) error {
+		<-hang
+		return nil
+	}
+	fs.writes = map[string]string{}
+	if err := Detach("/dev/mapper/mpatha", fs, WithTimeouts(Timeouts{DetachFlush: time.Millisecond})); !errors.Is(err, ErrDeviceBusy) {
+		t.Fatalf("expected the hanging flush to fail with ErrDeviceBusy, got %v", err)
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("expected the devices to be kept, got %v", fs.writes)
+	}
+	close(hang)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+//HBA describes a local Fibre Channel host port as exposed under /sys/class/fc_host. Model,
+//SerialNumber and Temperature (degrees Celsius) come from driver private attributes and are empty
+//when the driver doesn't expose them, so inventory tooling doesn't need vendor CLIs.
+type HBA struct {
+	Host            string
+	PortName        string
+	NodeName        string
+	PortState       string
+	Speed           string
+	FabricName      string
+	Driver          string
+	DriverVersion   string
+	FirmwareVersion string
+	Model           string
+	SerialNumber    string
+	Temperature     string
+}
+
+//HBAVersionRule describes a known-bad HBA driver/firmware combination. DriverVersion and
+//FirmwareVersion are path.Match patterns, an empty pattern matches any version.
+type HBAVersionRule struct {
+	Driver          string `json:"driver"`
+	DriverVersion   string `json:"driverVersion,omitempty"`
+	FirmwareVersion string `json:"firmwareVersion,omitempty"`
+	Feature         string `json:"feature,omitempty"`
+	Reason          string `json:"reason"`
+}
+
+//KnownBadHBAVersions is the matrix consulted by Attach and Diagnose. It is empty by default,
+//callers append their own rules or replace it with the result of LoadHBAVersionMatrix.
+var KnownBadHBAVersions []HBAVersionRule
+
+// GetHBAs returns every FC host port found in /sys/class/fc_host
+func GetHBAs(io ioHandler) (hbas []HBA, err error) {
+	defer recoverPanic("GetHBAs", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.FCHosts())
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range dirs {
+		host := f.Name()
+		driver, adapter := driverFor(host, io)
+		hba := HBA{
+			Host:            host,
+			PortName:        sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.FCHost(host), "port_name"), io),
+			NodeName:        sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.FCHost(host), "node_name"), io),
+			PortState:       sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.FCHost(host), "port_state"), io),
+			Speed:           sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.FCHost(host), "speed"), io),
+			FabricName:      sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.FCHost(host), "fabric_name"), io),
+			Driver:          driver,
+			DriverVersion:   readHostAttr(host, adapter.driverVersionAttrs, io),
+			FirmwareVersion: readHostAttr(host, adapter.firmwareVersionAttrs, io),
+			Model:           readHostAttr(host, adapter.modelAttrs, io),
+			SerialNumber:    readHostAttr(host, adapter.serialNumberAttrs, io),
+			Temperature:     readHostAttr(host, adapter.temperatureAttrs, io),
+		}
+		hbas = append(hbas, hba)
+	}
+	return hbas, nil
+}
+
+// FindHostByWWPN returns the scsi host (hostN) of the local initiator port named wwpn. The port
+// name may be given in any of the spellings wwn.Equal accepts, anything else fails.
+func FindHostByWWPN(wwpn string, io ioHandler) (host string, err error) {
+	defer recoverPanic("FindHostByWWPN", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	if !wwn.Valid(wwpn) {
+		return "", fmt.Errorf("fc: invalid WWPN %q", wwpn)
+	}
+
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.FCHosts())
+	if err != nil {
+		return "", err
+	}
+	for _, f := range dirs {
+		if wwn.Equal(sysfs.ReadAttrRetry(path.Join(sysfs.DefaultLayout.FCHost(f.Name()), "port_name"), io), wwpn) {
+			return f.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("fc: no local port with WWPN %s", wwpn)
+}
+
+// LoadHBAVersionMatrix reads a JSON list of HBAVersionRule from filename
+func LoadHBAVersionMatrix(filename string, io ioHandler) ([]HBAVersionRule, error) {
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	data, err := io.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rules []HBAVersionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("fc: invalid HBA version matrix %s: %v", filename, err)
+	}
+	return rules, nil
+}
+
+// CheckHBAVersions returns a warning for every HBA matching one of the rules
+func CheckHBAVersions(hbas []HBA, rules []HBAVersionRule) []string {
+	var warnings []string
+	for _, hba := range hbas {
+		for _, rule := range rules {
+			if rule.Driver != hba.Driver ||
+				!matchVersion(rule.DriverVersion, hba.DriverVersion) ||
+				!matchVersion(rule.FirmwareVersion, hba.FirmwareVersion) {
+				continue
+			}
+			msg := fmt.Sprintf("%s: %s driver %s firmware %s is known bad", hba.Host, hba.Driver, hba.DriverVersion, hba.FirmwareVersion)
+			if rule.Feature != "" {
+				msg += " for " + rule.Feature
+			}
+			if rule.Reason != "" {
+				msg += ": " + rule.Reason
+			}
+			warnings = append(warnings, msg)
+		}
+	}
+	return warnings
+}
+
+func matchVersion(pattern, version string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(pattern, version)
+	return err == nil && matched
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+func newFakeHBAs() *fakeSysfs {
+	fs := newFakeSysfs()
+	fs.files["/sys/class/fc_host/host5/port_name"] = "0x10000000c9a02834\n"
+	fs.files["/sys/class/fc_host/host5/port_state"] = "Online\n"
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/scsi_host/host5/lpfc_drvr_version"] = "Emulex LightPulse Fibre Channel SCSI driver 12.0.0.5\n"
+	fs.files["/sys/class/scsi_host/host5/fwrev"] = "11.4.204.20\n"
+	fs.files["/sys/class/fc_host/host6/port_name"] = "0x21000024ff3f8e1a\n"
+	fs.files["/sys/class/scsi_host/host6/proc_name"] = "qla2xxx\n"
+	fs.files["/sys/class/scsi_host/host6/driver_version"] = "10.00.00.06-k\n"
+	fs.files["/sys/class/scsi_host/host6/fw_version"] = "8.07.00 (d0d5)\n"
+	return fs
+}
+
+func TestGetHBAsExtendedInfo(t *testing.T) {
+	fs := newFakeHBAs()
+	fs.files["/sys/class/fc_host/host5/speed"] = "16 Gbit\n"
+	fs.files["/sys/class/scsi_host/host5/modelname"] = "LPe32002-M2\n"
+	fs.files["/sys/class/scsi_host/host5/serialnum"] = "FC72831547\n"
+	fs.files["/sys/class/scsi_host/host6/model_name"] = "QLE2692\n"
+	fs.files["/sys/class/scsi_host/host6/serial_num"] = "RFD1712K58734\n"
+	fs.files["/sys/class/scsi_host/host6/thermal_temp"] = "47\n"
+
+	hbas, err := GetHBAs(fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hbas[0].Model != "LPe32002-M2" || hbas[0].SerialNumber != "FC72831547" || hbas[0].Speed != "16 Gbit" || hbas[0].Temperature != "" {
+		t.Errorf("unexpected lpfc HBA: %+v", hbas[0])
+	}
+	if hbas[1].Model != "QLE2692" || hbas[1].SerialNumber != "RFD1712K58734" || hbas[1].Temperature != "47" {
+		t.Errorf("unexpected qla2xxx HBA: %+v", hbas[1])
+	}
+}
+
+func TestGetHBAs(t *testing.T) {
+	hbas, err := GetHBAs(newFakeHBAs())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(hbas) != 2 {
+		t.Fatalf("expected 2 HBAs, got %d", len(hbas))
+	}
+	if hbas[0].Host != "host5" || hbas[0].PortName != "0x10000000c9a02834" || hbas[0].FirmwareVersion != "11.4.204.20" {
+		t.Errorf("unexpected lpfc HBA: %+v", hbas[0])
+	}
+	if hbas[1].Driver != "qla2xxx" || hbas[1].DriverVersion != "10.00.00.06-k" || hbas[1].FirmwareVersion != "8.07.00 (d0d5)" {
+		t.Errorf("unexpected qla2xxx HBA: %+v", hbas[1])
+	}
+}
+
+func TestFindHostByWWPN(t *testing.T) {
+	fs := newFakeHBAs()
+	for _, wwpn := range []string{"21000024ff3f8e1a", "0x21000024FF3F8E1A"} {
+		if host, err := FindHostByWWPN(wwpn, fs); err != nil || host != "host6" {
+			t.Errorf("%s: expected host6, got %q, %v", wwpn, host, err)
+		}
+	}
+	if host, err := FindHostByWWPN("21000024ff3f8e1b", fs); err == nil {
+		t.Errorf("expected no host, got %s", host)
+	}
+	// a host whose port_name can't be read must not match an empty or malformed WWPN
+	fs.files["/sys/class/fc_host/host7/port_state"] = "Online\n"
+	for _, wwpn := range []string{"", "0x", "not-a-wwpn"} {
+		if host, err := FindHostByWWPN(wwpn, fs); err == nil {
+			t.Errorf("%q: expected an error, got %s", wwpn, host)
+		}
+	}
+}
+
+func TestCheckHBAVersions(t *testing.T) {
+	hbas, _ := GetHBAs(newFakeHBAs())
+	tests := []struct {
+		name  string
+		rules []HBAVersionRule
+		count int
+	}{
+		{"no rules", nil, 0},
+		{"driver only", []HBAVersionRule{{Driver: "qla2xxx", Reason: "bad"}}, 1},
+		{"firmware pattern", []HBAVersionRule{{Driver: "lpfc", FirmwareVersion: "11.4.*"}}, 1},
+		{"firmware mismatch", []HBAVersionRule{{Driver: "lpfc", FirmwareVersion: "12.*"}}, 0},
+		{"driver mismatch", []HBAVersionRule{{Driver: "bfa"}}, 0},
+	}
+	for _, test := range tests {
+		if warnings := CheckHBAVersions(hbas, test.rules); len(warnings) != test.count {
+			t.Errorf("%s: expected %d warnings, got %v", test.name, test.count, warnings)
+		}
+	}
+}
+
+func TestLoadHBAVersionMatrix(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.files["/etc/fc/matrix.json"] = `[{"driver": "qla2xxx", "firmwareVersion": "8.07.*", "feature": "fc-nvme", "reason": "namespace scan hangs"}]`
+	rules, err := LoadHBAVersionMatrix("/etc/fc/matrix.json", fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Feature != "fc-nvme" {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+
+	fs.files["/etc/fc/bad.json"] = "{"
+	if _, err := LoadHBAVersionMatrix("/etc/fc/bad.json", fs); err == nil {
+		t.Error("expected an error for malformed matrix")
+	}
+}
+
+func TestDriverFor(t *testing.T) {
+	fs := newFakeHBAs()
+	fs.files["/sys/class/scsi_host/host7/proc_name"] = "bfa\n"
+	fs.files["/sys/class/scsi_host/host7/driver_version"] = "3.2.25.1\n"
+	// lpfc hosts must not pick up a generic attribute
+	fs.files["/sys/class/scsi_host/host5/fw_version"] = "bogus\n"
+
+	if name, d := driverFor("host5", fs); name != "lpfc" || readHostAttr("host5", d.firmwareVersionAttrs, fs) != "11.4.204.20" {
+		t.Errorf("unexpected lpfc adapter %s %+v", name, d)
+	}
+	if name, d := driverFor("host7", fs); name != "bfa" || d != genericHBADriver || readHostAttr("host7", d.driverVersionAttrs, fs) != "3.2.25.1" {
+		t.Errorf("unexpected bfa adapter %s %+v", name, d)
+	}
+}
+
+func TestDriverForDriverLink(t *testing.T) {
+	fs := newFakeHBAs()
+	// an NPIV port of the qla2xxx adapter whose proc_name says something else
+	fs.files["/sys/class/scsi_host/host8/proc_name"] = "qla2xxx_vport\n"
+	fs.links["/sys/class/scsi_host/host8/device"] = "/sys/devices/pci0000:40/0000:40:01.1/0000:42:00.0/host6/vport-6:0-0/host8"
+	fs.links["/sys/devices/pci0000:40/0000:40:01.1/0000:42:00.0/driver"] = "/sys/bus/pci/drivers/qla2xxx"
+
+	if name, d := driverFor("host8", fs); name != "qla2xxx" || d != hbaDrivers["qla2xxx"] {
+		t.Errorf("unexpected adapter %s %+v", name, d)
+	}
+}
+
+func TestScanThroughDriver(t *testing.T) {
+	defer func(d *hbaDriver) { hbaDrivers["qla2xxx"] = d }(hbaDrivers["qla2xxx"])
+	quirky := *hbaDrivers["qla2xxx"]
+	quirky.scan = func(channel, target, lun string) string { return "scan " + channel + ":" + target + ":" + lun }
+	hbaDrivers["qla2xxx"] = &quirky
+
+	fs := newFakeHBAs()
+	if err := scanTarget("6:0:2", "1", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := scanTarget("5:0:2", "1", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := rescanHost("host6", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fs.writes["/sys/class/scsi_host/host5/scan"] != "0 2 1" || fs.writes["/sys/class/scsi_host/host6/scan"] != "scan -:-:-" {
+		t.Errorf("unexpected scans %v", fs.writes)
+	}
+	if err := scanTarget("6:0", "1", fs); err == nil {
+		t.Error("expected an invalid target to fail")
+	}
+}
+
+func TestCreateVport(t *testing.T) {
+	fs := newFakeHBAs()
+	fs.files["/sys/class/fc_host/host5/vport_create"] = ""
+	fs.files["/sys/class/fc_host/host5/vport_delete"] = ""
+
+	if err := CreateVport("host5", "0x20000025B5A0001F", "20:00:00:25:b5:b0:00:1f", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fs.writes["/sys/class/fc_host/host5/vport_create"]; got != "20000025b5a0001f:20000025b5b0001f" {
+		t.Errorf("unexpected vport_create write %q", got)
+	}
+	if err := DeleteVport("host5", "20000025b5a0001f", "20000025b5b0001f", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CreateVport("host6", "20000025b5a0001f", "20000025b5b0001f", fs); err == nil {
+		t.Error("expected a host without vport_create to fail")
+	}
+	if err := CreateVport("host5", "0000000000000000", "20000025b5b0001f", fs); err == nil {
+		t.Error("expected a placeholder port name to fail")
+	}
+}
+
+func TestGetHBAsMovedSysfsRoot(t *testing.T) {
+	defer func(layout sysfs.Layout) { sysfs.DefaultLayout = layout }(sysfs.DefaultLayout)
+	sysfs.DefaultLayout = sysfs.Layout{Root: "/host/sys"}
+
+	fs := newFakeSysfs()
+	fs.files["/host/sys/class/fc_host/host5/port_name"] = "0x10000090fa1b2c3d\n"
+
+	hbas, err := GetHBAs(fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(hbas) != 1 || hbas[0].Host != "host5" || hbas[0].PortName != "0x10000090fa1b2c3d" {
+		t.Errorf("unexpected HBAs %+v", hbas)
+	}
+}
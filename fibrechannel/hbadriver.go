@@ -0,0 +1,200 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// hbaDriver adapts to the differences between HBA drivers: where a driver exposes its private host
+// attributes under scsi_host and how it takes scan requests, NPIV port requests and link error
+// statistics. The fc transport attributes are common to all drivers. A nil scan or vport, or
+// empty linkErrorAttrs, means the driver does what the scsi and fc transports document.
+type hbaDriver struct {
+	driverVersionAttrs   []string
+	firmwareVersionAttrs []string
+	modelAttrs           []string
+	serialNumberAttrs    []string
+	temperatureAttrs     []string
+
+	// scan formats what the host's scan attribute is written to scan lun on channel and target,
+	// "-" for all of them
+	scan func(channel, target, lun string) string
+	// vport formats what fc_host's vport_create and vport_delete are written for the virtual
+	// port wwpn with node name wwnn, both normalized
+	vport func(wwpn, wwnn string) string
+	// linkErrorAttrs are the fc_host statistics counting errors on the physical link
+	linkErrorAttrs []string
+}
+
+// hbaDrivers holds the adapters for the drivers we know, keyed by the name of the driver bound
+// to the host's adapter
+var hbaDrivers = map[string]*hbaDriver{
+	"lpfc": {
+		driverVersionAttrs:   []string{"lpfc_drvr_version"},
+		firmwareVersionAttrs: []string{"fwrev"},
+		modelAttrs:           []string{"modelname"},
+		serialNumberAttrs:    []string{"serialnum"},
+	},
+	"qla2xxx": {
+		driverVersionAttrs:   []string{"driver_version"},
+		firmwareVersionAttrs: []string{"fw_version"},
+		modelAttrs:           []string{"model_name"},
+		serialNumberAttrs:    []string{"serial_num"},
+		temperatureAttrs:     []string{"thermal_temp"},
+	},
+}
+
+// genericHBADriver is used for unknown drivers, the first readable attribute wins
+var genericHBADriver = &hbaDriver{
+	driverVersionAttrs:   []string{"driver_version", "lpfc_drvr_version"},
+	firmwareVersionAttrs: []string{"fw_version", "fwrev"},
+	modelAttrs:           []string{"model_name", "modelname"},
+	serialNumberAttrs:    []string{"serial_num", "serialnum"},
+	temperatureAttrs:     []string{"thermal_temp"},
+}
+
+// driverFor returns the adapter for the driver of host (hostN)
+func driverFor(host string, io ioHandler) (string, *hbaDriver) {
+	name := driverName(host, io)
+	if d, ok := hbaDrivers[name]; ok {
+		return name, d
+	}
+	return name, genericHBADriver
+}
+
+// driverName returns the name of the driver bound to the adapter of host: the driver link of the
+// closest device above the host, the pci function for a physical port and the one of its parent
+// port for an NPIV port. proc_name, which drivers are free to set to anything, is only used
+// when sysfs has no driver link.
+func driverName(host string, io ioHandler) string {
+	devices := sysfs.DefaultLayout.Path("devices")
+	dir, err := io.EvalSymlinks(path.Join(sysfs.DefaultLayout.SCSIHost(host), "device"))
+	for err == nil && strings.HasPrefix(dir, devices+"/") {
+		if driver, err := io.EvalSymlinks(path.Join(dir, "driver")); err == nil {
+			return path.Base(driver)
+		}
+		dir = path.Dir(dir)
+	}
+	return sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.SCSIHost(host), "proc_name"), io)
+}
+
+// readHostAttr returns the first readable of the host's attrs
+func readHostAttr(host string, attrs []string, io ioHandler) string {
+	for _, attr := range attrs {
+		if value := sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.SCSIHost(host), attr), io); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// scanString returns what the host's scan attribute is written to scan lun on channel and target
+func (d *hbaDriver) scanString(channel, target, lun string) string {
+	if d.scan != nil {
+		return d.scan(channel, target, lun)
+	}
+	return channel + " " + target + " " + lun
+}
+
+// vportString returns what vport_create and vport_delete are written for the virtual port wwpn
+// with node name wwnn
+func (d *hbaDriver) vportString(wwpn, wwnn string) string {
+	if d.vport != nil {
+		return d.vport(wwn.Normalize(wwpn), wwn.Normalize(wwnn))
+	}
+	return wwn.Normalize(wwpn) + ":" + wwn.Normalize(wwnn)
+}
+
+// linkErrorStatistics returns the fc_host statistics counting link errors
+func (d *hbaDriver) linkErrorStatistics() []string {
+	if len(d.linkErrorAttrs) > 0 {
+		return d.linkErrorAttrs
+	}
+	return linkErrorCounters
+}
+
+// rescanHosts asks every scsi host to scan all channels, targets and luns, as scsi.RescanHosts
+// does in the format of each host's driver
+func rescanHosts(io ioHandler) {
+	if dirs, err := io.ReadDir(sysfs.DefaultLayout.SCSIHosts()); err == nil {
+		for _, f := range dirs {
+			rescanHost(f.Name(), io)
+		}
+	}
+}
+
+// rescanHost asks host (hostN) to scan all its channels, targets and luns
+func rescanHost(host string, io ioHandler) error {
+	_, d := driverFor(host, io)
+	return io.WriteFile(path.Join(sysfs.DefaultLayout.SCSIHost(host), "scan"), []byte(d.scanString("-", "-", "-")), 0666)
+}
+
+// scanTarget asks the host of target (H:C:T) to scan only lun on that channel and target, as
+// scsi.ScanTarget does in the format of the host's driver
+func scanTarget(target, lun string, io ioHandler) error {
+	parts := strings.Split(target, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("fc: invalid scsi target %q", target)
+	}
+	host := "host" + parts[0]
+	_, d := driverFor(host, io)
+	return io.WriteFile(path.Join(sysfs.DefaultLayout.SCSIHost(host), "scan"), []byte(d.scanString(parts[1], parts[2], lun)), 0666)
+}
+
+// CreateVport creates the NPIV virtual port wwpn with node name wwnn on the local fc port host
+// (hostN), e.g. to give a pod or tenant its own zoning. The names may be given in any of the
+// spellings wwn.Equal accepts. The new port appears as a host of its own once it logged in.
+func CreateVport(host, wwpn, wwnn string, io ioHandler) (err error) {
+	defer recoverPanic("CreateVport", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	return writeVport(host, "vport_create", wwpn, wwnn, io)
+}
+
+// DeleteVport deletes the NPIV virtual port wwpn with node name wwnn from host, the physical
+// port it was created on
+func DeleteVport(host, wwpn, wwnn string, io ioHandler) (err error) {
+	defer recoverPanic("DeleteVport", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	return writeVport(host, "vport_delete", wwpn, wwnn, io)
+}
+
+func writeVport(host, attr, wwpn, wwnn string, io ioHandler) error {
+	for _, name := range []string{wwpn, wwnn} {
+		if !wwn.Valid(name) || wwn.Placeholder(name) {
+			return fmt.Errorf("fc: invalid port or node name %q", name)
+		}
+	}
+	name := path.Join(sysfs.DefaultLayout.FCHost(host), attr)
+	if _, err := io.Lstat(name); err != nil {
+		return fmt.Errorf("fc: %s doesn't support NPIV, it has no %s: %v", host, attr, err)
+	}
+	_, d := driverFor(host, io)
+	glog.Infof("fc: writing %s to %s", d.vportString(wwpn, wwnn), name)
+	return io.WriteFile(name, []byte(d.vportString(wwpn, wwnn)), 0200)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// Volume condition reasons, a machine readable summary of a VolumeCondition
+const (
+	ConditionHealthy       = "FCHealthy"
+	ConditionDegraded      = "FCPathsDegraded"
+	ConditionSlowPath      = "FCSlowPath"
+	ConditionBelowMinPaths = "FCBelowMinPaths"
+	ConditionAllPathsDown  = "FCAllPathsDown"
+	ConditionDeviceMissing = "FCDeviceMissing"
+)
+
+//VolumeCondition is the health of an attached volume, shaped like the VolumeCondition of CSI's
+//NodeGetVolumeStats: Abnormal and Message map onto its abnormal and message fields as they are.
+//Reason is one of the Condition constants, for drivers that count or alert on conditions.
+type VolumeCondition struct {
+	Abnormal bool
+	Message  string
+	Reason   string
+}
+
+// GetVolumeCondition checks the device Attach returned for a volume. A device that is gone or has
+// no running path is abnormal. Failed paths are reported as degraded, and are abnormal once fewer
+// paths than the MinPathsPolicy of opts are usable. With WithPathLatencyCheck paths much slower
+// than their siblings are reported too.
+func GetVolumeCondition(devicePath string, io ioHandler, opts ...Option) (condition VolumeCondition, err error) {
+	defer recoverPanic("GetVolumeCondition", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	abnormal := func(reason, format string, args ...interface{}) (VolumeCondition, error) {
+		return VolumeCondition{Abnormal: true, Reason: reason, Message: fmt.Sprintf(format, args...)}, nil
+	}
+	o := newOptions(opts)
+	dev, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return abnormal(ConditionDeviceMissing, "%s is gone: %v", devicePath, err)
+	}
+	info := getDeviceInfo(dev, io)
+	var failed []string
+	for _, p := range info.Paths {
+		if state := sysfs.ReadAttr(sysfs.DefaultLayout.Block(path.Base(p), "device/state"), io); pathFailed(state) {
+			failed = append(failed, fmt.Sprintf("%s (%s)", path.Base(p), state))
+		}
+	}
+
+	if len(info.Paths) == 0 {
+		return abnormal(ConditionAllPathsDown, "%s has no paths", devicePath)
+	}
+	if len(failed) == len(info.Paths) {
+		return abnormal(ConditionAllPathsDown, "no path of %s is running: %s", devicePath, strings.Join(failed, ", "))
+	}
+	if usable := usablePaths(dev, o.minPaths.CountGhost, io); o.minPaths.Min > 0 && usable < o.minPaths.Min {
+		return abnormal(ConditionBelowMinPaths, "%s has %d usable paths, %d required", devicePath, usable, o.minPaths.Min)
+	}
+	if len(failed) > 0 {
+		return VolumeCondition{Reason: ConditionDegraded, Message: fmt.Sprintf("%d of %d paths of %s failed: %s", len(failed), len(info.Paths), devicePath, strings.Join(failed, ", "))}, nil
+	}
+	if o.latencyInterval > 0 {
+		latencies, err := samplePathLatency(info.Paths, o.latencyInterval, io, o)
+		if err != nil {
+			return VolumeCondition{}, err
+		}
+		var slow []string
+		for _, l := range latencies {
+			if l.Outlier {
+				slow = append(slow, fmt.Sprintf("%s (%v)", path.Base(l.Path), l.Latency))
+			}
+		}
+		if len(slow) > 0 {
+			return VolumeCondition{Reason: ConditionSlowPath, Message: fmt.Sprintf("paths of %s are much slower than the others: %s", devicePath, strings.Join(slow, ", "))}, nil
+		}
+	}
+	return VolumeCondition{Reason: ConditionHealthy, Message: fmt.Sprintf("all %d paths of %s are running", len(info.Paths), devicePath)}, nil
+}
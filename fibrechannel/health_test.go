@@ -0,0 +1,46 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+func TestGetVolumeCondition(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.files["/sys/block/sdb/device/state"] = "running\n"
+	fs.files["/sys/block/sdc/device/state"] = "running\n"
+
+	check := func(name, reason string, abnormal bool, opts ...Option) {
+		condition, err := GetVolumeCondition("/dev/mapper/mpatha", fs, opts...)
+		if err != nil || condition.Reason != reason || condition.Abnormal != abnormal || condition.Message == "" {
+			t.Errorf("%s: expected %s (abnormal %v), got %+v, %v", name, reason, abnormal, condition, err)
+		}
+	}
+	check("healthy", ConditionHealthy, false)
+	fs.files["/sys/block/sdc/device/state"] = "transport-offline\n"
+	check("one path down", ConditionDegraded, false)
+	check("below policy", ConditionBelowMinPaths, true, WithMinPathsPolicy(MinPathsPolicy{Min: 2}))
+	fs.files["/sys/block/sdb/device/state"] = "offline\n"
+	check("all paths down", ConditionAllPathsDown, true)
+
+	if condition, err := GetVolumeCondition("/dev/mapper/mpathb", fs); err != nil || !condition.Abnormal || condition.Reason != ConditionDeviceMissing {
+		t.Errorf("expected a missing device, got %+v, %v", condition, err)
+	}
+}
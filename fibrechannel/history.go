@@ -0,0 +1,93 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"sync"
+	"time"
+)
+
+// maxHistoryEntries bounds the memory a Client spends on its history of operations
+const maxHistoryEntries = 256
+
+//OperationRecord is one operation a Client ran. Operation is attach, prefetch or detach.
+//Connector holds the inputs of an attach or prefetch, DevicePath the device attached or the one
+//passed to detach. Timings are the attach phases, Err is nil for a successful operation.
+type OperationRecord struct {
+	Operation   string
+	VolumeName  string
+	OperationID string
+	Connector   Connector
+	DevicePath  string
+	Start       time.Time
+	Duration    time.Duration
+	Timings     PhaseTimings
+	Err         error
+}
+
+// history keeps the most recent operations of a Client in a ring buffer, overwriting the oldest
+// once it is full
+type history struct {
+	mu      sync.Mutex
+	records []OperationRecord
+	next    int
+	full    bool
+}
+
+func newHistory(max int) *history {
+	return &history{records: make([]OperationRecord, max)}
+}
+
+func (h *history) add(r OperationRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records[h.next] = r
+	h.next = (h.next + 1) % len(h.records)
+	h.full = h.full || h.next == 0
+}
+
+// list returns the recorded operations, oldest first
+func (h *history) list() []OperationRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]OperationRecord(nil), h.records[:h.next]...)
+	}
+	return append(append([]OperationRecord(nil), h.records[h.next:]...), h.records[:h.next]...)
+}
+
+// History returns the Client's most recent operations with their inputs, timings and results,
+// oldest first. It keeps the last 256, so when a volume is reported to have failed to mount an hour
+// ago the node plugin can still show what happened, e.g. from a debug endpoint.
+func (cl *Client) History() []OperationRecord {
+	return cl.history.list()
+}
+
+// record adds an operation that started at start to the history
+func (cl *Client) record(operation string, c Connector, devicePath string, o *options, start time.Time, err error) {
+	c.io = nil
+	cl.history.add(OperationRecord{
+		Operation:   operation,
+		VolumeName:  c.VolumeName,
+		OperationID: o.operationID,
+		Connector:   c,
+		DevicePath:  devicePath,
+		Start:       start,
+		Duration:    o.clock.Now().Sub(start),
+		Timings:     o.phases,
+		Err:         err,
+	})
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+func TestHistoryRingBuffer(t *testing.T) {
+	h := newHistory(3)
+	if records := h.list(); len(records) != 0 {
+		t.Fatalf("expected an empty history, got %+v", records)
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		h.add(OperationRecord{VolumeName: name})
+	}
+	records := h.list()
+	if len(records) != 3 || records[0].VolumeName != "c" || records[1].VolumeName != "d" || records[2].VolumeName != "e" {
+		t.Errorf("expected the last 3 operations oldest first, got %+v", records)
+	}
+}
+
+func TestClientHistory(t *testing.T) {
+	client := NewClient(&fakeIOHandler{})
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	devicePath, err := client.Attach(c, WithOperationID("op1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Attach(Connector{VolumeName: "bad"}); err == nil {
+		t.Fatal("expected the attach without targets to fail")
+	}
+	client.Detach("vol", devicePath)
+
+	records := client.History()
+	if len(records) != 3 {
+		t.Fatalf("expected 3 operations, got %+v", records)
+	}
+	attach := records[0]
+	if attach.Operation != "attach" || attach.VolumeName != "vol" || attach.OperationID != "op1" || attach.DevicePath != devicePath ||
+		attach.Connector.Lun != "0" || attach.Err != nil || attach.Start.IsZero() {
+		t.Errorf("unexpected attach record %+v", attach)
+	}
+	if records[1].VolumeName != "bad" || records[1].Err == nil {
+		t.Errorf("expected the failed attach to be recorded with its error, got %+v", records[1])
+	}
+	if records[2].Operation != "detach" || records[2].DevicePath != devicePath {
+		t.Errorf("unexpected detach record %+v", records[2])
+	}
+}
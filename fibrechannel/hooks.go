@@ -0,0 +1,93 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+//AttachHook runs after Attach found the device and before it returns it, e.g. to trigger vendor
+//udev rules, apply array recommended tunables or register the device with a monitoring agent
+type AttachHook func(c Connector, info DeviceInfo) error
+
+//DetachHook runs before Detach removes anything, e.g. to flush application buffers, release
+//persistent reservations or notify monitoring. Returning an error vetoes the detach, blocking in
+//the hook delays it.
+type DetachHook func(info DeviceInfo) error
+
+//HookFailurePolicy decides what a failing hook does to the operation it runs in
+type HookFailurePolicy int
+
+const (
+	//HookErrorFails fails the operation with the hook's error
+	HookErrorFails HookFailurePolicy = iota
+	//HookErrorIgnored logs the hook's error and lets the operation succeed
+	HookErrorIgnored
+)
+
+// WithAttachHook runs hook at the end of a successful Attach, policy decides whether its error
+// fails the Attach. The device stays attached either way.
+func WithAttachHook(hook AttachHook, policy HookFailurePolicy) Option {
+	return func(o *options) {
+		o.attachHook = hook
+		o.attachHookPolicy = policy
+	}
+}
+
+// runAttachHook runs the attach hook, if any, for the device Attach is about to return
+func (o *options) runAttachHook(c Connector, devicePath string, io ioHandler) error {
+	if o.attachHook == nil {
+		return nil
+	}
+	info := getDeviceInfo(devicePath, io)
+	info.Shared = o.shared
+	if err := o.attachHook(c, info); err != nil {
+		if o.attachHookPolicy == HookErrorIgnored {
+			glog.Warningf("fc: attach hook failed for %s, ignoring: %v", devicePath, err)
+			return nil
+		}
+		return fmt.Errorf("fc: attach hook failed for %s: %v", devicePath, err)
+	}
+	return nil
+}
+
+// WithDetachHook runs hook before a Detach removes the device, policy decides whether its error
+// vetoes the Detach
+func WithDetachHook(hook DetachHook, policy HookFailurePolicy) Option {
+	return func(o *options) {
+		o.detachHook = hook
+		o.detachHookPolicy = policy
+	}
+}
+
+// runDetachHook runs the detach hook, if any, for the device Detach is about to remove
+func (o *options) runDetachHook(devicePath string, io ioHandler) error {
+	if o.detachHook == nil {
+		return nil
+	}
+	info := getDeviceInfo(devicePath, io)
+	info.Shared = o.shared
+	if err := o.detachHook(info); err != nil {
+		if o.detachHookPolicy == HookErrorIgnored {
+			glog.Warningf("fc: detach hook failed for %s, ignoring: %v", devicePath, err)
+			return nil
+		}
+		return fmt.Errorf("fc: detach of %s vetoed by hook: %v", devicePath, err)
+	}
+	return nil
+}
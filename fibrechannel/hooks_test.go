@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAttachHook(t *testing.T) {
+	fakeConnector := Connector{
+		VolumeName: "fakeVol",
+		TargetWWNs: []string{"500a0981891b8dc5"},
+		Lun:        "0",
+	}
+	var seen DeviceInfo
+	record := func(c Connector, info DeviceInfo) error {
+		seen = info
+		return nil
+	}
+	fail := func(c Connector, info DeviceInfo) error {
+		return errors.New("agent unreachable")
+	}
+
+	devicePath, err := Attach(fakeConnector, &fakeIOHandler{}, WithAttachHook(record, HookErrorFails))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if seen.DevicePath != devicePath || !seen.Multipath {
+		t.Errorf("unexpected device info %+v for %s", seen, devicePath)
+	}
+
+	if _, err := Attach(fakeConnector, &fakeIOHandler{}, WithAttachHook(fail, HookErrorFails)); err == nil {
+		t.Error("expected the hook's error to fail the attach")
+	}
+	if _, err := Attach(fakeConnector, &fakeIOHandler{}, WithAttachHook(fail, HookErrorIgnored)); err != nil {
+		t.Errorf("expected the hook's error to be ignored, got %v", err)
+	}
+}
+
+func TestGetDeviceInfo(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.files["/sys/block/sdb/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+	fs.files["/sys/block/dm-0/size"] = "2097152\n"
+	fs.files["/sys/block/dm-0/dm/name"] = "mpatha\n"
+	fs.links["/sys/block/sdb/device"] = "../../devices/platform/host1/rport-1:0-0/target1:0:0/1:0:0:3"
+	fs.links["/sys/block/sdc/device"] = "../../devices/platform/host2/rport-2:0-0/target2:0:0/2:0:0:3"
+
+	info := getDeviceInfo("/dev/dm-0", fs)
+	if !info.Multipath || len(info.Paths) != 2 || info.WWID != "naa.600a098038303053453f463045727a44" || info.Size != 1073741824 {
+		t.Errorf("unexpected device info %+v", info)
+	}
+	if info.MapName != "mpatha" || len(info.HCTLs) != 2 || info.HCTLs[0] != "1:0:0:3" || info.HCTLs[1] != "2:0:0:3" {
+		t.Errorf("unexpected map name or addresses %+v", info)
+	}
+}
+
+func TestDetachHook(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	veto := func(info DeviceInfo) error {
+		if info.DevicePath != "/dev/dm-0" || len(info.Paths) != 1 {
+			t.Errorf("unexpected device info %+v", info)
+		}
+		return errors.New("application still flushing")
+	}
+
+	if err := Detach("/dev/mapper/mpatha", fs, WithDetachHook(veto, HookErrorFails)); err == nil {
+		t.Error("expected the hook to veto the detach")
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("vetoed detach wrote %v", fs.writes)
+	}
+	if err := Detach("/dev/mapper/mpatha", fs, WithDetachHook(veto, HookErrorIgnored)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fs.writes["/sys/block/sdb/device/delete"] != "1" {
+		t.Errorf("expected sdb to be deleted, got %v", fs.writes)
+	}
+}
+
+func TestAttachDevice(t *testing.T) {
+	fakeConnector := Connector{
+		VolumeName: "fakeVol",
+		TargetWWNs: []string{"500a0981891b8dc5"},
+		Lun:        "0",
+	}
+	info, err := AttachDevice(fakeConnector, &fakeIOHandler{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.DevicePath != "/dev/dm-1" || !info.Multipath || len(info.HCTLs) != len(info.Paths) {
+		t.Errorf("unexpected device info %+v", info)
+	}
+}
+
+func TestSharedVolumeHooks(t *testing.T) {
+	fakeConnector := Connector{
+		VolumeName: "fakeVol",
+		TargetWWNs: []string{"500a0981891b8dc5"},
+		Lun:        "0",
+	}
+	var shared bool
+	record := func(c Connector, info DeviceInfo) error {
+		shared = info.Shared
+		return nil
+	}
+	if _, err := Attach(fakeConnector, &fakeIOHandler{}, WithAttachHook(record, HookErrorFails)); err != nil || shared {
+		t.Errorf("expected an exclusive volume, got shared %v, error %v", shared, err)
+	}
+	info, err := AttachDevice(fakeConnector, &fakeIOHandler{}, WithAttachHook(record, HookErrorFails), WithSharedVolume())
+	if err != nil || !shared || !info.Shared {
+		t.Errorf("expected a shared volume, got hook %v, info %+v, error %v", shared, info, err)
+	}
+}
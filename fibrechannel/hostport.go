@@ -0,0 +1,118 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// hostPortControls are the writable attributes HBA drivers offer to take a port down and up,
+// with the values meaning offline and online. Drivers without any can't be controlled.
+var hostPortControls = []struct {
+	dir     func(host string) string
+	attr    string
+	offline string
+	online  string
+}{
+	{sysfs.DefaultLayout.FCHost, "port_state", "Offline", "Online"},
+	{sysfs.DefaultLayout.SCSIHost, "link_state", "down", "up"},
+}
+
+// DisableHostPort takes the local fc port host (e.g. host5) offline for maintenance. It refuses
+// if any device on the port is the last path of an attached volume.
+func DisableHostPort(host string, io ioHandler) (err error) {
+	defer recoverPanic("DisableHostPort", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	if err := checkOtherPaths(host, io); err != nil {
+		return err
+	}
+	return setHostPortState(host, false, io)
+}
+
+// EnableHostPort brings the local fc port host back online
+func EnableHostPort(host string, io ioHandler) (err error) {
+	defer recoverPanic("EnableHostPort", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	return setHostPortState(host, true, io)
+}
+
+func setHostPortState(host string, online bool, io ioHandler) error {
+	for _, control := range hostPortControls {
+		name := path.Join(control.dir(host), control.attr)
+		if _, err := io.Lstat(name); err != nil {
+			continue
+		}
+		value := control.offline
+		if online {
+			value = control.online
+		}
+		glog.Infof("fc: setting %s to %s", name, value)
+		if err := io.WriteFile(name, []byte(value), 0644); err != nil {
+			glog.Warningf("fc: %s rejected %s: %v", name, value, err)
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("fc: %s has no writable port state, its driver doesn't support it", host)
+}
+
+// checkOtherPaths fails if a block device behind host is not reachable through another host
+func checkOtherPaths(host string, io ioHandler) error {
+	hostNumber := strings.TrimPrefix(host, "host")
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.SCSIDevices())
+	if err != nil {
+		return err
+	}
+	for _, f := range dirs {
+		hctl := f.Name()
+		if !strings.HasPrefix(hctl, hostNumber+":") || !scsi.IsDisk(hctl, io) {
+			continue
+		}
+		for _, dev := range scsi.BlockDevices(hctl, io) {
+			dm, err := multipath.FindParent("/dev/"+dev, io)
+			if err != nil || dm == "" {
+				return errorf(ErrDeviceBusy, "fc: refusing to take %s offline, /dev/%s (%s) has no other path", host, dev, hctl)
+			}
+			if !hasPathOutside(dm, hostNumber, io) {
+				return errorf(ErrDeviceBusy, "fc: refusing to take %s offline, it has the last path of %s", host, dm)
+			}
+		}
+	}
+	return nil
+}
+
+func hasPathOutside(dm, hostNumber string, io ioHandler) bool {
+	for _, slave := range multipath.Slaves(dm, io) {
+		hctl, err := scsi.DeviceHCTL(path.Base(slave), io)
+		if err == nil && !strings.HasPrefix(hctl, hostNumber+":") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+// newFakeTwoPaths lays out dm-0 with a path through host5 (sdb) and one through host6 (sdc)
+func newFakeTwoPaths() *fakeSysfs {
+	fs := newFakeSysfs()
+	fs.files["/sys/class/scsi_host/host5/link_state"] = "Link Up - Ready\n"
+	fs.files["/sys/bus/scsi/devices/5:0:0:1/block/sdb/dev"] = "8:16"
+	fs.files["/sys/bus/scsi/devices/6:0:0:1/block/sdc/dev"] = "8:32"
+	fs.links["/sys/block/sdb/device"] = "/sys/devices/host5/rport-5:0-0/target5:0:0/5:0:0:1"
+	fs.links["/sys/block/sdc/device"] = "/sys/devices/host6/rport-6:0-0/target6:0:0/6:0:0:1"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "/sys/devices/sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "/sys/devices/sdc"
+	fs.files["/dev/sdb"] = ""
+	fs.files["/dev/sdc"] = ""
+	return fs
+}
+
+func TestDisableHostPort(t *testing.T) {
+	fs := newFakeTwoPaths()
+	if err := DisableHostPort("host5", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fs.writes["/sys/class/scsi_host/host5/link_state"] != "down" {
+		t.Errorf("expected host5 link to be set down, got %v", fs.writes)
+	}
+	if err := EnableHostPort("host5", fs); err != nil || fs.writes["/sys/class/scsi_host/host5/link_state"] != "up" {
+		t.Errorf("expected host5 link to be set up, got %v, %v", fs.writes, err)
+	}
+}
+
+func TestDisableHostPortLastPath(t *testing.T) {
+	fs := newFakeTwoPaths()
+	delete(fs.links, "/sys/block/dm-0/slaves/sdc")
+	if err := DisableHostPort("host5", fs); err == nil {
+		t.Error("expected refusal to drop the last path of dm-0")
+	}
+
+	fs = newFakeTwoPaths()
+	delete(fs.links, "/sys/block/dm-0/slaves/sdb")
+	delete(fs.links, "/sys/block/dm-0/slaves/sdc")
+	if err := DisableHostPort("host5", fs); err == nil {
+		t.Error("expected refusal to drop the only path of sdb")
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("expected nothing to be written, got %v", fs.writes)
+	}
+}
+
+func TestDisableHostPortUnsupported(t *testing.T) {
+	fs := newFakeTwoPaths()
+	if err := DisableHostPort("host6", fs); err == nil {
+		t.Error("expected an error for a driver without a writable port state")
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// WithIdentityCheck makes Attach read the Device Identification VPD page (0x83) of every path of
+// the device it found and fail with ErrIdentityMismatch if a path reports another LUN than the
+// volume's: one of the Connector's WWIDs, or the wwid of the map or disk when it has none. The
+// by-path links and the kernel's wwid are only as fresh as the last scan, an array that renumbers
+// its LUNs in between would otherwise have another volume's disk handed to the workload. Paths
+// that don't answer the INQUIRY are skipped, Attach fails with ErrDeviceBusy if none does.
+func WithIdentityCheck() Option {
+	return func(o *options) {
+		o.identityCheck = true
+	}
+}
+
+// checkIdentity verifies that every path of devicePath identifies as the volume of c
+func (o *options) checkIdentity(c Connector, devicePath string, io ioHandler) error {
+	if !o.identityCheck {
+		return nil
+	}
+	expected := c.WWIDs
+	if len(expected) == 0 {
+		expected = []string{deviceWWID(devicePath, io)}
+		if expected[0] == "" {
+			return errorf(ErrIdentityMismatch, "fc: %s has no wwid to verify its identity against", devicePath)
+		}
+	}
+	paths := getDeviceInfo(devicePath, io).Paths
+	verified := 0
+	for _, p := range paths {
+		designators, err := scsi.DeviceIdentification(p)
+		if err != nil {
+			glog.Warningf("fc: unable to read the identity of path %s of %s: %v", p, devicePath, err)
+			continue
+		}
+		if !identifiesAs(designators, expected) {
+			var ids []string
+			for _, d := range designators {
+				if d.Association == scsi.AssociationLogicalUnit && d.WWID() != "" {
+					ids = append(ids, d.WWID())
+				}
+			}
+			return errorf(ErrIdentityMismatch, "fc: path %s of %s identifies as %s, expected %s",
+				p, devicePath, strings.Join(ids, ", "), strings.Join(expected, ", "))
+		}
+		verified++
+	}
+	if verified == 0 && len(paths) > 0 {
+		return errorf(ErrDeviceBusy, "fc: unable to verify the identity of %s, none of its %d paths answered", devicePath, len(paths))
+	}
+	return nil
+}
+
+// deviceWWID returns the wwid of devicePath in the form scsi_id uses: a map's is its uuid without
+// the mpath- prefix, a disk's the kernel's
+func deviceWWID(devicePath string, io ioHandler) string {
+	dev := path.Base(devicePath)
+	if strings.HasPrefix(dev, "dm-") {
+		return strings.TrimPrefix(sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "dm/uuid"), io), multipath.UUIDPrefix)
+	}
+	return wwn.SCSIID(sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "device/wwid"), io))
+}
+
+// identifiesAs reports whether one of the logical unit designators matches one of wwids
+func identifiesAs(designators []scsi.Designator, wwids []string) bool {
+	for _, d := range designators {
+		if d.Association == scsi.AssociationLogicalUnit && matchesAnyWWID(d.WWID(), wwids) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+// identifyAs makes every path answer INQUIRY with a Device Identification page holding the NAA
+// designator naa
+func identifyAs(naa string) func(string, *scsi.Command) error {
+	return func(device string, cmd *scsi.Command) error {
+		id, _ := hex.DecodeString(naa)
+		page := append([]byte{0x00, 0x83, 0x00, byte(4 + len(id)), 0x01, 0x03, 0x00, byte(len(id))}, id...)
+		copy(cmd.Data, page)
+		return nil
+	}
+}
+
+func TestIdentityCheck(t *testing.T) {
+	defer func(send func(string, *scsi.Command) error) { scsi.Send = send }(scsi.Send)
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.files["/dev/sdb"] = ""
+	fs.files["/sys/block/sdb/size"] = "2097152"
+	fs.files["/sys/block/sdb/device/wwid"] = "naa.600a098038303053743f463045727a41\n"
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+
+	scsi.Send = identifyAs("600a098038303053743f463045727a41")
+	if _, err := Attach(c, fs, WithIdentityCheck()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the array renumbered its LUNs since the kernel read the wwid
+	scsi.Send = identifyAs("600a098038303053743f463045727a42")
+	if _, err := Attach(c, fs, WithIdentityCheck()); !errors.Is(err, ErrIdentityMismatch) {
+		t.Errorf("expected ErrIdentityMismatch, got %v", err)
+	}
+	if _, err := Attach(c, fs); err != nil {
+		t.Errorf("expected no check without WithIdentityCheck, got %v", err)
+	}
+
+	// the connector's WWIDs win over the kernel's
+	c.WWIDs = []string{"3600a098038303053743f463045727a42"}
+	if _, err := Attach(c, fs, WithIdentityCheck()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		return &scsi.SenseError{Key: scsi.SenseKeyNotReady, ASC: 0x04}
+	}
+	if _, err := Attach(c, fs, WithIdentityCheck()); !errors.Is(err, ErrDeviceBusy) {
+		t.Errorf("expected ErrDeviceBusy without a path answering, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//DeviceInquiry is the INQUIRY data of a volume's LUN, e.g. to log which array serves a volume or
+//to apply vendor specific quirks. Vendor, Model and Revision are as the kernel shows them in
+//sysfs, without the padding of the INQUIRY data. SerialNumber is "" for LUNs without a Unit
+//Serial Number VPD page.
+type DeviceInquiry struct {
+	Vendor       string
+	Model        string
+	Revision     string
+	SerialNumber string
+}
+
+// GetDeviceInquiry returns the INQUIRY data of the device Attach returned, for a multipath map
+// that of its first path the kernel has it for. The serial number is the one the kernel cached
+// when it found the path, kernels that don't cache it have it read with INQUIRY.
+func GetDeviceInquiry(devicePath string, io ioHandler) (inquiry DeviceInquiry, err error) {
+	defer recoverPanic("GetDeviceInquiry", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	dev, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return DeviceInquiry{}, err
+	}
+	for _, p := range getDeviceInfo(dev, io).Paths {
+		device := sysfs.DefaultLayout.Block(path.Base(p), "device")
+		inquiry = DeviceInquiry{
+			Vendor:   sysfs.ReadAttr(path.Join(device, "vendor"), io),
+			Model:    sysfs.ReadAttr(path.Join(device, "model"), io),
+			Revision: sysfs.ReadAttr(path.Join(device, "rev"), io),
+		}
+		if inquiry.Vendor == "" && inquiry.Model == "" {
+			continue
+		}
+		if page, err := io.ReadFile(path.Join(device, "vpd_pg80")); err == nil {
+			inquiry.SerialNumber, err = scsi.ParseUnitSerialNumber(page)
+			if err == nil {
+				return inquiry, nil
+			}
+		}
+		if inquiry.SerialNumber, err = scsi.UnitSerialNumber(p); err != nil {
+			glog.Warningf("fc: unable to read the serial number of %s: %v", p, err)
+		}
+		return inquiry, nil
+	}
+	return DeviceInquiry{}, fmt.Errorf("fc: no inquiry data found for %s", devicePath)
+}
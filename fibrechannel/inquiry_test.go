@@ -0,0 +1,64 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+func TestGetDeviceInquiry(t *testing.T) {
+	defer func(send func(string, *scsi.Command) error) { scsi.Send = send }(scsi.Send)
+	fs := mapFixture()
+	for _, dev := range []string{"sdb", "sdc"} {
+		fs.files["/sys/block/"+dev+"/device/vendor"] = "NETAPP  \n"
+		fs.files["/sys/block/"+dev+"/device/model"] = "LUN C-Mode      \n"
+		fs.files["/sys/block/"+dev+"/device/rev"] = "9800\n"
+	}
+	fs.files["/sys/block/sdb/device/vpd_pg80"] = "\x00\x80\x00\x0e80OS3t?F0Erz  "
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		t.Errorf("unexpected INQUIRY of %s", device)
+		return nil
+	}
+
+	inquiry, err := GetDeviceInquiry("/dev/mapper/mpatha", fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := DeviceInquiry{Vendor: "NETAPP", Model: "LUN C-Mode", Revision: "9800", SerialNumber: "80OS3t?F0Erz"}
+	if inquiry != expected {
+		t.Errorf("expected %+v, got %+v", expected, inquiry)
+	}
+
+	// the kernel didn't cache the page, the serial number is read from the device
+	delete(fs.files, "/sys/block/sdb/device/vpd_pg80")
+	fs.files["/dev/sdb"] = ""
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		if cmd.CDB[2] != 0x80 {
+			t.Errorf("unexpected VPD page %#x", cmd.CDB[2])
+		}
+		copy(cmd.Data, "\x00\x80\x00\x0c80OS3t?F0Erz")
+		return nil
+	}
+	if inquiry, err := GetDeviceInquiry("/dev/sdb", fs); err != nil || inquiry != expected {
+		t.Errorf("expected %+v, got %+v %v", expected, inquiry, err)
+	}
+
+	if _, err := GetDeviceInquiry("/dev/sdx", fs); err == nil {
+		t.Error("expected an error for a missing device")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//Inventory is a snapshot of the kernel objects the library creates and removes, block devices
+//are listed as block/<name> and scsi devices as scsi/<H:C:T:L>
+type Inventory struct {
+	Objects []string
+}
+
+//InventoryDiff lists the kernel objects that appeared and disappeared between two snapshots
+type InventoryDiff struct {
+	Added   []string
+	Removed []string
+}
+
+// TakeInventory snapshots the block and scsi devices currently present on the node
+func TakeInventory(io ioHandler) (inv Inventory, err error) {
+	defer recoverPanic("TakeInventory", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	blocks, err := io.ReadDir(sysfs.DefaultLayout.Blocks())
+	if err != nil {
+		return inv, err
+	}
+	for _, f := range blocks {
+		inv.Objects = append(inv.Objects, "block/"+f.Name())
+	}
+	if devices, err := io.ReadDir(sysfs.DefaultLayout.SCSIDevices()); err == nil {
+		for _, f := range devices {
+			if _, ok := scsi.ParseHCTL(f.Name()); ok {
+				inv.Objects = append(inv.Objects, "scsi/"+f.Name())
+			}
+		}
+	}
+	sort.Strings(inv.Objects)
+	return inv, nil
+}
+
+// Diff returns what is in after but not in inv and the other way round
+func (inv Inventory) Diff(after Inventory) InventoryDiff {
+	var diff InventoryDiff
+	before := map[string]bool{}
+	for _, o := range inv.Objects {
+		before[o] = true
+	}
+	now := map[string]bool{}
+	for _, o := range after.Objects {
+		now[o] = true
+		if !before[o] {
+			diff.Added = append(diff.Added, o)
+		}
+	}
+	for _, o := range inv.Objects {
+		if !now[o] {
+			diff.Removed = append(diff.Removed, o)
+		}
+	}
+	return diff
+}
+
+// startAudit takes the "before" snapshot if an audit was requested
+func (o *options) startAudit(io ioHandler) *Inventory {
+	if o.audit == nil {
+		return nil
+	}
+	inv, err := TakeInventory(io)
+	if err != nil {
+		glog.Warningf("fc: unable to take device inventory: %v", err)
+		return nil
+	}
+	return &inv
+}
+
+// finishAudit takes the "after" snapshot and records the difference to before
+func (o *options) finishAudit(before *Inventory, io ioHandler) {
+	if before == nil {
+		return
+	}
+	after, err := TakeInventory(io)
+	if err != nil {
+		glog.Warningf("fc: unable to take device inventory: %v", err)
+		return
+	}
+	*o.audit = before.Diff(after)
+	glog.Infof("fc: operation added %v, removed %v%s", o.audit.Added, o.audit.Removed, formatLabels(o.labels))
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInventoryDiff(t *testing.T) {
+	before := Inventory{Objects: []string{"block/dm-0", "block/sda", "block/sdb", "scsi/5:0:0:1"}}
+	after := Inventory{Objects: []string{"block/dm-0", "block/sda", "block/sdc", "scsi/5:0:0:2"}}
+
+	diff := before.Diff(after)
+	if !reflect.DeepEqual(diff.Added, []string{"block/sdc", "scsi/5:0:0:2"}) {
+		t.Errorf("unexpected added objects: %v", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"block/sdb", "scsi/5:0:0:1"}) {
+		t.Errorf("unexpected removed objects: %v", diff.Removed)
+	}
+}
+
+// removingSysfs drops the block and scsi device of a disk when its delete attribute is written
+type removingSysfs struct {
+	*fakeSysfs
+}
+
+func (fs *removingSysfs) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	if filename == "/sys/block/sdb/device/delete" {
+		delete(fs.files, "/sys/block/sdb/size")
+		delete(fs.files, "/sys/bus/scsi/devices/5:0:0:1/vendor")
+	}
+	return fs.fakeSysfs.WriteFile(filename, data, perm)
+}
+
+func TestDetachInventoryAudit(t *testing.T) {
+	fs := &removingSysfs{newFakeSysfs()}
+	fs.files["/dev/sdb"] = ""
+	fs.files["/sys/block/sda/size"] = "2097152"
+	fs.files["/sys/block/sdb/size"] = "2097152"
+	fs.files["/sys/bus/scsi/devices/5:0:0:1/vendor"] = "NETAPP"
+
+	var diff InventoryDiff
+	if err := Detach("/dev/sdb", fs, WithInventoryAudit(&diff)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"block/sdb", "scsi/5:0:0:1"}) || len(diff.Added) != 0 {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"sync"
+)
+
+// maxJournalEntries bounds the memory a Client spends remembering completed operations
+const maxJournalEntries = 1024
+
+// journal remembers the result of completed operations by volume and operation id so CSI's
+// at-least-once retries get the same answer. Only successful operations are recorded, a failed one
+// may have stopped half way and must run again. The oldest entries are dropped once the journal is
+// full.
+type journal struct {
+	mu      sync.Mutex
+	max     int
+	order   []journalKey
+	results map[journalKey]string
+}
+
+// journalKey keeps the volume in the key, an operation id reused for another volume must not
+// return the first volume's result
+type journalKey struct {
+	op     string
+	volume string
+	id     string
+}
+
+func newJournal(max int) *journal {
+	return &journal{max: max, results: map[journalKey]string{}}
+}
+
+func (j *journal) lookup(op, volume, id string) (string, bool) {
+	if id == "" {
+		return "", false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result, ok := j.results[journalKey{op, volume, id}]
+	return result, ok
+}
+
+func (j *journal) record(op, volume, id, result string) {
+	if id == "" {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key := journalKey{op, volume, id}
+	if _, ok := j.results[key]; !ok {
+		j.order = append(j.order, key)
+	}
+	j.results[key] = result
+	for len(j.order) > j.max {
+		delete(j.results, j.order[0])
+		j.order = j.order[1:]
+	}
+}
+
+// forget drops the op entries of volume, e.g. its attaches once it was detached, so a retried
+// attach runs again instead of returning a device that is gone
+func (j *journal) forget(op, volume string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	order := j.order[:0]
+	for _, key := range j.order {
+		if key.op == op && key.volume == volume {
+			delete(j.results, key)
+			continue
+		}
+		order = append(order, key)
+	}
+	j.order = order
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+func TestFormatLabels(t *testing.T) {
+	labels := map[string]string{
+		"storageClass": "gold",
+		"array":        "netapp-01",
+		"pv":           "pvc-1234",
+	}
+	if s := formatLabels(labels); s != " array=netapp-01 pv=pvc-1234 storageClass=gold" {
+		t.Errorf("unexpected labels %q", s)
+	}
+	if s := formatLabels(nil); s != "" {
+		t.Errorf("expected no labels, got %q", s)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+const (
+	// outlierFactor is how many times slower than the median of its siblings a path is an outlier
+	outlierFactor = 3
+	// outlierFloor keeps paths that are fast in absolute terms from being outliers
+	outlierFloor = 2 * time.Millisecond
+)
+
+//PathLatency is the average service time of one path of a volume over a sampling interval. IOs
+//is the number of I/Os the path completed in it, a path without I/O has no Latency. Outlier is
+//set for a path much slower than its siblings, a link degrading before it fails. FailedOver is set
+//when WithSlowPathFailover had multipathd mark the outlier marginal.
+type PathLatency struct {
+	Path       string
+	IOs        uint64
+	Latency    time.Duration
+	Outlier    bool
+	FailedOver bool
+}
+
+// WithPathLatencyCheck makes GetVolumeCondition sample the latency of the volume's paths for
+// interval and report the volume as ConditionSlowPath when one is an outlier
+func WithPathLatencyCheck(interval time.Duration) Option {
+	return func(o *options) {
+		o.latencyInterval = interval
+	}
+}
+
+// WithSlowPathFailover makes SamplePathLatency ask multipathd to mark the paths flagged as
+// outliers marginal, moving the I/O to the healthy paths before the degrading link fails outright.
+// A slow path still passes the path checker, which would reinstate a failed path right away, a
+// marginal one only gets I/O again once no other path is left or multipath.UnsetMarginal returns
+// it, e.g. after the link was repaired. Paths are only set aside while a path serving I/O at
+// normal latency remains. GetVolumeCondition only reports slow paths, it never changes them.
+func WithSlowPathFailover() Option {
+	return func(o *options) {
+		o.failSlowPaths = true
+	}
+}
+
+// SamplePathLatency measures the average service time of every path of devicePath from the I/O
+// statistics of /sys/block/sdX/stat over interval, and flags the outliers among them. Only the
+// volume's own I/O is measured, an idle volume has no latency to report.
+func SamplePathLatency(devicePath string, interval time.Duration, io ioHandler, opts ...Option) (latencies []PathLatency, err error) {
+	defer recoverPanic("SamplePathLatency", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	o := newOptions(opts)
+	dev, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	latencies, err = samplePathLatency(getDeviceInfo(dev, io).Paths, interval, io, o)
+	if err == nil && o.failSlowPaths {
+		o.failOutliers(latencies, io)
+	}
+	return latencies, err
+}
+
+func samplePathLatency(paths []string, interval time.Duration, io ioHandler, o *options) ([]PathLatency, error) {
+	before := make([]blockStat, len(paths))
+	for i, p := range paths {
+		before[i] = readBlockStat(path.Base(p), io)
+	}
+	if err := poll.Sleep(o.ctx, o.clock, interval); err != nil {
+		return nil, err
+	}
+	latencies := make([]PathLatency, len(paths))
+	for i, p := range paths {
+		after := readBlockStat(path.Base(p), io)
+		l := PathLatency{Path: p}
+		if after.ios >= before[i].ios && after.ticks >= before[i].ticks {
+			l.IOs = after.ios - before[i].ios
+		}
+		if l.IOs > 0 {
+			l.Latency = time.Duration(after.ticks-before[i].ticks) * time.Millisecond / time.Duration(l.IOs)
+		}
+		latencies[i] = l
+	}
+	flagOutliers(latencies)
+	return latencies, nil
+}
+
+// failOutliers asks multipathd to mark the outliers among latencies marginal, if another path
+// serves I/O at normal latency
+func (o *options) failOutliers(latencies []PathLatency, io ioHandler) {
+	healthy := false
+	for _, l := range latencies {
+		healthy = healthy || (l.IOs > 0 && !l.Outlier)
+	}
+	if !healthy {
+		return
+	}
+	if !multipathdRunning(io) {
+		glog.Warningf("fc: multipathd isn't running to mark slow paths marginal")
+		return
+	}
+	for i, l := range latencies {
+		if !l.Outlier {
+			continue
+		}
+		if err := multipath.SetMarginal(path.Base(l.Path)); err != nil {
+			glog.Warningf("fc: unable to mark slow path %s marginal: %v", l.Path, err)
+			continue
+		}
+		latencies[i].FailedOver = true
+		o.event(EventTypeWarning, ReasonSlowPathFailed, "marked path %s marginal, its latency of %v is far above its siblings'", l.Path, l.Latency)
+	}
+}
+
+// flagOutliers marks the paths whose latency is well above the median of the paths with I/O
+func flagOutliers(latencies []PathLatency) {
+	var measured []time.Duration
+	for _, l := range latencies {
+		if l.IOs > 0 {
+			measured = append(measured, l.Latency)
+		}
+	}
+	if len(measured) < 2 {
+		return
+	}
+	sort.Slice(measured, func(i, j int) bool { return measured[i] < measured[j] })
+	median := measured[len(measured)/2]
+	if len(measured)%2 == 0 {
+		median = (measured[len(measured)/2-1] + median) / 2
+	}
+	for i, l := range latencies {
+		latencies[i].Outlier = l.IOs > 0 && l.Latency > outlierFloor && l.Latency > outlierFactor*median
+	}
+}
+
+// blockStat is the number of completed I/Os and the milliseconds spent on them of a block device
+type blockStat struct {
+	ios   uint64
+	ticks uint64
+}
+
+// readBlockStat reads the reads and writes of /sys/block/<dev>/stat, see the kernel's
+// Documentation/block/stat.rst. Missing or malformed statistics read as zero.
+func readBlockStat(dev string, io ioHandler) blockStat {
+	fields := strings.Fields(sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "stat"), io))
+	if len(fields) < 8 {
+		return blockStat{}
+	}
+	n := func(i int) uint64 {
+		v, _ := strconv.ParseUint(fields[i], 10, 64)
+		return v
+	}
+	// read I/Os, read merges, read sectors, read ticks, then the same for writes
+	return blockStat{ios: n(0) + n(4), ticks: n(3) + n(7)}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+)
+
+// statSysfs returns the next of a device's stat lines at every read
+type statSysfs struct {
+	*fakeSysfs
+	stats map[string][]string
+}
+
+func (fs *statSysfs) ReadFile(filename string) ([]byte, error) {
+	if lines := fs.stats[filename]; len(lines) > 0 {
+		fs.stats[filename] = lines[1:]
+		return []byte(lines[0]), nil
+	}
+	return fs.fakeSysfs.ReadFile(filename)
+}
+
+func TestSamplePathLatency(t *testing.T) {
+	fs := &statSysfs{fakeSysfs: newFakeSysfs(), stats: map[string][]string{
+		// 100 reads and 100 writes taking 200ms, 1ms each
+		"/sys/block/sdb/stat": {"1000 0 8000 500 1000 0 8000 500 0 900 1000 0 0 0 0\n", "1100 0 8800 600 1100 0 8800 600 0 1000 1200 0 0 0 0\n"},
+		"/sys/block/sdc/stat": {"1000 0 8000 500 1000 0 8000 500 0 900 1000 0 0 0 0\n", "1100 0 8800 620 1100 0 8800 600 0 1000 1200 0 0 0 0\n"},
+		// 200 I/Os taking 5s, 25ms each
+		"/sys/block/sdd/stat": {"1000 0 8000 500 1000 0 8000 500 0 900 1000 0 0 0 0\n", "1100 0 8800 3000 1100 0 8800 3000 0 1000 1200 0 0 0 0\n"},
+		// idle
+		"/sys/block/sde/stat": {"1000 0 8000 500 1000 0 8000 500 0 900 1000 0 0 0 0\n", "1000 0 8000 500 1000 0 8000 500 0 900 1000 0 0 0 0\n"},
+	}}
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	for _, dev := range []string{"sdb", "sdc", "sdd", "sde"} {
+		fs.links["/sys/block/dm-0/slaves/"+dev] = "../../" + dev
+	}
+
+	latencies, err := SamplePathLatency("/dev/mapper/mpatha", time.Millisecond, fs)
+	if err != nil || len(latencies) != 4 {
+		t.Fatalf("unexpected result %+v, %v", latencies, err)
+	}
+	expected := map[string]PathLatency{
+		"/dev/sdb": {Path: "/dev/sdb", IOs: 200, Latency: time.Millisecond},
+		"/dev/sdc": {Path: "/dev/sdc", IOs: 200, Latency: 1100 * time.Microsecond},
+		"/dev/sdd": {Path: "/dev/sdd", IOs: 200, Latency: 25 * time.Millisecond, Outlier: true},
+		"/dev/sde": {Path: "/dev/sde"},
+	}
+	for _, l := range latencies {
+		if l != expected[l.Path] {
+			t.Errorf("expected %+v, got %+v", expected[l.Path], l)
+		}
+	}
+}
+
+func TestFlagOutliers(t *testing.T) {
+	latencies := []PathLatency{
+		{IOs: 10, Latency: 500 * time.Microsecond},
+		{IOs: 10, Latency: 1900 * time.Microsecond},
+	}
+	flagOutliers(latencies)
+	if latencies[1].Outlier {
+		t.Error("expected a path below the floor not to be an outlier")
+	}
+	latencies = []PathLatency{{IOs: 10, Latency: 50 * time.Millisecond}}
+	flagOutliers(latencies)
+	if latencies[0].Outlier {
+		t.Error("expected a single path not to be an outlier")
+	}
+}
+
+func TestSlowPathFailover(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	var commands []string
+	multipath.Command = func(args ...string) (string, error) {
+		commands = append(commands, strings.Join(args, " "))
+		return "ok\n", nil
+	}
+
+	fixture := func() *statSysfs {
+		fs := &statSysfs{fakeSysfs: newFakeSysfs(), stats: map[string][]string{
+			"/sys/block/sdb/stat": {"1000 0 8000 500 1000 0 8000 500 0 900 1000 0 0 0 0\n", "1100 0 8800 600 1100 0 8800 600 0 1000 1200 0 0 0 0\n"},
+			"/sys/block/sdc/stat": {"1000 0 8000 500 1000 0 8000 500 0 900 1000 0 0 0 0\n", "1100 0 8800 600 1100 0 8800 600 0 1000 1200 0 0 0 0\n"},
+			"/sys/block/sdd/stat": {"1000 0 8000 500 1000 0 8000 500 0 900 1000 0 0 0 0\n", "1100 0 8800 3000 1100 0 8800 3000 0 1000 1200 0 0 0 0\n"},
+		}}
+		fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+		for _, dev := range []string{"sdb", "sdc", "sdd"} {
+			fs.links["/sys/block/dm-0/slaves/"+dev] = "../../" + dev
+		}
+		fs.files["/run/multipathd.pid"] = "1234\n"
+		return fs
+	}
+
+	latencies, err := SamplePathLatency("/dev/mapper/mpatha", time.Millisecond, fixture())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commands) != 0 || latencies[2].FailedOver {
+		t.Errorf("expected no failover without the option, got %q", commands)
+	}
+
+	var events []recordedEvent
+	latencies, err = SamplePathLatency("/dev/mapper/mpatha", time.Millisecond, fixture(), WithSlowPathFailover(), WithEvents(recordEvents(&events)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commands) != 1 || commands[0] != "set marginal path sdd" {
+		t.Errorf("expected sdd to be marked marginal, got %q", commands)
+	}
+	if latencies[0].FailedOver || latencies[1].FailedOver || !latencies[2].FailedOver {
+		t.Errorf("unexpected latencies %+v", latencies)
+	}
+	if len(events) != 1 || events[0].reason != ReasonSlowPathFailed {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	// the health check reports the slow path without changing it
+	commands = nil
+	condition, err := GetVolumeCondition("/dev/mapper/mpatha", fixture(), WithPathLatencyCheck(time.Millisecond), WithSlowPathFailover())
+	if err != nil || condition.Reason != ConditionSlowPath || !strings.Contains(condition.Message, "sdd") {
+		t.Errorf("expected sdd to be reported slow, got %+v %v", condition, err)
+	}
+	if len(commands) != 0 {
+		t.Errorf("expected GetVolumeCondition to change nothing, got %q", commands)
+	}
+
+	// without a healthy path serving I/O nothing is failed
+	commands = nil
+	latencies = []PathLatency{{Path: "/dev/sdb", IOs: 10, Latency: 50 * time.Millisecond, Outlier: true}, {Path: "/dev/sdc"}}
+	newOptions([]Option{WithSlowPathFailover()}).failOutliers(latencies, fixture())
+	if len(commands) != 0 || latencies[0].FailedOver {
+		t.Errorf("expected the only path with I/O to be kept, got %q", commands)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"sync"
+)
+
+//Load is what a Client is doing at one moment: the volume operations running, per kind, and
+//Waiting, those queued behind an operation on the same volume. Drivers use it for backpressure,
+//e.g. answering new CSI calls with RESOURCE_EXHAUSTED while too many are queued rather than
+//letting them time out. AttachMulti counts once per volume.
+type Load struct {
+	Attaches   int
+	Detaches   int
+	Prefetches int
+	Waiting    int
+}
+
+// Running returns the number of operations running
+func (l Load) Running() int {
+	return l.Attaches + l.Detaches + l.Prefetches
+}
+
+// loadCounter keeps the Load of a Client
+type loadCounter struct {
+	mu   sync.Mutex
+	load Load
+}
+
+func (lc *loadCounter) get() Load {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return lc.load
+}
+
+// add adds n operations of kind operation to the running ones and removes them from the waiting
+// ones, negative n removes running operations
+func (lc *loadCounter) add(operation string, n int, waiting int) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	switch operation {
+	case "attach":
+		lc.load.Attaches += n
+	case "detach":
+		lc.load.Detaches += n
+	case "prefetch":
+		lc.load.Prefetches += n
+	}
+	lc.load.Waiting += waiting
+}
+
+// Load returns the operations of the Client running and waiting right now
+func (cl *Client) Load() Load {
+	return cl.load.get()
+}
+
+// enter counts n operations of kind operation as waiting while lock takes their volume locks,
+// then as running until the returned function, which releases the locks, is called
+func (cl *Client) enter(operation string, n int, lock func() func()) func() {
+	cl.load.add(operation, 0, n)
+	unlock := lock()
+	cl.load.add(operation, n, -n)
+	return func() {
+		cl.load.add(operation, -n, 0)
+		unlock()
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPathStates(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.files["/sys/block/sdb/device/state"] = "running\n"
+	fs.files["/sys/block/sdc/device/state"] = "transport-offline\n"
+
+	expected := map[string]string{"sdb": "running", "sdc": "transport-offline"}
+	if states := pathStates("/dev/dm-0", fs); !reflect.DeepEqual(states, expected) {
+		t.Errorf("expected %v, got %v", expected, states)
+	}
+}
+
+func TestDiffPathStates(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   map[string]string
+		after    map[string]string
+		expected []PathEvent
+	}{
+		{
+			"unchanged",
+			map[string]string{"sdb": "running", "sdc": "offline"},
+			map[string]string{"sdb": "running", "sdc": "offline"},
+			nil,
+		},
+		{
+			"failed and reinstated",
+			map[string]string{"sdb": "running", "sdc": "offline"},
+			map[string]string{"sdb": "blocked", "sdc": "running"},
+			[]PathEvent{
+				{Map: "/dev/dm-0", Path: "sdb", State: "blocked", Failed: true},
+				{Map: "/dev/dm-0", Path: "sdc", State: "running"},
+			},
+		},
+		{
+			"removed and added",
+			map[string]string{"sdb": "running"},
+			map[string]string{"sdd": "running"},
+			[]PathEvent{
+				{Map: "/dev/dm-0", Path: "sdb", State: "removed", Failed: true},
+				{Map: "/dev/dm-0", Path: "sdd", State: "running"},
+			},
+		},
+	}
+	for _, test := range tests {
+		if events := diffPathStates("/dev/dm-0", test.before, test.after); !reflect.DeepEqual(events, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, events)
+		}
+	}
+}
+
+func TestMonitorMultipathStops(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := MonitorMultipath(ctx, "/dev/mapper/mpatha", time.Millisecond, fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cancel()
+	for range events {
+	}
+
+	if _, err := MonitorMultipath(context.Background(), "/dev/mapper/mpathb", time.Millisecond, fs); err == nil {
+		t.Error("expected an error for a missing map")
+	}
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := MonitorMultipath(context.Background(), "/dev/mapper/mpatha", interval, fs); err == nil {
+			t.Errorf("expected an error for interval %v", interval)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mount detects, creates and mounts the filesystems of block devices with the util-linux
+// and e2fsprogs/xfsprogs tools, following what Kubernetes' mount-utils does for CSI staging.
+package mount
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// Mounts is the file the mounted filesystems are read from
+const Mounts = "/proc/mounts"
+
+//Command runs the program name with args and returns its combined output. A program exiting
+//with a status other than 0 returns an *ExitError. Tests and deployments running the tools
+//differently, e.g. through nsenter, replace it.
+var Command = run
+
+//ExitError is a program that exited with a status other than 0
+type ExitError struct {
+	Name   string
+	Code   int
+	Output string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("fc: %s exited with status %d: %s", e.Name, e.Code, strings.TrimSpace(e.Output))
+}
+
+func run(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), &ExitError{Name: name, Code: exitErr.ExitCode(), Output: string(out)}
+	}
+	return string(out), err
+}
+
+// FilesystemType returns the type of the filesystem on device as blkid probes it, e.g. ext4 or
+// xfs, or "" if device is empty. A device with a partition table but no filesystem fails, it
+// holds data that formatting would destroy.
+func FilesystemType(device string) (string, error) {
+	out, err := Command("blkid", "-p", "-s", "TYPE", "-s", "PTTYPE", "-o", "export", device)
+	if exitErr, ok := err.(*ExitError); ok && exitErr.Code == 2 {
+		// blkid found nothing to identify
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var fsType, ptType string
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "TYPE":
+			fsType = kv[1]
+		case "PTTYPE":
+			ptType = kv[1]
+		}
+	}
+	if fsType == "" && ptType != "" {
+		return "", fmt.Errorf("fc: %s has a %s partition table and no filesystem", device, ptType)
+	}
+	return fsType, nil
+}
+
+// Format creates a filesystem of type fsType on device with mkfs.<fsType>. ext filesystems are
+// created without blocks reserved for root, as mount-utils does.
+func Format(device, fsType string) error {
+	args := []string{device}
+	if strings.HasPrefix(fsType, "ext") {
+		args = []string{"-F", "-m0", device}
+	}
+	_, err := Command("mkfs."+fsType, args...)
+	return err
+}
+
+//CheckResult is the outcome of Check. Repaired reports that errors were found and corrected,
+//Skipped that the filesystem couldn't be checked before it is mounted, e.g. an xfs filesystem
+//whose log only the mount replays. Output is what the checking program printed.
+type CheckResult struct {
+	Program  string
+	Repaired bool
+	Skipped  bool
+	Output   string
+}
+
+// Check checks the filesystem of type fsType on device before it is mounted, as after an unclean
+// shutdown of the node: ext2, ext3 and ext4 with fsck -a, which repairs what can be repaired
+// safely, xfs with xfs_repair -n, which only reports. It fails on errors left uncorrected. Other
+// types, and checks that couldn't run, return a Skipped result.
+func Check(device, fsType string) (CheckResult, error) {
+	switch {
+	case strings.HasPrefix(fsType, "ext"):
+		return fsck(device)
+	case fsType == "xfs":
+		return xfsRepair(device)
+	}
+	return CheckResult{Skipped: true}, nil
+}
+
+// exit status bits of fsck, see fsck(8)
+const (
+	fsckCorrected         = 1
+	fsckRebootNeeded      = 2
+	fsckErrorsUncorrected = 4
+)
+
+func fsck(device string) (CheckResult, error) {
+	result := CheckResult{Program: "fsck"}
+	out, err := Command("fsck", "-a", device)
+	result.Output = out
+	exitErr, ok := err.(*ExitError)
+	switch {
+	case err == nil:
+		return result, nil
+	case !ok:
+		return result, err
+	case exitErr.Code&fsckErrorsUncorrected != 0:
+		return result, fmt.Errorf("fc: %s has filesystem errors fsck -a can't correct: %s", device, strings.TrimSpace(out))
+	case exitErr.Code&^(fsckCorrected|fsckRebootNeeded) == 0:
+		result.Repaired = true
+		return result, nil
+	}
+	// fsck failed to run, e.g. the filesystem is in use
+	result.Skipped = true
+	return result, nil
+}
+
+// exit status of xfs_repair -n
+const (
+	xfsCorrupted = 1
+	xfsDirtyLog  = 2
+)
+
+func xfsRepair(device string) (CheckResult, error) {
+	result := CheckResult{Program: "xfs_repair"}
+	out, err := Command("xfs_repair", "-n", device)
+	result.Output = out
+	exitErr, ok := err.(*ExitError)
+	switch {
+	case err == nil:
+		return result, nil
+	case ok && exitErr.Code == xfsCorrupted:
+		return result, fmt.Errorf("fc: %s has filesystem errors, repair them with xfs_repair: %s", device, strings.TrimSpace(out))
+	case ok && exitErr.Code == xfsDirtyLog:
+		// the mount replays the log, xfs_repair can't check before that
+		result.Skipped = true
+		return result, nil
+	}
+	return result, err
+}
+
+// Mount mounts the filesystem of type fsType on device at target with options
+func Mount(device, target, fsType string, options []string) error {
+	args := []string{"-t", fsType}
+	if len(options) > 0 {
+		args = append(args, "-o", strings.Join(options, ","))
+	}
+	_, err := Command("mount", append(args, device, target)...)
+	return err
+}
+
+// MountedAt returns the device mounted at target, the last one if several are stacked, and false
+// if nothing is mounted there
+func MountedAt(target string, io sysfs.IO) (string, bool) {
+	data, err := io.ReadFile(Mounts)
+	if err != nil {
+		return "", false
+	}
+	device, found := "", false
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if unescape(fields[1]) == target {
+			device, found = unescape(fields[0]), true
+		}
+	}
+	return device, found
+}
+
+// Sources returns the devices of every mount, as /proc/mounts names them
+func Sources(io sysfs.IO) []string {
+	data, err := io.ReadFile(Mounts)
+	if err != nil {
+		return nil
+	}
+	var sources []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			sources = append(sources, unescape(fields[0]))
+		}
+	}
+	return sources
+}
+
+// unescape undoes the octal escapes of white space and backslashes in /proc/mounts
+func unescape(field string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(field)
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mountsFile serves /proc/mounts
+type mountsFile string
+
+func (m mountsFile) ReadDir(dirname string) ([]os.FileInfo, error) { return nil, os.ErrNotExist }
+func (m mountsFile) Lstat(name string) (os.FileInfo, error)        { return nil, os.ErrNotExist }
+func (m mountsFile) EvalSymlinks(p string) (string, error)         { return path.Clean(p), nil }
+func (m mountsFile) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	return os.ErrPermission
+}
+func (m mountsFile) Remove(name string) error             { return os.ErrPermission }
+func (m mountsFile) Rename(oldpath, newpath string) error { return os.ErrPermission }
+func (m mountsFile) ReadFile(filename string) ([]byte, error) {
+	if filename != Mounts {
+		return nil, os.ErrNotExist
+	}
+	return []byte(m), nil
+}
+
+func TestMountedAt(t *testing.T) {
+	mounts := mountsFile(`sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+/dev/mapper/mpatha /var/lib/kubelet/plugins/kubernetes.io/csi/fc/pv\0401/globalmount ext4 rw,relatime 0 0
+/dev/sdb /mnt/stacked xfs rw 0 0
+/dev/sdc /mnt/stacked xfs rw 0 0
+`)
+	if device, ok := MountedAt("/var/lib/kubelet/plugins/kubernetes.io/csi/fc/pv 1/globalmount", mounts); !ok || device != "/dev/mapper/mpatha" {
+		t.Errorf("expected /dev/mapper/mpatha, got %q %v", device, ok)
+	}
+	if device, ok := MountedAt("/mnt/stacked", mounts); !ok || device != "/dev/sdc" {
+		t.Errorf("expected the last mount /dev/sdc, got %q %v", device, ok)
+	}
+	if _, ok := MountedAt("/mnt", mounts); ok {
+		t.Error("expected nothing to be mounted at /mnt")
+	}
+}
+
+func TestFilesystemType(t *testing.T) {
+	defer func(command func(string, ...string) (string, error)) { Command = command }(Command)
+	var calls []string
+	replies := map[string]struct {
+		out string
+		err error
+	}{
+		"/dev/sdb": {"DEVNAME=/dev/sdb\nTYPE=xfs\n", nil},
+		"/dev/sdc": {"", &ExitError{Name: "blkid", Code: 2}},
+		"/dev/sdd": {"DEVNAME=/dev/sdd\nPTTYPE=gpt\n", nil},
+		"/dev/sde": {"", &ExitError{Name: "blkid", Code: 4, Output: "blkid: error: /dev/sde: No such device"}},
+	}
+	Command = func(name string, args ...string) (string, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		reply := replies[args[len(args)-1]]
+		return reply.out, reply.err
+	}
+
+	if fsType, err := FilesystemType("/dev/sdb"); err != nil || fsType != "xfs" {
+		t.Errorf("expected xfs, got %q %v", fsType, err)
+	}
+	if calls[0] != "blkid -p -s TYPE -s PTTYPE -o export /dev/sdb" {
+		t.Errorf("unexpected command %q", calls[0])
+	}
+	if fsType, err := FilesystemType("/dev/sdc"); err != nil || fsType != "" {
+		t.Errorf("expected an empty device, got %q %v", fsType, err)
+	}
+	if _, err := FilesystemType("/dev/sdd"); err == nil || !strings.Contains(err.Error(), "gpt partition table") {
+		t.Errorf("expected a partitioned device to fail, got %v", err)
+	}
+	if _, err := FilesystemType("/dev/sde"); err == nil {
+		t.Error("expected blkid failing to fail")
+	}
+}
+
+func TestFormatAndMount(t *testing.T) {
+	defer func(command func(string, ...string) (string, error)) { Command = command }(Command)
+	var calls [][]string
+	Command = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "", nil
+	}
+	Format("/dev/dm-0", "ext4")
+	Format("/dev/dm-0", "xfs")
+	Mount("/dev/dm-0", "/staging", "xfs", []string{"noatime", "nouuid"})
+	Mount("/dev/dm-0", "/staging", "ext4", nil)
+	expected := [][]string{
+		{"mkfs.ext4", "-F", "-m0", "/dev/dm-0"},
+		{"mkfs.xfs", "/dev/dm-0"},
+		{"mount", "-t", "xfs", "-o", "noatime,nouuid", "/dev/dm-0", "/staging"},
+		{"mount", "-t", "ext4", "/dev/dm-0", "/staging"},
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %q, got %q", expected, calls)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	defer func(command func(string, ...string) (string, error)) { Command = command }(Command)
+	tests := []struct {
+		fsType   string
+		code     int
+		program  string
+		repaired bool
+		skipped  bool
+		fails    bool
+	}{
+		{"ext4", 0, "fsck", false, false, false},
+		{"ext4", 1, "fsck", true, false, false},
+		{"ext3", 3, "fsck", true, false, false},
+		{"ext4", 4, "fsck", false, false, true},
+		{"ext4", 8, "fsck", false, true, false},
+		{"xfs", 0, "xfs_repair", false, false, false},
+		{"xfs", 1, "xfs_repair", false, false, true},
+		{"xfs", 2, "xfs_repair", false, true, false},
+		{"btrfs", 0, "", false, true, false},
+	}
+	for _, test := range tests {
+		var calls []string
+		Command = func(name string, args ...string) (string, error) {
+			calls = append(calls, name+" "+strings.Join(args, " "))
+			if test.code != 0 {
+				return "output\n", &ExitError{Name: name, Code: test.code, Output: "output\n"}
+			}
+			return "output\n", nil
+		}
+		result, err := Check("/dev/dm-0", test.fsType)
+		if (err != nil) != test.fails || result.Program != test.program || result.Repaired != test.repaired || result.Skipped != test.skipped {
+			t.Errorf("%s exiting with %d: unexpected result %+v %v", test.fsType, test.code, result, err)
+		}
+		if test.program == "fsck" && calls[0] != "fsck -a /dev/dm-0" || test.program == "xfs_repair" && calls[0] != "xfs_repair -n /dev/dm-0" {
+			t.Errorf("unexpected command %q", calls)
+		}
+	}
+}
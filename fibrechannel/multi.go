@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+)
+
+//AttachResult is the outcome of attaching one volume of AttachMulti
+type AttachResult struct {
+	VolumeName string
+	DevicePath string
+	Err        error
+}
+
+// AttachMulti attaches the volumes of cs, typically several LUNs of the same target published for
+// one pod, with a single rescan instead of one per volume. The volumes are then resolved one by
+// one as Attach does, without further rescans. The results are in the order of cs, the returned
+// error lists the volumes that failed.
+func AttachMulti(cs []Connector, io ioHandler, opts ...Option) (results []AttachResult, err error) {
+	defer recoverPanic("AttachMulti", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	return attachMulti(cs, io, func() *options { return newOptions(opts) })
+}
+
+// attachMulti attaches cs with options from newOpts, one set per volume
+func attachMulti(cs []Connector, io ioHandler, newOpts func() *options) ([]AttachResult, error) {
+	results := make([]AttachResult, len(cs))
+	o := newOpts()
+	failAll := func(err error) ([]AttachResult, error) {
+		for i, c := range cs {
+			results[i] = AttachResult{VolumeName: c.VolumeName, Err: err}
+		}
+		return results, err
+	}
+	if err := o.checkFCHosts(io); err != nil {
+		return failAll(err)
+	}
+
+	// volumes whose multipath map is in place don't need the rescan
+	var missing []Connector
+	for _, c := range cs {
+		if c.Validate() == nil && !hasMultipath(findCandidates(c, io)) {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 && o.maxRescans > 0 {
+		glog.Infof("fc: rescanning once for %d of %d volumes", len(missing), len(cs))
+		o.rescanAll(missing, io)
+		if err := poll.Sleep(o.ctx, o.clock, o.pollInterval); err != nil {
+			return failAll(err)
+		}
+	}
+
+	for i, c := range cs {
+		oc := newOpts()
+		oc.maxRescans = 0
+		devicePath, err := attach(c, io, oc)
+		results[i] = AttachResult{VolumeName: c.VolumeName, DevicePath: devicePath, Err: err}
+	}
+	return results, attachMultiErr(results)
+}
+
+// attachMultiErr returns an error listing the failed volumes of results, nil if none failed
+func attachMultiErr(results []AttachResult) error {
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", r.VolumeName, r.Err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("fc: failed to attach %d of %d volumes: %s", len(failed), len(results), strings.Join(failed, "; "))
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// scanAddsSysfs makes its pending links appear with the first rescan
+type scanAddsSysfs struct {
+	*scanCountingSysfs
+	pending map[string]string
+}
+
+func (fs *scanAddsSysfs) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	if strings.HasSuffix(filename, "/scan") {
+		for link, target := range fs.pending {
+			fs.links[link] = target
+		}
+	}
+	return fs.scanCountingSysfs.WriteFile(filename, data, perm)
+}
+
+func TestAttachMulti(t *testing.T) {
+	fs := &scanAddsSysfs{
+		scanCountingSysfs: &scanCountingSysfs{fakeSysfs: newFakeSysfs()},
+		pending: map[string]string{
+			"/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1": "/dev/sdb",
+			"/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-2": "/dev/sdc",
+		},
+	}
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	for _, dev := range []string{"sdb", "sdc"} {
+		fs.files["/dev/"+dev] = ""
+		fs.files["/sys/block/"+dev+"/size"] = "2097152"
+	}
+	cs := []Connector{
+		{VolumeName: "vol1", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"},
+		{VolumeName: "vol2", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "2"},
+		{VolumeName: "vol3", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "3"},
+	}
+
+	results, err := NewClient(fs).AttachMulti(cs)
+	if err == nil || !strings.Contains(err.Error(), "vol3") {
+		t.Errorf("expected vol3 to fail, got %v", err)
+	}
+	if len(results) != 3 || results[0].DevicePath != "/dev/sdb" || results[1].DevicePath != "/dev/sdc" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if !errors.Is(results[2].Err, ErrDiskNotFound) {
+		t.Errorf("expected ErrDiskNotFound for vol3, got %v", results[2].Err)
+	}
+	if fs.scans != 1 {
+		t.Errorf("expected a single rescan for all volumes, got %d", fs.scans)
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CreateMap creates a dm-multipath map named name with dm uuid uuid, sectors long, over the block
+// devices given by their MAJ:MIN numbers, and returns its /dev/dm-N path. It talks to
+// device-mapper directly and is meant for nodes without multipathd. Such a map has no path
+// checker: a failed path is not reinstated when it comes back, all paths form a single round-robin
+// group regardless of ALUA state and paths added later are not picked up. Tests replace it.
+var CreateMap = createMap
+
+// RemoveMap removes the map name through device-mapper directly. It fails with EBUSY while the map
+// is open. Tests replace it.
+var RemoveMap = removeMap
+
+// OpenCount returns how many times the map name is open, by mounts, holders or processes, as
+// dmsetup info reports it. Tests replace it.
+var OpenCount = openCount
+
+// Table returns the parameters of a multipath target with all devices (MAJ:MIN) in one
+// round-robin path group, switching paths every 1000 I/Os
+func Table(devices []string) string {
+	params := []string{"0", "0", "1", "1", "round-robin", "0", fmt.Sprint(len(devices)), "1"}
+	for _, dev := range devices {
+		params = append(params, dev, "1000")
+	}
+	return strings.Join(params, " ")
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const dmControl = "/dev/mapper/control"
+
+// device-mapper ioctl commands, see linux/dm-ioctl.h
+const (
+	dmDevCreate  = 3
+	dmDevRemove  = 4
+	dmDevSuspend = 6
+	dmDevStatus  = 7
+	dmTableLoad  = 9
+	dmTargetMsg  = 14
+)
+
+// flags of struct dm_ioctl
+const (
+	dmBufferFullFlag = 1 << 8
+	dmDataOutFlag    = 1 << 16
+)
+
+// messageReplySize bounds the reply of a target message, enough for the counters of a few hundred
+// dm-stats areas
+const messageReplySize = 64 << 10
+
+// dmIoctl is struct dm_ioctl, the header of every device-mapper ioctl
+type dmIoctl struct {
+	Version     [3]uint32
+	DataSize    uint32
+	DataStart   uint32
+	TargetCount uint32
+	OpenCount   int32
+	Flags       uint32
+	EventNr     uint32
+	Padding     uint32
+	Dev         uint64
+	Name        [128]byte
+	UUID        [129]byte
+	Data        [7]byte
+}
+
+// dmTargetSpec is struct dm_target_spec, followed by the target's parameters
+type dmTargetSpec struct {
+	SectorStart uint64
+	Length      uint64
+	Status      int32
+	Next        uint32
+	TargetType  [16]byte
+}
+
+func createMap(name, uuid string, sectors int64, devices []string) (string, error) {
+	control, err := os.OpenFile(dmControl, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer control.Close()
+
+	hdr, err := dmCall(control, dmDevCreate, name, uuid, nil)
+	if err != nil {
+		return "", fmt.Errorf("fc: unable to create map %s: %v", name, err)
+	}
+	dev := hdr.Dev
+
+	spec := dmTargetSpec{Length: uint64(sectors)}
+	copy(spec.TargetType[:], "multipath")
+	params := append([]byte(Table(devices)), 0)
+	payload := make([]byte, unsafe.Sizeof(spec)+uintptr(len(params)))
+	*(*dmTargetSpec)(unsafe.Pointer(&payload[0])) = spec
+	copy(payload[unsafe.Sizeof(spec):], params)
+
+	if _, err := dmCall(control, dmTableLoad, name, "", payload); err != nil {
+		dmCall(control, dmDevRemove, name, "", nil)
+		return "", fmt.Errorf("fc: unable to load the table of map %s: %v", name, err)
+	}
+	// DM_DEV_SUSPEND without DM_SUSPEND_FLAG resumes the map, activating the loaded table
+	if _, err := dmCall(control, dmDevSuspend, name, "", nil); err != nil {
+		dmCall(control, dmDevRemove, name, "", nil)
+		return "", fmt.Errorf("fc: unable to activate map %s: %v", name, err)
+	}
+	// new_decode_dev of the kernel
+	minor := (dev & 0xff) | ((dev >> 12) & 0xfff00)
+	return fmt.Sprintf("/dev/dm-%d", minor), nil
+}
+
+func removeMap(name string) error {
+	control, err := os.OpenFile(dmControl, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer control.Close()
+
+	if _, err := dmCall(control, dmDevRemove, name, "", nil); err != nil {
+		return fmt.Errorf("fc: unable to remove map %s: %v", name, err)
+	}
+	return nil
+}
+
+func openCount(name string) (int, error) {
+	control, err := os.OpenFile(dmControl, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer control.Close()
+
+	hdr, err := dmCall(control, dmDevStatus, name, "", nil)
+	if err != nil {
+		return 0, fmt.Errorf("fc: unable to read the status of map %s: %v", name, err)
+	}
+	return int(hdr.OpenCount), nil
+}
+
+func message(name, msg string) (string, error) {
+	control, err := os.OpenFile(dmControl, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer control.Close()
+
+	// struct dm_target_msg, the sector the message is for, then the message. The kernel writes
+	// the reply over it.
+	payload := make([]byte, 8+len(msg)+1+messageReplySize)
+	copy(payload[8:], msg)
+	hdr, err := dmCall(control, dmTargetMsg, name, "", payload)
+	if err != nil {
+		return "", fmt.Errorf("fc: map %s rejected message %q: %v", name, msg, err)
+	}
+	if hdr.Flags&dmBufferFullFlag != 0 {
+		return "", fmt.Errorf("fc: reply of map %s to %q exceeds %d bytes", name, msg, messageReplySize)
+	}
+	if hdr.Flags&dmDataOutFlag == 0 || hdr.DataSize <= hdr.DataStart {
+		return "", nil
+	}
+	reply := (*[1 << 30]byte)(unsafe.Pointer(hdr))[hdr.DataStart:hdr.DataSize]
+	return strings.TrimRight(string(reply), "\x00"), nil
+}
+
+// dmCall issues the device-mapper ioctl cmd for the map name with payload after the header and
+// returns the header the kernel wrote back
+func dmCall(control *os.File, cmd uintptr, name, uuid string, payload []byte) (*dmIoctl, error) {
+	size := unsafe.Sizeof(dmIoctl{})
+	// payloads are 8 byte aligned
+	total := (size + uintptr(len(payload)) + 7) &^ 7
+	buf := make([]byte, total)
+	hdr := (*dmIoctl)(unsafe.Pointer(&buf[0]))
+	hdr.Version = [3]uint32{4, 0, 0}
+	hdr.DataSize = uint32(total)
+	hdr.DataStart = uint32(size)
+	if payload != nil {
+		hdr.TargetCount = 1
+	}
+	copy(hdr.Name[:len(hdr.Name)-1], name)
+	copy(hdr.UUID[:len(hdr.UUID)-1], uuid)
+	copy(buf[size:], payload)
+
+	// _IOWR(DM_IOCTL, cmd, struct dm_ioctl)
+	request := uintptr(3)<<30 | size<<16 | 0xfd<<8 | cmd
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, control.Fd(), request, uintptr(unsafe.Pointer(&buf[0]))); errno != 0 {
+		return nil, errno
+	}
+	return hdr, nil
+}
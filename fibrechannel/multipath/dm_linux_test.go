@@ -0,0 +1,32 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestDMIoctlLayout(t *testing.T) {
+	// sizeof(struct dm_ioctl) and sizeof(struct dm_target_spec) of linux/dm-ioctl.h
+	if size := unsafe.Sizeof(dmIoctl{}); size != 312 {
+		t.Errorf("expected dm_ioctl to be 312 bytes, got %d", size)
+	}
+	if size := unsafe.Sizeof(dmTargetSpec{}); size != 40 {
+		t.Errorf("expected dm_target_spec to be 40 bytes, got %d", size)
+	}
+}
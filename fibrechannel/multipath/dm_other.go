@@ -0,0 +1,40 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"fmt"
+)
+
+func createMap(name, uuid string, sectors int64, devices []string) (string, error) {
+	return "", fmt.Errorf("fc: creating multipath maps is only supported on linux")
+}
+
+func removeMap(name string) error {
+	return fmt.Errorf("fc: removing multipath maps is only supported on linux")
+}
+
+func openCount(name string) (int, error) {
+	return 0, fmt.Errorf("fc: reading the status of maps is only supported on linux")
+}
+
+func message(name, msg string) (string, error) {
+	return "", fmt.Errorf("fc: device-mapper messages are only supported on linux")
+}
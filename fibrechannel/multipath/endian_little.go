@@ -0,0 +1,25 @@
+//go:build 386 || amd64 || amd64p32 || arm || arm64 || loong64 || mips64le || mipsle || ppc64le || riscv64 || wasm
+// +build 386 amd64 amd64p32 arm arm64 loong64 mips64le mipsle ppc64le riscv64 wasm
+
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import "encoding/binary"
+
+// nativeEndian is the byte order of this host, multipathd frames the commands and answers on its socket with their sizes in it
+var nativeEndian = binary.LittleEndian
@@ -0,0 +1,194 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package multipath resolves dm-multipath maps and their paths through sysfs and talks to multipathd.
+package multipath
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+const (
+	//UUIDPrefix starts the dm uuid of every map multipathd creates, "mpath-<wwid>"
+	UUIDPrefix = "mpath-"
+	//ConfDir is the directory multipathd reads configuration drop-ins from
+	ConfDir = "/etc/multipath/conf.d/"
+)
+
+//Command sends multipathd the command args over its socket, or runs the multipathd binary with
+//args when it listens on none, and returns the reply. Tests and deployments that reach multipathd
+//differently replace it.
+var Command = run
+
+// IsMap reports whether the dm device (e.g. dm-3) is a dm-multipath map. Devices stacked on our
+// disks by LVM ("LVM-"), dm-crypt ("CRYPT-") or anything else must never be treated as the
+// volume's multipath parent. If the uuid can't be read we can't tell either way and keep the device.
+func IsMap(dm string, io sysfs.IO) bool {
+	data, err := sysfs.ReadFileRetry(sysfs.DefaultLayout.Block(dm, "dm/uuid"), io)
+	if err != nil {
+		return true
+	}
+	uuid := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(uuid, UUIDPrefix) {
+		glog.Infof("fc: ignoring %s, uuid %q is not a multipath map", dm, uuid)
+		return false
+	}
+	return true
+}
+
+// FindParent given a device name like /dev/sdx, find the devicemapper parent
+func FindParent(device string, io sysfs.IO) (string, error) {
+	disk, err := deviceName(device, io)
+	if err != nil {
+		return "", err
+	}
+	if dirs, err2 := io.ReadDir(sysfs.DefaultLayout.Blocks()); err2 == nil {
+		for _, f := range dirs {
+			name := f.Name()
+			if strings.HasPrefix(name, "dm-") {
+				if _, err1 := io.Lstat(path.Join(sysfs.DefaultLayout.BlockSlaves(name), disk)); err1 == nil {
+					if !IsMap(name, io) {
+						continue
+					}
+					return "/dev/" + name, nil
+				}
+			}
+		}
+	} else {
+		return "", err2
+	}
+
+	return "", nil
+}
+
+// Slaves returns all slaves on the multipath device given the device path
+func Slaves(dm string, io sysfs.IO) []string {
+	var devices []string
+	// Split path /dev/dm-1 into "", "dev", "dm-1"
+	parts := strings.Split(dm, "/")
+	if len(parts) != 3 || !strings.HasPrefix(parts[1], "dev") {
+		return devices
+	}
+	disk := parts[2]
+	if files, err := io.ReadDir(sysfs.DefaultLayout.BlockSlaves(disk)); err == nil {
+		for _, f := range files {
+			devices = append(devices, path.Join("/dev/", f.Name()))
+		}
+	}
+	return devices
+}
+
+// deviceName Find the underlaying disk for a linked path such as /dev/disk/by-path/XXXX or /dev/mapper/XXXX
+// will return sdX or hdX etc, if /dev/sdX is passed in then sdX will be returned
+func deviceName(path string, io sysfs.IO) (string, error) {
+	devicePath, err := io.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	// if path /dev/hdX split into "", "dev", "hdX" then we will
+	// return just the last part
+	parts := strings.Split(devicePath, "/")
+	if len(parts) == 3 && strings.HasPrefix(parts[1], "dev") {
+		return parts[2], nil
+	}
+	return "", errors.New("Illegal path for device " + devicePath)
+}
+
+// Reconfigure makes multipathd reread its configuration and checks that it accepted it
+func Reconfigure() error {
+	return runOK("reconfigure")
+}
+
+// WriteDropIn writes content to ConfDir/<name>.conf and reconfigures multipathd. If multipathd
+// doesn't take the new configuration the previous content is restored, or the drop-in removed if
+// there was none, and multipathd reconfigured again, so the node's multipath state keeps matching
+// what is on disk. name must not contain "/" or "..".
+func WriteDropIn(name string, content []byte, io sysfs.IO) error {
+	file, err := dropInFile(name)
+	if err != nil {
+		return err
+	}
+	previous, err := io.ReadFile(file)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("fc: can't read %s to roll back to: %v", file, err)
+	}
+	if err := io.WriteFile(file, content, 0644); err != nil {
+		return err
+	}
+	if err := Reconfigure(); err != nil {
+		return rollbackDropIn(file, previous, existed, err, io)
+	}
+	return nil
+}
+
+// RemoveDropIn removes ConfDir/<name>.conf and reconfigures multipathd, rolling back like
+// WriteDropIn when multipathd doesn't take the configuration without it. A drop-in that doesn't
+// exist is already removed.
+func RemoveDropIn(name string, io sysfs.IO) error {
+	file, err := dropInFile(name)
+	if err != nil {
+		return err
+	}
+	previous, err := io.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fc: can't read %s to roll back to: %v", file, err)
+	}
+	if err := io.Remove(file); err != nil {
+		return err
+	}
+	if err := Reconfigure(); err != nil {
+		return rollbackDropIn(file, previous, true, err, io)
+	}
+	return nil
+}
+
+// dropInFile returns the drop-in file of name, refusing names that would leave ConfDir
+func dropInFile(name string) (string, error) {
+	if name == "" || strings.Contains(name, "/") || strings.Contains(name, "..") {
+		return "", fmt.Errorf("fc: invalid multipath drop-in name %q", name)
+	}
+	return path.Join(ConfDir, name+".conf"), nil
+}
+
+// rollbackDropIn puts file back as it was before the change multipathd refused with err, previous
+// being its content if it existed, and reconfigures multipathd again
+func rollbackDropIn(file string, previous []byte, existed bool, err error, io sysfs.IO) error {
+	glog.Warningf("fc: rolling back %s: %v", file, err)
+	var rerr error
+	if existed {
+		rerr = io.WriteFile(file, previous, 0644)
+	} else {
+		rerr = io.Remove(file)
+	}
+	if rerr != nil {
+		return fmt.Errorf("%v, rollback of %s failed: %v", err, file, rerr)
+	}
+	if rerr := Reconfigure(); rerr != nil {
+		return fmt.Errorf("%v, reconfigure after rollback of %s failed: %v", err, file, rerr)
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// confFiles is an in-memory /etc holding regular files only
+type confFiles map[string]string
+
+func (f confFiles) ReadDir(dirname string) ([]os.FileInfo, error) { return nil, os.ErrNotExist }
+func (f confFiles) Lstat(name string) (os.FileInfo, error)        { return nil, os.ErrNotExist }
+func (f confFiles) EvalSymlinks(p string) (string, error)         { return p, nil }
+func (f confFiles) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	f[filename] = string(data)
+	return nil
+}
+func (f confFiles) ReadFile(filename string) ([]byte, error) {
+	data, ok := f[filename]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: os.ErrNotExist}
+	}
+	return []byte(data), nil
+}
+func (f confFiles) Rename(oldpath, newpath string) error { return os.ErrPermission }
+func (f confFiles) Remove(name string) error {
+	if _, ok := f[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(f, name)
+	return nil
+}
+
+// reconfigures makes multipathd refuse the reconfigures listed in refused, counting from 1, and
+// returns the number of reconfigures so far
+func reconfigures(refused ...int) func() int {
+	calls := 0
+	Command = func(args ...string) (string, error) {
+		calls++
+		for _, n := range refused {
+			if calls == n {
+				return "fail\n", errors.New("exit status 1")
+			}
+		}
+		return "ok\n", nil
+	}
+	return func() int { return calls }
+}
+
+func TestWriteDropIn(t *testing.T) {
+	defer func(command func(...string) (string, error)) { Command = command }(Command)
+	const file = "/etc/multipath/conf.d/pv1.conf"
+
+	calls := reconfigures()
+	fs := confFiles{}
+	if err := WriteDropIn("pv1", []byte("multipaths {}\n"), fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fs[file] != "multipaths {}\n" || calls() != 1 {
+		t.Errorf("unexpected files %v after %d reconfigures", fs, calls())
+	}
+
+	// multipathd refuses the new configuration, the old one is put back
+	calls = reconfigures(1)
+	if err := WriteDropIn("pv1", []byte("bogus"), fs); err == nil {
+		t.Error("expected the failed reconfigure to be reported")
+	}
+	if fs[file] != "multipaths {}\n" || calls() != 2 {
+		t.Errorf("expected the drop-in to be rolled back, got %v after %d reconfigures", fs, calls())
+	}
+
+	// a refused new drop-in is removed again
+	calls = reconfigures(1)
+	if err := WriteDropIn("pv2", []byte("bogus"), fs); err == nil {
+		t.Error("expected the failed reconfigure to be reported")
+	}
+	if _, ok := fs["/etc/multipath/conf.d/pv2.conf"]; ok || calls() != 2 {
+		t.Errorf("expected the new drop-in to be removed, got %v after %d reconfigures", fs, calls())
+	}
+
+	for _, name := range []string{"", "../multipath", "a/b", "..", "pv..1"} {
+		if err := WriteDropIn(name, []byte("bogus"), fs); err == nil {
+			t.Errorf("expected %q to be refused", name)
+		}
+	}
+	if len(fs) != 1 {
+		t.Errorf("expected no file to be written for invalid names, got %v", fs)
+	}
+}
+
+func TestRemoveDropIn(t *testing.T) {
+	defer func(command func(...string) (string, error)) { Command = command }(Command)
+	const file = "/etc/multipath/conf.d/pv1.conf"
+
+	// multipathd refuses the configuration without the drop-in, it is put back
+	calls := reconfigures(1)
+	fs := confFiles{file: "multipaths {}\n"}
+	if err := RemoveDropIn("pv1", fs); err == nil {
+		t.Error("expected the failed reconfigure to be reported")
+	}
+	if fs[file] != "multipaths {}\n" || calls() != 2 {
+		t.Errorf("expected the drop-in to be put back, got %v after %d reconfigures", fs, calls())
+	}
+
+	calls = reconfigures()
+	if err := RemoveDropIn("pv1", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fs) != 0 || calls() != 1 {
+		t.Errorf("expected the drop-in to be removed, got %v after %d reconfigures", fs, calls())
+	}
+
+	// removing it again changes nothing
+	if err := RemoveDropIn("pv1", fs); err != nil || calls() != 1 {
+		t.Errorf("expected a removed drop-in to stay removed, got %v after %d reconfigures", err, calls())
+	}
+}
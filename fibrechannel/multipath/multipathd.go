@@ -0,0 +1,278 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Sockets are the addresses multipathd takes commands on, tried in order before falling back to
+//the multipathd binary. multipathd listens on the abstract socket, some distributions configure a
+//socket file instead. A leading @ names an abstract socket.
+var Sockets = []string{"@/org/kernel/linux/storage/multipathd", "/run/multipathd.sock"}
+
+// socketTimeout bounds a command sent over the socket, reconfigure of a node with many maps can
+// take several seconds
+const socketTimeout = 30 * time.Second
+
+// maxReply guards against a corrupt length in multipathd's reply
+const maxReply = 64 << 20
+
+//MapStatus is multipathd's view of a map
+type MapStatus struct {
+	Name string
+	WWID string
+	// Device is the dm device of the map, e.g. dm-3
+	Device string
+	// State is the device-mapper state of the map, active or suspend
+	State string
+	Paths int
+}
+
+//PathStatus is multipathd's view of a path of a map
+type PathStatus struct {
+	// Device is the path's disk, e.g. sdb
+	Device string
+	// Map is the name of the map the path is in, empty for paths multipathd doesn't use
+	Map string
+	// DMState is the state device-mapper uses the path in, active or failed
+	DMState string
+	// CheckerState is what multipathd's path checker last found, e.g. ready or faulty
+	CheckerState string
+}
+
+// run sends a command to multipathd over the first socket it listens on, or runs the multipathd
+// binary when it listens on none
+func run(args ...string) (string, error) {
+	cmd := commandLine(args)
+	for _, addr := range Sockets {
+		conn, err := net.DialTimeout("unix", addr, socketTimeout)
+		if err != nil {
+			continue
+		}
+		out, err := exchange(conn, cmd)
+		conn.Close()
+		if err != nil {
+			return "", fmt.Errorf("fc: multipathd socket %s: %v", addr, err)
+		}
+		if strings.TrimSpace(out) == "fail" {
+			return out, errors.New("multipathd rejected the command")
+		}
+		return out, nil
+	}
+	out, err := exec.Command("multipathd", args...).CombinedOutput()
+	return string(out), err
+}
+
+// commandLine joins args the way the multipathd binary does, quoting those with spaces
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.Contains(arg, " ") {
+			arg = `"` + arg + `"`
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// exchange sends cmd and reads the reply. Both are prefixed with their length as a native size_t
+// and end with a NUL, like libmpathcmd frames them.
+func exchange(conn net.Conn, cmd string) (string, error) {
+	if err := conn.SetDeadline(time.Now().Add(socketTimeout)); err != nil {
+		return "", err
+	}
+	if err := writePacket(conn, append([]byte(cmd), 0)); err != nil {
+		return "", err
+	}
+	reply, err := readPacket(conn)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(reply), "\x00"), nil
+}
+
+func writePacket(w io.Writer, data []byte) error {
+	size := make([]byte, strconv.IntSize/8)
+	putSize(size, uint64(len(data)))
+	if _, err := w.Write(append(size, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+	size := make([]byte, strconv.IntSize/8)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return nil, err
+	}
+	n := getSize(size)
+	if n > maxReply {
+		return nil, fmt.Errorf("reply of %d bytes is too long", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func putSize(b []byte, n uint64) {
+	if len(b) == 8 {
+		nativeEndian.PutUint64(b, n)
+		return
+	}
+	nativeEndian.PutUint32(b, uint32(n))
+}
+
+func getSize(b []byte) uint64 {
+	if len(b) == 8 {
+		return nativeEndian.Uint64(b)
+	}
+	return uint64(nativeEndian.Uint32(b))
+}
+
+// runOK runs a command that multipathd answers with "ok" when it succeeded
+func runOK(args ...string) error {
+	out, err := Command(args...)
+	if err != nil {
+		return fmt.Errorf("fc: multipathd %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(out))
+	}
+	if strings.TrimSpace(out) != "ok" {
+		return fmt.Errorf("fc: multipathd %s failed: %s", strings.Join(args, " "), strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// AddPath makes multipathd take the disk (e.g. sdb) into its map, creating the map if needed
+func AddPath(dev string) error {
+	return runOK("add", "path", dev)
+}
+
+// RemovePath makes multipathd drop the disk (e.g. sdb) from its map, before the disk is deleted
+func RemovePath(dev string) error {
+	return runOK("remove", "path", dev)
+}
+
+// FailPath makes multipathd stop sending I/O to the disk (e.g. sdb). Its path checker reinstates
+// the path once the path passes a check again.
+func FailPath(dev string) error {
+	return runOK("fail", "path", dev)
+}
+
+// SetMarginal makes multipathd move the disk (e.g. sdb) into a path group of its own that only
+// gets I/O once no other path is left. Unlike FailPath its path checker doesn't undo it, the path
+// stays marginal until UnsetMarginal. It needs multipath-tools 0.8.4 or later.
+func SetMarginal(dev string) error {
+	return runOK("set", "marginal", "path", dev)
+}
+
+// UnsetMarginal returns the disk (e.g. sdb) SetMarginal set aside to its path group
+func UnsetMarginal(dev string) error {
+	return runOK("unset", "marginal", "path", dev)
+}
+
+// ReinstatePath makes multipathd send I/O to the disk (e.g. sdb) again
+func ReinstatePath(dev string) error {
+	return runOK("reinstate", "path", dev)
+}
+
+// ResizeMap makes multipathd grow the map (name or WWID) to the size of its paths, after each of
+// them was rescanned
+func ResizeMap(name string) error {
+	return runOK("resize", "map", name)
+}
+
+// FlushMap removes the map name once nothing holds it open. It asks multipathd, which would
+// otherwise recreate the map from its paths, and removes the map through device-mapper when
+// multipathd can't, e.g. for maps created without multipathd.
+func FlushMap(name string) error {
+	err := runOK("del", "map", name)
+	if err == nil {
+		return nil
+	}
+	if rerr := RemoveMap(name); rerr != nil {
+		return fmt.Errorf("%v, %v", err, rerr)
+	}
+	return nil
+}
+
+// Maps returns the maps multipathd manages
+func Maps() ([]MapStatus, error) {
+	out, err := Command("show", "maps", "raw", "format", "%n %w %d %t %N")
+	if err != nil {
+		return nil, fmt.Errorf("fc: multipathd show maps failed: %v: %s", err, strings.TrimSpace(out))
+	}
+	var maps []MapStatus
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			continue
+		}
+		paths, err := strconv.Atoi(fields[4])
+		if err != nil {
+			continue
+		}
+		maps = append(maps, MapStatus{Name: fields[0], WWID: fields[1], Device: fields[2], State: fields[3], Paths: paths})
+	}
+	return maps, nil
+}
+
+// ShowMap returns the map whose name, WWID or dm device (dm-3 or /dev/dm-3) is id, and false when
+// multipathd doesn't manage it
+func ShowMap(id string) (MapStatus, bool, error) {
+	maps, err := Maps()
+	if err != nil {
+		return MapStatus{}, false, err
+	}
+	id = strings.TrimPrefix(id, "/dev/")
+	for _, m := range maps {
+		if m.Name == id || m.WWID == id || m.Device == id {
+			return m, true, nil
+		}
+	}
+	return MapStatus{}, false, nil
+}
+
+// Paths returns the paths multipathd knows of, in maps or not
+func Paths() ([]PathStatus, error) {
+	out, err := Command("show", "paths", "raw", "format", "%d %m %t %T")
+	if err != nil {
+		return nil, fmt.Errorf("fc: multipathd show paths failed: %v: %s", err, strings.TrimSpace(out))
+	}
+	var paths []PathStatus
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		p := PathStatus{Device: fields[0], Map: fields[1], DMState: fields[2], CheckerState: fields[3]}
+		// multipathd prints [orphan] for a path in no map and undef for unknown states
+		if p.Map == "[orphan]" {
+			p.Map = ""
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
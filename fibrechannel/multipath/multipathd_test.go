@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serveMultipathd answers the commands sent to a socket in a temporary directory with replies and
+// points Sockets at it. It returns the commands received so far.
+func serveMultipathd(t *testing.T, replies map[string]string) func() []string {
+	var mu sync.Mutex
+	var commands []string
+	addr := filepath.Join(t.TempDir(), "multipathd.sock")
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	sockets := Sockets
+	t.Cleanup(func() { Sockets = sockets })
+	Sockets = []string{filepath.Join(t.TempDir(), "missing.sock"), addr}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			cmd, err := readPacket(conn)
+			if err == nil {
+				command := strings.TrimRight(string(cmd), "\x00")
+				mu.Lock()
+				commands = append(commands, command)
+				mu.Unlock()
+				reply, ok := replies[command]
+				if !ok {
+					reply = "fail\n"
+				}
+				writePacket(conn, append([]byte(reply), 0))
+			}
+			conn.Close()
+		}
+	}()
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), commands...)
+	}
+}
+
+func TestMultipathdSocket(t *testing.T) {
+	received := serveMultipathd(t, map[string]string{
+		"add path sdb":                          "ok\n",
+		"reconfigure":                           "ok\n",
+		`show maps raw format "%n %w %d %t %N"`: "mpatha 3600a098038303053 dm-2 active 2\nmpathb 3600a098038303054 dm-3 suspend 1\n",
+		`show paths raw format "%d %m %t %T"`:   "sdb mpatha active ready\nsdc [orphan] undef faulty\n",
+		"resize map 3600a098038303053":          "ok\n",
+		"remove path sdc":                       "ok\n",
+	})
+
+	if err := AddPath("sdb"); err != nil {
+		t.Errorf("unexpected error adding a path: %v", err)
+	}
+	if err := Reconfigure(); err != nil {
+		t.Errorf("unexpected error reconfiguring: %v", err)
+	}
+	if err := RemovePath("sdd"); err == nil {
+		t.Error("expected the rejected command to fail")
+	}
+	if err := ResizeMap("3600a098038303053"); err != nil {
+		t.Errorf("unexpected error resizing: %v", err)
+	}
+
+	m, ok, err := ShowMap("/dev/dm-3")
+	if err != nil || !ok {
+		t.Fatalf("expected map dm-3, got %v %v", ok, err)
+	}
+	if m != (MapStatus{Name: "mpathb", WWID: "3600a098038303054", Device: "dm-3", State: "suspend", Paths: 1}) {
+		t.Errorf("unexpected map %+v", m)
+	}
+	if _, ok, _ := ShowMap("mpathz"); ok {
+		t.Error("expected no map mpathz")
+	}
+
+	paths, err := Paths()
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("expected 2 paths, got %v %v", paths, err)
+	}
+	if paths[0].Map != "mpatha" || paths[0].CheckerState != "ready" || paths[1].Map != "" || paths[1].CheckerState != "faulty" {
+		t.Errorf("unexpected paths %+v", paths)
+	}
+
+	if commands := received(); len(commands) != 7 || commands[0] != "add path sdb" || commands[2] != "remove path sdd" {
+		t.Errorf("unexpected commands %q", commands)
+	}
+}
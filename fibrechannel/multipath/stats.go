@@ -0,0 +1,139 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatsProgramID tags the dm-stats regions created here, so they are told apart from those of
+// dmstats or other tools on the same map
+const StatsProgramID = "csi-lib-fc"
+
+// Message sends msg to the map name through device-mapper directly (DM_TARGET_MSG) and returns
+// the reply. Tests replace it.
+var Message = message
+
+//IOStats are the dm-stats counters of one area of a region, as Documentation/device-mapper/statistics
+//describes them. Start and Length are in 512 byte sectors, the times in milliseconds.
+type IOStats struct {
+	Start            uint64
+	Length           uint64
+	Reads            uint64
+	ReadsMerged      uint64
+	SectorsRead      uint64
+	ReadMillis       uint64
+	Writes           uint64
+	WritesMerged     uint64
+	SectorsWritten   uint64
+	WriteMillis      uint64
+	InFlight         uint64
+	IOMillis         uint64
+	WeightedIOMillis uint64
+}
+
+// CreateStatsRegion makes device-mapper count the I/O of the whole map name, split into areas
+// equal areas, and returns the region's id
+func CreateStatsRegion(name string, areas int) (int, error) {
+	if areas < 1 {
+		areas = 1
+	}
+	reply, err := Message(name, fmt.Sprintf("@stats_create - /%d %s", areas, StatsProgramID))
+	if err != nil {
+		return 0, err
+	}
+	region, err := strconv.Atoi(strings.TrimSpace(reply))
+	if err != nil {
+		return 0, fmt.Errorf("fc: unexpected reply %q to @stats_create of map %s", reply, name)
+	}
+	return region, nil
+}
+
+// StatsRegions returns the ids of the regions of map name tagged with StatsProgramID
+func StatsRegions(name string) ([]int, error) {
+	reply, err := Message(name, "@stats_list "+StatsProgramID)
+	if err != nil {
+		return nil, err
+	}
+	var regions []int
+	for _, line := range strings.Split(reply, "\n") {
+		// <region_id>: <start_sector>+<length> <step> <program_id> <aux_data>
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[3] != StatsProgramID {
+			continue
+		}
+		region, err := strconv.Atoi(strings.TrimSuffix(fields[0], ":"))
+		if err != nil {
+			return nil, fmt.Errorf("fc: unexpected line %q in the stats regions of map %s", line, name)
+		}
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// PrintStats returns the counters of every area of region of map name
+func PrintStats(name string, region int) ([]IOStats, error) {
+	reply, err := Message(name, fmt.Sprintf("@stats_print %d", region))
+	if err != nil {
+		return nil, err
+	}
+	var stats []IOStats
+	for _, line := range strings.Split(reply, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		s, err := parseIOStats(line)
+		if err != nil {
+			return nil, fmt.Errorf("fc: unexpected line %q in the stats of region %d of map %s: %v", line, region, name, err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// DeleteStatsRegion stops counting the I/O of region of map name
+func DeleteStatsRegion(name string, region int) error {
+	_, err := Message(name, fmt.Sprintf("@stats_delete %d", region))
+	return err
+}
+
+// parseIOStats parses a line of @stats_print, <start_sector>+<length> and the counters. Counters
+// newer kernels add after the eleven documented ones are ignored.
+func parseIOStats(line string) (IOStats, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 12 {
+		return IOStats{}, fmt.Errorf("%d fields", len(fields))
+	}
+	var s IOStats
+	area := strings.SplitN(fields[0], "+", 2)
+	if len(area) != 2 {
+		return IOStats{}, fmt.Errorf("no area in %q", fields[0])
+	}
+	values := append(area, fields[1:12]...)
+	counters := []*uint64{&s.Start, &s.Length, &s.Reads, &s.ReadsMerged, &s.SectorsRead, &s.ReadMillis,
+		&s.Writes, &s.WritesMerged, &s.SectorsWritten, &s.WriteMillis, &s.InFlight, &s.IOMillis, &s.WeightedIOMillis}
+	for i, counter := range counters {
+		value, err := strconv.ParseUint(values[i], 10, 64)
+		if err != nil {
+			return IOStats{}, err
+		}
+		*counter = value
+	}
+	return s, nil
+}
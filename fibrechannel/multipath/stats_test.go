@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multipath
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	defer func(m func(string, string) (string, error)) { Message = m }(Message)
+	var sent []string
+	replies := map[string]string{
+		"@stats_create - /2 csi-lib-fc": "3\n",
+		"@stats_list csi-lib-fc":        "3: 0+2097152 1048576 csi-lib-fc -\n",
+		"@stats_print 3": "0+1048576 120 4 960 35 80 0 640 22 1 30 57 0 0 0 0\n" +
+			"1048576+1048576 6 0 48 2 0 0 0 0 0 2 2 0 0 0 0\n",
+		"@stats_delete 3": "",
+	}
+	Message = func(name, msg string) (string, error) {
+		sent = append(sent, name+" "+msg)
+		return replies[msg], nil
+	}
+
+	region, err := CreateStatsRegion("mpatha", 2)
+	if err != nil || region != 3 {
+		t.Fatalf("expected region 3, got %d %v", region, err)
+	}
+	regions, err := StatsRegions("mpatha")
+	if err != nil || len(regions) != 1 || regions[0] != 3 {
+		t.Errorf("expected region 3 to be listed, got %v %v", regions, err)
+	}
+	stats, err := PrintStats("mpatha", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := IOStats{Start: 0, Length: 1048576, Reads: 120, ReadsMerged: 4, SectorsRead: 960, ReadMillis: 35,
+		Writes: 80, SectorsWritten: 640, WriteMillis: 22, InFlight: 1, IOMillis: 30, WeightedIOMillis: 57}
+	if len(stats) != 2 || stats[0] != expected || stats[1].Start != 1048576 || stats[1].Reads != 6 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if err := DeleteStatsRegion("mpatha", 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(sent) != 4 || sent[3] != "mpatha @stats_delete 3" {
+		t.Errorf("unexpected messages %q", sent)
+	}
+
+	replies["@stats_print 3"] = "0+1048576 120 4\n"
+	if _, err := PrintStats("mpatha", 3); err == nil {
+		t.Error("expected an error for a truncated line")
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+)
+
+func TestFindMultipathDeviceSkipsOtherDMTargets(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.files["/sys/block/dm-0/dm/uuid"] = "LVM-Qx1bTzlIS4y0cB1ELjAVFbMFF0c6oo0J\n"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "/sys/devices/sdb"
+	fs.files["/sys/block/dm-1/dm/uuid"] = "CRYPT-LUKS2-4d1c0ac2bdcd4d4c8a3e-luks\n"
+	fs.links["/sys/block/dm-1/slaves/sdb"] = "/sys/devices/sdb"
+	fs.files["/sys/block/dm-2/dm/uuid"] = "mpath-3600508b400105e210000900000490000\n"
+	fs.links["/sys/block/dm-2/slaves/sdb"] = "/sys/devices/sdb"
+	fs.files["/dev/sdb"] = ""
+
+	dm, err := FindMultipathDeviceForDevice("/dev/sdb", fs)
+	if err != nil || dm != "/dev/dm-2" {
+		t.Errorf("expected /dev/dm-2, got %q, %v", dm, err)
+	}
+
+	delete(fs.files, "/sys/block/dm-2/dm/uuid")
+	delete(fs.links, "/sys/block/dm-2/slaves/sdb")
+	if dm, _ := FindMultipathDeviceForDevice("/dev/sdb", fs); dm != "" {
+		t.Errorf("expected no multipath device, got %s", dm)
+	}
+}
+
+func TestMultipathDropInOption(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	var commands []string
+	multipath.Command = func(args ...string) (string, error) {
+		commands = append(commands, strings.Join(args, " "))
+		return "ok\n", nil
+	}
+
+	c := Connector{VolumeName: "pv1", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	dropIn := WithMultipathDropIn("pv1", []byte("multipaths {}\n"))
+	if _, err := searchDisk(c, &fakeIOHandler{}, newOptions([]Option{dropIn})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(commands) == 0 || commands[0] != "reconfigure" {
+		t.Errorf("expected multipathd to be reconfigured first, got %v", commands)
+	}
+
+	// the detach of the volume removes the drop-in
+	fs := newFakeSysfs()
+	fs.files["/etc/multipath/conf.d/pv1.conf"] = "multipaths {}\n"
+	if err := detach("/dev/sdz", fs, newOptions([]Option{dropIn, WithWWID("3600a098038303634722b4d59614b6a6d")})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := fs.files["/etc/multipath/conf.d/pv1.conf"]; ok {
+		t.Error("expected the drop-in to be removed")
+	}
+
+	// a drop-in multipathd refuses fails the attach
+	multipath.Command = func(args ...string) (string, error) {
+		return "fail\n", errors.New("exit status 1")
+	}
+	if _, err := searchDisk(c, &fakeIOHandler{}, newOptions([]Option{dropIn})); err == nil {
+		t.Error("expected the refused drop-in to fail the search")
+	}
+}
+
+func TestMultipathFallback(t *testing.T) {
+	defer func(create func(string, string, int64, []string) (string, error)) { multipath.CreateMap = create }(multipath.CreateMap)
+	var table, uuid string
+	multipath.CreateMap = func(name, id string, sectors int64, devices []string) (string, error) {
+		table, uuid = multipath.Table(devices), id
+		return "/dev/dm-7", nil
+	}
+
+	fs := newFakeSysfs()
+	fs.files["/sys/block/sdb/dev"] = "8:16\n"
+	fs.files["/sys/block/sdc/dev"] = "8:32\n"
+	fs.files["/sys/block/sdb/size"] = "2097152\n"
+	wwid := "naa.600a098038303053453f463045727a44"
+	candidates := []candidate{
+		{disk: "/dev/sdb", hctl: "5:0:0:1", wwid: wwid},
+		{disk: "/dev/sdc", hctl: "6:0:0:1", wwid: wwid},
+	}
+
+	if dm := fallbackMap(candidates[0], candidates, fs); dm != "" {
+		t.Errorf("expected no map without dm-multipath, got %s", dm)
+	}
+	fs.files["/sys/module/dm_multipath/refcnt"] = "0\n"
+	fs.files["/dev/mapper/control"] = ""
+	if dm := fallbackMap(candidates[0], candidates[:1], fs); dm != "" {
+		t.Errorf("expected no map for a single path, got %s", dm)
+	}
+	if dm := fallbackMap(candidates[0], candidates, fs); dm != "/dev/dm-7" {
+		t.Fatalf("expected a map, got %q", dm)
+	}
+	if uuid != "mpath-3600a098038303053453f463045727a44" || table != "0 0 1 1 round-robin 0 2 1 8:16 1000 8:32 1000" {
+		t.Errorf("unexpected map %s with table %q", uuid, table)
+	}
+
+	fs.files["/run/multipathd.pid"] = "1234\n"
+	if dm := fallbackMap(candidates[0], candidates, fs); dm != "" {
+		t.Errorf("expected multipathd to be left to create the map, got %s", dm)
+	}
+}
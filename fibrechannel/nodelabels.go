@@ -0,0 +1,58 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// DefaultNodeLabelPrefix is the key prefix for NodeLabels of drivers without their own
+const DefaultNodeLabelPrefix = "fc.csi.k8s.io/"
+
+// NodeLabels returns the labels a driver should put on its node at registration, or report as
+// topology segments from NodeGetInfo, so fc volumes are only scheduled onto nodes that can reach
+// them. Every key starts with prefix: has-fc is "true" when at least one of hbas is online,
+// hba-count is the number of ports, and fabric-<fabric name> is "true" for every fabric an
+// online port is logged into, e.g. fabric-100000051e0a1b2c. Pass it the result of GetHBAs.
+func NodeLabels(hbas []HBA, prefix string) map[string]string {
+	labels := map[string]string{
+		prefix + "has-fc":    "false",
+		prefix + "hba-count": strconv.Itoa(len(hbas)),
+	}
+	for _, hba := range hbas {
+		if hba.PortState != "Online" {
+			continue
+		}
+		labels[prefix+"has-fc"] = "true"
+		if fabric := fabricLabel(hba.FabricName); fabric != "" {
+			labels[prefix+"fabric-"+fabric] = "true"
+		}
+	}
+	return labels
+}
+
+// fabricLabel returns a fabric name as used in label keys, or "" for a port outside a fabric,
+// e.g. point to point, which reports a fabric name of 0 or all ones
+func fabricLabel(name string) string {
+	name = wwn.Normalize(name)
+	if strings.Trim(name, "0") == "" || strings.Trim(name, "f") == "" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodeLabels(t *testing.T) {
+	hbas := []HBA{
+		{Host: "host5", PortState: "Online", FabricName: "0x100000051E0A1B2C"},
+		{Host: "host6", PortState: "Online", FabricName: "0x100000051e0a9f00"},
+		{Host: "host7", PortState: "Linkdown", FabricName: "0x100000051e0a7777"},
+		{Host: "host8", PortState: "Online", FabricName: "0xffffffffffffffff"},
+	}
+	expected := map[string]string{
+		"fc.csi.k8s.io/has-fc":                  "true",
+		"fc.csi.k8s.io/hba-count":               "4",
+		"fc.csi.k8s.io/fabric-100000051e0a1b2c": "true",
+		"fc.csi.k8s.io/fabric-100000051e0a9f00": "true",
+	}
+	if labels := NodeLabels(hbas, DefaultNodeLabelPrefix); !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected %v, got %v", expected, labels)
+	}
+
+	expected = map[string]string{"example.com/has-fc": "false", "example.com/hba-count": "0"}
+	if labels := NodeLabels(nil, "example.com/"); !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected %v without HBAs, got %v", expected, labels)
+	}
+}
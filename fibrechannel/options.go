@@ -0,0 +1,385 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/mount"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//Option configures optional behaviour of Attach and Detach
+type Option func(*options)
+
+type options struct {
+	// ctx of the operation, set by the Context variants of the Client methods
+	ctx   context.Context
+	audit *InventoryDiff
+	// scanLock serializes rescans across operations of a Client, nil for the free functions
+	scanLock sync.Locker
+	// checkClaim refuses a device a Client attached for another volume, nil for the free functions
+	checkClaim  func(volumeName, devicePath string) error
+	operationID string
+	// labels of the Connector the operation works on
+	labels map[string]string
+	// what the operation's summary line reports
+	summary summary
+	// no wildcard rescans while the node has been up for less than this
+	bootSuppression time.Duration
+	// phases accumulates the time spent per phase, copied to timings when the operation ends
+	phases  PhaseTimings
+	timings *PhaseTimings
+	// devices matching these patterns are never removed
+	protected []string
+
+	attachHook       AttachHook
+	attachHookPolicy HookFailurePolicy
+	detachHook       DetachHook
+	detachHookPolicy HookFailurePolicy
+
+	// clock times every wait, poll and phase of the operation
+	clock poll.Clock
+	// set for a Detach that only plans
+	dryRun *DetachPlan
+	// wwid of the volume, to find its devices when the device path is gone
+	wwid string
+	// wwids of the volume's Connector, any of which its devices may report when wwid is unset
+	wwids        []string
+	detachResult *DetachResult
+	events       EventSink
+
+	// the volume is attached on several nodes at once
+	shared       bool
+	minPaths     MinPathsPolicy
+	waitMinPaths bool
+	// sample path latency for GetVolumeCondition
+	latencyInterval time.Duration
+	// have multipathd fail the paths latency sampling flags
+	failSlowPaths bool
+	// scan only the connector's targets and lun
+	targetedRescan bool
+	rescanStrategy RescanStrategy
+	// LIP and rebind the HBA driver when rescans find nothing
+	driverRebind bool
+	// create multipath maps when multipathd doesn't
+	multipathFallback bool
+	// multipathd drop-in written before the volume is looked for and removed after its detach
+	dropInName string
+	dropIn     []byte
+	// fail with ErrNoFCHosts on nodes without fc hosts
+	requireFCHosts bool
+	// clear the unit attentions of a new device's paths
+	drainUnitAttentions bool
+	// verify the new device's paths report the volume's wwid
+	identityCheck bool
+	// every device discovery found, for the caller
+	discovered *[]DiscoveredPath
+	// which of the connector's targets the volume was found through, for the caller
+	targets *[]TargetStatus
+	// check the filesystem before StageFilesystem mounts it, and where to report the result
+	fsck       bool
+	fsckResult *mount.CheckResult
+	// unregister the node's reservation key on detach
+	prKey        uint64
+	prDeregister bool
+
+	// device search of Attach and Prefetch
+	timeout       time.Duration
+	maxRescans    int
+	pollInterval  time.Duration
+	multipathWait time.Duration
+	udevSettle    time.Duration
+	deviceGone    time.Duration
+	uevents       bool
+	// bound of the buffer flush of each device on detach
+	detachFlush time.Duration
+	// bound of the wait for a resized map to take its new size
+	resize    time.Duration
+	skipFlush bool
+	// the timeouts the caller set, validated together
+	timeoutsSet Timeouts
+	// invalid fails the operation, set by options that can't be applied
+	invalid error
+}
+
+//PhaseTimings records where an Attach spent its time. Discovery covers reading and verifying the
+//by-path and by-id entries, DeviceWait waiting for a previous attachment's devices to go away.
+type PhaseTimings struct {
+	Rescan     time.Duration
+	DeviceWait time.Duration
+	Discovery  time.Duration
+	Total      time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		ctx:           context.Background(),
+		clock:         poll.RealClock{},
+		maxRescans:    1,
+		timeout:       DefaultTimeouts.Attach,
+		pollInterval:  DefaultTimeouts.RescanWait,
+		multipathWait: DefaultTimeouts.MultipathWait,
+		udevSettle:    DefaultTimeouts.UdevSettle,
+		deviceGone:    DefaultTimeouts.DeviceGone,
+		detachFlush:   DefaultTimeouts.DetachFlush,
+		resize:        DefaultTimeouts.Resize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithInventoryAudit snapshots the node's devices before and after the operation and stores what
+// the operation added and removed in diff, whether the operation succeeded or not
+func WithInventoryAudit(diff *InventoryDiff) Option {
+	return func(o *options) {
+		o.audit = diff
+	}
+}
+
+// WithOperationID tags an operation with the caller's id, typically derived from the CSI request.
+// A Client that already completed an operation with the same id returns the recorded result
+// instead of running it again. The free functions keep no state and ignore the id.
+func WithOperationID(id string) Option {
+	return func(o *options) {
+		o.operationID = id
+	}
+}
+
+// WithBootRescanSuppression skips the wildcard scsi rescan while the node has been up for less than
+// window. Right after boot udev is still settling every device of a large SAN attached node, a
+// rescan of all hosts only prolongs that storm, so discovery relies on the existing by-path entries
+// and the scans that only touch the volume's lun: targeted, REPORT LUNS and a driver's own
+// strategies still run, the targeted scan without its wildcard fallback.
+func WithBootRescanSuppression(window time.Duration) Option {
+	return func(o *options) {
+		o.bootSuppression = window
+	}
+}
+
+// WithPhaseTimings stores the time the operation spent in each phase in timings, so drivers can
+// log or export where the time went for a volume. The library itself exports no metrics.
+func WithPhaseTimings(timings *PhaseTimings) Option {
+	return func(o *options) {
+		o.timings = timings
+	}
+}
+
+// WithClock makes the operation take time from clock for all its waits, polls and timings, so
+// tests of timeout heavy code can run instantly with a fake clock
+func WithClock(clock poll.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithTimeout bounds the time Attach and Prefetch spend rescanning for the volume's devices. No
+// further rescan is started once timeout has passed, a rescan in progress is not interrupted.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+		o.timeoutsSet.Attach = timeout
+	}
+}
+
+// WithMaxRescans lets Attach and Prefetch rescan the scsi hosts up to n times while the volume's
+// devices don't show up, instead of once. Slow fabrics may need several rescans before a newly
+// mapped LUN is reported.
+func WithMaxRescans(n int) Option {
+	return func(o *options) {
+		o.maxRescans = n
+	}
+}
+
+// WithoutRescan makes Attach and Prefetch rely on the devices already present, e.g. when the
+// driver rescans by itself or the node's udev rules add devices on fabric events
+func WithoutRescan() Option {
+	return WithMaxRescans(0)
+}
+
+// WithPollInterval makes Attach and Prefetch wait interval after each rescan before searching
+// again, giving udev time to create the by-path and by-id links. The default is not to wait.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.pollInterval = interval
+		o.timeoutsSet.RescanWait = interval
+	}
+}
+
+// WithSharedVolume marks the volume as attached on several nodes at once, e.g. shared raw block
+// for a clustered filesystem. Nothing may then assume exclusive use of the LUN: reservations
+// registered by other nodes are not a reason to refuse the volume and the reservation must not be
+// cleared on detach. Hooks handling persistent reservations see the setting in DeviceInfo.Shared.
+func WithSharedVolume() Option {
+	return func(o *options) {
+		o.shared = true
+	}
+}
+
+// since adds the time elapsed since start to phase and returns now, for timing consecutive phases
+func (o *options) since(phase *time.Duration, start time.Time) time.Time {
+	now := o.clock.Now()
+	*phase += now.Sub(start)
+	return now
+}
+
+// finishTimings hands the collected timings to the caller, if it asked for them
+func (o *options) finishTimings(start time.Time) {
+	if o.timings == nil {
+		return
+	}
+	o.since(&o.phases.Total, start)
+	*o.timings = o.phases
+}
+
+// WithProtectedDevices adds site policy to the automatic swap and resume device protection: a
+// device matching one of the path.Match patterns is never removed, tuned, throttled or formatted.
+// Patterns are matched against the device path (/dev/sdb), its kernel name (sdb) and its sysfs
+// WWID (naa.600a0980...), e.g. "naa.600a0980383030*" protects every LUN of one array. Pass it to
+// NewClient to apply it to every operation.
+func WithProtectedDevices(patterns ...string) Option {
+	return func(o *options) {
+		o.protected = append(o.protected, patterns...)
+	}
+}
+
+// WithTargetedRescan makes Attach and Prefetch ask the hosts that see one of the connector's
+// targets to scan only the connector's lun on that target, instead of everything they see.
+// On nodes with hundreds of LUNs the wildcard scan is slow and disturbs unrelated workloads.
+// Connectors identifying the volume by WWID, or whose targets the node doesn't see yet, still get
+// the wildcard scan. WithRescanStrategy(TargetedRescan()) never falls back to it.
+func WithTargetedRescan() Option {
+	return func(o *options) {
+		o.targetedRescan = true
+	}
+}
+
+// WithFailWithoutFCHosts makes Attach and Prefetch fail at once with ErrNoFCHosts on a node
+// without fc hosts, instead of rescanning scsi hosts that can't find the volume until the search
+// gives up. A pod scheduled onto a node without HBAs then fails in milliseconds.
+func WithFailWithoutFCHosts() Option {
+	return func(o *options) {
+		o.requireFCHosts = true
+	}
+}
+
+// checkFCHosts returns ErrNoFCHosts if the option is set and the node has no fc hosts
+func (o *options) checkFCHosts(io ioHandler) error {
+	if !o.requireFCHosts {
+		return nil
+	}
+	if hosts, err := io.ReadDir(sysfs.DefaultLayout.FCHosts()); err == nil && len(hosts) > 0 {
+		return nil
+	}
+	return errorf(ErrNoFCHosts, "fc: no fc hosts in %s, is this node connected to the fabric?", sysfs.DefaultLayout.FCHosts())
+}
+
+// rescan triggers a scsi host rescan, serialized with other rescans if a scan lock is set
+func (o *options) rescan(c Connector, io ioHandler) {
+	o.rescanAll([]Connector{c}, io)
+}
+
+// rescanAll triggers one scsi host rescan finding the volumes of all of cs
+func (o *options) rescanAll(cs []Connector, io ioHandler) {
+	defer o.since(&o.phases.Rescan, o.clock.Now())
+	suppress := func(strategy RescanStrategy) RescanStrategy { return strategy }
+	if o.bootSuppression > 0 {
+		if uptime, ok := readUptime(io); ok && uptime < o.bootSuppression {
+			glog.Infof("fc: node up for %v, skipping wildcard rescans during the first %v after boot", uptime, o.bootSuppression)
+			suppress = withoutWildcard
+		}
+	}
+	if o.scanLock != nil {
+		o.scanLock.Lock()
+		defer o.scanLock.Unlock()
+	}
+	// the connectors without a strategy of their own are scanned together
+	var shared []Connector
+	for _, c := range cs {
+		if c.RescanStrategy == nil {
+			shared = append(shared, c)
+		} else if err := suppress(c.RescanStrategy).Rescan([]Connector{c}, io); err != nil {
+			glog.Warningf("fc: rescan for volume %s failed: %v", c.VolumeName, err)
+		}
+	}
+	if len(shared) == 0 {
+		return
+	}
+	if err := suppress(o.strategy()).Rescan(shared, io); err != nil {
+		glog.Warningf("fc: rescan failed: %v", err)
+	}
+}
+
+// zonedHosts returns the local hosts that see one of c's targets. Only they can find the volume,
+// so rescanning the other hosts of a multi-HBA node only adds latency. When none is known yet,
+// or c identifies the volume by WWID, all hosts need to be scanned.
+func zonedHosts(c Connector, io ioHandler) []string {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, targetWWN := range c.TargetWWNs {
+		for _, target := range scsi.FindTargets(targetWWN, io) {
+			host := "host" + strings.SplitN(target, ":", 2)[0]
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// scanTargets scans c's lun on every target of c the node sees and reports whether there was any
+func scanTargets(c Connector, io ioHandler) bool {
+	if !targetedScan(io) {
+		glog.Infof("fc: the fc transport reports no scsi targets to scan volume %s on", c.VolumeName)
+		return false
+	}
+	scanned := false
+	for _, targetWWN := range c.TargetWWNs {
+		for _, target := range scsi.FindTargets(targetWWN, io) {
+			if err := scanTarget(target, kernelLun(c.Lun), io); err != nil {
+				glog.Warningf("fc: scan of lun %s on target %s failed: %v", c.Lun, target, err)
+				continue
+			}
+			scanned = true
+		}
+	}
+	return scanned
+}
+
+// readUptime returns the time since boot from /proc/uptime
+func readUptime(io ioHandler) (time.Duration, bool) {
+	fields := strings.Fields(sysfs.ReadAttr("/proc/uptime", io))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
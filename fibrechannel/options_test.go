@@ -0,0 +1,183 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	polltesting "github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll/testing"
+)
+
+func TestBootRescanSuppression(t *testing.T) {
+	tests := []struct {
+		name     string
+		uptime   string
+		window   time.Duration
+		rescaned bool
+	}{
+		{"no window", "35.20 120.10\n", 0, true},
+		{"within window", "35.20 120.10\n", 10 * time.Minute, false},
+		{"after window", "900.52 3400.77\n", 10 * time.Minute, true},
+		{"unknown uptime", "", 10 * time.Minute, true},
+	}
+	for _, test := range tests {
+		fs := newFakeSysfs()
+		fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+		if test.uptime != "" {
+			fs.files["/proc/uptime"] = test.uptime
+		}
+		newOptions([]Option{WithBootRescanSuppression(test.window)}).rescan(Connector{}, fs)
+		if _, ok := fs.writes["/sys/class/scsi_host/host5/scan"]; ok != test.rescaned {
+			t.Errorf("%s: expected rescan %v, got %v", test.name, test.rescaned, ok)
+		}
+	}
+
+	// the scans of the volume's lun on its targets still run within the window
+	fs := newFakeSysfs()
+	fs.files["/proc/uptime"] = "35.20 120.10\n"
+	fs.files["/sys/class/scsi_host/host6/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/fc_transport/target6:0:2/port_name"] = "0x500a0981891b8dc5\n"
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+	newOptions([]Option{WithBootRescanSuppression(10 * time.Minute), WithTargetedRescan()}).rescan(c, fs)
+	if scan := fs.writes["/sys/class/scsi_host/host6/scan"]; scan != "0 2 1" {
+		t.Errorf("expected the targeted scan to run, got %q", scan)
+	}
+
+	// a volume whose targets aren't visible gets no wildcard fallback
+	fs.writes = map[string]string{}
+	c.TargetWWNs = []string{"500a0981891b8dc6"}
+	newOptions([]Option{WithBootRescanSuppression(10 * time.Minute), WithTargetedRescan()}).rescan(c, fs)
+	if len(fs.writes) != 0 {
+		t.Errorf("expected no wildcard rescan, got %v", fs.writes)
+	}
+}
+
+func TestPhaseTimings(t *testing.T) {
+	fakeConnector := Connector{
+		VolumeName: "fakeVol",
+		TargetWWNs: []string{"500a0981891b8dc5"},
+		Lun:        "0",
+	}
+	var timings PhaseTimings
+	if _, err := attach(fakeConnector, &fakeIOHandler{}, newOptions([]Option{WithPhaseTimings(&timings)})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if timings.Total == 0 || timings.Discovery == 0 || timings.Total < timings.Discovery+timings.Rescan+timings.DeviceWait {
+		t.Errorf("unexpected timings %+v", timings)
+	}
+}
+
+// scanCountingSysfs counts the scsi host rescans written through it
+type scanCountingSysfs struct {
+	*fakeSysfs
+	scans int
+}
+
+func (fs *scanCountingSysfs) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	if strings.HasSuffix(filename, "/scan") {
+		fs.scans++
+	}
+	return fs.fakeSysfs.WriteFile(filename, data, perm)
+}
+
+func TestRescanOptions(t *testing.T) {
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	tests := []struct {
+		name  string
+		opts  []Option
+		scans int
+	}{
+		{"default", nil, 1},
+		{"without rescan", []Option{WithoutRescan()}, 0},
+		{"max rescans", []Option{WithMaxRescans(3)}, 3},
+	}
+	for _, test := range tests {
+		fs := &scanCountingSysfs{fakeSysfs: newFakeSysfs()}
+		fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+		if _, err := Attach(c, fs, test.opts...); !errors.Is(err, ErrDiskNotFound) {
+			t.Errorf("%s: expected ErrDiskNotFound, got %v", test.name, err)
+		}
+		if fs.scans != test.scans {
+			t.Errorf("%s: expected %d rescans, got %d", test.name, test.scans, fs.scans)
+		}
+	}
+}
+
+func TestRescanTimeout(t *testing.T) {
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	fs := &scanCountingSysfs{fakeSysfs: newFakeSysfs()}
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	clock := polltesting.NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go clock.StepUntilDone(time.Second, done)
+	defer close(done)
+
+	_, err := Attach(c, fs, WithClock(clock), WithMaxRescans(10), WithPollInterval(time.Second), WithTimeout(2*time.Second))
+	if !errors.Is(err, ErrDiskNotFound) {
+		t.Errorf("expected ErrDiskNotFound, got %v", err)
+	}
+	if fs.scans != 2 {
+		t.Errorf("expected the timeout to stop after 2 rescans, got %d", fs.scans)
+	}
+}
+
+func TestTargetedRescan(t *testing.T) {
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "7"}
+	fs := newFakeSysfs()
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/scsi_host/host6/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/fc_transport/target6:0:2/port_name"] = "0x500a0981891b8dc5\n"
+
+	newOptions([]Option{WithTargetedRescan()}).rescan(c, fs)
+	if len(fs.writes) != 1 || fs.writes["/sys/class/scsi_host/host6/scan"] != "0 2 7" {
+		t.Errorf("expected only target 6:0:2 to be scanned, got %v", fs.writes)
+	}
+
+	fs = newFakeSysfs()
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	newOptions([]Option{WithTargetedRescan()}).rescan(c, fs)
+	if fs.writes["/sys/class/scsi_host/host5/scan"] != "- - -" {
+		t.Errorf("expected a wildcard scan without known targets, got %v", fs.writes)
+	}
+
+	// luns from 256 on are scanned by the kernel's number
+	c.Lun = "256"
+	fs = newFakeSysfs()
+	fs.files["/sys/class/scsi_host/host6/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/fc_transport/target6:0:2/port_name"] = "0x500a0981891b8dc5\n"
+	newOptions([]Option{WithTargetedRescan()}).rescan(c, fs)
+	if fs.writes["/sys/class/scsi_host/host6/scan"] != "0 2 16640" {
+		t.Errorf("expected lun 256 to be scanned as 16640, got %v", fs.writes)
+	}
+}
+
+func TestRescanZonedHosts(t *testing.T) {
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "7"}
+	fs := newFakeSysfs()
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/scsi_host/host6/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/fc_remote_ports/rport-6:0-2/port_name"] = "0x500a0981891b8dc5\n"
+	fs.files["/sys/class/fc_remote_ports/rport-6:0-2/scsi_target_id"] = "2\n"
+
+	newOptions(nil).rescan(c, fs)
+	if len(fs.writes) != 1 || fs.writes["/sys/class/scsi_host/host6/scan"] != "- - -" {
+		t.Errorf("expected only host6 to be rescanned, got %v", fs.writes)
+	}
+}
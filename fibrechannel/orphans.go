@@ -0,0 +1,293 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/mount"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// Reasons a device is an orphan
+const (
+	// OrphanRemotePortGone is a path whose remote port left the fabric for good
+	OrphanRemotePortGone = "RemotePortGone"
+	// OrphanLUNUnmapped is a path to a LUN the array no longer exports to the node
+	OrphanLUNUnmapped = "LUNUnmapped"
+	// OrphanEmptyMap is a multipath map without paths nothing is stacked on
+	OrphanEmptyMap = "EmptyMap"
+)
+
+//Orphan is a stale fc device left behind by an array side unmap, a target removed from the fabric
+//or a failed detach. Device is the disk (/dev/sdX) or map (/dev/dm-N), Map the map a disk is a
+//path of and Reason one of the Orphan constants.
+type Orphan struct {
+	Device string
+	HCTL   string
+	Map    string
+	Reason string
+}
+
+// FindOrphans returns the stale fc devices of the node without changing anything. It sends a
+// single TEST UNIT READY to the disks whose remote port is still there and that nothing uses, to
+// learn whether their LUN is still mapped. Disks in use, including the paths of an open map, are
+// left alone: their unit attentions belong to the volume's user.
+func FindOrphans(io ioHandler, opts ...Option) (orphans []Orphan, err error) {
+	defer recoverPanic("FindOrphans", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	return findOrphans(io, newOptions(opts))
+}
+
+// CleanupOrphans removes the stale fc devices FindOrphans finds, so they don't pile up until
+// the node runs out of scsi devices. A map all of whose paths are orphans is flushed before its
+// paths are deleted, unless something is stacked on it, in which case it and its paths are kept.
+// Orphaned paths of a map with working paths are taken out of multipathd before being deleted.
+// Protected and system devices are never removed. It returns the devices it removed, and an error
+// listing those it failed to.
+func CleanupOrphans(io ioHandler, opts ...Option) (removed []Orphan, err error) {
+	defer recoverPanic("CleanupOrphans", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	o := newOptions(opts)
+	orphans, err := findOrphans(io, o)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string][]Orphan{}
+	var maps []string
+	for _, orphan := range orphans {
+		if orphan.Reason == OrphanEmptyMap {
+			continue
+		}
+		if _, ok := paths[orphan.Map]; !ok {
+			maps = append(maps, orphan.Map)
+		}
+		paths[orphan.Map] = append(paths[orphan.Map], orphan)
+	}
+
+	var failed []string
+	fail := func(device string, err error) {
+		glog.Warningf("fc: unable to remove orphan %s: %v", device, err)
+		failed = append(failed, fmt.Sprintf("%s: %v", device, err))
+	}
+	remove := func(orphan Orphan) {
+		if err := o.checkNotReserved(orphan.Device, io); err != nil {
+			fail(orphan.Device, err)
+			return
+		}
+		if orphan.Reason == OrphanEmptyMap {
+			if err := o.flushOrphanMap(orphan.Device, io); err != nil {
+				fail(orphan.Device, err)
+				return
+			}
+		} else if err := removeFromScsiSubsystem(path.Base(orphan.Device), io); err != nil {
+			fail(orphan.Device, err)
+			return
+		}
+		glog.Infof("fc: removed orphan %s (%s)", orphan.Device, orphan.Reason)
+		removed = append(removed, orphan)
+	}
+
+	for _, dm := range maps {
+		if dm == "" {
+			for _, orphan := range paths[dm] {
+				remove(orphan)
+			}
+			continue
+		}
+		if len(paths[dm]) < len(multipath.Slaves(dm, io)) {
+			// the map keeps working paths, multipathd lets go of the orphans first
+			running := multipathdRunning(io)
+			for _, orphan := range paths[dm] {
+				if !running {
+					remove(orphan)
+					continue
+				}
+				if err := multipath.RemovePath(path.Base(orphan.Device)); err != nil {
+					glog.Warningf("fc: multipathd didn't remove %s from %s: %v", orphan.Device, dm, err)
+				}
+				remove(orphan)
+			}
+			continue
+		}
+		if holders := blockHolders(dm, io); len(holders) > 0 {
+			fail(dm, fmt.Errorf("all paths are gone but %v are stacked on it", holders))
+			continue
+		}
+		if err := o.checkNotReserved(dm, io); err != nil {
+			fail(dm, err)
+			continue
+		}
+		if err := o.flushOrphanMap(dm, io); err != nil {
+			fail(dm, err)
+			continue
+		}
+		for _, orphan := range paths[dm] {
+			remove(orphan)
+		}
+	}
+	for _, orphan := range orphans {
+		if orphan.Reason == OrphanEmptyMap {
+			remove(orphan)
+		}
+	}
+
+	if len(failed) > 0 {
+		return removed, fmt.Errorf("fc: failed to remove %d orphans: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return removed, nil
+}
+
+func findOrphans(io ioHandler, o *options) ([]Orphan, error) {
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.Blocks())
+	if err != nil {
+		return nil, err
+	}
+	var orphans []Orphan
+	for _, f := range dirs {
+		dev := f.Name()
+		switch {
+		case strings.HasPrefix(dev, "sd"):
+			if orphan, ok := orphanPath(dev, io); ok {
+				orphans = append(orphans, orphan)
+			}
+		case strings.HasPrefix(dev, "dm-"):
+			if emptyMap(dev, io) {
+				orphans = append(orphans, Orphan{Device: "/dev/" + dev, Reason: OrphanEmptyMap})
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// orphanPath reports whether the disk dev is a path of an fc target that is gone, or to a LUN the
+// target no longer exports
+func orphanPath(dev string, io ioHandler) (Orphan, bool) {
+	device, err := io.EvalSymlinks(sysfs.DefaultLayout.Block(dev, "device"))
+	if err != nil {
+		return Orphan{}, false
+	}
+	rport := ""
+	for _, elem := range strings.Split(device, "/") {
+		if strings.HasPrefix(elem, "rport-") {
+			rport = elem
+		}
+	}
+	hctl := path.Base(device)
+	if rport == "" || !scsi.IsDisk(hctl, io) {
+		// not behind an fc remote port
+		return Orphan{}, false
+	}
+	orphan := Orphan{Device: "/dev/" + dev, HCTL: hctl}
+	if dm, err := multipath.FindParent(orphan.Device, io); err == nil {
+		orphan.Map = dm
+	}
+
+	if _, err := io.Lstat(sysfs.DefaultLayout.FCRemotePort(rport)); err != nil {
+		orphan.Reason = OrphanRemotePortGone
+		return orphan, true
+	}
+	switch sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.FCRemotePort(rport), "port_state"), io) {
+	case "Not Present", "Deleted":
+		orphan.Reason = OrphanRemotePortGone
+		return orphan, true
+	case "Online":
+	default:
+		// blocked while the fabric settles, it may come back
+		return Orphan{}, false
+	}
+
+	if diskInUse(dev, orphan.Map, io) {
+		// a TEST UNIT READY would take the unit attentions, e.g. a preempted reservation, that
+		// are meant for the volume's user
+		return Orphan{}, false
+	}
+	var sense *scsi.SenseError
+	if err := scsi.TestUnitReady(orphan.Device); errors.As(err, &sense) && sense.Key == scsi.SenseKeyIllegalRequest && sense.ASC == scsi.ASCLogicalUnitNotSupported {
+		orphan.Reason = OrphanLUNUnmapped
+		return orphan, true
+	}
+	return Orphan{}, false
+}
+
+// diskInUse reports whether the disk dev, or the map dm it is a path of, may be in use: the map is
+// open or its open count unknown, or the disk has holders, is mounted or is a system device
+func diskInUse(dev, dm string, io ioHandler) bool {
+	if dm != "" {
+		name := sysfs.ReadAttr(sysfs.DefaultLayout.Block(path.Base(dm), "dm/name"), io)
+		if name == "" || !dmIoctls(io) {
+			return true
+		}
+		count, err := multipath.OpenCount(name)
+		return err != nil || count > 0
+	}
+	if len(blockHolders("/dev/"+dev, io)) > 0 || checkNotSystemDevice("/dev/"+dev, io) != nil {
+		return true
+	}
+	for _, source := range mount.Sources(io) {
+		if resolved, err := io.EvalSymlinks(source); err == nil {
+			source = resolved
+		}
+		if usesDevice(path.Base(source), dev, io) {
+			return true
+		}
+	}
+	return false
+}
+
+// emptyMap reports whether the dm device dev is a multipath map without paths or holders
+func emptyMap(dev string, io ioHandler) bool {
+	uuid := sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "dm/uuid"), io)
+	if !strings.HasPrefix(uuid, multipath.UUIDPrefix) {
+		return false
+	}
+	if slaves, _ := io.ReadDir(sysfs.DefaultLayout.BlockSlaves(dev)); len(slaves) > 0 {
+		return false
+	}
+	return len(blockHolders("/dev/"+dev, io)) == 0
+}
+
+// blockHolders returns the devices stacked on the block device devicePath
+func blockHolders(devicePath string, io ioHandler) []string {
+	var holders []string
+	if dirs, err := io.ReadDir(sysfs.DefaultLayout.BlockHolders(path.Base(devicePath))); err == nil {
+		for _, f := range dirs {
+			holders = append(holders, "/dev/"+f.Name())
+		}
+	}
+	return holders
+}
+
+// flushOrphanMap removes the map dm, which unlike Detach it can't leave to the removal of its paths
+func (o *options) flushOrphanMap(dm string, io ioHandler) error {
+	if sysfs.ReadAttr(sysfs.DefaultLayout.Block(path.Base(dm), "dm/name"), io) == "" {
+		return fmt.Errorf("fc: name of map %s unknown", dm)
+	}
+	return o.flushMap(DetachPlan{Map: dm}, io)
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+func orphanFixture() *fakeSysfs {
+	fs := newFakeSysfs()
+	disk := func(dev, rport, hctl string) {
+		fs.files["/dev/"+dev] = ""
+		fs.files["/sys/block/"+dev+"/size"] = "2097152"
+		fs.links["/sys/block/"+dev+"/device"] = "/sys/devices/pci0000:00/0000:41:00.0/host5/" + rport + "/target" + hctl[:5] + "/" + hctl
+	}
+	// the target left the fabric
+	disk("sdb", "rport-5:0-2", "5:0:2:1")
+	// paths of mpatha, the LUN of sdc was unmapped on the array
+	disk("sdc", "rport-5:0-3", "5:0:3:1")
+	disk("sdd", "rport-5:0-3", "5:0:3:2")
+	fs.files["/sys/class/fc_remote_ports/rport-5:0-3/port_state"] = "Online\n"
+	fs.files["/sys/block/dm-0/dm/uuid"] = "mpath-3600a098038303053743f463045727a41\n"
+	fs.files["/sys/block/dm-0/dm/name"] = "mpatha\n"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.links["/sys/block/dm-0/slaves/sdd"] = "../../sdd"
+	// blocked while the fabric settles
+	disk("sde", "rport-5:0-4", "5:0:4:1")
+	fs.files["/sys/class/fc_remote_ports/rport-5:0-4/port_state"] = "Blocked\n"
+	// a local disk
+	fs.files["/sys/block/sdf/size"] = "2097152"
+	fs.links["/sys/block/sdf/device"] = "/sys/devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0"
+	// a map whose paths are all gone
+	fs.files["/sys/block/dm-1/dm/uuid"] = "mpath-3600a098038303053743f463045727a42\n"
+	fs.files["/sys/block/dm-1/dm/name"] = "mpathb\n"
+	// a map a volume group is stacked on
+	fs.files["/sys/block/dm-2/dm/uuid"] = "mpath-3600a098038303053743f463045727a43\n"
+	fs.links["/sys/block/dm-2/holders/dm-3"] = "../../dm-3"
+	fs.files["/dev/mapper/control"] = ""
+	fs.files["/run/multipathd.pid"] = "1234\n"
+	return fs
+}
+
+func TestCleanupOrphans(t *testing.T) {
+	defer func(send func(string, *scsi.Command) error) { scsi.Send = send }(scsi.Send)
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	defer func(openCount func(string) (int, error)) { multipath.OpenCount = openCount }(multipath.OpenCount)
+	multipath.OpenCount = func(name string) (int, error) { return 0, nil }
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		if device == "/dev/sdc" {
+			return &scsi.SenseError{Key: scsi.SenseKeyIllegalRequest, ASC: scsi.ASCLogicalUnitNotSupported}
+		}
+		return nil
+	}
+	fs := orphanFixture()
+	var commands []string
+	multipath.Command = func(args ...string) (string, error) {
+		commands = append(commands, strings.Join(args, " "))
+		if args[0] == "del" {
+			delete(fs.files, "/sys/block/dm-1/dm/uuid")
+			delete(fs.files, "/sys/block/dm-1/dm/name")
+		}
+		return "ok\n", nil
+	}
+
+	orphans, err := FindOrphans(fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"/dev/sdb": OrphanRemotePortGone, "/dev/sdc": OrphanLUNUnmapped, "/dev/dm-1": OrphanEmptyMap}
+	if len(orphans) != len(expected) {
+		t.Fatalf("expected %v, got %+v", expected, orphans)
+	}
+	for _, orphan := range orphans {
+		if expected[orphan.Device] != orphan.Reason {
+			t.Errorf("%s: expected %s, got %+v", orphan.Device, expected[orphan.Device], orphan)
+		}
+	}
+	if len(fs.writes) != 0 || len(commands) != 0 {
+		t.Errorf("expected FindOrphans to change nothing, got %v %q", fs.writes, commands)
+	}
+
+	removed, err := CleanupOrphans(fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(removed) != 3 {
+		t.Errorf("expected the 3 orphans to be removed, got %+v", removed)
+	}
+	if fs.writes["/sys/block/sdb/device/delete"] != "1" || fs.writes["/sys/block/sdc/device/delete"] != "1" || len(fs.writes) != 2 {
+		t.Errorf("expected sdb and sdc to be deleted, got %v", fs.writes)
+	}
+	if len(commands) != 2 || commands[0] != "remove path sdc" || commands[1] != "del map mpathb" {
+		t.Errorf("unexpected multipathd commands %q", commands)
+	}
+}
+
+func TestCleanupOrphansKeepsHeldMap(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	multipath.Command = func(args ...string) (string, error) {
+		t.Errorf("unexpected multipathd command %q", args)
+		return "ok\n", nil
+	}
+	fs := orphanFixture()
+	// every path of mpatha is gone
+	fs.files["/sys/class/fc_remote_ports/rport-5:0-3/port_state"] = "Not Present\n"
+	fs.links["/sys/block/dm-0/holders/dm-4"] = "../../dm-4"
+	delete(fs.files, "/sys/block/dm-1/dm/uuid")
+
+	removed, err := CleanupOrphans(fs)
+	if err == nil || !strings.Contains(err.Error(), "/dev/dm-0") {
+		t.Fatalf("expected the held map to be reported, got %v", err)
+	}
+	if len(removed) != 1 || removed[0].Device != "/dev/sdb" {
+		t.Errorf("expected only sdb to be removed, got %+v", removed)
+	}
+	if _, ok := fs.writes["/sys/block/sdc/device/delete"]; ok {
+		t.Errorf("expected the paths of the held map to be kept, got %v", fs.writes)
+	}
+}
+
+func TestFindOrphansLeavesDisksInUse(t *testing.T) {
+	defer func(send func(string, *scsi.Command) error) { scsi.Send = send }(scsi.Send)
+	defer func(openCount func(string) (int, error)) { multipath.OpenCount = openCount }(multipath.OpenCount)
+	var probed []string
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		probed = append(probed, device)
+		return &scsi.SenseError{Key: scsi.SenseKeyIllegalRequest, ASC: scsi.ASCLogicalUnitNotSupported}
+	}
+	// mpatha is mounted
+	multipath.OpenCount = func(name string) (int, error) { return 1, nil }
+	fs := orphanFixture()
+	// and so is a partition of a disk without map
+	disk := func(dev, hctl string) {
+		fs.files["/dev/"+dev] = ""
+		fs.links["/sys/block/"+dev+"/device"] = "/sys/devices/pci0000:00/0000:41:00.0/host5/rport-5:0-3/target" + hctl[:5] + "/" + hctl
+	}
+	disk("sdg", "5:0:3:3")
+	fs.files["/sys/block/sdg/sdg1/partition"] = "1\n"
+	fs.files["/proc/mounts"] = "/dev/sdg1 /var/lib/data ext4 rw 0 0\n"
+	disk("sdh", "5:0:3:4")
+
+	orphans, err := FindOrphans(fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(probed, " ") != "/dev/sdh" {
+		t.Errorf("expected only the unused sdh to be probed, got %v", probed)
+	}
+	for _, orphan := range orphans {
+		if orphan.Reason == OrphanLUNUnmapped && orphan.Device != "/dev/sdh" {
+			t.Errorf("expected %s in use not to be an orphan", orphan.Device)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//MinPathsPolicy makes Attach fail when the volume has fewer than Min usable paths, so a volume
+//isn't mounted without redundancy. A path is usable while its scsi device is running. Ghost
+//paths, the standby paths of active-passive arrays (ALUA access state standby), count only with
+//CountGhost: such arrays legitimately present half their paths as ghosts.
+type MinPathsPolicy struct {
+	Min        int
+	CountGhost bool
+}
+
+// WithMinPathsPolicy checks the paths of the device Attach found against policy
+func WithMinPathsPolicy(policy MinPathsPolicy) Option {
+	return func(o *options) {
+		o.minPaths = policy
+	}
+}
+
+// pathGhost reports whether the ALUA access state of the path dev (e.g. sdb) is standby. Devices
+// without an ALUA device handler have no access state and are never ghosts.
+func pathGhost(dev string, io ioHandler) bool {
+	return sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "device/access_state"), io) == "standby"
+}
+
+// usablePaths counts the paths of devicePath that are running, ghosts only if countGhost is set
+func usablePaths(devicePath string, countGhost bool, io ioHandler) int {
+	n := 0
+	for _, p := range getDeviceInfo(devicePath, io).Paths {
+		dev := path.Base(p)
+		if pathFailed(sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "device/state"), io)) {
+			continue
+		}
+		if !countGhost && pathGhost(dev, io) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// minPathsWait is how long WithMinPaths waits for the paths without a MultipathWait of WithTimeouts
+const minPathsWait = 30 * time.Second
+
+// WithMinPaths makes Attach wait until the device it found has at least n usable paths, for up to
+// the MultipathWait of WithTimeouts or 30 seconds without one, and fail if they don't come up.
+// Returning as soon as the first path is up mounts volumes without redundancy, which then trips
+// over the first path flap. Ghost paths count as MinPathsPolicy says, pass WithMinPathsPolicy
+// before it to count them.
+func WithMinPaths(n int) Option {
+	return func(o *options) {
+		o.minPaths.Min = n
+		o.waitMinPaths = true
+	}
+}
+
+// pathWait returns how long Attach waits for multipathd to assemble a map and add its paths
+func (o *options) pathWait() time.Duration {
+	if o.multipathWait == 0 && o.waitMinPaths && o.minPaths.Min > 1 {
+		return minPathsWait
+	}
+	return o.multipathWait
+}
+
+// checkMinPaths fails if devicePath has fewer usable paths than the policy requires, after
+// waiting for them with WithMinPaths
+func (o *options) checkMinPaths(devicePath string, io ioHandler) error {
+	if o.minPaths.Min <= 0 {
+		return nil
+	}
+	n := usablePaths(devicePath, o.minPaths.CountGhost, io)
+	if n < o.minPaths.Min && o.waitMinPaths {
+		glog.Infof("fc: %s has %d usable paths, waiting for %d", devicePath, n, o.minPaths.Min)
+		deadline := o.clock.Now().Add(o.pathWait())
+		err := poll.Until(o.ctx, o.clock, multipathPollInterval, func() (bool, error) {
+			n = usablePaths(devicePath, o.minPaths.CountGhost, io)
+			return n >= o.minPaths.Min || !o.clock.Now().Before(deadline), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if n < o.minPaths.Min {
+		return fmt.Errorf("fc: %s has %d usable paths, %d required", devicePath, n, o.minPaths.Min)
+	}
+	return nil
+}
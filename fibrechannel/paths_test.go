@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+	"time"
+
+	polltesting "github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll/testing"
+)
+
+func TestMinPathsPolicy(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	for _, dev := range []string{"sdb", "sdc", "sdd", "sde"} {
+		fs.links["/sys/block/dm-0/slaves/"+dev] = "../../" + dev
+		fs.files["/sys/block/"+dev+"/device/state"] = "running\n"
+	}
+	fs.files["/sys/block/sdb/device/access_state"] = "active/optimized\n"
+	fs.files["/sys/block/sdc/device/access_state"] = "active/optimized\n"
+	fs.files["/sys/block/sdd/device/access_state"] = "standby\n"
+	fs.files["/sys/block/sde/device/access_state"] = "standby\n"
+
+	tests := []struct {
+		policy MinPathsPolicy
+		ok     bool
+	}{
+		{MinPathsPolicy{}, true},
+		{MinPathsPolicy{Min: 2}, true},
+		{MinPathsPolicy{Min: 4}, false},
+		{MinPathsPolicy{Min: 4, CountGhost: true}, true},
+	}
+	for _, test := range tests {
+		o := newOptions([]Option{WithMinPathsPolicy(test.policy)})
+		if err := o.checkMinPaths("/dev/dm-0", fs); (err == nil) != test.ok {
+			t.Errorf("%+v: unexpected result %v", test.policy, err)
+		}
+	}
+
+	fs.files["/sys/block/sdc/device/state"] = "offline\n"
+	o := newOptions([]Option{WithMinPathsPolicy(MinPathsPolicy{Min: 2})})
+	if err := o.checkMinPaths("/dev/dm-0", fs); err == nil {
+		t.Error("expected the offline path not to count")
+	}
+}
+
+// pathsComingUpSysfs reports sdc offline for its first reads of the state, like a path that
+// multipathd adds to the map a moment after the first
+type pathsComingUpSysfs struct {
+	*fakeSysfs
+	offlineReads int
+}
+
+func (fs *pathsComingUpSysfs) ReadFile(filename string) ([]byte, error) {
+	if filename == "/sys/block/sdc/device/state" && fs.offlineReads > 0 {
+		fs.offlineReads--
+		return []byte("offline\n"), nil
+	}
+	return fs.fakeSysfs.ReadFile(filename)
+}
+
+func TestWithMinPaths(t *testing.T) {
+	fs := &pathsComingUpSysfs{fakeSysfs: newFakeSysfs(), offlineReads: 3}
+	for _, dev := range []string{"sdb", "sdc"} {
+		fs.links["/sys/block/dm-0/slaves/"+dev] = "../../" + dev
+		fs.files["/sys/block/"+dev+"/device/state"] = "running\n"
+	}
+	clock := polltesting.NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go clock.StepUntilDone(time.Second, done)
+	defer close(done)
+
+	if err := newOptions([]Option{WithMinPaths(2), WithClock(clock)}).checkMinPaths("/dev/dm-0", fs); err != nil {
+		t.Errorf("expected the wait for the second path, got %v", err)
+	}
+	if fs.offlineReads != 0 {
+		t.Errorf("expected the path to be checked until it came up, %d reads left", fs.offlineReads)
+	}
+
+	fs.offlineReads = 1 << 30
+	o := newOptions([]Option{WithMinPaths(2), WithClock(clock), WithTimeouts(Timeouts{MultipathWait: 5 * time.Second})})
+	if err := o.checkMinPaths("/dev/dm-0", fs); err == nil {
+		t.Error("expected the wait to time out")
+	}
+}
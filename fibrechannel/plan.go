@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"path"
+	"strings"
+)
+
+//DetachPlan is what Detach does to a device, in order. Holders are devices stacked on DevicePath,
+//e.g. partition mappings, LVM or dm-crypt, that keep it open. Partitions are the partitions found
+//on it. Map is the multipath map flushed before its paths are removed, empty for a single path device.
+//Devices are the scsi devices deleted. Refused is why Detach won't touch the device, empty if it would.
+type DetachPlan struct {
+	DevicePath string
+	Holders    []string
+	Partitions []string
+	Map        string
+	Devices    []string
+	Refused    string
+}
+
+// WithDryRun makes Detach fill plan with what it would do instead of doing it. The safety checks
+// still run and Detach returns their error, so drivers can validate an unstage before committing.
+func WithDryRun(plan *DetachPlan) Option {
+	return func(o *options) {
+		o.dryRun = plan
+	}
+}
+
+// planDetach works out the teardown of devicePath without changing anything
+func planDetach(devicePath string, io ioHandler) (DetachPlan, error) {
+	dstPath, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return DetachPlan{}, err
+	}
+	plan := DetachPlan{DevicePath: dstPath}
+	if strings.HasPrefix(dstPath, "/dev/dm-") {
+		plan.Map = dstPath
+		plan.Devices = FindSlaveDevicesOnMultipath(dstPath, io)
+	} else {
+		// Add single devicepath to devices
+		plan.Devices = []string{dstPath}
+	}
+
+	dev := path.Base(dstPath)
+	if dirs, err := io.ReadDir(sysfs.DefaultLayout.Block(dev)); err == nil {
+		for _, f := range dirs {
+			if strings.HasPrefix(f.Name(), dev) {
+				plan.Partitions = append(plan.Partitions, "/dev/"+f.Name())
+			}
+		}
+	}
+	if holders, err := io.ReadDir(sysfs.DefaultLayout.BlockHolders(dev)); err == nil {
+		for _, f := range holders {
+			plan.Holders = append(plan.Holders, "/dev/"+f.Name())
+		}
+	}
+	return plan, nil
+}
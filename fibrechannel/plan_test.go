@@ -0,0 +1,56 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetachDryRun(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.links["/sys/block/dm-0/holders/dm-1"] = "../../dm-1"
+
+	var plan DetachPlan
+	client := NewClient(fs)
+	if err := client.Detach("vol", "/dev/mapper/mpatha", WithDryRun(&plan)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := DetachPlan{
+		DevicePath: "/dev/dm-0",
+		Holders:    []string{"/dev/dm-1"},
+		Map:        "/dev/dm-0",
+		Devices:    []string{"/dev/sdb", "/dev/sdc"},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("expected %+v, got %+v", expected, plan)
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("dry run wrote %v", fs.writes)
+	}
+
+	// a refused detach still reports its plan
+	plan = DetachPlan{}
+	if err := client.Detach("vol", "/dev/mapper/mpatha", WithDryRun(&plan), WithProtectedDevices("sdc")); err == nil {
+		t.Error("expected the protected device to refuse the detach")
+	}
+	if plan.Refused == "" || len(plan.Devices) != 2 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+}
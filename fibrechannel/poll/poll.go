@@ -0,0 +1,116 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package poll holds the context aware waiting, polling and retry helpers the fibre channel
+// packages use, exported so drivers building on partial operations wait the same way.
+package poll
+
+import (
+	"context"
+	"time"
+)
+
+//Clock is the source of time of the helpers, so tests can substitute one they control
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+//RealClock is the Clock of the time package
+type RealClock struct{}
+
+//Now calls Now from time package
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+//After calls After from time package
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func orReal(clock Clock) Clock {
+	if clock == nil {
+		return RealClock{}
+	}
+	return clock
+}
+
+// Sleep waits for d or until ctx is done, in which case it returns ctx's error. A nil clock is
+// the real one.
+func Sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-orReal(clock).After(d):
+		return nil
+	}
+}
+
+// Until calls condition right away and then every interval until it reports done, returns an
+// error or ctx is done, returning condition's or ctx's error
+func Until(ctx context.Context, clock Clock, interval time.Duration, condition func() (bool, error)) error {
+	for {
+		done, err := condition()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if err := Sleep(ctx, clock, interval); err != nil {
+			return err
+		}
+	}
+}
+
+//Backoff describes retries with exponentially growing delays: Initial before the second attempt,
+//then multiplied by Factor up to Max, for at most Steps attempts. A Factor below 1 counts as 1,
+//a zero Max means no limit.
+type Backoff struct {
+	Initial time.Duration
+	Factor  float64
+	Max     time.Duration
+	Steps   int
+}
+
+// Delay returns the delay after the given attempt, counted from 1
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Initial)
+	for i := 1; i < attempt; i++ {
+		if b.Factor > 1 {
+			d *= b.Factor
+		}
+		if b.Max > 0 && d >= float64(b.Max) {
+			return b.Max
+		}
+	}
+	return time.Duration(d)
+}
+
+// Retry calls fn until it succeeds, b.Steps attempts were made or ctx is done and returns fn's
+// last error, or ctx's if it ended the retries
+func Retry(ctx context.Context, clock Clock, b Backoff, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= b.Steps {
+			return err
+		}
+		if err := Sleep(ctx, clock, b.Delay(attempt)); err != nil {
+			return err
+		}
+	}
+}
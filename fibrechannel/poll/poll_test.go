@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package poll
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Millisecond, Factor: 2, Max: 50 * time.Millisecond}
+	expected := []time.Duration{10, 20, 40, 50, 50}
+	for i, d := range expected {
+		if delay := b.Delay(i + 1); delay != d*time.Millisecond {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, d*time.Millisecond, delay)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	b := Backoff{Initial: time.Millisecond, Factor: 2, Steps: 3}
+	calls := 0
+	err := Retry(context.Background(), nil, b, func() error {
+		calls++
+		return errors.New("busy")
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("expected 3 failed attempts, got %d, %v", calls, err)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), nil, b, func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("busy")
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("expected success on the second attempt, got %d, %v", calls, err)
+	}
+}
+
+func TestUntil(t *testing.T) {
+	calls := 0
+	err := Until(context.Background(), nil, time.Millisecond, func() (bool, error) {
+		calls++
+		return calls == 3, nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected 3 calls, got %d, %v", calls, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	err = Until(ctx, nil, time.Millisecond, func() (bool, error) { return false, nil })
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to end polling, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2018, 9, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	ch := c.After(time.Second)
+	if !c.HasWaiters() {
+		t.Fatal("expected a waiter")
+	}
+
+	c.Step(500 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatal("fired too early")
+	default:
+	}
+
+	c.Step(500 * time.Millisecond)
+	select {
+	case now := <-ch:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("unexpected time %v", now)
+		}
+	default:
+		t.Fatal("expected After to fire")
+	}
+	if c.HasWaiters() {
+		t.Error("expected no waiters")
+	}
+}
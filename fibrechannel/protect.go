@@ -0,0 +1,188 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// checkNotSystemDevice refuses devices the node itself depends on: active swap and the
+// hibernation resume device, on the device itself, one of its partitions or a device stacked on
+// it. Nodes that (mis)use SAN LUNs for swap must not lose them to a library driven removal.
+func checkNotSystemDevice(devicePath string, io ioHandler) error {
+	dev := path.Base(devicePath)
+	for _, swap := range activeSwapDevices(io) {
+		if usesDevice(swap, dev, io) {
+			return fmt.Errorf("fc: refusing to touch %s, %s is in use as swap", devicePath, swap)
+		}
+	}
+	if resume := sysfs.ReadAttr(sysfs.DefaultLayout.Path("power/resume"), io); resume != "" && resume != "0:0" {
+		for _, name := range append([]string{dev}, relatedDevices(dev, io)...) {
+			if sysfs.ReadAttr(sysfs.DefaultLayout.Path("class/block", name, "dev"), io) == resume {
+				return fmt.Errorf("fc: refusing to touch %s, %s is the hibernation resume device", devicePath, name)
+			}
+		}
+	}
+	return nil
+}
+
+// activeSwapDevices returns the kernel names (sdX, dm-N, ...) of the block devices in /proc/swaps
+func activeSwapDevices(io ioHandler) []string {
+	var devices []string
+	data, err := io.ReadFile("/proc/swaps")
+	if err != nil {
+		return devices
+	}
+	lines := strings.Split(string(data), "\n")
+	// the first line is the header: Filename Type Size Used Priority
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != "partition" {
+			continue
+		}
+		name := fields[0]
+		if resolved, err := io.EvalSymlinks(name); err == nil {
+			name = resolved
+		}
+		devices = append(devices, path.Base(name))
+	}
+	return devices
+}
+
+// usesDevice reports whether name is dev, one of its partitions or a device stacked on it
+func usesDevice(name, dev string, io ioHandler) bool {
+	if name == dev {
+		return true
+	}
+	for _, related := range relatedDevices(dev, io) {
+		if related == name {
+			return true
+		}
+	}
+	return false
+}
+
+// relatedDevices returns dev's partitions and holders, and recursively theirs
+func relatedDevices(dev string, io ioHandler) []string {
+	var related []string
+	if dirs, err := io.ReadDir(sysfs.DefaultLayout.Block(dev)); err == nil {
+		for _, f := range dirs {
+			// partitions are subdirectories named after the disk, sdb1 for sdb
+			if strings.HasPrefix(f.Name(), dev) {
+				related = append(related, f.Name())
+			}
+		}
+	}
+	if holders, err := io.ReadDir(sysfs.DefaultLayout.BlockHolders(dev)); err == nil {
+		for _, f := range holders {
+			related = append(related, f.Name())
+			related = append(related, relatedDevices(f.Name(), io)...)
+		}
+	}
+	return related
+}
+
+// checkNotReserved refuses the devices the node depends on and those the operator protected
+func (o *options) checkNotReserved(devicePath string, io ioHandler) error {
+	if err := checkNotSystemDevice(devicePath, io); err != nil {
+		return err
+	}
+	return o.checkNotProtected(devicePath, io)
+}
+
+// checkNotProtected refuses devices matching one of the operator's protected patterns
+func (o *options) checkNotProtected(devicePath string, io ioHandler) error {
+	if len(o.protected) == 0 {
+		return nil
+	}
+	dev := path.Base(devicePath)
+	names := []string{devicePath, dev}
+	if wwid := sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "device/wwid"), io); wwid != "" {
+		names = append(names, wwid)
+	}
+	for _, pattern := range o.protected {
+		for _, name := range names {
+			if matched, err := path.Match(pattern, name); err == nil && matched {
+				return fmt.Errorf("fc: refusing to touch %s, %s matches protected pattern %q", devicePath, name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// checkDetachAllowed runs the safety checks on every device of plan
+func (o *options) checkDetachAllowed(plan DetachPlan, io ioHandler) error {
+	for _, device := range append([]string{plan.DevicePath}, plan.Devices...) {
+		if err := checkNotSystemDevice(device, io); err != nil {
+			return err
+		}
+		if err := o.checkNotProtected(device, io); err != nil {
+			return err
+		}
+		if err := checkIsDisk(device, io); err != nil {
+			return err
+		}
+		if err := o.checkWWID(device, io); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWWID refuses a device whose wwid isn't the one recorded for the volume at attach, or one
+// of its Connector's. sdX names are handed out in discovery order: when a path went away between
+// stage and unstage and its name was reused for another LUN, that LUN must not be removed along
+// with the volume. Without a recorded wwid, and for devices whose wwid can't be read, there is
+// nothing to compare.
+func (o *options) checkWWID(devicePath string, io ioHandler) error {
+	expected := o.wwids
+	if o.wwid != "" {
+		expected = []string{o.wwid}
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+	wwid := deviceWWID(devicePath, io)
+	if wwid == "" {
+		return nil
+	}
+	for _, w := range expected {
+		if strings.EqualFold(wwid, wwn.SCSIID(wwn.FromIdentifier(w))) {
+			return nil
+		}
+	}
+	return errorf(ErrIdentityMismatch, "fc: refusing to remove %s, its wwid %s is not one of the volume's %s", devicePath, wwid, strings.Join(expected, ", "))
+}
+
+// checkIsDisk refuses scsi devices that aren't disks, tapes and changers of a media server sharing
+// the HBAs must never be removed along with a volume
+func checkIsDisk(devicePath string, io ioHandler) error {
+	hctl, err := scsi.DeviceHCTL(path.Base(devicePath), io)
+	if err != nil {
+		// not a scsi device, e.g. the multipath map
+		return nil
+	}
+	if !scsi.IsDisk(hctl, io) {
+		return fmt.Errorf("fc: refusing to touch %s, %s is scsi device type %d, not a disk", devicePath, hctl, scsi.DeviceType(hctl, io))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+const swapsHeader = "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n"
+
+func TestDetachRefusesSwap(t *testing.T) {
+	tests := []struct {
+		name  string
+		swaps string
+	}{
+		{"whole disk", "/dev/sdb                                partition\t4194300\t\t0\t\t-2\n"},
+		{"partition", "/dev/sdb1                               partition\t4194300\t\t0\t\t-2\n"},
+		{"stacked map", "/dev/mapper/mpatha                      partition\t4194300\t\t0\t\t-2\n"},
+	}
+	for _, test := range tests {
+		fs := newFakeSysfs()
+		fs.files["/dev/sdb"] = ""
+		fs.files["/sys/block/sdb/sdb1/partition"] = "1"
+		fs.links["/sys/block/sdb/holders/dm-0"] = "/sys/devices/virtual/block/dm-0"
+		fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+		fs.files["/proc/swaps"] = swapsHeader + test.swaps
+
+		if err := Detach("/dev/sdb", fs); err == nil {
+			t.Errorf("%s: expected detach of a swap device to be refused", test.name)
+		}
+		if len(fs.writes) != 0 {
+			t.Errorf("%s: expected nothing to be written, got %v", test.name, fs.writes)
+		}
+	}
+}
+
+func TestDetachRefusesResumeDevice(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.files["/dev/sdb"] = ""
+	fs.files["/sys/class/block/sdb/dev"] = "8:16\n"
+	fs.files["/sys/power/resume"] = "8:16\n"
+	if err := Detach("/dev/sdb", fs); err == nil {
+		t.Error("expected detach of the resume device to be refused")
+	}
+
+	fs.files["/sys/power/resume"] = "0:0\n"
+	fs.files["/proc/swaps"] = swapsHeader + "/swapfile                               file\t\t4194300\t\t0\t\t-2\n"
+	if err := Detach("/dev/sdb", fs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDetachRefusesProtectedDevices(t *testing.T) {
+	tests := []struct {
+		name      string
+		patterns  []string
+		protected bool
+	}{
+		{"no patterns", nil, false},
+		{"device path", []string{"/dev/sd[a-c]"}, true},
+		{"kernel name", []string{"sdb"}, true},
+		{"wwid", []string{"naa.600a0980383030*"}, true},
+		{"other array", []string{"naa.6000d31000*"}, false},
+	}
+	for _, test := range tests {
+		fs := newFakeSysfs()
+		fs.files["/dev/sdb"] = ""
+		fs.files["/sys/block/sdb/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+
+		client := NewClient(fs, WithProtectedDevices(test.patterns...))
+		err := client.Detach("vol", "/dev/sdb")
+		if test.protected && (err == nil || len(fs.writes) != 0) {
+			t.Errorf("%s: expected detach to be refused, got %v, writes %v", test.name, err, fs.writes)
+		}
+		if !test.protected && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestDetachRefusesNonDisks(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.files["/dev/sdb"] = ""
+	fs.links["/sys/block/sdb/device"] = "/sys/devices/pci0000:40/0000:40:01.0/host5/rport-5:0-0/target5:0:0/5:0:0:3"
+	fs.files["/sys/bus/scsi/devices/5:0:0:3/type"] = "8\n"
+	if err := Detach("/dev/sdb", fs); err == nil {
+		t.Error("expected detach of a medium changer to be refused")
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("expected nothing to be written, got %v", fs.writes)
+	}
+
+	fs.files["/sys/bus/scsi/devices/5:0:0:3/type"] = "0\n"
+	if err := Detach("/dev/sdb", fs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// volume context keys understood by ParseIOLimits
+const (
+	ReadBPSKey   = "readBPS"
+	WriteBPSKey  = "writeBPS"
+	ReadIOPSKey  = "readIOPS"
+	WriteIOPSKey = "writeIOPS"
+	IOWeightKey  = "ioWeight"
+)
+
+//IOLimits are cgroup v2 io controller settings for one volume, zero means unlimited/default
+type IOLimits struct {
+	ReadBPS   uint64
+	WriteBPS  uint64
+	ReadIOPS  uint64
+	WriteIOPS uint64
+	Weight    uint64
+}
+
+// ParseIOLimits reads IOLimits from a CSI volume context, keys that are absent stay unlimited
+func ParseIOLimits(volumeContext map[string]string) (IOLimits, error) {
+	var limits IOLimits
+	fields := map[string]*uint64{
+		ReadBPSKey:   &limits.ReadBPS,
+		WriteBPSKey:  &limits.WriteBPS,
+		ReadIOPSKey:  &limits.ReadIOPS,
+		WriteIOPSKey: &limits.WriteIOPS,
+		IOWeightKey:  &limits.Weight,
+	}
+	for key, field := range fields {
+		value, ok := volumeContext[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return limits, fmt.Errorf("fc: invalid %s %q: %v", key, value, err)
+		}
+		*field = n
+	}
+	if limits.Weight > 10000 {
+		return limits, fmt.Errorf("fc: %s must be between 1 and 10000, got %d", IOWeightKey, limits.Weight)
+	}
+	return limits, nil
+}
+
+// ApplyIOLimits programs limits for the attached device devicePath into the cgroup v2 directory
+// cgroupPath. FC volumes have no array-agnostic QoS hook, the node's io controller is the one
+// place a requested limit can be enforced. The weight goes to io.bfq.weight where the bfq
+// scheduler provides it and to io.weight otherwise. System devices and those matching
+// WithProtectedDevices are refused.
+func ApplyIOLimits(devicePath, cgroupPath string, limits IOLimits, io ioHandler, opts ...Option) (err error) {
+	defer recoverPanic("ApplyIOLimits", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	o := newOptions(opts)
+	if o.invalid != nil {
+		return o.invalid
+	}
+
+	dev, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return err
+	}
+	if err := o.checkNotReserved(dev, io); err != nil {
+		return err
+	}
+	majMin := sysfs.ReadAttr(sysfs.DefaultLayout.Block(path.Base(dev), "dev"), io)
+	if majMin == "" {
+		return fmt.Errorf("fc: unable to find the device number of %s", dev)
+	}
+
+	max := []string{majMin}
+	for _, limit := range []struct {
+		key   string
+		value uint64
+	}{
+		{"rbps", limits.ReadBPS},
+		{"wbps", limits.WriteBPS},
+		{"riops", limits.ReadIOPS},
+		{"wiops", limits.WriteIOPS},
+	} {
+		value := "max"
+		if limit.value != 0 {
+			value = strconv.FormatUint(limit.value, 10)
+		}
+		max = append(max, limit.key+"="+value)
+	}
+	if err := writeCgroupFile(path.Join(cgroupPath, "io.max"), strings.Join(max, " "), io); err != nil {
+		return err
+	}
+
+	if limits.Weight == 0 {
+		return nil
+	}
+	weight := fmt.Sprintf("%s %d", majMin, limits.Weight)
+	for _, file := range []string{"io.bfq.weight", "io.weight"} {
+		name := path.Join(cgroupPath, file)
+		if _, err := io.Lstat(name); err == nil {
+			return writeCgroupFile(name, weight, io)
+		}
+	}
+	return fmt.Errorf("fc: cgroup %s has neither io.bfq.weight nor io.weight", cgroupPath)
+}
+
+func writeCgroupFile(name, value string, io ioHandler) error {
+	glog.Infof("fc: writing %q to %s", value, name)
+	if err := io.WriteFile(name, []byte(value), 0644); err != nil {
+		return fmt.Errorf("fc: unable to write %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+func TestParseIOLimits(t *testing.T) {
+	limits, err := ParseIOLimits(map[string]string{ReadBPSKey: "104857600", WriteIOPSKey: "5000", "other": "x"})
+	if err != nil || limits != (IOLimits{ReadBPS: 104857600, WriteIOPS: 5000}) {
+		t.Errorf("unexpected limits %+v, %v", limits, err)
+	}
+	if _, err := ParseIOLimits(map[string]string{ReadIOPSKey: "-1"}); err == nil {
+		t.Error("expected an error for a negative limit")
+	}
+	if _, err := ParseIOLimits(map[string]string{IOWeightKey: "20000"}); err == nil {
+		t.Error("expected an error for an out of range weight")
+	}
+}
+
+func TestApplyIOLimits(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.files["/sys/block/dm-0/dev"] = "253:0\n"
+	fs.files["/sys/fs/cgroup/kubepods/pod1/io.max"] = ""
+	fs.files["/sys/fs/cgroup/kubepods/pod1/io.weight"] = "default 100\n"
+
+	limits := IOLimits{ReadBPS: 104857600, WriteIOPS: 5000, Weight: 200}
+	if err := ApplyIOLimits("/dev/mapper/mpatha", "/sys/fs/cgroup/kubepods/pod1", limits, fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if max := fs.writes["/sys/fs/cgroup/kubepods/pod1/io.max"]; max != "253:0 rbps=104857600 wbps=max riops=max wiops=5000" {
+		t.Errorf("unexpected io.max %q", max)
+	}
+	if weight := fs.writes["/sys/fs/cgroup/kubepods/pod1/io.weight"]; weight != "253:0 200" {
+		t.Errorf("unexpected io.weight %q", weight)
+	}
+
+	fs.writes = map[string]string{}
+	if err := ApplyIOLimits("/dev/mapper/mpatha", "/sys/fs/cgroup/kubepods/pod1", limits, fs, WithProtectedDevices("dm-0")); err == nil || len(fs.writes) != 0 {
+		t.Errorf("expected a protected device to be refused, got %v %v", err, fs.writes)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"path"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// maxUnitAttentions bounds the TEST UNIT READYs per path, a device queues a few unit attentions
+// at most
+const maxUnitAttentions = 8
+
+// WithUnitAttentionDrain makes Attach send TEST UNIT READY through every path of the device it
+// found until the path has no unit attention left. A freshly mapped LUN queues some on every
+// path, e.g. power on or reset and reported luns data changed, which the first I/O of the
+// workload would otherwise receive as errors. Attach fails with ErrDeviceBusy if no path becomes
+// ready.
+func WithUnitAttentionDrain() Option {
+	return func(o *options) {
+		o.drainUnitAttentions = true
+	}
+}
+
+// checkReady drains the unit attentions of every path of devicePath, if asked to, and fails if
+// none of them is ready afterwards. When c has preferred target port groups the paths through them
+// are drained first and, once one of them is ready, the others aren't: on active-passive arrays
+// the non-optimized paths may take until their timeout to answer.
+func (o *options) checkReady(c Connector, devicePath string, io ioHandler) error {
+	if !o.drainUnitAttentions {
+		return nil
+	}
+	paths := getDeviceInfo(devicePath, io).Paths
+	preferred, others := preferredPaths(paths, c.TargetPortGroups, io)
+	ready := 0
+	for _, group := range [][]string{preferred, others} {
+		if ready > 0 {
+			if len(group) > 0 {
+				glog.Infof("fc: a preferred path of %s is ready, not verifying %v", devicePath, group)
+			}
+			break
+		}
+		for _, p := range group {
+			if err := drainUnitAttentions(p); err != nil {
+				glog.Warningf("fc: path %s of %s is not ready: %v", p, devicePath, err)
+				continue
+			}
+			ready++
+		}
+	}
+	if ready == 0 && len(paths) > 0 {
+		return errorf(ErrDeviceBusy, "fc: none of the %d paths of %s is ready", len(paths), devicePath)
+	}
+	return nil
+}
+
+// preferredPaths splits paths into those through one of the target port groups tpgs and the
+// others. The group of a path is read from the Device Identification VPD page the kernel cached,
+// a path without one is not preferred.
+func preferredPaths(paths []string, tpgs []uint16, io ioHandler) (preferred, others []string) {
+	if len(tpgs) == 0 {
+		return nil, paths
+	}
+	for _, p := range paths {
+		page, err := io.ReadFile(sysfs.DefaultLayout.Block(path.Base(p), "device/vpd_pg83"))
+		if err != nil {
+			others = append(others, p)
+			continue
+		}
+		designators, err := scsi.ParseDeviceIdentification(page)
+		if err != nil {
+			others = append(others, p)
+			continue
+		}
+		tpg, ok := scsi.TargetPortGroup(designators)
+		if !ok || !containsTPG(tpgs, tpg) {
+			others = append(others, p)
+			continue
+		}
+		preferred = append(preferred, p)
+	}
+	return preferred, others
+}
+
+func containsTPG(tpgs []uint16, tpg uint16) bool {
+	for _, t := range tpgs {
+		if t == tpg {
+			return true
+		}
+	}
+	return false
+}
+
+// drainUnitAttentions sends TEST UNIT READY to device until it reports something other than a
+// unit attention, and returns that
+func drainUnitAttentions(device string) error {
+	var err error
+	for i := 0; i < maxUnitAttentions; i++ {
+		err = scsi.TestUnitReady(device)
+		var sense *scsi.SenseError
+		if !errors.As(err, &sense) || sense.Key != scsi.SenseKeyUnitAttention {
+			return err
+		}
+		glog.Infof("fc: cleared unit attention (asc %#x ascq %#x) of %s", sense.ASC, sense.ASCQ, device)
+	}
+	return err
+}
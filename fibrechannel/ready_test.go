@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+func TestUnitAttentionDrain(t *testing.T) {
+	defer func(send func(string, *scsi.Command) error) { scsi.Send = send }(scsi.Send)
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.files["/dev/sdb"] = ""
+	fs.files["/sys/block/sdb/size"] = "2097152"
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+
+	// power on reset, then reported luns data changed
+	pending := []*scsi.SenseError{{Key: scsi.SenseKeyUnitAttention, ASC: 0x29}, {Key: scsi.SenseKeyUnitAttention, ASC: 0x3f, ASCQ: 0x0e}}
+	turs := 0
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		turs++
+		if len(pending) == 0 {
+			return nil
+		}
+		ua := pending[0]
+		pending = pending[1:]
+		return ua
+	}
+	if _, err := Attach(c, fs, WithUnitAttentionDrain()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if turs != 3 {
+		t.Errorf("expected 3 TEST UNIT READYs, got %d", turs)
+	}
+
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		return &scsi.SenseError{Key: scsi.SenseKeyNotReady, ASC: 0x04, ASCQ: 0x01}
+	}
+	if _, err := Attach(c, fs, WithUnitAttentionDrain()); !errors.Is(err, ErrDeviceBusy) {
+		t.Errorf("expected ErrDeviceBusy without a ready path, got %v", err)
+	}
+}
+
+func TestReadyPrefersTargetPortGroups(t *testing.T) {
+	defer func(send func(string, *scsi.Command) error) { scsi.Send = send }(scsi.Send)
+	fs := mapFixture()
+	fs.files["/dev/dm-0"] = ""
+	fs.files["/dev/sdb"] = ""
+	fs.files["/dev/sdc"] = ""
+	// sdb is through target port group 1, sdc through group 2
+	page := func(tpg byte) string {
+		return "\x00\x83\x00\x08" + "\x01\x15\x00\x04\x00\x00\x00" + string([]byte{tpg})
+	}
+	fs.files["/sys/block/sdb/device/vpd_pg83"] = page(1)
+	fs.files["/sys/block/sdc/device/vpd_pg83"] = page(2)
+
+	var turs []string
+	ready := map[string]bool{"/dev/sdb": true, "/dev/sdc": true}
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		turs = append(turs, device)
+		if !ready[device] {
+			return &scsi.SenseError{Key: scsi.SenseKeyNotReady, ASC: 0x04, ASCQ: 0x0b}
+		}
+		return nil
+	}
+	o := newOptions([]Option{WithUnitAttentionDrain()})
+	c := Connector{VolumeName: "vol", WWIDs: []string{"3600a098038303053743f463045727a41"}, TargetPortGroups: []uint16{2}}
+	if err := o.checkReady(c, "/dev/dm-0", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(turs) != 1 || turs[0] != "/dev/sdc" {
+		t.Errorf("expected only the preferred path to be verified, got %v", turs)
+	}
+
+	// the other paths are verified when no preferred one is ready
+	turs, ready["/dev/sdc"] = nil, false
+	if err := o.checkReady(c, "/dev/dm-0", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(turs) != 2 || turs[0] != "/dev/sdc" || turs[1] != "/dev/sdb" {
+		t.Errorf("expected the preferred path first, then the other one, got %v", turs)
+	}
+
+	// without hints every path is verified
+	turs, ready["/dev/sdc"] = nil, true
+	c.TargetPortGroups = nil
+	if err := o.checkReady(c, "/dev/dm-0", fs); err != nil || len(turs) != 2 {
+		t.Errorf("expected both paths to be verified, got %v %v", turs, err)
+	}
+}
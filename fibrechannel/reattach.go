@@ -0,0 +1,156 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"errors"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+var errTimeout = errors.New("timed out")
+
+const (
+	teardownTimeout      = 10 * time.Second
+	teardownPollInterval = 100 * time.Millisecond
+)
+
+// tearingDown reports whether the scsi device behind dev (sdX) is being deleted. The kernel moves
+// it to "cancel" when the delete starts and "deleted" once it is gone but still referenced.
+func tearingDown(dev string, io ioHandler) bool {
+	switch sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "device/state"), io) {
+	case "cancel", "deleted":
+		return true
+	}
+	return false
+}
+
+// teardownDevices returns the candidates' disks, and the paths of their maps, that are being deleted
+func teardownDevices(candidates []candidate, io ioHandler) []string {
+	var devices []string
+	seen := map[string]bool{}
+	check := func(dev string) {
+		if !seen[dev] && tearingDown(dev, io) {
+			devices = append(devices, dev)
+		}
+		seen[dev] = true
+	}
+	for _, c := range candidates {
+		check(path.Base(c.disk))
+		if c.dm != "" {
+			for _, slave := range multipath.Slaves(c.dm, io) {
+				check(path.Base(slave))
+			}
+		}
+	}
+	return devices
+}
+
+// awaitTeardown handles a volume re-attached seconds after it was detached from this node, e.g.
+// a pod rescheduled to the same node: the previous instance's devices may still be going away
+// and must not be handed out, nor the map they're in, which would carry their failed paths. It
+// waits until none of the candidates' devices are being deleted, clears what multipathd kept of
+// the previous instance and reports whether it had to, in which case the caller must discover
+// again.
+func awaitTeardown(ctx context.Context, candidates []candidate, io ioHandler, clock poll.Clock, timeout time.Duration) (bool, error) {
+	devices := teardownDevices(candidates, io)
+	if len(devices) == 0 {
+		return false, nil
+	}
+	glog.Infof("fc: waiting for the previous instance of the volume to be removed: %v", devices)
+	deadline := clock.Now().Add(timeout)
+	err := poll.Until(ctx, clock, teardownPollInterval, func() (bool, error) {
+		if clock.Now().After(deadline) {
+			return false, errTimeout
+		}
+		var remaining []string
+		for _, dev := range devices {
+			if tearingDown(dev, io) {
+				remaining = append(remaining, dev)
+			}
+		}
+		devices = remaining
+		return len(devices) == 0, nil
+	})
+	if err == errTimeout {
+		return true, errorf(ErrDeviceBusy, "fc: devices %v of a previous attachment are still being removed", devices)
+	}
+	if err != nil {
+		return true, err
+	}
+	clearStaleMaps(candidates, io)
+	return true, nil
+}
+
+// clearStaleMaps runs once the previous instance's devices are gone and before the volume is
+// searched again. multipathd may still hold the previous instance's map, and the wwid it was
+// created for, with the paths that didn't go away cleanly in it. Paths of the candidates' maps
+// that aren't running are removed from multipathd and a map left without a running path is
+// deleted, so the map is rebuilt from the new paths only. Without multipathd running there is
+// nothing to clear.
+func clearStaleMaps(candidates []candidate, io ioHandler) {
+	ids := map[string]bool{}
+	for _, c := range candidates {
+		if c.dm != "" {
+			ids[c.dm] = true
+		} else if c.wwid != "" {
+			ids[wwn.SCSIID(c.wwid)] = true
+		}
+	}
+	if len(ids) == 0 || !multipathdRunning(io) {
+		return
+	}
+	paths, err := multipath.Paths()
+	if err != nil {
+		glog.Infof("fc: not clearing stale multipath state: %v", err)
+		return
+	}
+	cleared := map[string]bool{}
+	for id := range ids {
+		m, ok, err := multipath.ShowMap(id)
+		if err != nil || !ok || cleared[m.Name] {
+			continue
+		}
+		cleared[m.Name] = true
+		running := 0
+		for _, p := range paths {
+			if p.Map != m.Name {
+				continue
+			}
+			if sysfs.ReadAttr(sysfs.DefaultLayout.Block(p.Device, "device/state"), io) == "running" {
+				running++
+				continue
+			}
+			glog.Infof("fc: removing path %s of %s left by the previous attachment", p.Device, m.Name)
+			if err := multipath.RemovePath(p.Device); err != nil {
+				glog.Warningf("%v", err)
+			}
+		}
+		if running == 0 {
+			glog.Infof("fc: removing map %s of wwid %s left by the previous attachment", m.Name, m.WWID)
+			if err := multipath.FlushMap(m.Name); err != nil {
+				glog.Warningf("%v", err)
+			}
+		}
+	}
+}
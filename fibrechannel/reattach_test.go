@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	polltesting "github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll/testing"
+)
+
+// deletingSysfs reports the devices in deleting as being deleted for a few state reads, after
+// which they disappear, as the kernel does when a detach is still in progress
+type deletingSysfs struct {
+	*fakeSysfs
+	deleting map[string]int
+}
+
+func (fs *deletingSysfs) ReadFile(filename string) ([]byte, error) {
+	if path.Base(filename) == "state" {
+		dev := path.Base(path.Dir(path.Dir(filename)))
+		if reads, ok := fs.deleting[dev]; ok {
+			if reads == 0 {
+				return nil, &os.PathError{Op: "open", Path: filename, Err: os.ErrNotExist}
+			}
+			fs.deleting[dev] = reads - 1
+			return []byte("deleted\n"), nil
+		}
+	}
+	return fs.fakeSysfs.ReadFile(filename)
+}
+
+func TestAwaitTeardown(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	multipath.Command = func(args ...string) (string, error) { return "", errors.New("multipathd is not running") }
+	fs := &deletingSysfs{fakeSysfs: newFakeSysfs(), deleting: map[string]int{"sdc": 2}}
+	fs.files["/sys/block/sdb/device/state"] = "running\n"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	candidates := []candidate{{disk: "/dev/sdb", dm: "/dev/dm-0"}}
+
+	waited, err := awaitTeardown(context.Background(), candidates, fs, poll.RealClock{}, teardownTimeout)
+	if err != nil || !waited {
+		t.Errorf("expected to wait for sdc, got %v, %v", waited, err)
+	}
+	if waited, err := awaitTeardown(context.Background(), candidates, fs, poll.RealClock{}, teardownTimeout); err != nil || waited {
+		t.Errorf("expected no wait once sdc is gone, got %v, %v", waited, err)
+	}
+}
+
+func TestAwaitTeardownTimeout(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.files["/sys/block/sdb/device/state"] = "deleted\n"
+	clock := polltesting.NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go clock.StepUntilDone(teardownPollInterval, done)
+	defer close(done)
+
+	if _, err := awaitTeardown(context.Background(), []candidate{{disk: "/dev/sdb"}}, fs, clock, teardownTimeout); err == nil {
+		t.Error("expected the wait to time out")
+	}
+}
+
+func TestClearStaleMaps(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	var commands []string
+	multipath.Command = func(args ...string) (string, error) {
+		cmd := strings.Join(args, " ")
+		switch {
+		case strings.HasPrefix(cmd, "show maps"):
+			return "mpatha 3600a098038303053453f463045727a44 dm-0 active 2\nmpathb 3600a098038303053453f463045727a45 dm-1 active 1\n", nil
+		case strings.HasPrefix(cmd, "show paths"):
+			return "sdb mpatha active ready\nsdc mpatha failed faulty\nsdd mpathb failed faulty\n", nil
+		}
+		commands = append(commands, cmd)
+		return "ok\n", nil
+	}
+
+	fs := newFakeSysfs()
+	fs.files["/sys/block/sdb/device/state"] = "running\n"
+	fs.files["/sys/block/sdc/device/state"] = "offline\n"
+	fs.files["/sys/block/sdd/device/state"] = "transport-offline\n"
+	fs.files["/run/multipathd.pid"] = "1234\n"
+	candidates := []candidate{
+		{disk: "/dev/sdb", dm: "/dev/dm-0"},
+		{disk: "/dev/sdd", wwid: "naa.600a098038303053453f463045727a45"},
+	}
+	clearStaleMaps(candidates, fs)
+
+	sort.Strings(commands)
+	expected := []string{"del map mpathb", "remove path sdc", "remove path sdd"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected %v, got %v", expected, commands)
+	}
+}
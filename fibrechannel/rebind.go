@@ -0,0 +1,163 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// WithDriverRebind lets Attach and Prefetch recover an HBA whose discovery is stuck, as a last
+// resort when the rescans found nothing: the fc hosts are first asked to log into the fabric again
+// with a LIP, and if that finds nothing either the driver of each host is unbound from the HBA and
+// bound again, which resets it like a reload of the driver module. A host is only rebound if no
+// device is attached through it or any other port of the same HBA, since the rebind removes them
+// all; hosts the node uses for volumes are left alone and Attach fails with ErrDiskNotFound.
+func WithDriverRebind() Option {
+	return func(o *options) {
+		o.driverRebind = true
+	}
+}
+
+// recoverDiscovery escalates from a LIP to a driver rebind of the hosts that should see c and
+// returns the candidates found after the first step that finds any
+func (o *options) recoverDiscovery(c Connector, io ioHandler, deadline time.Time) []candidate {
+	hosts := zonedHosts(c, io)
+	if len(hosts) == 0 {
+		dirs, err := io.ReadDir(sysfs.DefaultLayout.FCHosts())
+		if err != nil {
+			return nil
+		}
+		for _, f := range dirs {
+			hosts = append(hosts, f.Name())
+		}
+	}
+
+	steps := []struct {
+		name string
+		do   func(host string) error
+	}{
+		{"LIP", func(host string) error { return issueLIP(host, io) }},
+		{"driver rebind", func(host string) error { return o.rebindHostDriver(host, io) }},
+	}
+	for _, step := range steps {
+		done := 0
+		for _, host := range hosts {
+			if err := step.do(host); err != nil {
+				glog.Warningf("fc: %s of %s failed: %v", step.name, host, err)
+				continue
+			}
+			done++
+		}
+		if done == 0 {
+			continue
+		}
+		if o.timeout > 0 && !o.clock.Now().Before(deadline) {
+			return nil
+		}
+		if err := o.rescanAndWait(c, io, deadline); err != nil {
+			return nil
+		}
+		if candidates := findCandidates(c, io); len(candidates) > 0 {
+			glog.Infof("fc: %s found the volume %s", step.name, c.VolumeName)
+			return candidates
+		}
+	}
+	return nil
+}
+
+// issueLIP makes the local fc port host log into the fabric again
+func issueLIP(host string, io ioHandler) error {
+	if !canIssueLIP(host, io) {
+		return fmt.Errorf("fc: the driver of %s doesn't support issue_lip", host)
+	}
+	name := path.Join(sysfs.DefaultLayout.FCHost(host), "issue_lip")
+	glog.Infof("fc: issuing a LIP on %s", host)
+	return io.WriteFile(name, []byte("1"), 0200)
+}
+
+// rebindHostDriver unbinds the driver of host's HBA from it and binds it again, unless a device
+// is attached through one of the HBA's ports
+func (o *options) rebindHostDriver(host string, io ioHandler) error {
+	scsiHost, err := io.EvalSymlinks(sysfs.DefaultLayout.SCSIHost(host))
+	if err != nil {
+		return err
+	}
+	// /sys/devices/pci0000:00/0000:41:00.0/host5/scsi_host/host5, the HBA is the parent of host5
+	elems := strings.Split(scsiHost, "/")
+	hba := ""
+	for i, elem := range elems {
+		if elem == host && i > 0 {
+			hba = strings.Join(elems[:i], "/")
+			break
+		}
+	}
+	if hba == "" {
+		return fmt.Errorf("fc: no HBA found for %s in %s", host, scsiHost)
+	}
+	// an attach bringing up a device on the HBA between the check and the unbind would lose it
+	if o.scanLock != nil {
+		o.scanLock.Lock()
+		defer o.scanLock.Unlock()
+	}
+	dirs, err := io.ReadDir(hba)
+	if err != nil {
+		return err
+	}
+	for _, f := range dirs {
+		if strings.HasPrefix(f.Name(), "host") {
+			if err := checkHostUnused(f.Name(), io); err != nil {
+				return err
+			}
+		}
+	}
+	driver, err := io.EvalSymlinks(path.Join(hba, "driver"))
+	if err != nil {
+		return err
+	}
+
+	device := path.Base(hba)
+	glog.Warningf("fc: rebinding %s of %s to recover discovery", path.Base(driver), device)
+	o.event(EventTypeWarning, ReasonDriverRebound, "rebinding driver %s of HBA %s (%s) to recover discovery", path.Base(driver), device, host)
+	if err := io.WriteFile(path.Join(driver, "unbind"), []byte(device), 0200); err != nil {
+		return err
+	}
+	return io.WriteFile(path.Join(driver, "bind"), []byte(device), 0200)
+}
+
+// checkHostUnused fails if a device other than an array's controller LUN is attached through host
+func checkHostUnused(host string, io ioHandler) error {
+	hostNumber := strings.TrimPrefix(host, "host")
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.SCSIDevices())
+	if err != nil {
+		// no scsi devices at all
+		return nil
+	}
+	for _, f := range dirs {
+		hctl := f.Name()
+		if !strings.HasPrefix(hctl, hostNumber+":") || scsi.IsControllerLUN(hctl, io) {
+			continue
+		}
+		return errorf(ErrDeviceBusy, "fc: refusing to rebind the driver of %s, %s is attached through it", host, hctl)
+	}
+	return nil
+}
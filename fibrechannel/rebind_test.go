@@ -0,0 +1,139 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// rebindSysfs brings the volume's disk up once the HBA driver is bound again
+type rebindSysfs struct {
+	*fakeSysfs
+}
+
+func (fs rebindSysfs) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	if filename == "/sys/bus/pci/drivers/qla2xxx/bind" {
+		fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+		fs.files["/dev/sdb"] = ""
+		fs.files["/sys/block/sdb/size"] = "2097152"
+	}
+	return fs.fakeSysfs.WriteFile(filename, data, perm)
+}
+
+func rebindFixture() *fakeSysfs {
+	fs := newFakeSysfs()
+	fs.files["/sys/class/fc_host/host5/port_state"] = "Online\n"
+	fs.files["/sys/class/fc_host/host5/issue_lip"] = ""
+	fs.links["/sys/class/scsi_host/host5"] = "/sys/devices/pci0000:00/0000:41:00.0/host5/scsi_host/host5"
+	fs.files["/sys/devices/pci0000:00/0000:41:00.0/host5/scsi_host/host5/proc_name"] = "qla2xxx\n"
+	fs.links["/sys/devices/pci0000:00/0000:41:00.0/driver"] = "/sys/bus/pci/drivers/qla2xxx"
+	return fs
+}
+
+func TestDriverRebind(t *testing.T) {
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+	fs := rebindFixture()
+	var events []recordedEvent
+	devicePath, err := Attach(c, rebindSysfs{fs}, WithoutRescan(), WithDriverRebind(), WithEvents(recordEvents(&events)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if devicePath != "/dev/sdb" {
+		t.Errorf("expected /dev/sdb, got %s", devicePath)
+	}
+	if fs.writes["/sys/class/fc_host/host5/issue_lip"] != "1" {
+		t.Errorf("expected a LIP before the rebind, got %v", fs.writes)
+	}
+	if fs.writes["/sys/bus/pci/drivers/qla2xxx/unbind"] != "0000:41:00.0" || fs.writes["/sys/bus/pci/drivers/qla2xxx/bind"] != "0000:41:00.0" {
+		t.Errorf("expected the HBA to be rebound, got %v", fs.writes)
+	}
+	if len(events) != 1 || events[0].reason != ReasonDriverRebound {
+		t.Errorf("expected a %s event, got %+v", ReasonDriverRebound, events)
+	}
+
+	// a driver without issue_lip goes straight to the rebind
+	fs = rebindFixture()
+	delete(fs.files, "/sys/class/fc_host/host5/issue_lip")
+	if _, err := Attach(c, rebindSysfs{fs}, WithoutRescan(), WithDriverRebind()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := fs.writes["/sys/class/fc_host/host5/issue_lip"]; ok || fs.writes["/sys/bus/pci/drivers/qla2xxx/bind"] != "0000:41:00.0" {
+		t.Errorf("expected the rebind without a LIP, got %v", fs.writes)
+	}
+
+	// not opted in
+	fs = rebindFixture()
+	if _, err := Attach(c, rebindSysfs{fs}, WithoutRescan()); !errors.Is(err, ErrDiskNotFound) {
+		t.Errorf("expected ErrDiskNotFound, got %v", err)
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("expected no recovery without WithDriverRebind, got %v", fs.writes)
+	}
+}
+
+func TestDriverRebindKeepsUsedHBA(t *testing.T) {
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+	fs := rebindFixture()
+	// another volume is attached through the second port of the HBA
+	fs.files["/sys/devices/pci0000:00/0000:41:00.0/host6/scsi_host/host6/proc_name"] = "qla2xxx\n"
+	fs.files["/sys/bus/scsi/devices/6:0:0:3/type"] = "0\n"
+	if _, err := Attach(c, rebindSysfs{fs}, WithoutRescan(), WithDriverRebind()); !errors.Is(err, ErrDiskNotFound) {
+		t.Fatalf("expected ErrDiskNotFound, got %v", err)
+	}
+	if fs.writes["/sys/class/fc_host/host5/issue_lip"] != "1" {
+		t.Errorf("expected a LIP, got %v", fs.writes)
+	}
+	if _, ok := fs.writes["/sys/bus/pci/drivers/qla2xxx/unbind"]; ok {
+		t.Errorf("expected the driver of the HBA in use to stay bound, got %v", fs.writes)
+	}
+}
+
+// heldLock is a sync.Locker that knows whether it is held
+type heldLock struct {
+	held bool
+}
+
+func (l *heldLock) Lock()   { l.held = true }
+func (l *heldLock) Unlock() { l.held = false }
+
+// lockCheckingSysfs records whether lock was held when the HBA's hosts were listed
+type lockCheckingSysfs struct {
+	*fakeSysfs
+	lock          *heldLock
+	checkedLocked bool
+}
+
+func (fs *lockCheckingSysfs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	if dirname == "/sys/devices/pci0000:00/0000:41:00.0" {
+		fs.checkedLocked = fs.lock.held
+	}
+	return fs.fakeSysfs.ReadDir(dirname)
+}
+
+func TestDriverRebindChecksHostsUnderScanLock(t *testing.T) {
+	lock := &heldLock{}
+	fs := &lockCheckingSysfs{fakeSysfs: rebindFixture(), lock: lock}
+	o := newOptions(nil)
+	o.scanLock = lock
+	if err := o.rebindHostDriver("host5", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !fs.checkedLocked {
+		t.Error("expected the hosts of the HBA to be checked under the scan lock")
+	}
+}
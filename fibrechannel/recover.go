@@ -0,0 +1,34 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/golang/glog"
+)
+
+// recoverPanic turns a panic in a public entry point into an error carrying the stack. A panic in
+// a CSI node plugin takes down volume operations for every pod on the node, unexpected sysfs
+// content must fail the one operation instead. Use it as the first deferred call of a function
+// with a named error result.
+func recoverPanic(op string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("fc: %s panicked: %v\n%s", op, r, debug.Stack())
+		glog.Errorf("%v", *err)
+	}
+}
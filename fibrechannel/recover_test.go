@@ -0,0 +1,45 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// nilInfoIOHandler returns a nil FileInfo from ReadDir, like a broken handler would
+type nilInfoIOHandler struct {
+	fakeIOHandler
+}
+
+func (handler *nilInfoIOHandler) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return []os.FileInfo{nil}, nil
+}
+
+func TestPublicAPIRecoversPanics(t *testing.T) {
+	fakeConnector := Connector{
+		VolumeName: "fakeVol",
+		TargetWWNs: []string{"500a0981891b8dc5"},
+		Lun:        "0",
+	}
+	if _, err := Attach(fakeConnector, &nilInfoIOHandler{}); err == nil || !strings.Contains(err.Error(), "Attach panicked") {
+		t.Errorf("expected a panic error from Attach, got %v", err)
+	}
+	if _, err := GetHBAs(&nilInfoIOHandler{}); err == nil || !strings.Contains(err.Error(), "GetHBAs panicked") {
+		t.Errorf("expected a panic error from GetHBAs, got %v", err)
+	}
+}
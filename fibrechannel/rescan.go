@@ -0,0 +1,211 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//RescanStrategy makes the kernel discover the LUNs of volumes before Attach and Prefetch search for
+//their devices. Rescan is called with every volume of the operation at once, AttachMulti's too,
+//under the Client's rescan lock; the errors it returns are logged and the search goes ahead.
+//WildcardRescan is the default, environments whose SAN policy forbids scanning more than the
+//volume's LUN use TargetedRescan or ReportLUNsRescan.
+type RescanStrategy interface {
+	Rescan(cs []Connector, io sysfs.IO) error
+}
+
+// WithRescanStrategy rescans with strategy, for a Client when passed to NewClient. A Connector's
+// own RescanStrategy takes precedence. It replaces WithTargetedRescan.
+func WithRescanStrategy(strategy RescanStrategy) Option {
+	return func(o *options) {
+		o.rescanStrategy = strategy
+	}
+}
+
+// WildcardRescan scans every channel, target and lun of the hosts that see one of a connector's
+// targets, or of all hosts when none is known yet or the connector identifies the volume by WWID
+func WildcardRescan() RescanStrategy {
+	return wildcardRescan{}
+}
+
+// TargetedRescan only asks the hosts that see one of a connector's targets to scan the
+// connector's lun on that target. Connectors whose targets the node doesn't see, or without
+// targets, aren't scanned at all.
+func TargetedRescan() RescanStrategy {
+	return targetedRescan{}
+}
+
+// ReportLUNsRescan asks each of a connector's targets for the luns it exports with REPORT LUNS,
+// through a device the node already has on the target, and scans the connector's lun only once
+// the target reports it. A volume not yet mapped to the node costs no scan. Targets the node has
+// no device on get the scan of TargetedRescan.
+func ReportLUNsRescan() RescanStrategy {
+	return reportLUNsRescan{}
+}
+
+// NoRescan scans nothing, Attach and Prefetch wait for the devices to appear on their own, e.g.
+// through the driver's or udev's rescans on fabric events
+func NoRescan() RescanStrategy {
+	return noRescan{}
+}
+
+type wildcardRescan struct{}
+
+func (wildcardRescan) Rescan(cs []Connector, io sysfs.IO) error {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, c := range cs {
+		zoned := zonedHosts(c, io)
+		if len(zoned) == 0 {
+			rescanHosts(io)
+			return nil
+		}
+		for _, host := range zoned {
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if err := rescanHost(host, io); err != nil {
+			glog.Warningf("fc: rescan of %s failed: %v", host, err)
+		}
+	}
+	return nil
+}
+
+// targetedRescan falls back to the wildcard scan for the connectors it can't scan, as
+// WithTargetedRescan does
+type targetedRescan struct {
+	fallback bool
+}
+
+func (s targetedRescan) Rescan(cs []Connector, io sysfs.IO) error {
+	var unscanned []Connector
+	for _, c := range cs {
+		if !scanTargets(c, io) {
+			unscanned = append(unscanned, c)
+		}
+	}
+	if len(unscanned) == 0 {
+		return nil
+	}
+	if s.fallback {
+		return wildcardRescan{}.Rescan(unscanned, io)
+	}
+	for _, c := range unscanned {
+		glog.Infof("fc: no target of volume %s visible, not scanning", c.VolumeName)
+	}
+	return nil
+}
+
+type reportLUNsRescan struct{}
+
+func (reportLUNsRescan) Rescan(cs []Connector, io sysfs.IO) error {
+	for _, c := range cs {
+		lun, err := scsi.KernelLUN(c.Lun)
+		if err != nil {
+			glog.Infof("fc: volume %s has no lun to scan for", c.VolumeName)
+			continue
+		}
+		for _, targetWWN := range c.TargetWWNs {
+			for _, target := range scsi.FindTargets(targetWWN, io) {
+				if device := targetDevice(target, io); device != "" {
+					luns, err := scsi.ReportLUNs(device)
+					if err != nil {
+						glog.Warningf("fc: REPORT LUNS of target %s through %s failed, scanning anyway: %v", target, device, err)
+					} else if !containsLUN(luns, lun) {
+						glog.Infof("fc: target %s doesn't report lun %s of volume %s, not scanning", target, c.Lun, c.VolumeName)
+						continue
+					}
+				}
+				if err := scanTarget(target, kernelLun(c.Lun), io); err != nil {
+					glog.Warningf("fc: scan of lun %s on target %s failed: %v", c.Lun, target, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// targetDevice returns a device REPORT LUNS can be sent to on target (H:C:T): the block device or
+// scsi generic device of any of its luns, "" if the node has none
+func targetDevice(target string, io sysfs.IO) string {
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.SCSIDevices())
+	if err != nil {
+		return ""
+	}
+	for _, f := range dirs {
+		hctl := f.Name()
+		if !strings.HasPrefix(hctl, target+":") {
+			continue
+		}
+		if devices := scsi.BlockDevices(hctl, io); len(devices) > 0 {
+			return "/dev/" + devices[0]
+		}
+		if sg, err := io.ReadDir(path.Join(sysfs.DefaultLayout.SCSIDevice(hctl), "scsi_generic")); err == nil && len(sg) > 0 {
+			return "/dev/" + sg[0].Name()
+		}
+	}
+	return ""
+}
+
+func containsLUN(luns []uint64, lun uint64) bool {
+	for _, l := range luns {
+		if l == lun {
+			return true
+		}
+	}
+	return false
+}
+
+type noRescan struct{}
+
+func (noRescan) Rescan(cs []Connector, io sysfs.IO) error {
+	return nil
+}
+
+// strategy returns the strategy of the operation, for the connectors without one of their own
+func (o *options) strategy() RescanStrategy {
+	switch {
+	case o.rescanStrategy != nil:
+		return o.rescanStrategy
+	case o.targetedRescan:
+		return targetedRescan{fallback: true}
+	}
+	return wildcardRescan{}
+}
+
+// withoutWildcard returns strategy without the scans of every lun of a host, for the boot window
+// of WithBootRescanSuppression
+func withoutWildcard(strategy RescanStrategy) RescanStrategy {
+	switch strategy.(type) {
+	case wildcardRescan:
+		return noRescan{}
+	case targetedRescan:
+		return targetedRescan{}
+	}
+	return strategy
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+func strategyFixture() *fakeSysfs {
+	fs := newFakeSysfs()
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/scsi_host/host6/proc_name"] = "lpfc\n"
+	fs.files["/sys/class/fc_transport/target6:0:2/port_name"] = "0x500a0981891b8dc5\n"
+	return fs
+}
+
+// countingStrategy records the volumes it was asked to scan for
+type countingStrategy struct {
+	volumes *[]string
+}
+
+func (s countingStrategy) Rescan(cs []Connector, io sysfs.IO) error {
+	for _, c := range cs {
+		*s.volumes = append(*s.volumes, c.VolumeName)
+	}
+	return nil
+}
+
+func TestRescanStrategies(t *testing.T) {
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "7"}
+	unzoned := Connector{VolumeName: "other", TargetWWNs: []string{"500a0981891b8dc9"}, Lun: "1"}
+
+	fs := strategyFixture()
+	newOptions([]Option{WithRescanStrategy(TargetedRescan())}).rescanAll([]Connector{c, unzoned}, fs)
+	if len(fs.writes) != 1 || fs.writes["/sys/class/scsi_host/host6/scan"] != "0 2 7" {
+		t.Errorf("expected only lun 7 of target 6:0:2 to be scanned, got %v", fs.writes)
+	}
+
+	fs = strategyFixture()
+	newOptions([]Option{WithRescanStrategy(WildcardRescan())}).rescan(c, fs)
+	if len(fs.writes) != 1 || fs.writes["/sys/class/scsi_host/host6/scan"] != "- - -" {
+		t.Errorf("expected a wildcard scan of host6, got %v", fs.writes)
+	}
+
+	fs = strategyFixture()
+	newOptions([]Option{WithRescanStrategy(NoRescan())}).rescan(c, fs)
+	if len(fs.writes) != 0 {
+		t.Errorf("expected no scan, got %v", fs.writes)
+	}
+
+	// the connector's strategy wins over the Client's
+	var volumes []string
+	fs = strategyFixture()
+	client := NewClient(fs, WithRescanStrategy(countingStrategy{&volumes}))
+	o := client.options(nil)
+	c.RescanStrategy = NoRescan()
+	o.rescanAll([]Connector{c, unzoned}, fs)
+	if len(volumes) != 1 || volumes[0] != "other" || len(fs.writes) != 0 {
+		t.Errorf("expected only the other volume to be scanned by the Client's strategy, got %v %v", volumes, fs.writes)
+	}
+}
+
+func TestReportLUNsRescan(t *testing.T) {
+	defer func(send func(string, *scsi.Command) error) { scsi.Send = send }(scsi.Send)
+	var sentTo []string
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		sentTo = append(sentTo, device)
+		// luns 0, 3 and 256
+		binary.BigEndian.PutUint32(cmd.Data, 24)
+		cmd.Data[8+8+1] = 3
+		cmd.Data[8+16], cmd.Data[8+16+1] = 0x41, 0x00
+		return nil
+	}
+	fs := strategyFixture()
+	fs.files["/sys/bus/scsi/devices/6:0:2:0/scsi_generic/sg1/dev"] = "21:1\n"
+	strategy := WithRescanStrategy(ReportLUNsRescan())
+
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "7"}
+	newOptions([]Option{strategy}).rescan(c, fs)
+	if len(fs.writes) != 0 {
+		t.Errorf("expected no scan for a lun the target doesn't report, got %v", fs.writes)
+	}
+	if len(sentTo) != 1 || sentTo[0] != "/dev/sg1" {
+		t.Errorf("expected REPORT LUNS to be sent through the target's controller lun, got %v", sentTo)
+	}
+
+	for lun, scan := range map[string]string{"3": "0 2 3", "256": "0 2 16640"} {
+		c.Lun = lun
+		fs.writes = map[string]string{}
+		newOptions([]Option{strategy}).rescan(c, fs)
+		if len(fs.writes) != 1 || fs.writes["/sys/class/scsi_host/host6/scan"] != scan {
+			t.Errorf("lun %s: expected the scan %q, got %v", lun, scan, fs.writes)
+		}
+	}
+
+	// without a device to ask, the lun is scanned
+	sentTo = nil
+	fs = strategyFixture()
+	c.Lun = "7"
+	newOptions([]Option{strategy}).rescan(c, fs)
+	if len(sentTo) != 0 || fs.writes["/sys/class/scsi_host/host6/scan"] != "0 2 7" {
+		t.Errorf("expected lun 7 to be scanned, got %v %v", sentTo, fs.writes)
+	}
+}
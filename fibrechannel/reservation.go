@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+// WithReservationKeyDeregistration makes Detach unregister this node's persistent reservation
+// key from every path of the volume before removing them, so fencing deployments don't keep a
+// registration for a volume the node no longer uses after its pod moved. A failure is reported
+// as an FCDeregistrationFailed warning event and doesn't stop the detach. Shared volumes (see
+// WithSharedVolume) keep their registrations.
+func WithReservationKeyDeregistration(key uint64) Option {
+	return func(o *options) {
+		o.prKey = key
+		o.prDeregister = true
+	}
+}
+
+// deregisterKey unregisters the node's reservation key from devices, if asked to
+func (o *options) deregisterKey(dstPath string, devices []string) {
+	if !o.prDeregister {
+		return
+	}
+	if o.shared {
+		glog.Infof("fc: keeping the reservation key of shared volume %s registered", dstPath)
+		return
+	}
+	for _, device := range devices {
+		if err := scsi.UnregisterKey(device, o.prKey); err != nil {
+			glog.Warningf("fc: unable to unregister the reservation key through %s: %v", device, err)
+			o.event(EventTypeWarning, ReasonDeregistrationFailed, "unable to unregister the reservation key of %s through %s: %v", dstPath, device, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+func TestReservationKeyDeregistration(t *testing.T) {
+	defer func(send func(string, *scsi.Command) error) { scsi.Send = send }(scsi.Send)
+	var unregistered []string
+	scsi.Send = func(device string, cmd *scsi.Command) error {
+		unregistered = append(unregistered, device)
+		if device == "/dev/sdc" {
+			return errors.New("path down")
+		}
+		return nil
+	}
+	newFS := func() *fakeSysfs {
+		fs := newFakeSysfs()
+		fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+		fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+		fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+		return fs
+	}
+
+	var events []recordedEvent
+	fs := newFS()
+	if err := Detach("/dev/mapper/mpatha", fs, WithReservationKeyDeregistration(0x1234), WithEvents(recordEvents(&events))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(unregistered) != 2 {
+		t.Errorf("expected the key to be unregistered through both paths, got %v", unregistered)
+	}
+	if len(events) == 0 || events[0].reason != ReasonDeregistrationFailed {
+		t.Errorf("expected an event for the failed path, got %v", events)
+	}
+	if fs.writes["/sys/block/sdc/device/delete"] != "1" {
+		t.Errorf("expected the detach to go on, got %v", fs.writes)
+	}
+
+	unregistered = nil
+	if err := Detach("/dev/mapper/mpatha", newFS(), WithReservationKeyDeregistration(0x1234), WithSharedVolume()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(unregistered) != 0 {
+		t.Errorf("expected a shared volume to keep its registrations, got %v", unregistered)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+// resizeTimeout is how long ResizeMultipathDevice waits for the map to take the new size, unless
+// Timeouts.Resize says otherwise
+const resizeTimeout = 30 * time.Second
+
+// ResizeMultipathDevice has multipathd resize the multipath map dm (/dev/dm-N or
+// /dev/mapper/<name>) to the size of its paths, and waits until the map's new table is loaded
+// and the device reports that size. multipathd answers as soon as it sent the new table, reading
+// the size of the map right after can still return the old one. The paths must have been
+// rescanned first: paths that disagree on the size fail with a *SizeMismatchError and the map is
+// left alone. It returns the size of the map in bytes.
+func ResizeMultipathDevice(dm string, io ioHandler, opts ...Option) (size int64, err error) {
+	defer recoverPanic("ResizeMultipathDevice", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	o := newOptions(opts)
+	if o.invalid != nil {
+		return 0, o.invalid
+	}
+	dev, err := io.EvalSymlinks(dm)
+	if err != nil {
+		return 0, err
+	}
+	info := getDeviceInfo(dev, io)
+	if !info.Multipath || info.MapName == "" {
+		return 0, errorf(ErrNoMultipathDevice, "fc: %s is not a multipath device", dm)
+	}
+	if err := CheckPathSizes(dev, io); err != nil {
+		return 0, err
+	}
+	for _, p := range info.Paths {
+		if size = scsi.DeviceSize(path.Base(p), io); size != 0 {
+			break
+		}
+	}
+	if size == 0 {
+		return 0, fmt.Errorf("fc: no path of %s reports its size", dm)
+	}
+	if info.Size == size {
+		return size, nil
+	}
+
+	if !multipathdRunning(io) {
+		return 0, fmt.Errorf("fc: multipathd isn't running to resize %s", info.MapName)
+	}
+	glog.Infof("fc: resizing multipath map %s (%s) from %d to %d bytes", info.MapName, dev, info.Size, size)
+	if err := multipath.ResizeMap(info.MapName); err != nil {
+		return 0, fmt.Errorf("fc: multipathd failed to resize %s: %v", info.MapName, err)
+	}
+	deadline := o.clock.Now().Add(o.resize)
+	err = poll.Until(o.ctx, o.clock, multipathPollInterval, func() (bool, error) {
+		if scsi.DeviceSize(path.Base(dev), io) == size {
+			return true, nil
+		}
+		if !o.clock.Now().Before(deadline) {
+			return false, errTimeout
+		}
+		return false, nil
+	})
+	if err == errTimeout {
+		return 0, fmt.Errorf("fc: multipath map %s (%s) still has %d bytes %v after it was resized to %d", info.MapName, dev, scsi.DeviceSize(path.Base(dev), io), o.resize, size)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	polltesting "github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll/testing"
+)
+
+func resizeFixture() *fakeSysfs {
+	fs := mapFixture()
+	for _, dev := range []string{"dm-0", "sdb", "sdc"} {
+		fs.files["/dev/"+dev] = ""
+		fs.files["/sys/block/"+dev+"/size"] = "2097152"
+	}
+	fs.files["/sys/block/sdb/size"] = "4194304"
+	fs.files["/sys/block/sdc/size"] = "4194304"
+	return fs
+}
+
+func TestResizeMultipathDevice(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	fs := resizeFixture()
+	clock := polltesting.NewFakeClock(time.Now())
+	resized := clock.Now().Add(time.Second)
+	var commands []string
+	multipath.Command = func(args ...string) (string, error) {
+		commands = append(commands, strings.Join(args, " "))
+		return "ok\n", nil
+	}
+	// the new table is loaded a second after multipathd answered
+	sized := sizeAfter{fs, clock, resized}
+	done := make(chan struct{})
+	go clock.StepUntilDone(multipathPollInterval, done)
+
+	size, err := ResizeMultipathDevice("/dev/mapper/mpatha", sized, WithClock(clock))
+	close(done)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size != 2147483648 {
+		t.Errorf("expected 2147483648 bytes, got %d", size)
+	}
+	if len(commands) != 1 || commands[0] != "resize map mpatha" {
+		t.Errorf("unexpected multipathd commands %q", commands)
+	}
+	if clock.Now().Before(resized) {
+		t.Errorf("returned before the map took the new size")
+	}
+
+	// nothing to do for a map of its paths' size
+	commands = nil
+	fs.files["/sys/block/dm-0/size"] = "4194304"
+	if size, err := ResizeMultipathDevice("/dev/dm-0", fs); err != nil || size != 2147483648 || len(commands) != 0 {
+		t.Errorf("expected the map to be left alone, got %d %v %q", size, err, commands)
+	}
+
+	if _, err := ResizeMultipathDevice("/dev/sdb", fs); !errors.Is(err, ErrNoMultipathDevice) {
+		t.Errorf("expected ErrNoMultipathDevice, got %v", err)
+	}
+
+	// only multipathd reloads the map with the new size
+	fs.files["/sys/block/dm-0/size"] = "2097152"
+	delete(fs.files, "/run/multipathd.pid")
+	if _, err := ResizeMultipathDevice("/dev/dm-0", fs); err == nil || len(commands) != 0 {
+		t.Errorf("expected the resize to fail without multipathd, got %v %q", err, commands)
+	}
+}
+
+func TestResizeMultipathDeviceTimeout(t *testing.T) {
+	defer func(command func(...string) (string, error)) { multipath.Command = command }(multipath.Command)
+	multipath.Command = func(args ...string) (string, error) { return "ok\n", nil }
+	clock := polltesting.NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go clock.StepUntilDone(time.Second, done)
+	defer close(done)
+
+	_, err := ResizeMultipathDevice("/dev/dm-0", resizeFixture(), WithClock(clock))
+	if err == nil || !strings.Contains(err.Error(), "still has 1073741824 bytes") {
+		t.Errorf("expected the map not taking the new size to fail, got %v", err)
+	}
+}
+
+// sizeAfter is fs with the map dm-0 taking the size of its paths once the clock reaches at
+type sizeAfter struct {
+	*fakeSysfs
+	clock *polltesting.FakeClock
+	at    time.Time
+}
+
+func (fs sizeAfter) ReadFile(filename string) ([]byte, error) {
+	if filename == "/sys/block/dm-0/size" && !fs.clock.Now().Before(fs.at) {
+		return []byte("4194304\n"), nil
+	}
+	return fs.fakeSysfs.ReadFile(filename)
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// WithWWID tells Detach the WWID of the volume, in the sysfs (naa.600a...) or the scsi_id form
+// (3600a...). If the devicePath Detach was given no longer resolves, the volume's devices are
+// looked up by WWID instead. Detach refuses with ErrIdentityMismatch to remove a device reporting
+// another WWID. A Client remembers the WWID of the volumes it attached by itself.
+func WithWWID(wwid string) Option {
+	return func(o *options) {
+		o.wwid = wwid
+	}
+}
+
+// DetachVolume detaches the volume c identifies. Its device is resolved from the connector's
+// target WWNs and lun, or its WWIDs, as Attach finds it but without rescanning, so a driver whose
+// NodeUnstageVolume only has the publish context needn't persist the device path at stage time.
+// A volume none of whose devices is left is already detached and DetachVolume returns nil. The
+// devices of a Connector with WWIDs, e.g. one LoadConnector read, must report one of them to be
+// removed, as with WithWWID.
+func DetachVolume(c Connector, io ioHandler, opts ...Option) (err error) {
+	defer recoverPanic("DetachVolume", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	return detachVolume(c, io, newOptions(opts))
+}
+
+func detachVolume(c Connector, io ioHandler, o *options) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	o.summary.volume, o.labels = c.VolumeName, c.Labels
+	if o.wwid == "" {
+		o.wwids = c.WWIDs
+	}
+	devicePath := resolveConnector(c, io)
+	if devicePath == "" {
+		glog.Infof("fc: no device of volume %s left, nothing to detach", c.VolumeName)
+		return nil
+	}
+	glog.Infof("fc: detaching %s resolved for volume %s", devicePath, c.VolumeName)
+	return detach(devicePath, io, o)
+}
+
+// resolveConnector returns the device Attach finds for c, the multipath map of its paths if they
+// have one, or "" when none of them is present
+func resolveConnector(c Connector, io ioHandler) string {
+	candidates := findCandidates(c, io)
+	if len(candidates) == 0 {
+		// the by-path links may be gone before the disks
+		for _, wwid := range c.WWIDs {
+			if device := findDeviceByWWID(wwid, io); device != "" {
+				return device
+			}
+		}
+		for _, targetWWN := range c.uniqueTargetWWNs() {
+			if device := findDeviceByTarget(targetWWN, c.Lun, io); device != "" {
+				return device
+			}
+		}
+		return ""
+	}
+	best := selectCandidate(candidates, c.WWIDs)
+	if best.dm != "" {
+		return best.dm
+	}
+	return best.disk
+}
+
+// resolveDetachPath resolves devicePath for Detach. When it's gone, e.g. udev already removed the
+// by-path link on a NodeUnstage retry, the device is looked up by the volume's WWID or, for a
+// by-path link, by the target and lun in its name. gone reports that nothing of the volume is
+// left, which Detach treats as success so that retries converge. A device that is gone and can be
+// looked up neither way fails, the volume's paths may still be there.
+func resolveDetachPath(devicePath string, io ioHandler, o *options) (resolved string, gone bool, err error) {
+	if _, err := io.EvalSymlinks(devicePath); err == nil || !os.IsNotExist(err) {
+		return devicePath, false, err
+	}
+	if o.wwid != "" {
+		if device := findDeviceByWWID(o.wwid, io); device != "" {
+			glog.Infof("fc: %s no longer exists, detaching %s found by wwid %s", devicePath, device, o.wwid)
+			return device, false, nil
+		}
+		glog.Infof("fc: %s no longer exists and no device has wwid %s, nothing to detach", devicePath, o.wwid)
+		return "", true, nil
+	}
+	p, perr := ParseFCPath(path.Base(devicePath))
+	if perr != nil || p.Partition != "" {
+		return "", false, fmt.Errorf("fc: %s no longer exists and the volume's wwid is unknown, unable to tell whether its devices are gone", devicePath)
+	}
+	if device := findDeviceByTarget(p.WWN, p.Lun, io); device != "" {
+		glog.Infof("fc: %s no longer exists, detaching %s found on target %s lun %s", devicePath, device, p.WWN, p.Lun)
+		return device, false, nil
+	}
+	glog.Infof("fc: %s no longer exists and target %s has no device on lun %s, nothing to detach", devicePath, p.WWN, p.Lun)
+	return "", true, nil
+}
+
+// findDeviceByTarget returns the multipath map of the scsi disks sysfs has for lun on the targets
+// named targetWWN, or the first of them if they have none
+func findDeviceByTarget(targetWWN, lun string, io ioHandler) string {
+	var disks []string
+	for _, hctl := range findHCTLs(targetWWN, lun, io) {
+		for _, dev := range scsi.BlockDevices(hctl, io) {
+			disks = append(disks, "/dev/"+dev)
+		}
+	}
+	return mapOrFirst(disks, io)
+}
+
+// findDeviceByWWID returns the multipath map of the scsi disks with the given wwid, or the first
+// of them if they have none
+func findDeviceByWWID(wantWWID string, io ioHandler) string {
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.Blocks())
+	if err != nil {
+		return ""
+	}
+	var disks []string
+	for _, f := range dirs {
+		dev := f.Name()
+		if !strings.HasPrefix(dev, "sd") {
+			continue
+		}
+		sysfsWWID := sysfs.ReadAttr(sysfs.DefaultLayout.Block(dev, "device/wwid"), io)
+		if strings.EqualFold(sysfsWWID, wantWWID) || wwn.SameWWID(sysfsWWID, wantWWID) {
+			disks = append(disks, "/dev/"+dev)
+		}
+	}
+	return mapOrFirst(disks, io)
+}
+
+// mapOrFirst returns the multipath map of disks, or the first of them if they have none
+func mapOrFirst(disks []string, io ioHandler) string {
+	for _, disk := range disks {
+		if dm, err := FindMultipathDeviceForDevice(disk, io); err == nil && dm != "" {
+			return dm
+		}
+	}
+	if len(disks) > 0 {
+		return disks[0]
+	}
+	return ""
+}
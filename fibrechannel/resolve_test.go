@@ -0,0 +1,204 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDetachAlreadyGone(t *testing.T) {
+	fs := newFakeSysfs()
+	if err := Detach("/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-0", fs); err != nil {
+		t.Errorf("expected detach of a vanished device to succeed, got %v", err)
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("unexpected writes %v", fs.writes)
+	}
+}
+
+func TestDetachResolvesByWWID(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.files["/sys/block/sdb/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+	fs.files["/sys/block/sdc/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+	fs.files["/sys/block/sdd/device/wwid"] = "naa.600a098038303053453f463045727a45\n"
+	fs.files["/sys/block/dm-0/dm/uuid"] = "mpath-3600a098038303053453f463045727a44\n"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.files["/dev/sdb"] = ""
+	fs.files["/dev/sdc"] = ""
+	fs.files["/dev/dm-0"] = ""
+
+	err := Detach("/dev/disk/by-id/dm-uuid-mpath-3600a098038303053453f463045727a44", fs, WithWWID("3600a098038303053453f463045727a44"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fs.writes["/sys/block/sdb/device/delete"] != "1" || fs.writes["/sys/block/sdc/device/delete"] != "1" || len(fs.writes) != 2 {
+		t.Errorf("expected sdb and sdc to be deleted, got %v", fs.writes)
+	}
+}
+
+func TestDetachVolume(t *testing.T) {
+	fixture := func() *fakeSysfs {
+		fs := newFakeSysfs()
+		fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+		fs.links["/dev/disk/by-path/pci-0000:41:00.1-fc-0x500a0981891b8dc6-lun-1"] = "/dev/sdc"
+		for _, dev := range []string{"sdb", "sdc"} {
+			fs.files["/dev/"+dev] = ""
+			fs.files["/sys/block/"+dev+"/size"] = "2097152"
+			fs.files["/sys/block/"+dev+"/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+			fs.links["/sys/block/dm-0/slaves/"+dev] = "../../" + dev
+		}
+		fs.files["/sys/block/dm-0/dm/uuid"] = "mpath-3600a098038303053453f463045727a44\n"
+		fs.files["/dev/dm-0"] = ""
+		return fs
+	}
+	deleted := func(fs *fakeSysfs) bool {
+		return fs.writes["/sys/block/sdb/device/delete"] == "1" && fs.writes["/sys/block/sdc/device/delete"] == "1" && len(fs.writes) == 2
+	}
+
+	fs := fixture()
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5", "500a0981891b8dc6"}, Lun: "1"}
+	if err := DetachVolume(c, fs, WithoutBufferFlush()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !deleted(fs) {
+		t.Errorf("expected both paths of the map to be deleted, got %v", fs.writes)
+	}
+
+	// the by-path links are gone already, the WWID still finds the disks
+	fs = fixture()
+	for name := range fs.links {
+		if strings.HasPrefix(name, "/dev/disk/by-path/") {
+			delete(fs.links, name)
+		}
+	}
+	c = Connector{VolumeName: "vol", WWIDs: []string{"3600a098038303053453f463045727a44"}}
+	if err := NewClient(fs).DetachVolume(c, WithoutBufferFlush()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !deleted(fs) {
+		t.Errorf("expected both paths of the map to be deleted, got %v", fs.writes)
+	}
+
+	fs = newFakeSysfs()
+	if err := DetachVolume(c, fs); err != nil {
+		t.Errorf("expected the detach of a volume without devices to succeed, got %v", err)
+	}
+	if err := DetachVolume(Connector{VolumeName: "vol"}, fs); err == nil {
+		t.Error("expected a connector without targets or WWIDs to be refused")
+	}
+}
+
+func TestAttachByIdentifier(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-id/scsi-3600a098038303053453f463045727a44"] = "/dev/sdb"
+	fs.files["/dev/sdb"] = ""
+	fs.files["/sys/block/sdb/size"] = "2097152"
+	fs.files["/sys/block/sdb/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+
+	c := Connector{VolumeName: "vol", WWIDs: []string{"naa.600A098038303053453F463045727A44"}}
+	devicePath, err := Attach(c, fs, WithoutRescan())
+	if err != nil || devicePath != "/dev/sdb" {
+		t.Fatalf("expected /dev/sdb, got %q %v", devicePath, err)
+	}
+	if err := DetachVolume(c, fs, WithoutBufferFlush()); err != nil || fs.writes["/sys/block/sdb/device/delete"] != "1" {
+		t.Errorf("expected sdb to be deleted, got %v %v", err, fs.writes)
+	}
+}
+
+func TestDetachVerifiesWWID(t *testing.T) {
+	fixture := func() *fakeSysfs {
+		fs := newFakeSysfs()
+		fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/dm-0"
+		for _, dev := range []string{"sdb", "sdc"} {
+			fs.files["/dev/"+dev] = ""
+			fs.files["/sys/block/"+dev+"/device/wwid"] = "naa.600a098038303053453f463045727a44\n"
+			fs.links["/sys/block/dm-0/slaves/"+dev] = "../../" + dev
+		}
+		fs.files["/sys/block/dm-0/dm/uuid"] = "mpath-3600a098038303053453f463045727a44\n"
+		fs.files["/dev/dm-0"] = ""
+		return fs
+	}
+	devicePath := "/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"
+
+	for _, wwid := range []string{"naa.600a098038303053453f463045727a44", "3600A098038303053453F463045727A44"} {
+		fs := fixture()
+		if err := Detach(devicePath, fs, WithWWID(wwid), WithoutBufferFlush()); err != nil {
+			t.Errorf("%s: unexpected error: %v", wwid, err)
+		}
+	}
+
+	// sdc was renumbered to another LUN since the volume was staged
+	fs := fixture()
+	fs.files["/sys/block/sdc/device/wwid"] = "naa.600a098038303053453f463045727a45\n"
+	err := Detach(devicePath, fs, WithWWID("3600a098038303053453f463045727a44"), WithoutBufferFlush())
+	if !errors.Is(err, ErrIdentityMismatch) || !strings.Contains(err.Error(), "/dev/sdc") {
+		t.Errorf("expected sdc to be refused with ErrIdentityMismatch, got %v", err)
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("expected nothing to be removed, got %v", fs.writes)
+	}
+
+	// the map itself belongs to another volume
+	fs = fixture()
+	err = Detach(devicePath, fs, WithWWID("3600a098038303053453f463045727a45"), WithoutBufferFlush())
+	if !errors.Is(err, ErrIdentityMismatch) || !strings.Contains(err.Error(), "/dev/dm-0") {
+		t.Errorf("expected the map to be refused with ErrIdentityMismatch, got %v", err)
+	}
+
+	// the WWID of a loaded Connector is verified too
+	fs = fixture()
+	fs.files["/sys/block/sdc/device/wwid"] = "naa.600a098038303053453f463045727a45\n"
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1", WWIDs: []string{"naa.600a098038303053453f463045727a44"}}
+	if err := DetachVolume(c, fs, WithoutBufferFlush()); !errors.Is(err, ErrIdentityMismatch) || len(fs.writes) != 0 {
+		t.Errorf("expected the detach to be refused, got %v %v", err, fs.writes)
+	}
+
+	// with several WWIDs each device must report one of them
+	c.WWIDs = []string{"naa.600a098038303053453f463045727a46", "naa.600a098038303053453f463045727a45"}
+	if err := DetachVolume(c, fs, WithoutBufferFlush()); !errors.Is(err, ErrIdentityMismatch) || len(fs.writes) != 0 {
+		t.Errorf("expected the detach to be refused, got %v %v", err, fs.writes)
+	}
+	c.WWIDs = append(c.WWIDs, "naa.600a098038303053453f463045727a44")
+	if err := DetachVolume(c, fs, WithoutBufferFlush()); err != nil || fs.writes["/sys/block/sdc/device/delete"] != "1" {
+		t.Errorf("expected the detach to go ahead, got %v %v", err, fs.writes)
+	}
+}
+
+func TestDetachGoneLinkWithoutWWID(t *testing.T) {
+	fs := newFakeFCDisk("sdb")
+	fs.files["/dev/sdb"] = ""
+	fs.links["/sys/block/sdb/device"] = "/sys/devices/pci0000:40/0000:40:01.1/0000:41:00.0/host5/rport-5:0-0/target5:0:0/5:0:0:0"
+	devicePath := "/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-0"
+
+	// a Client restarted since the attach doesn't know the WWID, the target and lun of the link
+	// still find the disk
+	if err := NewClient(fs).Detach("vol", devicePath, WithoutBufferFlush()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fs.writes["/sys/block/sdb/device/delete"] != "1" {
+		t.Errorf("expected sdb to be deleted, got %v", fs.writes)
+	}
+
+	if err := Detach("/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1", fs); err != nil {
+		t.Errorf("expected the detach of a lun without devices to succeed, got %v", err)
+	}
+	if err := Detach("/dev/sdx", fs); err == nil {
+		t.Error("expected a gone device without a WWID to fail")
+	}
+}
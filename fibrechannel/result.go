@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"path"
+	"strings"
+)
+
+//DeviceResult is the outcome of removing one scsi device, Err is nil if it was removed
+type DeviceResult struct {
+	Device string
+	Err    error
+}
+
+//DetachResult lists what a Detach did to every device of the volume. Remaining holds the block
+//devices of the volume, paths and map, that were still present when Detach returned; a Detach
+//that failed before removing anything lists all of them, or the device it was given if it didn't
+//get as far as finding them.
+type DetachResult struct {
+	Devices   []DeviceResult
+	Remaining []string
+}
+
+// Complete reports whether every device was removed and nothing of the volume remains, i.e. the
+// volume can be reported as unstaged
+func (r DetachResult) Complete() bool {
+	if len(r.Remaining) != 0 {
+		return false
+	}
+	for _, d := range r.Devices {
+		if d.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// err summarizes the failed devices of the result, nil if none failed
+func (r DetachResult) err() error {
+	var failed []string
+	busy := false
+	for _, d := range r.Devices {
+		if d.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", d.Device, d.Err))
+			busy = busy || isBusy(d.Err)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	if busy {
+		return errorf(ErrDeviceBusy, "fc: failed to remove %d of %d devices: %s", len(failed), len(r.Devices), strings.Join(failed, "; "))
+	}
+	return fmt.Errorf("fc: failed to remove %d of %d devices: %s", len(failed), len(r.Devices), strings.Join(failed, "; "))
+}
+
+// WithDetachResult stores the per-device outcome of a Detach in result, so drivers can decide
+// whether a volume is safe to report as unstaged or the Detach must be retried
+func WithDetachResult(result *DetachResult) Option {
+	return func(o *options) {
+		o.detachResult = result
+	}
+}
+
+// setDetachResult stores result for WithDetachResult, if the caller asked for it
+func (o *options) setDetachResult(result DetachResult) {
+	if o.detachResult != nil {
+		*o.detachResult = result
+	}
+}
+
+// remainingDevices returns which of plan's devices and map are still known to the kernel
+func remainingDevices(plan DetachPlan, io ioHandler) []string {
+	var remaining []string
+	for _, device := range plannedDevices(plan) {
+		if _, err := io.Lstat(sysfs.DefaultLayout.Block(path.Base(device))); err == nil {
+			remaining = append(remaining, device)
+		}
+	}
+	return remaining
+}
+
+// plannedDevices returns plan's devices followed by its map
+func plannedDevices(plan DetachPlan) []string {
+	devices := append([]string{}, plan.Devices...)
+	if plan.Map != "" {
+		devices = append(devices, plan.Map)
+	}
+	return devices
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// failingDeleteSysfs fails the delete of the devices in failures
+type failingDeleteSysfs struct {
+	*fakeSysfs
+	failures map[string]bool
+}
+
+func (fs *failingDeleteSysfs) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	for dev := range fs.failures {
+		if filename == "/sys/block/"+dev+"/device/delete" {
+			return &os.PathError{Op: "write", Path: filename, Err: syscall.EBUSY}
+		}
+	}
+	return fs.fakeSysfs.WriteFile(filename, data, perm)
+}
+
+func TestDetachResult(t *testing.T) {
+	fs := &failingDeleteSysfs{fakeSysfs: newFakeSysfs(), failures: map[string]bool{"sdc": true}}
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+	fs.files["/sys/block/sdc/dev"] = "8:32\n"
+
+	var result DetachResult
+	err := Detach("/dev/mapper/mpatha", fs, WithDetachResult(&result))
+	if !errors.Is(err, ErrDeviceBusy) {
+		t.Errorf("expected the busy sdc to be reported as ErrDeviceBusy, got %v", err)
+	}
+	if len(result.Devices) != 2 || result.Devices[0].Err != nil || result.Devices[1].Device != "/dev/sdc" || result.Devices[1].Err == nil {
+		t.Errorf("unexpected device results %+v", result.Devices)
+	}
+	if len(result.Remaining) != 2 || result.Remaining[0] != "/dev/sdc" || result.Remaining[1] != "/dev/dm-0" {
+		t.Errorf("expected sdc and the map to remain, got %v", result.Remaining)
+	}
+	if result.Complete() {
+		t.Error("expected the detach not to be complete")
+	}
+}
+
+func TestDetachResultRefused(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/mapper/mpatha"] = "/dev/dm-0"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "../../sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "../../sdc"
+
+	result := DetachResult{}
+	if err := Detach("/dev/mapper/mpatha", fs, WithDetachResult(&result), WithProtectedDevices("sdc")); err == nil {
+		t.Fatal("expected the detach to be refused")
+	}
+	if result.Complete() || len(result.Remaining) != 3 {
+		t.Errorf("expected every planned device to remain, got %+v", result)
+	}
+
+	result = DetachResult{}
+	if err := Detach("/dev/sdx", fs, WithDetachResult(&result)); err == nil {
+		t.Fatal("expected a gone device without a WWID to fail")
+	}
+	if result.Complete() || len(result.Remaining) != 1 || result.Remaining[0] != "/dev/sdx" {
+		t.Errorf("expected the device to remain, got %+v", result)
+	}
+}
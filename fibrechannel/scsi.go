@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// findHCTLs returns the H:C:T:L address of lun behind every fc target whose port_name is targetWWN
+func findHCTLs(targetWWN, lun string, io ioHandler) []string {
+	var hctls []string
+	for _, target := range scsi.FindTargets(targetWWN, io) {
+		hctls = append(hctls, target+":"+kernelLun(lun))
+	}
+	return hctls
+}
+
+// crossCheckDisk verifies a disk found through /dev/disk/by-path against /sys/bus/scsi/devices.
+// udev may leave a by-path link pointing at a device that has since been renumbered, so when
+// the two disagree the sysfs view wins.
+func crossCheckDisk(targetWWN, lun, disk string, io ioHandler) string {
+	var sysfsDisks []string
+	for _, hctl := range findHCTLs(targetWWN, lun, io) {
+		for _, dev := range scsi.BlockDevices(hctl, io) {
+			if "/dev/"+dev == disk {
+				return disk
+			}
+			sysfsDisks = append(sysfsDisks, dev)
+		}
+	}
+	if len(sysfsDisks) == 0 {
+		return disk
+	}
+	glog.Warningf("fc: by-path entry for wwn %s lun %s resolved to %s but sysfs reports %v, using /dev/%s", targetWWN, lun, disk, sysfsDisks, sysfsDisks[0])
+	return "/dev/" + sysfsDisks[0]
+}
+
+//LUNInfo describes a LUN visible through a target port. WWID is the kernel's form as found in
+//sysfs (e.g. naa.600508b4...), Size is in bytes.
+type LUNInfo struct {
+	HCTL   string
+	Lun    string
+	Device string
+	WWID   string
+	Size   int64
+}
+
+// ListTargetLUNs lists every LUN visible from the target port targetWWN, so callers can check that
+// the LUN number in their publish context really maps to the volume they expect before using it.
+func ListTargetLUNs(targetWWN string, io ioHandler) (luns []LUNInfo, err error) {
+	defer recoverPanic("ListTargetLUNs", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	targets := scsi.FindTargets(targetWWN, io)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("fc: no target with port name %s found", targetWWN)
+	}
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.SCSIDevices())
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		for _, f := range dirs {
+			hctl := f.Name()
+			if !strings.HasPrefix(hctl, target+":") || !scsi.IsDisk(hctl, io) {
+				continue
+			}
+			lun := LUNInfo{
+				HCTL: hctl,
+				Lun:  strings.TrimPrefix(hctl, target+":"),
+				WWID: sysfs.ReadAttrRetry(path.Join(sysfs.DefaultLayout.SCSIDevice(hctl), "wwid"), io),
+			}
+			if devices := scsi.BlockDevices(hctl, io); len(devices) > 0 {
+				lun.Device = "/dev/" + devices[0]
+				lun.Size = scsi.DeviceSize(devices[0], io)
+			}
+			luns = append(luns, lun)
+		}
+	}
+	return luns, nil
+}
+
+// verifyTargetPort checks through fc_transport that disk is reached through the target port
+// targetWWN. It guards against a by-path name matching a different target than the one we asked
+// for. When the transport attributes aren't available the check can't be made and disk is accepted.
+func verifyTargetPort(disk, targetWWN string, io ioHandler) bool {
+	hctl, err := scsi.DeviceHCTL(path.Base(disk), io)
+	if err != nil {
+		return true
+	}
+	portName := scsi.TargetPortName(hctl, io)
+	if portName == "" {
+		return true
+	}
+	if !wwn.Equal(portName, targetWWN) {
+		glog.Warningf("fc: %s (%s) is behind target port %s, not %s", disk, hctl, portName, targetWWN)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scsi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// flatSpaceLUN is the address method bits of a SAM-3 flat space lun, as the kernel numbers it
+	flatSpaceLUN = 0x4000
+	// maxFlatSpaceLUN is the largest lun flat space addressing can express
+	maxFlatSpaceLUN = 0x3fff
+)
+
+// KernelLUN returns the number the kernel uses for lun in H:C:T:L addresses and scan requests.
+// Arrays number luns 256 and up in SAM-3 flat space addressing, which the kernel numbers as
+// 0x4000 plus the lun, larger numbers are taken to be the kernel's already. A lun of the form
+// 0x4001000000000000, as /dev/disk/by-path shows it, is the 8 byte SAM lun.
+func KernelLUN(lun string) (uint64, error) {
+	if strings.HasPrefix(lun, "0x") {
+		return ParseByPathLUN(lun)
+	}
+	n, err := strconv.ParseUint(lun, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("fc: invalid lun %q", lun)
+	}
+	if n > 255 && n <= maxFlatSpaceLUN {
+		n |= flatSpaceLUN
+	}
+	return n, nil
+}
+
+// ByPathLUN formats a kernel lun as udev does in /dev/disk/by-path names: decimal below 256 and
+// as the hex SAM lun, first two levels only, from there on
+func ByPathLUN(lun uint64) string {
+	if lun < 256 {
+		return strconv.FormatUint(lun, 10)
+	}
+	return fmt.Sprintf("0x%04x%04x00000000", lun&0xffff, lun>>16&0xffff)
+}
+
+// ParseByPathLUN returns the kernel lun of the lun in a /dev/disk/by-path name
+func ParseByPathLUN(lun string) (uint64, error) {
+	if !strings.HasPrefix(lun, "0x") {
+		n, err := strconv.ParseUint(lun, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("fc: invalid lun %q", lun)
+		}
+		return n, nil
+	}
+	sam, err := strconv.ParseUint(lun[2:], 16, 64)
+	if err != nil || len(lun) != 18 {
+		return 0, fmt.Errorf("fc: invalid lun %q", lun)
+	}
+	return samToKernelLUN(sam), nil
+}
+
+// samToKernelLUN returns the kernel lun of the 8 byte SAM lun sam. The kernel swaps the SAM lun's
+// 2 byte levels, see scsilun_to_int.
+func samToKernelLUN(sam uint64) uint64 {
+	var n uint64
+	for level := uint(0); level < 4; level++ {
+		n |= (sam >> (48 - 16*level) & 0xffff) << (16 * level)
+	}
+	return n
+}
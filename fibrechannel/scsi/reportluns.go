@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// REPORT LUNS, see SPC-4
+const (
+	opReportLUNs         = 0xa0
+	reportLUNsCDBLength  = 12
+	reportLUNsHeaderSize = 8
+	// room for 2047 luns, more than arrays map to a host
+	reportLUNsAllocationLength = reportLUNsHeaderSize + 8*2047
+)
+
+// ReportLUNs sends REPORT LUNS to device, any device of a target, and returns the luns the target
+// exports to the host, numbered as the kernel numbers them in H:C:T:L addresses
+func ReportLUNs(device string) ([]uint64, error) {
+	cdb := make([]byte, reportLUNsCDBLength)
+	cdb[0] = opReportLUNs
+	binary.BigEndian.PutUint32(cdb[6:], reportLUNsAllocationLength)
+	data := make([]byte, reportLUNsAllocationLength)
+	if err := Send(device, &Command{CDB: cdb, Data: data}); err != nil {
+		return nil, err
+	}
+	return parseReportLUNs(data)
+}
+
+// parseReportLUNs decodes REPORT LUNS parameter data. A list longer than what was read is decoded
+// as far as it goes.
+func parseReportLUNs(data []byte) ([]uint64, error) {
+	if len(data) < reportLUNsHeaderSize {
+		return nil, fmt.Errorf("fc: short REPORT LUNS data")
+	}
+	end := reportLUNsHeaderSize + int(binary.BigEndian.Uint32(data))
+	if end > len(data) {
+		end = len(data)
+	}
+	var luns []uint64
+	for i := reportLUNsHeaderSize; i+8 <= end; i += 8 {
+		luns = append(luns, samToKernelLUN(binary.BigEndian.Uint64(data[i:])))
+	}
+	return luns, nil
+}
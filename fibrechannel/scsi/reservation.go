@@ -0,0 +1,48 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scsi
+
+import (
+	"encoding/binary"
+)
+
+// PERSISTENT RESERVE OUT and its REGISTER service action, see SPC-4
+const (
+	opPersistentReserveOut = 0x5f
+	prOutRegister          = 0x00
+	prOutParamLen          = 24
+)
+
+// UnregisterKey removes the persistent reservation registration of key made through device's
+// I_T nexus, releasing a reservation the registration holds. Registrations are per path, so a
+// multipath map's key is removed through each of its paths. A key that isn't registered through
+// device is not an error.
+func UnregisterKey(device string, key uint64) error {
+	// REGISTER with a service action reservation key of 0 unregisters the reservation key
+	param := make([]byte, prOutParamLen)
+	binary.BigEndian.PutUint64(param, key)
+	cdb := make([]byte, 10)
+	cdb[0] = opPersistentReserveOut
+	cdb[1] = prOutRegister
+	binary.BigEndian.PutUint32(cdb[5:], prOutParamLen)
+	err := Send(device, &Command{CDB: cdb, Data: param, Write: true})
+	if err == ErrReservationConflict {
+		// the device refuses REGISTER with a key that isn't registered
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scsi finds and manipulates scsi devices and fibre channel targets through sysfs.
+package scsi
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+// Peripheral device types of the INQUIRY data, as sysfs reports them in a device's type attribute
+const (
+	TypeDisk          = 0x00
+	TypeTape          = 0x01
+	TypeMediumChanger = 0x08
+	TypeRAID          = 0x0c
+	TypeEnclosure     = 0x0d
+	TypeRBC           = 0x0e
+	TypeZBC           = 0x14
+	TypeUnknown       = 0x1f
+)
+
+// RescanHosts asks every scsi host to scan all channels, targets and luns
+func RescanHosts(io sysfs.IO) {
+	if dirs, err := io.ReadDir(sysfs.DefaultLayout.SCSIHosts()); err == nil {
+		for _, f := range dirs {
+			name := path.Join(sysfs.DefaultLayout.SCSIHost(f.Name()), "scan")
+			data := []byte("- - -")
+			io.WriteFile(name, data, 0666)
+		}
+	}
+}
+
+// RescanHost asks the scsi host host (hostN) to scan all its channels, targets and luns
+func RescanHost(host string, io sysfs.IO) error {
+	return io.WriteFile(path.Join(sysfs.DefaultLayout.SCSIHost(host), "scan"), []byte("- - -"), 0666)
+}
+
+// RescanDevice makes the kernel read the capacity and inquiry data of the disk dev (e.g. sdb)
+// again, after the LUN was grown on the array
+func RescanDevice(dev string, io sysfs.IO) error {
+	return io.WriteFile(sysfs.DefaultLayout.Block(dev, "device/rescan"), []byte("1"), 0200)
+}
+
+// FindTargets returns the H:C:T address of every fc target whose port_name is portName. Targets
+// come from fc_transport and, since drivers don't always populate it completely, the remote ports.
+func FindTargets(portName string, io sysfs.IO) []string {
+	var targets []string
+	if dirs, err := io.ReadDir(sysfs.DefaultLayout.FCTransport()); err == nil {
+		for _, f := range dirs {
+			name := f.Name()
+			if !strings.HasPrefix(name, "target") {
+				continue
+			}
+			target := strings.TrimPrefix(name, "target")
+			if wwn.Equal(sysfs.ReadAttrRetry(path.Join(sysfs.DefaultLayout.FCTarget(target), "port_name"), io), portName) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	for _, target := range RemotePortTargets(portName, io) {
+		if !contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// RemotePortTargets returns the H:C:T address of every remote port named portName that the
+// transport bound to a scsi target. rport-H:C-N carries the host and channel in its name and the
+// target number in scsi_target_id, -1 for ports that are not targets (e.g. initiators).
+func RemotePortTargets(portName string, io sysfs.IO) []string {
+	var targets []string
+	dirs, err := io.ReadDir(sysfs.DefaultLayout.FCRemotePorts())
+	if err != nil {
+		return targets
+	}
+	for _, f := range dirs {
+		name := f.Name()
+		var host, channel, n uint64
+		if _, err := fmt.Sscanf(name, "rport-%d:%d-%d", &host, &channel, &n); err != nil {
+			continue
+		}
+		if !wwn.Equal(sysfs.ReadAttrRetry(path.Join(sysfs.DefaultLayout.FCRemotePort(name), "port_name"), io), portName) {
+			continue
+		}
+		id, err := strconv.ParseInt(sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.FCRemotePort(name), "scsi_target_id"), io), 10, 64)
+		if err != nil || id < 0 {
+			continue
+		}
+		targets = append(targets, fmt.Sprintf("%d:%d:%d", host, channel, id))
+	}
+	return targets
+}
+
+// ScanTarget asks the host of target (H:C:T) to scan only lun on that channel and target, instead
+// of every channel, target and lun as RescanHosts does
+func ScanTarget(target, lun string, io sysfs.IO) error {
+	parts := strings.Split(target, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("fc: invalid scsi target %q", target)
+	}
+	name := path.Join(sysfs.DefaultLayout.SCSIHost("host"+parts[0]), "scan")
+	return io.WriteFile(name, []byte(parts[1]+" "+parts[2]+" "+lun), 0666)
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceType returns the peripheral device type of the scsi device at hctl, -1 if sysfs has none
+func DeviceType(hctl string, io sysfs.IO) int {
+	t, err := strconv.Atoi(sysfs.ReadAttrRetry(path.Join(sysfs.DefaultLayout.SCSIDevice(hctl), "type"), io))
+	if err != nil {
+		return -1
+	}
+	return t
+}
+
+// IsDisk reports whether the scsi device at hctl is a disk a volume can live on, as opposed to a
+// tape, medium changer, enclosure or any other device type that may share the fc targets. Devices
+// sysfs reports no type for are assumed to be disks.
+func IsDisk(hctl string, io sysfs.IO) bool {
+	switch DeviceType(hctl, io) {
+	case -1, TypeDisk, TypeRBC, TypeZBC:
+		return true
+	}
+	return false
+}
+
+// IsControllerLUN reports whether the scsi device at hctl is one of the pseudo devices arrays
+// export for management, typically at LUN 0, rather than storage: its INQUIRY peripheral qualifier
+// says no device is connected or its type is storage array controller or unknown
+func IsControllerLUN(hctl string, io sysfs.IO) bool {
+	if inquiry, err := io.ReadFile(path.Join(sysfs.DefaultLayout.SCSIDevice(hctl), "inquiry")); err == nil && len(inquiry) > 0 {
+		if inquiry[0]>>5 != 0 {
+			return true
+		}
+	}
+	switch DeviceType(hctl, io) {
+	case TypeRAID, TypeUnknown:
+		return true
+	}
+	return false
+}
+
+// TargetPortName returns the port_name of the fc target a H:C:T:L address belongs to, "" if unknown
+func TargetPortName(hctl string, io sysfs.IO) string {
+	i := strings.LastIndex(hctl, ":")
+	if i < 0 {
+		return ""
+	}
+	return sysfs.ReadAttr(path.Join(sysfs.DefaultLayout.FCTarget(hctl[:i]), "port_name"), io)
+}
+
+// BlockDevices returns the block device names (sdX) sysfs has for a H:C:T:L address
+func BlockDevices(hctl string, io sysfs.IO) []string {
+	var devices []string
+	if dirs, err := io.ReadDir(path.Join(sysfs.DefaultLayout.SCSIDevice(hctl), "block")); err == nil {
+		for _, f := range dirs {
+			devices = append(devices, f.Name())
+		}
+	}
+	return devices
+}
+
+// DeviceHCTL returns the H:C:T:L address of a scsi block device such as sdX
+func DeviceHCTL(dev string, io sysfs.IO) (string, error) {
+	devicePath, err := io.EvalSymlinks(sysfs.DefaultLayout.Block(dev, "device"))
+	if err != nil {
+		return "", err
+	}
+	return path.Base(devicePath), nil
+}
+
+// DeviceSize returns the size in bytes of a block device such as sdX, 0 if unknown
+func DeviceSize(dev string, io sysfs.IO) int64 {
+	// the size attribute is always in 512 byte sectors
+	sectors, err := strconv.ParseInt(sysfs.ReadAttrRetry(sysfs.DefaultLayout.Block(dev, "size"), io), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return sectors * 512
+}
+
+// ParseHCTL parses a H:C:T:L address
+func ParseHCTL(hctl string) ([4]uint64, bool) {
+	var addr [4]uint64
+	parts := strings.Split(hctl, ":")
+	if len(parts) != 4 {
+		return addr, false
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return addr, false
+		}
+		addr[i] = n
+	}
+	return addr, true
+}
+
+// LessHCTL compares two H:C:T:L addresses numerically, unparsable addresses sort last
+func LessHCTL(a, b string) bool {
+	x, okA := ParseHCTL(a)
+	y, okB := ParseHCTL(b)
+	if !okA || !okB {
+		return okA
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return x[i] < y[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,344 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package scsi
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sysfsFiles is an in-memory sysfs holding attributes only, its directories are the parents of
+// the attributes
+type sysfsFiles struct {
+	files  map[string]string
+	writes map[string]string
+}
+
+func newSysfsFiles() *sysfsFiles {
+	return &sysfsFiles{files: map[string]string{}, writes: map[string]string{}}
+}
+
+// dirInfo is the os.FileInfo of a directory of sysfsFiles
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() os.FileMode  { return os.ModeDir }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
+
+func (fs *sysfsFiles) ReadDir(dirname string) ([]os.FileInfo, error) {
+	seen := map[string]bool{}
+	var infos []os.FileInfo
+	for name := range fs.files {
+		rest := strings.TrimPrefix(name, strings.TrimSuffix(dirname, "/")+"/")
+		if rest == name || !strings.Contains(rest, "/") {
+			continue
+		}
+		child := rest[:strings.Index(rest, "/")]
+		if !seen[child] {
+			seen[child] = true
+			infos = append(infos, dirInfo(child))
+		}
+	}
+	if len(infos) == 0 {
+		return nil, &os.PathError{Op: "open", Path: dirname, Err: os.ErrNotExist}
+	}
+	return infos, nil
+}
+
+func (fs *sysfsFiles) Lstat(name string) (os.FileInfo, error) {
+	if _, ok := fs.files[name]; !ok {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return dirInfo(path.Base(name)), nil
+}
+
+func (fs *sysfsFiles) EvalSymlinks(name string) (string, error) { return name, nil }
+
+func (fs *sysfsFiles) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	fs.writes[filename] = string(data)
+	return nil
+}
+
+func (fs *sysfsFiles) ReadFile(filename string) ([]byte, error) {
+	data, ok := fs.files[filename]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: os.ErrNotExist}
+	}
+	return []byte(data), nil
+}
+
+func (fs *sysfsFiles) Remove(name string) error             { return os.ErrPermission }
+func (fs *sysfsFiles) Rename(oldpath, newpath string) error { return os.ErrPermission }
+
+func TestParseHCTL(t *testing.T) {
+	if addr, ok := ParseHCTL("5:0:1:12"); !ok || addr != [4]uint64{5, 0, 1, 12} {
+		t.Errorf("unexpected result %v, %v", addr, ok)
+	}
+	for _, hctl := range []string{"", "5:0:1", "5:0:1:x", "host5"} {
+		if _, ok := ParseHCTL(hctl); ok {
+			t.Errorf("expected %q not to parse", hctl)
+		}
+	}
+}
+
+func TestLessHCTL(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"5:0:0:1", "5:0:0:2", true},
+		{"5:0:0:10", "5:0:0:2", false},
+		{"6:0:0:0", "10:0:0:0", true},
+		{"5:0:0:1", "", true},
+		{"", "5:0:0:1", false},
+	}
+	for _, test := range tests {
+		if LessHCTL(test.a, test.b) != test.expected {
+			t.Errorf("LessHCTL(%s, %s): expected %v", test.a, test.b, test.expected)
+		}
+	}
+}
+
+func TestKernelLUN(t *testing.T) {
+	tests := []struct {
+		lun    string
+		kernel uint64
+		bypath string
+	}{
+		{"0", 0, "0"},
+		{"255", 255, "255"},
+		{"256", 0x4100, "0x4100000000000000"},
+		{"16383", 0x7fff, "0x7fff000000000000"},
+		{"16640", 0x4100, "0x4100000000000000"},
+		{"0x4001000000000000", 0x4001, "0x4001000000000000"},
+		{"0x4001000200000000", 0x00024001, "0x4001000200000000"},
+	}
+	for _, test := range tests {
+		n, err := KernelLUN(test.lun)
+		if err != nil || n != test.kernel {
+			t.Errorf("%s: expected %#x, got %#x, %v", test.lun, test.kernel, n, err)
+			continue
+		}
+		if s := ByPathLUN(n); s != test.bypath {
+			t.Errorf("%s: expected by-path lun %s, got %s", test.lun, test.bypath, s)
+		}
+		if back, err := ParseByPathLUN(test.bypath); err != nil || back != n {
+			t.Errorf("%s: expected %s to parse to %#x, got %#x, %v", test.lun, test.bypath, n, back, err)
+		}
+	}
+	for _, lun := range []string{"", "x", "-1", "0x41", "0xzz00000000000000"} {
+		if _, err := KernelLUN(lun); err == nil {
+			t.Errorf("expected %q not to parse", lun)
+		}
+	}
+}
+
+func TestParseSense(t *testing.T) {
+	fixed := []byte{0x70, 0, 0x06, 0, 0, 0, 0, 0x0a, 0, 0, 0, 0, 0x29, 0x00}
+	if e := parseSense(fixed); *e != (SenseError{Key: 0x06, ASC: 0x29}) {
+		t.Errorf("unexpected fixed format sense %+v", e)
+	}
+	descriptor := []byte{0x72, 0x06, 0x2a, 0x09}
+	if e := parseSense(descriptor); *e != (SenseError{Key: 0x06, ASC: 0x2a, ASCQ: 0x09}) {
+		t.Errorf("unexpected descriptor format sense %+v", e)
+	}
+	if err := commandStatus(statusReservationConflict, nil); err != ErrReservationConflict {
+		t.Errorf("expected ErrReservationConflict, got %v", err)
+	}
+}
+
+func TestUnregisterKey(t *testing.T) {
+	defer func(send func(string, *Command) error) { Send = send }(Send)
+	var sent *Command
+	Send = func(device string, cmd *Command) error {
+		sent = cmd
+		return nil
+	}
+	if err := UnregisterKey("/dev/sdb", 0x0123456789abcdef); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(sent.CDB, []byte{0x5f, 0, 0, 0, 0, 0, 0, 0, 24, 0}) || !sent.Write {
+		t.Errorf("unexpected command %+v", sent)
+	}
+	if !bytes.Equal(sent.Data[:16], []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0, 0, 0, 0, 0, 0, 0, 0}) {
+		t.Errorf("unexpected parameter list %x", sent.Data)
+	}
+
+	Send = func(device string, cmd *Command) error { return ErrReservationConflict }
+	if err := UnregisterKey("/dev/sdb", 1); err != nil {
+		t.Errorf("expected an unregistered key to be ignored, got %v", err)
+	}
+	Send = func(device string, cmd *Command) error { return &SenseError{Key: 0x05} }
+	if err := UnregisterKey("/dev/sdb", 1); !errors.As(err, new(*SenseError)) {
+		t.Errorf("expected the sense error, got %v", err)
+	}
+}
+
+func TestDeviceIdentification(t *testing.T) {
+	defer func(send func(string, *Command) error) { Send = send }(Send)
+	page := []byte{0x00, 0x83, 0x00, 0x28,
+		// NAA IEEE registered extended of the logical unit
+		0x01, 0x03, 0x00, 0x10, 0x60, 0x0a, 0x09, 0x80, 0x38, 0x30, 0x30, 0x53, 0x74, 0x3f, 0x46, 0x30, 0x45, 0x72, 0x7a, 0x41,
+		// relative target port
+		0x61, 0x94, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01,
+		// T10 vendor id, padded
+		0x02, 0x01, 0x00, 0x08, 'N', 'E', 'T', 'A', 'P', 'P', ' ', ' ',
+	}
+	var sent *Command
+	Send = func(device string, cmd *Command) error {
+		sent = cmd
+		copy(cmd.Data, page)
+		return nil
+	}
+	designators, err := DeviceIdentification("/dev/sdb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(sent.CDB, []byte{0x12, 0x01, 0x83, 0x00, 0xfc, 0x00}) || sent.Write {
+		t.Errorf("unexpected command %+v", sent)
+	}
+	if len(designators) != 3 {
+		t.Fatalf("expected 3 designators, got %+v", designators)
+	}
+	if d := designators[0]; d.Association != AssociationLogicalUnit || d.WWID() != "naa.600a098038303053743f463045727a41" {
+		t.Errorf("unexpected NAA designator %+v (%s)", d, d.WWID())
+	}
+	if d := designators[1]; d.Association != 0x1 || d.WWID() != "" {
+		t.Errorf("unexpected relative target port designator %+v", d)
+	}
+	if d := designators[2]; d.WWID() != "t10.NETAPP" {
+		t.Errorf("unexpected T10 designator %q", d.WWID())
+	}
+	if _, ok := TargetPortGroup(designators); ok {
+		t.Error("expected no target port group")
+	}
+	group := Designator{Type: DesignatorTargetPortGroup, Association: AssociationTargetPort, Value: []byte{0x00, 0x00, 0x01, 0x02}}
+	if tpg, ok := TargetPortGroup(append(designators, group)); !ok || tpg != 0x102 {
+		t.Errorf("expected target port group 258, got %d %v", tpg, ok)
+	}
+
+	// a page longer than the allocation length is decoded as far as it goes
+	if designators, err := ParseDeviceIdentification(page[:30]); err != nil || len(designators) != 1 {
+		t.Errorf("expected the first designator of a truncated page, got %+v %v", designators, err)
+	}
+	if _, err := ParseDeviceIdentification([]byte{0x00, 0x80, 0x00, 0x00}); err == nil {
+		t.Error("expected an error for another VPD page")
+	}
+}
+
+func TestParseUnitSerialNumber(t *testing.T) {
+	if serial, err := ParseUnitSerialNumber([]byte("\x00\x80\x00\x0e80OS3t?F0Erz  ")); err != nil || serial != "80OS3t?F0Erz" {
+		t.Errorf("unexpected serial number %q %v", serial, err)
+	}
+	// a page longer than what was read
+	if serial, err := ParseUnitSerialNumber([]byte("\x00\x80\x00\x2080OS")); err != nil || serial != "80OS" {
+		t.Errorf("unexpected serial number %q %v", serial, err)
+	}
+	if _, err := ParseUnitSerialNumber([]byte{0x00, 0x83, 0x00, 0x00}); err == nil {
+		t.Error("expected an error for another VPD page")
+	}
+}
+
+func TestReportLUNs(t *testing.T) {
+	defer func(send func(string, *Command) error) { Send = send }(Send)
+	data := []byte{0x00, 0x00, 0x00, 0x18, 0x00, 0x00, 0x00, 0x00,
+		// peripheral lun 1
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// flat space lun 300
+		0x41, 0x2c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// two level lun
+		0x40, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00,
+		// beyond what was read
+		0x00, 0x07,
+	}
+	var sent *Command
+	Send = func(device string, cmd *Command) error {
+		sent = cmd
+		copy(cmd.Data, data)
+		return nil
+	}
+	luns, err := ReportLUNs("/dev/sg1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sent.CDB[0] != 0xa0 || len(sent.CDB) != 12 || int(sent.CDB[8])<<8|int(sent.CDB[9]) != len(sent.Data) {
+		t.Errorf("unexpected command %+v", sent.CDB)
+	}
+	expected := []uint64{1, 0x412c, 0x24001}
+	if len(luns) != len(expected) {
+		t.Fatalf("expected luns %v, got %v", expected, luns)
+	}
+	for i := range expected {
+		if luns[i] != expected[i] {
+			t.Errorf("expected luns %v, got %v", expected, luns)
+		}
+	}
+
+	if luns, err := parseReportLUNs(data[:30]); err != nil || len(luns) != 2 {
+		t.Errorf("expected a truncated list to be decoded as far as it goes, got %v %v", luns, err)
+	}
+}
+
+func TestFindTargetsFromRemotePorts(t *testing.T) {
+	fs := newSysfsFiles()
+	fs.files["/sys/class/fc_transport/target5:0:0/port_name"] = "0x500a0981891b8dc5\n"
+	// lpfc populated fc_transport for target5:0:0 only, the second path is known as an rport
+	fs.files["/sys/class/fc_remote_ports/rport-5:0-0/port_name"] = "0x500a0981891b8dc5\n"
+	fs.files["/sys/class/fc_remote_ports/rport-5:0-0/scsi_target_id"] = "0\n"
+	fs.files["/sys/class/fc_remote_ports/rport-6:0-2/port_name"] = "0x500a0981891b8dc5\n"
+	fs.files["/sys/class/fc_remote_ports/rport-6:0-2/scsi_target_id"] = "1\n"
+	// an initiator port, not bound to a target
+	fs.files["/sys/class/fc_remote_ports/rport-6:0-3/port_name"] = "0x500a0981891b8dc5\n"
+	fs.files["/sys/class/fc_remote_ports/rport-6:0-3/scsi_target_id"] = "-1\n"
+
+	expected := []string{"5:0:0", "6:0:1"}
+	if targets := FindTargets("500a0981891b8dc5", fs); !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected %v, got %v", expected, targets)
+	}
+
+	if err := ScanTarget("6:0:1", "3", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if scan := fs.writes["/sys/class/scsi_host/host6/scan"]; scan != "0 1 3" {
+		t.Errorf("expected scan string \"0 1 3\", got %q", scan)
+	}
+	if err := ScanTarget("6:0", "3", fs); err == nil {
+		t.Error("expected an error for an invalid target")
+	}
+}
+
+func TestIsControllerLUN(t *testing.T) {
+	fs := newSysfsFiles()
+	fs.files["/sys/bus/scsi/devices/5:0:0:0/type"] = "0\n"
+	fs.files["/sys/bus/scsi/devices/5:0:0:1/type"] = "0\n"
+	fs.files["/sys/bus/scsi/devices/5:0:0:1/inquiry"] = "\x20\x00"
+	fs.files["/sys/bus/scsi/devices/5:0:0:2/type"] = "31\n"
+
+	for hctl, expected := range map[string]bool{"5:0:0:0": false, "5:0:0:1": true, "5:0:0:2": true, "5:0:0:3": false} {
+		if IsControllerLUN(hctl, fs) != expected {
+			t.Errorf("%s: expected %v", hctl, expected)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scsi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// scsi status bytes, see SAM
+const (
+	statusGood                = 0x00
+	statusCheckCondition      = 0x02
+	statusReservationConflict = 0x18
+)
+
+// sense keys, see SPC
+const (
+	SenseKeyNotReady       = 0x02
+	SenseKeyIllegalRequest = 0x05
+	SenseKeyUnitAttention  = 0x06
+)
+
+// ASCLogicalUnitNotSupported is the additional sense code of a LUN the target doesn't export (any
+// longer), see SPC
+const ASCLogicalUnitNotSupported = 0x25
+
+// TEST UNIT READY, see SPC
+const (
+	opTestUnitReady        = 0x00
+	testUnitReadyCDBLength = 6
+)
+
+// defaultCommandTimeout is the timeout of a Command without one
+const defaultCommandTimeout = 30 * time.Second
+
+// ErrReservationConflict is the RESERVATION CONFLICT status of a command
+var ErrReservationConflict = errors.New("fc: reservation conflict")
+
+//Command is a scsi command sent to a device with Send. Data is sent to the device if Write is
+//set, otherwise the device's response is read into it.
+type Command struct {
+	CDB     []byte
+	Data    []byte
+	Write   bool
+	Timeout time.Duration
+}
+
+//SenseError is a command that ended with CHECK CONDITION, described by its sense data
+type SenseError struct {
+	Key  byte
+	ASC  byte
+	ASCQ byte
+}
+
+func (e *SenseError) Error() string {
+	return fmt.Sprintf("fc: check condition, sense key %#x asc %#x ascq %#x", e.Key, e.ASC, e.ASCQ)
+}
+
+// Send sends cmd to the block device device (/dev/sdX) through the SG_IO ioctl. A command ending
+// with CHECK CONDITION returns a *SenseError, one ending with RESERVATION CONFLICT
+// ErrReservationConflict.
+var Send = send
+
+// parseSense decodes fixed and descriptor format sense data
+func parseSense(sense []byte) *SenseError {
+	if len(sense) < 4 {
+		return &SenseError{}
+	}
+	switch sense[0] & 0x7f {
+	case 0x72, 0x73:
+		return &SenseError{Key: sense[1] & 0x0f, ASC: sense[2], ASCQ: sense[3]}
+	}
+	e := &SenseError{Key: sense[2] & 0x0f}
+	if len(sense) >= 14 {
+		e.ASC, e.ASCQ = sense[12], sense[13]
+	}
+	return e
+}
+
+// commandStatus turns the status of a finished command into its error
+func commandStatus(status byte, sense []byte) error {
+	switch status {
+	case statusGood:
+		return nil
+	case statusCheckCondition:
+		return parseSense(sense)
+	case statusReservationConflict:
+		return ErrReservationConflict
+	}
+	return fmt.Errorf("fc: scsi status %#x", status)
+}
+
+// TestUnitReady sends TEST UNIT READY to device. A pending unit attention is returned, and
+// cleared, as a *SenseError with Key SenseKeyUnitAttention.
+func TestUnitReady(device string) error {
+	cdb := make([]byte, testUnitReadyCDBLength)
+	cdb[0] = opTestUnitReady
+	return Send(device, &Command{CDB: cdb})
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scsi
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sgIO           = 0x2285
+	sgDxferNone    = -1
+	sgDxferToDev   = -2
+	sgDxferFromDev = -3
+	senseLen       = 32
+)
+
+// sgIOHdr is struct sg_io_hdr of scsi/sg.h
+type sgIOHdr struct {
+	InterfaceID    int32
+	DxferDirection int32
+	CmdLen         uint8
+	MxSbLen        uint8
+	IovecCount     uint16
+	DxferLen       uint32
+	Dxferp         unsafe.Pointer
+	Cmdp           unsafe.Pointer
+	Sbp            unsafe.Pointer
+	Timeout        uint32
+	Flags          uint32
+	PackID         int32
+	UsrPtr         unsafe.Pointer
+	Status         uint8
+	MaskedStatus   uint8
+	MsgStatus      uint8
+	SbLenWr        uint8
+	HostStatus     uint16
+	DriverStatus   uint16
+	Resid          int32
+	Duration       uint32
+	Info           uint32
+}
+
+func send(device string, cmd *Command) error {
+	flag := os.O_RDONLY
+	if cmd.Write {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(device, flag|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	timeout := cmd.Timeout
+	if timeout == 0 {
+		timeout = defaultCommandTimeout
+	}
+	sense := make([]byte, senseLen)
+	hdr := sgIOHdr{
+		InterfaceID:    'S',
+		DxferDirection: sgDxferNone,
+		CmdLen:         uint8(len(cmd.CDB)),
+		MxSbLen:        senseLen,
+		Cmdp:           unsafe.Pointer(&cmd.CDB[0]),
+		Sbp:            unsafe.Pointer(&sense[0]),
+		Timeout:        uint32(timeout.Nanoseconds() / 1e6),
+	}
+	if len(cmd.Data) > 0 {
+		hdr.DxferDirection = sgDxferFromDev
+		if cmd.Write {
+			hdr.DxferDirection = sgDxferToDev
+		}
+		hdr.DxferLen = uint32(len(cmd.Data))
+		hdr.Dxferp = unsafe.Pointer(&cmd.Data[0])
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), sgIO, uintptr(unsafe.Pointer(&hdr))); errno != 0 {
+		return fmt.Errorf("fc: SG_IO on %s failed: %v", device, errno)
+	}
+	if hdr.HostStatus != 0 {
+		return fmt.Errorf("fc: SG_IO on %s failed: host status %#x, driver status %#x", device, hdr.HostStatus, hdr.DriverStatus)
+	}
+	return commandStatus(hdr.Status, sense[:hdr.SbLenWr])
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scsi
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestSGIOHdrLayout(t *testing.T) {
+	// sizeof(struct sg_io_hdr) of scsi/sg.h on 64 bit platforms
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		if size := unsafe.Sizeof(sgIOHdr{}); size != 88 {
+			t.Errorf("expected sg_io_hdr to be 88 bytes, got %d", size)
+		}
+	}
+}
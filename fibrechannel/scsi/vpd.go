@@ -0,0 +1,162 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scsi
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// INQUIRY of the Unit Serial Number and Device Identification VPD pages, see SPC-4
+const (
+	opInquiry               = 0x12
+	inquiryEVPD             = 0x01
+	vpdUnitSerialNumber     = 0x80
+	vpdDeviceIdentification = 0x83
+	// the allocation length sg_inq uses, old devices only read its low byte
+	vpdAllocationLength = 252
+)
+
+// designator types, see SPC-4
+const (
+	DesignatorT10             = 0x1
+	DesignatorEUI64           = 0x2
+	DesignatorNAA             = 0x3
+	DesignatorTargetPortGroup = 0x5
+	DesignatorSCSIName        = 0x8
+)
+
+// AssociationLogicalUnit is the association of designators identifying the logical unit, rather
+// than the target port or device it is reached through
+const AssociationLogicalUnit = 0x0
+
+// AssociationTargetPort is the association of designators identifying the target port a device
+// is reached through, its target port group among them
+const AssociationTargetPort = 0x1
+
+//Designator is an entry of a device's Device Identification VPD page. Type is one of the
+//Designator constants or another SPC designator type, Value its raw bytes.
+type Designator struct {
+	Type        byte
+	Association byte
+	Value       []byte
+}
+
+// WWID returns the designator in the form the kernel shows in sysfs, naa.600a..., eui.00...,
+// t10.VENDOR... or the SCSI name string, "" for other types
+func (d Designator) WWID() string {
+	switch d.Type {
+	case DesignatorNAA:
+		return "naa." + hex.EncodeToString(d.Value)
+	case DesignatorEUI64:
+		return "eui." + hex.EncodeToString(d.Value)
+	case DesignatorT10:
+		return "t10." + strings.TrimRight(string(d.Value), " \x00")
+	case DesignatorSCSIName:
+		return strings.TrimRight(string(d.Value), "\x00")
+	}
+	return ""
+}
+
+// DeviceIdentification reads the designators of device's Device Identification VPD page (0x83)
+// with INQUIRY. Unlike the wwid in sysfs, which the kernel reads once when it finds the device,
+// they are what the array reports for the LUN now.
+func DeviceIdentification(device string) ([]Designator, error) {
+	page, err := inquiryVPD(device, vpdDeviceIdentification)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeviceIdentification(page)
+}
+
+// TargetPortGroup returns the ALUA target port group of the designators of a path, false if they
+// have none
+func TargetPortGroup(designators []Designator) (uint16, bool) {
+	for _, d := range designators {
+		if d.Type == DesignatorTargetPortGroup && d.Association == AssociationTargetPort && len(d.Value) >= 4 {
+			return binary.BigEndian.Uint16(d.Value[2:]), true
+		}
+	}
+	return 0, false
+}
+
+// UnitSerialNumber reads the serial number of device's logical unit from its Unit Serial Number
+// VPD page (0x80) with INQUIRY
+func UnitSerialNumber(device string) (string, error) {
+	page, err := inquiryVPD(device, vpdUnitSerialNumber)
+	if err != nil {
+		return "", err
+	}
+	return ParseUnitSerialNumber(page)
+}
+
+// ParseUnitSerialNumber decodes a Unit Serial Number VPD page, as INQUIRY returns it or the
+// kernel caches it in the vpd_pg80 attribute of a scsi device. Arrays pad the serial number with
+// spaces, they are trimmed.
+func ParseUnitSerialNumber(page []byte) (string, error) {
+	if len(page) < 4 || page[1] != vpdUnitSerialNumber {
+		return "", fmt.Errorf("fc: not a unit serial number page")
+	}
+	end := 4 + int(page[3])
+	if end > len(page) {
+		end = len(page)
+	}
+	return strings.Trim(string(page[4:end]), " \x00"), nil
+}
+
+// inquiryVPD reads the VPD page of device
+func inquiryVPD(device string, page byte) ([]byte, error) {
+	cdb := make([]byte, 6)
+	cdb[0] = opInquiry
+	cdb[1] = inquiryEVPD
+	cdb[2] = page
+	binary.BigEndian.PutUint16(cdb[3:], vpdAllocationLength)
+	data := make([]byte, vpdAllocationLength)
+	if err := Send(device, &Command{CDB: cdb, Data: data}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ParseDeviceIdentification decodes a Device Identification VPD page, as INQUIRY returns it or
+// the kernel caches it in the vpd_pg83 attribute of a scsi device. A page longer than what was
+// read is decoded as far as it goes.
+func ParseDeviceIdentification(page []byte) ([]Designator, error) {
+	if len(page) < 4 || page[1] != vpdDeviceIdentification {
+		return nil, fmt.Errorf("fc: not a device identification page")
+	}
+	end := 4 + int(binary.BigEndian.Uint16(page[2:]))
+	if end > len(page) {
+		end = len(page)
+	}
+	var designators []Designator
+	for i := 4; i+4 <= end; {
+		length := int(page[i+3])
+		if i+4+length > end {
+			break
+		}
+		designators = append(designators, Designator{
+			Type:        page[i+1] & 0x0f,
+			Association: page[i+1] >> 4 & 0x03,
+			Value:       append([]byte{}, page[i+4:i+4+length]...),
+		})
+		i += 4 + length
+	}
+	return designators, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+// newFakeFCDisk lays out one fc target (host5, wwn 500a0981891b8dc5) with lun 0 as sysfsDisk
+func newFakeFCDisk(sysfsDisk string) *fakeSysfs {
+	fs := newFakeSysfs()
+	fs.files["/sys/class/fc_transport/target5:0:0/port_name"] = "0x500a0981891b8dc5\n"
+	fs.files["/sys/bus/scsi/devices/5:0:0:0/block/"+sysfsDisk+"/dev"] = "8:16\n"
+	return fs
+}
+
+func TestCrossCheckDisk(t *testing.T) {
+	tests := []struct {
+		name      string
+		sysfsDisk string
+		disk      string
+		expected  string
+	}{
+		{"consistent", "sdb", "/dev/sdb", "/dev/sdb"},
+		{"renumbered", "sdc", "/dev/sdb", "/dev/sdc"},
+	}
+	for _, test := range tests {
+		fs := newFakeFCDisk(test.sysfsDisk)
+		if disk := crossCheckDisk("500a0981891b8dc5", "0", test.disk, fs); disk != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, disk)
+		}
+	}
+
+	// without fc_transport information the by-path result is kept
+	if disk := crossCheckDisk("500a0981891b8dc5", "0", "/dev/sdb", newFakeSysfs()); disk != "/dev/sdb" {
+		t.Errorf("expected /dev/sdb, got %s", disk)
+	}
+}
+
+func TestListTargetLUNs(t *testing.T) {
+	fs := newFakeFCDisk("sdb")
+	fs.files["/sys/bus/scsi/devices/5:0:0:0/wwid"] = "naa.600a098038303053453f463045727a44\n"
+	fs.files["/sys/block/sdb/size"] = "2097152\n"
+	fs.files["/sys/bus/scsi/devices/5:0:0:1/block/sdc/dev"] = "8:32\n"
+	fs.files["/sys/bus/scsi/devices/5:0:0:10/block/sdd/dev"] = "8:48\n"
+	fs.files["/sys/bus/scsi/devices/6:0:0:0/block/sde/dev"] = "8:64\n"
+
+	luns, err := ListTargetLUNs("500a0981891b8dc5", fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(luns) != 3 {
+		t.Fatalf("expected 3 luns, got %+v", luns)
+	}
+	if luns[0].Lun != "0" || luns[0].Device != "/dev/sdb" || luns[0].Size != 1073741824 || luns[0].WWID != "naa.600a098038303053453f463045727a44" {
+		t.Errorf("unexpected lun 0: %+v", luns[0])
+	}
+
+	if _, err := ListTargetLUNs("500a0981891b8dc6", fs); err == nil {
+		t.Error("expected an error for an unknown target")
+	}
+}
+
+func TestVerifyTargetPort(t *testing.T) {
+	fs := newFakeFCDisk("sdb")
+	fs.links["/sys/block/sdb/device"] = "/sys/devices/pci0000:40/0000:40:01.0/host5/rport-5:0-0/target5:0:0/5:0:0:0"
+
+	if !verifyTargetPort("/dev/sdb", "500a0981891b8dc5", fs) {
+		t.Error("expected /dev/sdb to be behind 500a0981891b8dc5")
+	}
+	if verifyTargetPort("/dev/sdb", "500a0981891b8dc50", fs) {
+		t.Error("expected /dev/sdb not to be behind 500a0981891b8dc50")
+	}
+	// nothing to verify against
+	if !verifyTargetPort("/dev/sdc", "500a0981891b8dc50", fs) {
+		t.Error("expected /dev/sdc to be accepted without sysfs information")
+	}
+}
+
+func TestSkipControllerLUN(t *testing.T) {
+	fs := newFakeFCDisk("sdb")
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-0"] = "/dev/sdb"
+	fs.files["/dev/sdb"] = ""
+	fs.links["/sys/block/sdb/device"] = "/sys/devices/pci0000:40/0000:40:01.0/host5/rport-5:0-0/target5:0:0/5:0:0:0"
+
+	if candidates := findDiskCandidates("500a0981891b8dc5", "0", fs); len(candidates) != 1 {
+		t.Fatalf("expected the disk to be found, got %+v", candidates)
+	}
+	fs.files["/sys/bus/scsi/devices/5:0:0:0/type"] = "12\n"
+	if candidates := findDiskCandidates("500a0981891b8dc5", "0", fs); len(candidates) != 0 {
+		t.Errorf("expected the array controller to be skipped, got %+v", candidates)
+	}
+	fs.files["/sys/bus/scsi/devices/5:0:0:0/type"] = "1\n"
+	if candidates := findDiskCandidates("500a0981891b8dc5", "0", fs); len(candidates) != 0 {
+		t.Errorf("expected the tape drive to be skipped, got %+v", candidates)
+	}
+}
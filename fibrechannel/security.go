@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"os"
+)
+
+const selinuxXattr = "security.selinux"
+
+// securityHandler is implemented by io handlers that can change the ownership and SELinux context
+// of device nodes. It is kept apart from ioHandler so existing handlers don't have to implement it.
+type securityHandler interface {
+	Chown(name string, uid, gid int) error
+	Chmod(name string, mode os.FileMode) error
+	Setxattr(path, attr string, data []byte) error
+}
+
+//DeviceSecurity describes how a raw block device node is exposed to a workload. SELinuxLabel is the
+//full context, e.g. system_u:object_r:container_file_t:s0:c1,c2. FSGroup follows the pod fsGroup
+//semantics for block volumes: the node's group is set to it and the group may read and write.
+//UID, GID and Mode set the node's owner, group and permissions explicitly for workloads running as
+//a non-root user. GID and FSGroup are mutually exclusive, Mode takes precedence over the mode
+//implied by FSGroup.
+type DeviceSecurity struct {
+	SELinuxLabel string
+	FSGroup      *int64
+	UID          *int64
+	GID          *int64
+	Mode         *os.FileMode
+}
+
+//Chown calls Chown from os package
+func (handler *OSioHandler) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+//Chmod calls Chmod from os package
+func (handler *OSioHandler) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+// SetDeviceSecurity applies sec to the device node or bind-mount target at path. Drivers on
+// SELinux enforcing hosts need this for raw block volumes, the node udev creates is labeled
+// fixed_disk_device_t which containers are denied access to.
+func SetDeviceSecurity(path string, sec DeviceSecurity, io ioHandler) (err error) {
+	defer recoverPanic("SetDeviceSecurity", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	sh, ok := io.(securityHandler)
+	if !ok {
+		return fmt.Errorf("fc: io handler can't change ownership or labels of %s", path)
+	}
+	if sec.FSGroup != nil && sec.GID != nil {
+		return fmt.Errorf("fc: only one of FSGroup and GID can be set")
+	}
+	uid, gid := -1, -1
+	if sec.UID != nil {
+		uid = int(*sec.UID)
+	}
+	if sec.GID != nil {
+		gid = int(*sec.GID)
+	}
+	var mode *os.FileMode
+	if sec.FSGroup != nil {
+		gid = int(*sec.FSGroup)
+		// block devices are created 0660 root:disk, group rw is what fsGroup grants
+		groupRW := os.FileMode(0660)
+		mode = &groupRW
+	}
+	if sec.Mode != nil {
+		mode = sec.Mode
+	}
+
+	if sec.SELinuxLabel != "" {
+		if err := sh.Setxattr(path, selinuxXattr, []byte(sec.SELinuxLabel)); err != nil {
+			return fmt.Errorf("fc: failed to set SELinux label %s on %s: %v", sec.SELinuxLabel, path, err)
+		}
+	}
+	if uid != -1 || gid != -1 {
+		if err := sh.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("fc: failed to set owner %d:%d on %s: %v", uid, gid, path, err)
+		}
+	}
+	if mode != nil {
+		if err := sh.Chmod(path, mode.Perm()); err != nil {
+			return fmt.Errorf("fc: failed to set mode %o on %s: %v", *mode, path, err)
+		}
+	}
+	return nil
+}
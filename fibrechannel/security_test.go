@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// securitySysfs records ownership, mode and xattr changes on top of fakeSysfs
+type securitySysfs struct {
+	*fakeSysfs
+	changes []string
+}
+
+func (fs *securitySysfs) Chown(name string, uid, gid int) error {
+	fs.changes = append(fs.changes, fmt.Sprintf("chown %s %d:%d", name, uid, gid))
+	return nil
+}
+
+func (fs *securitySysfs) Chmod(name string, mode os.FileMode) error {
+	fs.changes = append(fs.changes, fmt.Sprintf("chmod %s %o", name, mode))
+	return nil
+}
+
+func (fs *securitySysfs) Setxattr(path, attr string, data []byte) error {
+	fs.changes = append(fs.changes, fmt.Sprintf("setxattr %s %s=%s", path, attr, data))
+	return nil
+}
+
+func TestSetDeviceSecurity(t *testing.T) {
+	fs := &securitySysfs{fakeSysfs: newFakeSysfs()}
+	group := int64(2000)
+	sec := DeviceSecurity{
+		SELinuxLabel: "system_u:object_r:container_file_t:s0:c1,c2",
+		FSGroup:      &group,
+	}
+	if err := SetDeviceSecurity("/var/lib/kubelet/plugins/pv1/dev", sec, fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"setxattr /var/lib/kubelet/plugins/pv1/dev security.selinux=system_u:object_r:container_file_t:s0:c1,c2",
+		"chown /var/lib/kubelet/plugins/pv1/dev -1:2000",
+		"chmod /var/lib/kubelet/plugins/pv1/dev 660",
+	}
+	if fmt.Sprint(fs.changes) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, fs.changes)
+	}
+
+	if err := SetDeviceSecurity("/dev/sdb", sec, newFakeSysfs()); err == nil {
+		t.Error("expected an error from an io handler without security support")
+	}
+}
+
+func TestSetDevicePermissions(t *testing.T) {
+	uid, gid, group := int64(1000), int64(3000), int64(2000)
+	mode := os.FileMode(0600)
+	tests := []struct {
+		name     string
+		sec      DeviceSecurity
+		expected []string
+	}{
+		{"owner only", DeviceSecurity{UID: &uid}, []string{"chown /dev/sdb 1000:-1"}},
+		{"owner group and mode", DeviceSecurity{UID: &uid, GID: &gid, Mode: &mode}, []string{"chown /dev/sdb 1000:3000", "chmod /dev/sdb 600"}},
+		{"mode overrides fsGroup", DeviceSecurity{FSGroup: &group, Mode: &mode}, []string{"chown /dev/sdb -1:2000", "chmod /dev/sdb 600"}},
+		{"nothing to do", DeviceSecurity{}, nil},
+	}
+	for _, test := range tests {
+		fs := &securitySysfs{fakeSysfs: newFakeSysfs()}
+		if err := SetDeviceSecurity("/dev/sdb", test.sec, fs); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if fmt.Sprint(fs.changes) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, fs.changes)
+		}
+	}
+
+	fs := &securitySysfs{fakeSysfs: newFakeSysfs()}
+	if err := SetDeviceSecurity("/dev/sdb", DeviceSecurity{FSGroup: &group, GID: &gid}, fs); err == nil {
+		t.Error("expected an error when both FSGroup and GID are set")
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/scsi"
+)
+
+//SizeMismatchError lists the sizes the paths of a multipath map report when they differ, the
+//usual state after a LUN was grown on the array and only some paths were rescanned. Sizes maps
+//each path to its size in bytes, MapSize is the size of the map. errors.Is matches it against
+//ErrSizeMismatch.
+type SizeMismatchError struct {
+	Device  string
+	MapSize int64
+	Sizes   map[string]int64
+}
+
+func (e *SizeMismatchError) Error() string {
+	var paths []string
+	for p := range e.Sizes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var sizes []string
+	for _, p := range paths {
+		sizes = append(sizes, fmt.Sprintf("%s %d", p, e.Sizes[p]))
+	}
+	return fmt.Sprintf("fc: paths of %s report different sizes: %s (map %d)", e.Device, strings.Join(sizes, ", "), e.MapSize)
+}
+
+func (e *SizeMismatchError) Unwrap() error {
+	return ErrSizeMismatch
+}
+
+// CheckPathSizes fails with a *SizeMismatchError if the paths of the multipath map at devicePath
+// don't all report the same size, so drivers know to rescan the paths and resize the map before
+// growing the filesystem. Paths reporting no size, e.g. offline ones, are skipped; a single path
+// always passes.
+func CheckPathSizes(devicePath string, io ioHandler) (err error) {
+	defer recoverPanic("CheckPathSizes", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	dev, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return err
+	}
+	info := getDeviceInfo(dev, io)
+	sizes := map[string]int64{}
+	differ := false
+	var first int64
+	for _, p := range info.Paths {
+		size := scsi.DeviceSize(path.Base(p), io)
+		if size == 0 {
+			continue
+		}
+		if len(sizes) == 0 {
+			first = size
+		}
+		differ = differ || size != first
+		sizes[p] = size
+	}
+	if differ {
+		return &SizeMismatchError{Device: devicePath, MapSize: info.Size, Sizes: sizes}
+	}
+	return nil
+}
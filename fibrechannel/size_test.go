@@ -0,0 +1,52 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckPathSizes(t *testing.T) {
+	fs := mapFixture()
+	fs.files["/sys/block/dm-0/size"] = "2097152"
+	fs.files["/sys/block/sdb/size"] = "2097152"
+	fs.files["/sys/block/sdc/size"] = "2097152"
+	if err := CheckPathSizes("/dev/mapper/mpatha", fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the LUN was grown and only sdc rescanned
+	fs.files["/sys/block/sdc/size"] = "4194304"
+	err := CheckPathSizes("/dev/mapper/mpatha", fs)
+	var mismatch *SizeMismatchError
+	if !errors.As(err, &mismatch) || !errors.Is(err, ErrSizeMismatch) {
+		t.Fatalf("expected a SizeMismatchError, got %v", err)
+	}
+	if mismatch.MapSize != 1073741824 || mismatch.Sizes["/dev/sdb"] != 1073741824 || mismatch.Sizes["/dev/sdc"] != 2147483648 {
+		t.Errorf("unexpected sizes %+v", mismatch)
+	}
+	if !strings.Contains(err.Error(), "/dev/sdb 1073741824, /dev/sdc 2147483648 (map 1073741824)") {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	// an offline path has no size
+	fs.files["/sys/block/sdc/size"] = "0"
+	if err := CheckPathSizes("/dev/mapper/mpatha", fs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/mount"
+)
+
+// WithFilesystemCheck makes StageFilesystem check an existing filesystem with mount.Check before
+// mounting it, e.g. after an unclean shutdown of the node, and fail if errors are left. The
+// outcome, including whether fsck repaired anything, is stored in result if it isn't nil.
+func WithFilesystemCheck(result *mount.CheckResult) Option {
+	return func(o *options) {
+		o.fsck = true
+		o.fsckResult = result
+	}
+}
+
+// defaultFsType is the filesystem StageFilesystem creates when none is asked for, as mount-utils
+const defaultFsType = "ext4"
+
+// StageFilesystem mounts the filesystem of the attached volume devicePath at stagingPath with
+// mountOpts, as NodeStageVolume does, creating a filesystem of type fsType (ext4 if "") first when
+// the device has none. A device that holds another filesystem, or a partition table, is never
+// formatted and fails; so does formatting for a read-only ("ro") mount. A staging path the device
+// is already mounted at is left as it is, so CSI retries succeed. Swap, resume and protected
+// devices (WithProtectedDevices) are refused.
+func StageFilesystem(devicePath, fsType string, mountOpts []string, stagingPath string, io ioHandler, opts ...Option) (err error) {
+	defer recoverPanic("StageFilesystem", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	o := newOptions(opts)
+	if o.invalid != nil {
+		return o.invalid
+	}
+	if fsType == "" {
+		fsType = defaultFsType
+	}
+	dev, err := io.EvalSymlinks(devicePath)
+	if err != nil {
+		return err
+	}
+	if source, ok := mount.MountedAt(stagingPath, io); ok {
+		if mounted, err := io.EvalSymlinks(source); err == nil && mounted == dev {
+			glog.Infof("fc: %s is already mounted at %s", devicePath, stagingPath)
+			return nil
+		}
+		return fmt.Errorf("fc: %s is mounted at %s, not %s", source, stagingPath, devicePath)
+	}
+	if err := o.checkNotReserved(dev, io); err != nil {
+		return err
+	}
+
+	existing, err := mount.FilesystemType(dev)
+	if err != nil {
+		return err
+	}
+	switch {
+	case existing == "" && readOnly(mountOpts):
+		return fmt.Errorf("fc: %s has no filesystem and is to be mounted read-only", devicePath)
+	case existing == "":
+		glog.Infof("fc: creating %s filesystem on %s", fsType, devicePath)
+		if err := mount.Format(dev, fsType); err != nil {
+			return fmt.Errorf("fc: unable to create %s filesystem on %s: %v", fsType, devicePath, err)
+		}
+	case existing != fsType:
+		return fmt.Errorf("fc: %s has a %s filesystem, not %s", devicePath, existing, fsType)
+	case o.fsck:
+		if err := o.checkFilesystem(devicePath, dev, fsType); err != nil {
+			return err
+		}
+	}
+
+	glog.Infof("fc: mounting %s at %s", devicePath, stagingPath)
+	if err := mount.Mount(dev, stagingPath, fsType, mountOpts); err != nil {
+		return fmt.Errorf("fc: unable to mount %s at %s: %v", devicePath, stagingPath, err)
+	}
+	return nil
+}
+
+// checkFilesystem runs the filesystem check of WithFilesystemCheck on dev
+func (o *options) checkFilesystem(devicePath, dev, fsType string) error {
+	result, err := mount.Check(dev, fsType)
+	if o.fsckResult != nil {
+		*o.fsckResult = result
+	}
+	switch {
+	case err != nil:
+		return err
+	case result.Repaired:
+		glog.Warningf("fc: %s repaired the filesystem on %s: %s", result.Program, devicePath, result.Output)
+		o.event(EventTypeWarning, ReasonFilesystemRepaired, "%s repaired the filesystem on %s", result.Program, devicePath)
+	case result.Skipped:
+		glog.Warningf("fc: filesystem on %s not checked before mounting: %s", devicePath, result.Output)
+	}
+	return nil
+}
+
+func readOnly(mountOpts []string) bool {
+	for _, opt := range mountOpts {
+		if opt == "ro" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/mount"
+)
+
+func TestStageFilesystem(t *testing.T) {
+	defer func(command func(string, ...string) (string, error)) { mount.Command = command }(mount.Command)
+	var commands []string
+	fsType := ""
+	mount.Command = func(name string, args ...string) (string, error) {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		if name == "blkid" {
+			if fsType == "" {
+				return "", &mount.ExitError{Name: name, Code: 2}
+			}
+			return "TYPE=" + fsType + "\n", nil
+		}
+		return "", nil
+	}
+	fs := mapFixture()
+	fs.files["/dev/dm-0"] = ""
+	staging := "/var/lib/kubelet/plugins/kubernetes.io/csi/fc/pv1/globalmount"
+
+	if err := StageFilesystem("/dev/mapper/mpatha", "", []string{"noatime"}, staging, fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"blkid -p -s TYPE -s PTTYPE -o export /dev/dm-0",
+		"mkfs.ext4 -F -m0 /dev/dm-0",
+		"mount -t ext4 -o noatime /dev/dm-0 " + staging,
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got %q", expected, commands)
+	}
+
+	// an existing filesystem is mounted as it is, never formatted
+	commands, fsType = nil, "xfs"
+	if err := StageFilesystem("/dev/mapper/mpatha", "xfs", nil, staging, fs); err != nil || len(commands) != 2 || !strings.HasPrefix(commands[1], "mount -t xfs /dev/dm-0") {
+		t.Errorf("expected the xfs filesystem to be mounted, got %v %q", err, commands)
+	}
+	commands = nil
+	if err := StageFilesystem("/dev/mapper/mpatha", "ext4", nil, staging, fs); err == nil || !strings.Contains(err.Error(), "has a xfs filesystem") || len(commands) != 1 {
+		t.Errorf("expected a filesystem of another type to fail, got %v %q", err, commands)
+	}
+	commands, fsType = nil, ""
+	if err := StageFilesystem("/dev/mapper/mpatha", "ext4", []string{"ro"}, staging, fs); err == nil || len(commands) != 1 {
+		t.Errorf("expected a read-only mount of an empty device to fail, got %v %q", err, commands)
+	}
+
+	// a protected device is never probed or formatted
+	commands = nil
+	if err := StageFilesystem("/dev/mapper/mpatha", "ext4", nil, staging, fs, WithProtectedDevices("dm-0")); err == nil || len(commands) != 0 {
+		t.Errorf("expected the protected device to be refused, got %v %q", err, commands)
+	}
+
+	// CSI retries find the volume staged already
+	commands = nil
+	fs.files["/proc/mounts"] = "/dev/mapper/mpatha " + staging + " ext4 rw 0 0\n"
+	if err := StageFilesystem("/dev/mapper/mpatha", "ext4", nil, staging, fs); err != nil || len(commands) != 0 {
+		t.Errorf("expected the staged volume to be left alone, got %v %q", err, commands)
+	}
+	fs.files["/proc/mounts"] = "/dev/sdd " + staging + " ext4 rw 0 0\n"
+	fs.files["/dev/sdd"] = ""
+	if err := StageFilesystem("/dev/mapper/mpatha", "ext4", nil, staging, fs); err == nil || len(commands) != 0 {
+		t.Errorf("expected another device at the staging path to fail, got %v %q", err, commands)
+	}
+}
+
+func TestStageFilesystemCheck(t *testing.T) {
+	defer func(command func(string, ...string) (string, error)) { mount.Command = command }(mount.Command)
+	var commands []string
+	fsckCode := 1
+	mount.Command = func(name string, args ...string) (string, error) {
+		commands = append(commands, name)
+		switch name {
+		case "blkid":
+			return "TYPE=ext4\n", nil
+		case "fsck":
+			if fsckCode != 0 {
+				return "fixed\n", &mount.ExitError{Name: name, Code: fsckCode, Output: "fixed\n"}
+			}
+		}
+		return "", nil
+	}
+	fs := mapFixture()
+	fs.files["/dev/dm-0"] = ""
+	var events []recordedEvent
+	var result mount.CheckResult
+
+	err := StageFilesystem("/dev/mapper/mpatha", "ext4", nil, "/staging", fs, WithFilesystemCheck(&result), WithEvents(recordEvents(&events)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(commands, " ") != "blkid fsck mount" {
+		t.Errorf("expected the filesystem to be checked before it is mounted, got %v", commands)
+	}
+	if !result.Repaired || result.Program != "fsck" {
+		t.Errorf("expected the repair to be reported, got %+v", result)
+	}
+	if len(events) != 1 || events[0].reason != ReasonFilesystemRepaired {
+		t.Errorf("expected a %s event, got %+v", ReasonFilesystemRepaired, events)
+	}
+
+	// errors fsck can't correct keep the filesystem from being mounted
+	commands, fsckCode = nil, 4
+	if err := StageFilesystem("/dev/mapper/mpatha", "ext4", nil, "/staging", fs, WithFilesystemCheck(nil)); err == nil || strings.Join(commands, " ") != "blkid fsck" {
+		t.Errorf("expected the stage to fail before mounting, got %v %v", err, commands)
+	}
+
+	// without the option nothing is checked
+	commands = nil
+	if err := StageFilesystem("/dev/mapper/mpatha", "ext4", nil, "/staging", fs); err != nil || strings.Join(commands, " ") != "blkid mount" {
+		t.Errorf("expected no check, got %v %v", err, commands)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// summary is what the summary line of an operation reports besides its result and timings
+type summary struct {
+	volume  string
+	device  string
+	paths   int
+	rescans int
+}
+
+// logSummary logs the single line that sums up an attach or detach, started at start and ending
+// with err: its result, device, number of paths, rescans and where the time went. The lines start
+// with "fc: summary" and are made of key=value pairs, so environments short on log volume can keep
+// only them and still audit every operation.
+func (o *options) logSummary(operation string, start time.Time, err error) {
+	glog.Infof("%s", o.summaryLine(operation, o.clock.Now().Sub(start), err))
+}
+
+func (o *options) summaryLine(operation string, duration time.Duration, err error) string {
+	fields := []string{"operation=" + operation}
+	add := func(key string, value interface{}) {
+		fields = append(fields, fmt.Sprintf("%s=%v", key, value))
+	}
+	if o.summary.volume != "" {
+		add("volume", o.summary.volume)
+	}
+	if o.operationID != "" {
+		add("operationID", o.operationID)
+	}
+	if err != nil {
+		add("result", "failed")
+		add("error", fmt.Sprintf("%q", err.Error()))
+	} else {
+		add("result", "succeeded")
+	}
+	if o.summary.device != "" {
+		add("device", o.summary.device)
+	}
+	add("paths", o.summary.paths)
+	if operation == "attach" {
+		add("rescans", o.summary.rescans)
+	}
+	add("duration", duration)
+	if operation == "attach" {
+		add("rescan", o.phases.Rescan)
+		add("discovery", o.phases.Discovery)
+		add("deviceWait", o.phases.DeviceWait)
+	}
+	return "fc: summary " + strings.Join(fields, " ") + formatLabels(o.labels)
+}
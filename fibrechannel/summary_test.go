@@ -0,0 +1,56 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryLine(t *testing.T) {
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0", Labels: map[string]string{"pv": "pvc-1"}}
+	o := newOptions([]Option{WithOperationID("op1")})
+	devicePath, err := attach(c, &fakeIOHandler{}, o)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "fc: summary operation=attach volume=vol operationID=op1 result=succeeded device=" + devicePath + " paths=1 rescans=0 duration=2s"
+	if line := o.summaryLine("attach", 2*time.Second, nil); !strings.HasPrefix(line, expected) || !strings.HasSuffix(line, " pv=pvc-1") {
+		t.Errorf("expected a summary starting with %q, got %q", expected, line)
+	}
+
+	o = newOptions(nil)
+	if _, err := attach(Connector{VolumeName: "bad"}, &fakeIOHandler{}, o); err == nil {
+		t.Fatal("expected the attach without targets to fail")
+	}
+	if line := o.summaryLine("attach", time.Second, errors.New("no fc disk found")); !strings.Contains(line, `result=failed error="no fc disk found" paths=0`) {
+		t.Errorf("unexpected summary of a failed attach %q", line)
+	}
+
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+	fs.files["/dev/sdb"] = ""
+	o = newOptions([]Option{WithoutBufferFlush()})
+	o.summary.volume = "vol"
+	if err := detach("/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1", fs, o); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if line := o.summaryLine("detach", time.Second, nil); !strings.HasPrefix(line, "fc: summary operation=detach volume=vol result=succeeded device=/dev/sdb paths=1 duration=1s") {
+		t.Errorf("unexpected detach summary %q", line)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"path"
+)
+
+//Layout builds the paths of the sysfs objects the fibre channel packages work with below Root,
+//which defaults to /sys. The library builds all of its sysfs paths through DefaultLayout, so vendor
+//drivers doing one-off sysfs operations should use it too and stay consistent with the library
+//when the root is moved, e.g. to where a container mounts the host's sysfs. Methods naming a class
+//or bus directory return it with a trailing slash.
+type Layout struct {
+	Root string
+}
+
+//DefaultLayout is the layout the fibre channel packages use
+var DefaultLayout = Layout{Root: "/sys"}
+
+// Path returns the path below Root of elem, for the objects the Layout has no method for, e.g.
+// Path("power/resume")
+func (l Layout) Path(elem ...string) string {
+	root := l.Root
+	if root == "" {
+		root = "/sys"
+	}
+	return path.Join(append([]string{root}, elem...)...)
+}
+
+func (l Layout) dir(elem ...string) string {
+	return l.Path(elem...) + "/"
+}
+
+// SCSIHosts returns the directory listing every scsi host (hostN)
+func (l Layout) SCSIHosts() string {
+	return l.dir("class/scsi_host")
+}
+
+// SCSIHost returns the directory of the scsi host host, e.g. host3
+func (l Layout) SCSIHost(host string) string {
+	return l.Path("class/scsi_host", host)
+}
+
+// FCHosts returns the directory listing every fibre channel host port (hostN)
+func (l Layout) FCHosts() string {
+	return l.dir("class/fc_host")
+}
+
+// FCHost returns the directory of the fibre channel host port host, e.g. host3
+func (l Layout) FCHost(host string) string {
+	return l.Path("class/fc_host", host)
+}
+
+// FCRemotePorts returns the directory listing every fibre channel remote port (rport-H:C-N)
+func (l Layout) FCRemotePorts() string {
+	return l.dir("class/fc_remote_ports")
+}
+
+// FCRemotePort returns the directory of the remote port rport, e.g. rport-3:0-1
+func (l Layout) FCRemotePort(rport string) string {
+	return l.Path("class/fc_remote_ports", rport)
+}
+
+// FCTransport returns the directory listing every fibre channel target (targetH:C:T)
+func (l Layout) FCTransport() string {
+	return l.dir("class/fc_transport")
+}
+
+// FCTarget returns the fc_transport directory of the target with the H:C:T address target
+func (l Layout) FCTarget(target string) string {
+	return l.Path("class/fc_transport", "target"+target)
+}
+
+// Enclosures returns the directory listing every SES enclosure
+func (l Layout) Enclosures() string {
+	return l.dir("class/enclosure")
+}
+
+// Enclosure returns the directory of the SES enclosure enclosure, e.g. 5:0:1:0
+func (l Layout) Enclosure(enclosure string) string {
+	return l.Path("class/enclosure", enclosure)
+}
+
+// SCSIDevices returns the directory listing every scsi device by its H:C:T:L address
+func (l Layout) SCSIDevices() string {
+	return l.dir("bus/scsi/devices")
+}
+
+// SCSIDevice returns the directory of the scsi device with the H:C:T:L address hctl
+func (l Layout) SCSIDevice(hctl string) string {
+	return l.Path("bus/scsi/devices", hctl)
+}
+
+// Blocks returns the directory listing every block device
+func (l Layout) Blocks() string {
+	return l.dir("block")
+}
+
+// Block returns the directory of the block device dev, e.g. sdb or dm-0, or of its attribute attr
+// when given, e.g. Block("sdb", "device/wwid")
+func (l Layout) Block(dev string, attr ...string) string {
+	return l.Path(append([]string{"block", dev}, attr...)...)
+}
+
+// BlockSlaves returns the directory listing the devices a device mapper device dev is built on
+func (l Layout) BlockSlaves(dev string) string {
+	return l.Block(dev, "slaves")
+}
+
+// BlockHolders returns the directory listing the devices built on the block device dev
+func (l Layout) BlockHolders(dev string) string {
+	return l.Block(dev, "holders")
+}
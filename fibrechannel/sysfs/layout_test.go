@@ -0,0 +1,41 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{Layout{}.SCSIHosts(), "/sys/class/scsi_host/"},
+		{Layout{}.FCHost("host3"), "/sys/class/fc_host/host3"},
+		{Layout{}.FCRemotePort("rport-3:0-1"), "/sys/class/fc_remote_ports/rport-3:0-1"},
+		{Layout{}.FCTarget("3:0:1"), "/sys/class/fc_transport/target3:0:1"},
+		{Layout{}.SCSIDevice("3:0:1:2"), "/sys/bus/scsi/devices/3:0:1:2"},
+		{Layout{}.Block("sdb", "device/wwid"), "/sys/block/sdb/device/wwid"},
+		{Layout{Root: "/host/sys"}.BlockSlaves("dm-0"), "/host/sys/block/dm-0/slaves"},
+		{Layout{Root: "/host/sys/"}.Path("power/resume"), "/host/sys/power/resume"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("expected %s, got %s", test.want, test.got)
+		}
+	}
+}
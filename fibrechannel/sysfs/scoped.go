@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+//Scoped is an IO that hands every operation to the IO responsible for the tree its path is in:
+//Sys for the kernel interfaces under the root of DefaultLayout (/sys) and /proc, Dev for the device nodes and udev links in
+//the /dev tree, Etc for configuration under /etc and Default for anything else. A nil field falls
+//back to Default. It lets tests fake /sys alone, or a restricted deployment keep /dev read-only.
+type Scoped struct {
+	Sys     IO
+	Dev     IO
+	Etc     IO
+	Default IO
+}
+
+func (s *Scoped) route(name string) (IO, error) {
+	var io IO
+	switch {
+	case inTree(name, DefaultLayout.Path()), inTree(name, "/proc"):
+		io = s.Sys
+	case inTree(name, "/dev"):
+		io = s.Dev
+	case inTree(name, "/etc"):
+		io = s.Etc
+	}
+	if io == nil {
+		io = s.Default
+	}
+	if io == nil {
+		return nil, &os.PathError{Op: "route", Path: name, Err: fmt.Errorf("no io handler for path")}
+	}
+	return io, nil
+}
+
+func inTree(name, root string) bool {
+	return name == root || strings.HasPrefix(name, root+"/")
+}
+
+//ReadDir calls ReadDir of the IO responsible for dirname
+func (s *Scoped) ReadDir(dirname string) ([]os.FileInfo, error) {
+	io, err := s.route(dirname)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadDir(dirname)
+}
+
+//Lstat calls Lstat of the IO responsible for name
+func (s *Scoped) Lstat(name string) (os.FileInfo, error) {
+	io, err := s.route(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.Lstat(name)
+}
+
+//EvalSymlinks calls EvalSymlinks of the IO responsible for path
+func (s *Scoped) EvalSymlinks(path string) (string, error) {
+	io, err := s.route(path)
+	if err != nil {
+		return "", err
+	}
+	return io.EvalSymlinks(path)
+}
+
+//WriteFile calls WriteFile of the IO responsible for filename
+func (s *Scoped) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	io, err := s.route(filename)
+	if err != nil {
+		return err
+	}
+	return io.WriteFile(filename, data, perm)
+}
+
+//ReadFile calls ReadFile of the IO responsible for filename
+func (s *Scoped) ReadFile(filename string) ([]byte, error) {
+	io, err := s.route(filename)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadFile(filename)
+}
+
+//Remove calls Remove of the IO responsible for name
+func (s *Scoped) Remove(name string) error {
+	io, err := s.route(name)
+	if err != nil {
+		return err
+	}
+	return io.Remove(name)
+}
+
+//Rename calls Rename of the IO responsible for both paths, renaming across IOs fails
+func (s *Scoped) Rename(oldpath, newpath string) error {
+	io, err := s.route(oldpath)
+	if err != nil {
+		return err
+	}
+	if to, err := s.route(newpath); err != nil || to != io {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fmt.Errorf("paths handled by different io handlers")}
+	}
+	return io.Rename(oldpath, newpath)
+}
+
+// readOnly refuses every write of the IO it wraps
+type readOnly struct {
+	IO
+}
+
+// ReadOnly returns an IO that reads through io and fails every write, removal and rename with
+// os.ErrPermission
+func ReadOnly(io IO) IO {
+	return readOnly{io}
+}
+
+func (r readOnly) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	return &os.PathError{Op: "write", Path: filename, Err: os.ErrPermission}
+}
+
+func (r readOnly) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+}
+
+func (r readOnly) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrPermission}
+}
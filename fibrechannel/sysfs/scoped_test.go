@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"os"
+	"testing"
+)
+
+// recordingIO records the paths written through it and reads every file as its own name
+type recordingIO struct {
+	IO
+	writes []string
+}
+
+func (io *recordingIO) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	io.writes = append(io.writes, filename)
+	return nil
+}
+
+func (io *recordingIO) ReadFile(filename string) ([]byte, error) {
+	return []byte(filename), nil
+}
+
+func TestScoped(t *testing.T) {
+	sys, dev := &recordingIO{}, &recordingIO{}
+	io := &Scoped{Sys: sys, Dev: ReadOnly(dev)}
+
+	if err := io.WriteFile("/sys/block/sdb/device/delete", []byte("1"), 0666); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := io.WriteFile("/proc/sys/vm/drop_caches", []byte("1"), 0666); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := io.WriteFile("/dev/sdb", []byte("1"), 0666); !os.IsPermission(err) {
+		t.Errorf("expected a read-only /dev, got %v", err)
+	}
+	if len(sys.writes) != 2 || len(dev.writes) != 0 {
+		t.Errorf("unexpected writes: sys %v, dev %v", sys.writes, dev.writes)
+	}
+	if data, err := io.ReadFile("/dev/disk/by-id/wwn-0x600a"); err != nil || string(data) != "/dev/disk/by-id/wwn-0x600a" {
+		t.Errorf("expected /dev reads to pass, got %q, %v", data, err)
+	}
+	if err := io.Rename("/sys/block/sdb/device/delete", "/dev/sdb"); err == nil {
+		t.Error("expected a rename across io handlers to fail")
+	}
+	// nothing handles /etc or /devices
+	if _, err := io.ReadFile("/etc/multipath.conf"); err == nil {
+		t.Error("expected an error without an /etc handler")
+	}
+	if _, err := io.ReadFile("/devices"); err == nil {
+		t.Error("expected /devices not to be routed to the /dev handler")
+	}
+
+	// the kernel interfaces follow the root of DefaultLayout
+	defer func(layout Layout) { DefaultLayout = layout }(DefaultLayout)
+	DefaultLayout = Layout{Root: "/host/sys"}
+	sys.writes = nil
+	if err := io.WriteFile(DefaultLayout.Block("sdb", "device/delete"), []byte("1"), 0666); err != nil || len(sys.writes) != 1 {
+		t.Errorf("expected the moved sysfs to be routed to the sys handler, got %v %v", err, sys.writes)
+	}
+}
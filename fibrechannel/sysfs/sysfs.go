@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sysfs holds the io abstraction the fibre channel packages use to read and write the
+// kernel's /sys and /dev trees, so every building block can be driven by the same fake in tests.
+package sysfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	retryAttempts = 3
+	retryDelay    = 10 * time.Millisecond
+)
+
+//IO is the set of filesystem operations the fibre channel packages perform
+type IO interface {
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	EvalSymlinks(path string) (string, error)
+	WriteFile(filename string, data []byte, perm os.FileMode) error
+	ReadFile(filename string) ([]byte, error)
+	Remove(name string) error
+	Rename(oldpath, newpath string) error
+}
+
+// ReadAttr returns the trimmed content of a sysfs attribute or "" if it can't be read
+func ReadAttr(name string, io IO) string {
+	data, err := io.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ReadFileRetry reads a sysfs file retrying a few times on the errors sysfs returns transiently
+// while a device is being set up or torn down: ENOENT before an attribute is registered and
+// EINVAL while a driver isn't ready to answer yet. Use it for attributes that must exist.
+func ReadFileRetry(name string, io IO) ([]byte, error) {
+	return readRetry(name, io, IsTransient)
+}
+
+// ReadAttrRetry is ReadAttr retrying on EINVAL like ReadFileRetry. A missing attribute is read as
+// "" right away: it is used for attributes not every device, target or driver has, which would
+// otherwise cost every lookup the full retry delay.
+func ReadAttrRetry(name string, io IO) string {
+	data, err := readRetry(name, io, func(err error) bool {
+		return IsTransient(err) && !os.IsNotExist(err)
+	})
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readRetry reads name, retrying a few times with a growing delay while transient(err)
+func readRetry(name string, io IO, transient func(error) bool) ([]byte, error) {
+	var data []byte
+	var err error
+	for attempt := 1; ; attempt++ {
+		data, err = io.ReadFile(name)
+		if err == nil || !transient(err) || attempt == retryAttempts {
+			return data, err
+		}
+		time.Sleep(time.Duration(attempt) * retryDelay)
+	}
+}
+
+// IsTransient reports whether a sysfs error may go away on its own during device churn
+func IsTransient(err error) bool {
+	return errors.Is(err, syscall.ENOENT) || errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.EINVAL)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sysfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// flakyIO fails ReadFile with err for the first failures calls
+type flakyIO struct {
+	IO
+	err      error
+	failures int
+	calls    int
+}
+
+func (io *flakyIO) ReadFile(filename string) ([]byte, error) {
+	io.calls++
+	if io.calls <= io.failures {
+		return nil, &os.PathError{Op: "read", Path: filename, Err: io.err}
+	}
+	return []byte("0x500a0981891b8dc5\n"), nil
+}
+
+func TestReadFileRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		failures int
+		calls    int
+		success  bool
+	}{
+		{"no error", syscall.EINVAL, 0, 1, true},
+		{"transient EINVAL", syscall.EINVAL, 2, 3, true},
+		{"transient ENOENT", syscall.ENOENT, 1, 2, true},
+		{"persistent ENOENT", syscall.ENOENT, 5, 3, false},
+		{"EACCES is not retried", syscall.EACCES, 1, 1, false},
+	}
+	for _, test := range tests {
+		io := &flakyIO{err: test.err, failures: test.failures}
+		_, err := ReadFileRetry("/sys/class/fc_transport/target5:0:0/port_name", io)
+		if (err == nil) != test.success || io.calls != test.calls {
+			t.Errorf("%s: expected success %v after %d calls, got %v after %d", test.name, test.success, test.calls, err, io.calls)
+		}
+	}
+}
+
+func TestReadAttrRetry(t *testing.T) {
+	io := &flakyIO{err: syscall.EINVAL, failures: 1}
+	if value := ReadAttrRetry("/sys/class/fc_transport/target5:0:0/port_name", io); value != "0x500a0981891b8dc5" || io.calls != 2 {
+		t.Errorf("expected EINVAL to be retried, got %q after %d calls", value, io.calls)
+	}
+	io = &flakyIO{err: syscall.ENOENT, failures: 1}
+	if value := ReadAttrRetry("/sys/class/fc_transport/target5:0:0/port_name", io); value != "" || io.calls != 1 {
+		t.Errorf("expected a missing attribute not to be retried, got %q after %d calls", value, io.calls)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	if !IsTransient(os.ErrNotExist) || !IsTransient(syscall.EINVAL) || IsTransient(errors.New("other")) {
+		t.Error("unexpected transient classification")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+)
+
+// multipathPollInterval spaces the searches for a multipath map while waiting for multipathd
+const multipathPollInterval = 250 * time.Millisecond
+
+//Timeouts bounds the waits of an operation in one place. Attach bounds the rescans of Attach and
+//Prefetch as a whole. RescanWait is the pause after each rescan that gives udev time to create
+//the device links. MultipathWait is how long Attach waits for multipathd to assemble a map once
+//a single path was found, and for the paths WithMinPaths requires. UdevSettle is how long
+//WaitForWWIDSymlink waits for the by-id link and DeviceGone how long Attach waits for the devices
+//of a previous attachment to go away, and Detach for a flushed multipath map to. DetachFlush bounds
+//the flush of each device's buffers before Detach removes it. Resize is how long
+//ResizeMultipathDevice and ExpandVolume wait for a resized map to take its new size. A zero field
+//leaves its timeout as it was, the one of DefaultTimeouts unless an earlier option set it. Zero in
+//DefaultTimeouts means no wait or no bound.
+type Timeouts struct {
+	Attach        time.Duration
+	RescanWait    time.Duration
+	MultipathWait time.Duration
+	UdevSettle    time.Duration
+	DeviceGone    time.Duration
+	DetachFlush   time.Duration
+	Resize        time.Duration
+}
+
+//DefaultTimeouts are the timeouts of an operation without WithTimeouts
+var DefaultTimeouts = Timeouts{
+	DeviceGone:  teardownTimeout,
+	DetachFlush: flushTimeout,
+	Resize:      resizeTimeout,
+}
+
+// Validate checks that no timeout is negative and that, when Attach bounds the whole search, the
+// waits of the search fit into it
+func (t Timeouts) Validate() error {
+	waits := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"RescanWait", t.RescanWait},
+		{"MultipathWait", t.MultipathWait},
+		{"UdevSettle", t.UdevSettle},
+		{"DeviceGone", t.DeviceGone},
+		{"DetachFlush", t.DetachFlush},
+		{"Resize", t.Resize},
+	}
+	if t.Attach < 0 {
+		return fmt.Errorf("fc: timeout Attach must not be negative, got %v", t.Attach)
+	}
+	for _, w := range waits {
+		if w.timeout < 0 {
+			return fmt.Errorf("fc: timeout %s must not be negative, got %v", w.name, w.timeout)
+		}
+		if t.Attach > 0 && w.name != "UdevSettle" && w.name != "DetachFlush" && w.name != "Resize" && w.timeout > t.Attach {
+			return fmt.Errorf("fc: timeout %s (%v) is longer than Attach (%v) it is part of", w.name, w.timeout, t.Attach)
+		}
+	}
+	return nil
+}
+
+// WithTimeouts sets the operation's timeouts, overriding WithTimeout and WithPollInterval given
+// before it for the fields that are set. Invalid timeouts, including those that don't fit the
+// ones set before, fail the operation.
+func WithTimeouts(t Timeouts) Option {
+	return func(o *options) {
+		if err := t.Validate(); err != nil {
+			o.invalid = err
+			return
+		}
+		set := &o.timeoutsSet
+		for _, f := range []struct {
+			value      time.Duration
+			opt, saved *time.Duration
+		}{
+			{t.Attach, &o.timeout, &set.Attach},
+			{t.RescanWait, &o.pollInterval, &set.RescanWait},
+			{t.MultipathWait, &o.multipathWait, &set.MultipathWait},
+			{t.UdevSettle, &o.udevSettle, &set.UdevSettle},
+			{t.DeviceGone, &o.deviceGone, &set.DeviceGone},
+			{t.DetachFlush, &o.detachFlush, &set.DetachFlush},
+			{t.Resize, &o.resize, &set.Resize},
+		} {
+			if f.value > 0 {
+				*f.opt, *f.saved = f.value, f.value
+			}
+		}
+		// what this sets has to fit what earlier options set, the defaults aren't held against it
+		if err := set.Validate(); err != nil {
+			o.invalid = err
+		}
+	}
+}
+
+// awaitMultipath searches again until multipathd assembled the map of the single paths found or
+// o.pathWait() has passed, and returns what it found last
+func awaitMultipath(c Connector, candidates []candidate, io ioHandler, o *options) []candidate {
+	deadline := o.clock.Now().Add(o.pathWait())
+	poll.Until(o.ctx, o.clock, multipathPollInterval, func() (bool, error) {
+		if found := findCandidates(c, io); len(found) > 0 {
+			candidates = found
+		}
+		return hasMultipath(candidates) || !o.clock.Now().Before(deadline), nil
+	})
+	return candidates
+}
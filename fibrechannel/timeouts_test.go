@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	polltesting "github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll/testing"
+)
+
+func TestTimeoutsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts Timeouts
+		valid    bool
+	}{
+		{"defaults", DefaultTimeouts, true},
+		{"slow fabric", Timeouts{Attach: 5 * time.Minute, RescanWait: 10 * time.Second, MultipathWait: time.Minute, DeviceGone: time.Minute}, true},
+		{"no overall bound", Timeouts{MultipathWait: time.Hour}, true},
+		{"udev settle outside attach", Timeouts{Attach: time.Minute, UdevSettle: 2 * time.Minute}, true},
+		{"resize outside attach", Timeouts{Attach: time.Minute, Resize: 2 * time.Minute}, true},
+		{"negative resize", Timeouts{Resize: -time.Second}, false},
+		{"negative", Timeouts{RescanWait: -time.Second}, false},
+		{"negative attach", Timeouts{Attach: -time.Second}, false},
+		{"wait longer than attach", Timeouts{Attach: time.Minute, MultipathWait: 2 * time.Minute}, false},
+	}
+	for _, test := range tests {
+		if err := test.timeouts.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestWithTimeouts(t *testing.T) {
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	if _, err := Attach(c, &fakeIOHandler{}, WithTimeouts(Timeouts{Attach: time.Second, DeviceGone: time.Minute})); err == nil {
+		t.Errorf("expected invalid timeouts to fail the attach")
+	}
+
+	o := newOptions([]Option{WithTimeouts(Timeouts{Attach: time.Minute, RescanWait: time.Second})})
+	if o.timeout != time.Minute || o.pollInterval != time.Second || o.deviceGone != DefaultTimeouts.DeviceGone || o.resize != DefaultTimeouts.Resize {
+		t.Errorf("unexpected options %+v", o)
+	}
+	o = newOptions([]Option{WithTimeouts(Timeouts{DeviceGone: time.Minute, Resize: 2 * time.Minute})})
+	if o.deviceGone != time.Minute || o.resize != 2*time.Minute {
+		t.Errorf("unexpected options %+v", o)
+	}
+
+	// unset fields leave what earlier options set
+	o = newOptions([]Option{WithTimeout(time.Hour), WithPollInterval(time.Minute), WithTimeouts(Timeouts{UdevSettle: time.Second})})
+	if o.timeout != time.Hour || o.pollInterval != time.Minute || o.udevSettle != time.Second {
+		t.Errorf("unexpected options %+v", o)
+	}
+
+	// the merged timeouts are validated, not only the fields set
+	o = newOptions([]Option{WithTimeout(5 * time.Second), WithTimeouts(Timeouts{MultipathWait: time.Minute})})
+	if o.invalid == nil {
+		t.Errorf("expected MultipathWait longer than the earlier Attach timeout to be invalid")
+	}
+	o = newOptions([]Option{WithTimeouts(Timeouts{MultipathWait: time.Minute}), WithTimeouts(Timeouts{Attach: 5 * time.Second})})
+	if o.invalid == nil {
+		t.Errorf("expected an Attach timeout shorter than the earlier MultipathWait to be invalid")
+	}
+	// a short Attach timeout isn't held against the default DeviceGone
+	if o = newOptions([]Option{WithTimeouts(Timeouts{Attach: 5 * time.Second})}); o.invalid != nil {
+		t.Errorf("unexpected error %v", o.invalid)
+	}
+}
+
+func TestUdevSettleTimeout(t *testing.T) {
+	clock := polltesting.NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go clock.StepUntilDone(time.Second, done)
+	defer close(done)
+
+	_, err := WaitForWWIDSymlink(context.Background(), "3600508b400105e21000090000049ffff", newFakeSysfs(),
+		WithClock(clock), WithTimeouts(Timeouts{UdevSettle: 5 * time.Second}))
+	if err == nil {
+		t.Errorf("expected the missing link to time out")
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/multipath"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//QueueSettings are block queue tunables for an attached device, zero values are left alone.
+//Scheduler may name either a legacy or a blk-mq scheduler, it is translated to the equivalent
+//the device's queueing model offers.
+type QueueSettings struct {
+	Scheduler   string
+	NrRequests  int
+	ReadAheadKB int
+}
+
+//QueueInfo describes how a block device queues requests
+type QueueInfo struct {
+	MultiQueue          bool
+	HardwareQueues      int
+	Scheduler           string
+	AvailableSchedulers []string
+}
+
+// equivalent schedulers between the legacy block layer and blk-mq
+var schedulerEquivalents = map[string]string{
+	"noop":        "none",
+	"none":        "noop",
+	"deadline":    "mq-deadline",
+	"mq-deadline": "deadline",
+	"cfq":         "bfq",
+	"bfq":         "cfq",
+}
+
+// GetQueueInfo reports the queueing model of a block device such as sdX
+func GetQueueInfo(dev string, io ioHandler) (info QueueInfo, err error) {
+	defer recoverPanic("GetQueueInfo", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	schedulers, err := io.ReadFile(sysfs.DefaultLayout.Block(dev, "queue/scheduler"))
+	if err != nil {
+		return info, err
+	}
+	// e.g. "[mq-deadline] kyber bfq none", the active one is bracketed
+	for _, s := range strings.Fields(string(schedulers)) {
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			s = strings.Trim(s, "[]")
+			info.Scheduler = s
+		}
+		info.AvailableSchedulers = append(info.AvailableSchedulers, s)
+	}
+	// only blk-mq devices have an mq directory, with one entry per hardware queue
+	if queues, err := io.ReadDir(sysfs.DefaultLayout.Block(dev, "mq")); err == nil {
+		info.MultiQueue = true
+		info.HardwareQueues = len(queues)
+	}
+	return info, nil
+}
+
+// TuneDevice applies settings to an attached device. For a multipath device the scheduler and
+// request settings go to every path, the dm device itself only takes read-ahead. System devices
+// and those matching WithProtectedDevices are refused before anything is written.
+func TuneDevice(devicePath string, settings QueueSettings, io ioHandler, opts ...Option) (err error) {
+	defer recoverPanic("TuneDevice", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	o := newOptions(opts)
+	if o.invalid != nil {
+		return o.invalid
+	}
+
+	dev := path.Base(devicePath)
+	if strings.HasPrefix(dev, "dm-") {
+		slaves := multipath.Slaves("/dev/"+dev, io)
+		for _, device := range append([]string{"/dev/" + dev}, slaves...) {
+			if err := o.checkNotReserved(device, io); err != nil {
+				return err
+			}
+		}
+		if err := tuneQueue(dev, QueueSettings{ReadAheadKB: settings.ReadAheadKB}, io); err != nil {
+			return err
+		}
+		settings.ReadAheadKB = 0
+		for _, slave := range slaves {
+			if err := tuneQueue(path.Base(slave), settings, io); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := o.checkNotReserved("/dev/"+dev, io); err != nil {
+		return err
+	}
+	return tuneQueue(dev, settings, io)
+}
+
+func tuneQueue(dev string, settings QueueSettings, io ioHandler) error {
+	if settings.Scheduler != "" {
+		info, err := GetQueueInfo(dev, io)
+		if err != nil {
+			return err
+		}
+		scheduler, err := pickScheduler(settings.Scheduler, info)
+		if err != nil {
+			return fmt.Errorf("fc: %s: %v", dev, err)
+		}
+		if err := writeQueueAttr(dev, "scheduler", scheduler, io); err != nil {
+			return err
+		}
+	}
+	if settings.NrRequests > 0 {
+		if err := writeQueueAttr(dev, "nr_requests", strconv.Itoa(settings.NrRequests), io); err != nil {
+			return err
+		}
+	}
+	if settings.ReadAheadKB > 0 {
+		if err := writeQueueAttr(dev, "read_ahead_kb", strconv.Itoa(settings.ReadAheadKB), io); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pickScheduler returns scheduler or its equivalent for the device's queueing model
+func pickScheduler(scheduler string, info QueueInfo) (string, error) {
+	for _, candidate := range []string{scheduler, schedulerEquivalents[scheduler]} {
+		for _, available := range info.AvailableSchedulers {
+			if candidate != "" && candidate == available {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("scheduler %s is not available (multiqueue %v), have %v", scheduler, info.MultiQueue, info.AvailableSchedulers)
+}
+
+// writeQueueAttr writes a queue attribute, failing loudly if the kernel doesn't have it rather
+// than silently creating nothing
+func writeQueueAttr(dev, attr, value string, io ioHandler) error {
+	name := sysfs.DefaultLayout.Block(dev, "queue", attr)
+	if _, err := io.Lstat(name); err != nil {
+		return fmt.Errorf("fc: %s has no queue attribute %s: %v", dev, attr, err)
+	}
+	glog.Infof("fc: setting %s to %s", name, value)
+	if err := io.WriteFile(name, []byte(value), 0644); err != nil {
+		return err
+	}
+	if current := sysfs.ReadAttr(name, io); attr != "scheduler" && current != "" && current != value {
+		glog.Warningf("fc: %s is %s after writing %s", name, current, value)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"testing"
+)
+
+func newFakeQueues() *fakeSysfs {
+	fs := newFakeSysfs()
+	// sdb is blk-mq with two hardware queues, sdc uses the legacy block layer
+	fs.files["/sys/block/sdb/queue/scheduler"] = "[mq-deadline] kyber bfq none\n"
+	fs.files["/sys/block/sdb/queue/nr_requests"] = "256\n"
+	fs.files["/sys/block/sdb/mq/0/cpu_list"] = "0\n"
+	fs.files["/sys/block/sdb/mq/1/cpu_list"] = "1\n"
+	fs.files["/sys/block/sdc/queue/scheduler"] = "noop deadline [cfq]\n"
+	fs.files["/sys/block/sdc/queue/nr_requests"] = "128\n"
+	fs.files["/sys/block/dm-0/queue/read_ahead_kb"] = "128\n"
+	fs.links["/sys/block/dm-0/slaves/sdb"] = "/sys/devices/sdb"
+	fs.links["/sys/block/dm-0/slaves/sdc"] = "/sys/devices/sdc"
+	return fs
+}
+
+func TestGetQueueInfo(t *testing.T) {
+	fs := newFakeQueues()
+	info, err := GetQueueInfo("sdb", fs)
+	if err != nil || !info.MultiQueue || info.HardwareQueues != 2 || info.Scheduler != "mq-deadline" {
+		t.Errorf("unexpected sdb info %+v, %v", info, err)
+	}
+	info, err = GetQueueInfo("sdc", fs)
+	if err != nil || info.MultiQueue || info.Scheduler != "cfq" || len(info.AvailableSchedulers) != 3 {
+		t.Errorf("unexpected sdc info %+v, %v", info, err)
+	}
+}
+
+func TestTuneDeviceTranslatesSchedulers(t *testing.T) {
+	fs := newFakeQueues()
+	err := TuneDevice("/dev/dm-0", QueueSettings{Scheduler: "deadline", NrRequests: 64, ReadAheadKB: 4096}, fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"/sys/block/sdb/queue/scheduler":      "mq-deadline",
+		"/sys/block/sdc/queue/scheduler":      "deadline",
+		"/sys/block/sdb/queue/nr_requests":    "64",
+		"/sys/block/sdc/queue/nr_requests":    "64",
+		"/sys/block/dm-0/queue/read_ahead_kb": "4096",
+	}
+	for name, value := range expected {
+		if fs.writes[name] != value {
+			t.Errorf("expected %s to be %s, got %q", name, value, fs.writes[name])
+		}
+	}
+}
+
+func TestTuneDeviceMissingAttribute(t *testing.T) {
+	fs := newFakeQueues()
+	if err := TuneDevice("/dev/sdb", QueueSettings{ReadAheadKB: 4096}, fs); err == nil {
+		t.Error("expected an error for a missing queue attribute")
+	}
+	if err := TuneDevice("/dev/sdb", QueueSettings{Scheduler: "anticipatory"}, fs); err == nil {
+		t.Error("expected an error for an unavailable scheduler")
+	}
+}
+
+func TestTuneDeviceRefusesProtected(t *testing.T) {
+	fs := newFakeQueues()
+	if err := TuneDevice("/dev/dm-0", QueueSettings{ReadAheadKB: 4096}, fs, WithProtectedDevices("sdc")); err == nil {
+		t.Error("expected a map with a protected path to be refused")
+	}
+	fs.files["/proc/swaps"] = "Filename Type Size Used Priority\n/dev/sdb partition 1048572 0 -2\n"
+	if err := TuneDevice("/dev/sdb", QueueSettings{NrRequests: 64}, fs); err == nil {
+		t.Error("expected a swap device to be refused")
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("expected nothing to be written, got %v", fs.writes)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uevent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// netlink multicast groups of NETLINK_KOBJECT_UEVENT
+const (
+	// KernelGroup receives the events as the kernel sends them, before udev processed them
+	KernelGroup = 1
+	// UdevGroup receives the events udev rebroadcasts once it has run its rules, i.e. created
+	// the device node and its /dev/disk symlinks
+	UdevGroup = 2
+)
+
+// udev's netlink messages start with this prefix and a header in front of the properties
+const (
+	udevPrefix = "libudev\x00"
+	udevMagic  = 0xfeedcafe
+	// udevHeaderLen covers the prefix, magic, header size and properties offset and length
+	udevHeaderLen = 24
+)
+
+//Event is a uevent of a device: its action (add, remove, change, ...), sysfs path and properties
+type Event struct {
+	Action    string
+	DevPath   string
+	Subsystem string
+	DevType   string
+	DevName   string
+	Env       map[string]string
+}
+
+// Listen subscribes to the uevents of group and sends them until ctx is done. Anyone allowed
+// to send to the group can fake an event, so events should only prompt a look at sysfs.
+var Listen = listen
+
+// Parse decodes a uevent message as sent by the kernel (ACTION@DEVPATH followed by the
+// properties) or rebroadcast by udev (a libudev header followed by the properties)
+func Parse(msg []byte) (Event, error) {
+	var props []byte
+	if bytes.HasPrefix(msg, []byte(udevPrefix)) {
+		if len(msg) < udevHeaderLen || binary.BigEndian.Uint32(msg[8:]) != udevMagic {
+			return Event{}, fmt.Errorf("fc: malformed udev message")
+		}
+		// the offsets are in the sender's, i.e. this host's, byte order
+		off := nativeEndian.Uint32(msg[16:])
+		length := nativeEndian.Uint32(msg[20:])
+		if uint64(off)+uint64(length) > uint64(len(msg)) {
+			return Event{}, fmt.Errorf("fc: malformed udev message")
+		}
+		props = msg[off : off+length]
+	} else {
+		i := bytes.IndexByte(msg, 0)
+		if i < 0 || !bytes.Contains(msg[:i], []byte("@")) {
+			return Event{}, fmt.Errorf("fc: malformed uevent %q", msg)
+		}
+		props = msg[i+1:]
+	}
+
+	e := Event{Env: map[string]string{}}
+	for _, prop := range bytes.Split(props, []byte{0}) {
+		if kv := strings.SplitN(string(prop), "=", 2); len(kv) == 2 {
+			e.Env[kv[0]] = kv[1]
+		}
+	}
+	e.Action = e.Env["ACTION"]
+	e.DevPath = e.Env["DEVPATH"]
+	e.Subsystem = e.Env["SUBSYSTEM"]
+	e.DevType = e.Env["DEVTYPE"]
+	e.DevName = e.Env["DEVNAME"]
+	if e.Action == "" || e.DevPath == "" {
+		return Event{}, fmt.Errorf("fc: uevent without action or devpath")
+	}
+	return e, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uevent
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const props = "ACTION=add\x00DEVPATH=/devices/pci0000:00/0000:00:03.0/host5/rport-5:0-2/target5:0:1/5:0:1:3/block/sdc\x00SUBSYSTEM=block\x00DEVNAME=sdc\x00DEVTYPE=disk\x00SEQNUM=4711\x00"
+
+func TestParseKernel(t *testing.T) {
+	e, err := Parse([]byte("add@/devices/pci0000:00/0000:00:03.0/host5/rport-5:0-2/target5:0:1/5:0:1:3/block/sdc\x00" + props))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.Action != "add" || e.Subsystem != "block" || e.DevName != "sdc" || e.DevType != "disk" || e.Env["SEQNUM"] != "4711" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestParseUdev(t *testing.T) {
+	msg := make([]byte, 40)
+	copy(msg, udevPrefix)
+	binary.BigEndian.PutUint32(msg[8:], udevMagic)
+	binary.NativeEndian.PutUint32(msg[12:], 40)
+	binary.NativeEndian.PutUint32(msg[16:], 40)
+	binary.NativeEndian.PutUint32(msg[20:], uint32(len(props)))
+	msg = append(msg, props...)
+
+	e, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.Action != "add" || !strings.HasSuffix(e.DevPath, "/block/sdc") || e.DevName != "sdc" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	binary.NativeEndian.PutUint32(msg[20:], 4096)
+	if _, err := Parse(msg); err == nil {
+		t.Errorf("expected properties past the message to fail")
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, msg := range []string{"", "libudev\x00", "garbage", "add@/devices/x\x00SEQNUM=1\x00"} {
+		if _, err := Parse([]byte(msg)); err == nil {
+			t.Errorf("%q: expected an error", msg)
+		}
+	}
+}
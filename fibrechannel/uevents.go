@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/uevent"
+)
+
+// ueventWait bounds the wait for udev to announce the volume after a rescan when there is no
+// RescanWait
+const ueventWait = 10 * time.Second
+
+// WithUeventDiscovery waits for udev to announce new block devices after a rescan, instead of
+// sleeping for the RescanWait of WithTimeouts. The volume is searched again as soon as udev has
+// processed a device, so attach returns without the fixed pause and only once the device's
+// symlinks exist. A rescan waits at most RescanWait, or 10s without one, before the next rescan.
+// Where no uevents arrive, e.g. in a container without host networking, every rescan waits that
+// long without finding the volume any sooner.
+func WithUeventDiscovery() Option {
+	return func(o *options) {
+		o.uevents = true
+	}
+}
+
+// rescanAndWait rescans and gives the kernel and udev time to create the volume's devices, for
+// one rescan's wait and no longer than until deadline if the operation has a timeout
+func (o *options) rescanAndWait(c Connector, io ioHandler, deadline time.Time) error {
+	if !o.uevents {
+		o.rescan(c, io)
+		return poll.Sleep(o.ctx, o.clock, o.pollInterval)
+	}
+
+	// subscribe before the rescan, udev may announce the devices before it returns
+	ctx, cancel := context.WithCancel(o.ctx)
+	defer cancel()
+	events, err := uevent.Listen(ctx, uevent.UdevGroup)
+	if err != nil {
+		glog.Warningf("fc: unable to receive uevents, waiting %v instead: %v", o.pollInterval, err)
+		o.rescan(c, io)
+		return poll.Sleep(o.ctx, o.clock, o.pollInterval)
+	}
+	o.rescan(c, io)
+
+	// the caller rescans again or gives up once the wait passed
+	wait := o.pollInterval
+	if wait <= 0 {
+		wait = ueventWait
+	}
+	if left := deadline.Sub(o.clock.Now()); o.timeout > 0 && left < wait {
+		wait = left
+	}
+	timeout := o.clock.After(wait)
+	for len(findCandidates(c, io)) == 0 {
+		// search again whenever udev is done with a disk
+		for e := (uevent.Event{}); !announcesDisk(e); {
+			var ok bool
+			select {
+			case <-timeout:
+				return nil
+			case <-o.ctx.Done():
+				return o.ctx.Err()
+			case e, ok = <-events:
+				if !ok {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// announcesDisk reports whether e is udev done with a disk or a multipath map, which may be the
+// volume
+func announcesDisk(e uevent.Event) bool {
+	if e.Subsystem != "block" || e.DevType != "disk" {
+		return false
+	}
+	// multipathd loads the table of a new map with a change event
+	return e.Action == "add" || e.Action == "change"
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/uevent"
+)
+
+// udevSysfs shows the volume's by-path link from the reads'th read of /dev/disk/by-path on,
+// like udev creating it while the attach waits
+type udevSysfs struct {
+	*fakeSysfs
+	reads int
+}
+
+func (fs *udevSysfs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	if dirname == "/dev/disk/by-path/" {
+		if fs.reads--; fs.reads == 0 {
+			fs.links["/dev/disk/by-path/pci-0000:41:00.0-fc-0x500a0981891b8dc5-lun-1"] = "/dev/sdb"
+		}
+	}
+	return fs.fakeSysfs.ReadDir(dirname)
+}
+
+func TestUeventDiscovery(t *testing.T) {
+	defer func(listen func(context.Context, int) (<-chan uevent.Event, error)) { uevent.Listen = listen }(uevent.Listen)
+	events := make(chan uevent.Event, 2)
+	events <- uevent.Event{Action: "add", Subsystem: "scsi", DevType: "scsi_device"}
+	events <- uevent.Event{Action: "add", Subsystem: "block", DevType: "disk", DevName: "sdb"}
+	uevent.Listen = func(ctx context.Context, group int) (<-chan uevent.Event, error) {
+		return events, nil
+	}
+	// searches before the rescan, right after it and after the disk event
+	fs := &udevSysfs{fakeSysfs: newFakeSysfs(), reads: 3}
+	fs.files["/dev/sdb"] = ""
+	fs.files["/sys/block/sdb/size"] = "2097152"
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+
+	devicePath, err := Attach(c, fs, WithUeventDiscovery())
+	if err != nil || devicePath != "/dev/sdb" {
+		t.Fatalf("unexpected result %q, %v", devicePath, err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected the attach to wait for the disk event, %d events left", len(events))
+	}
+}
+
+func TestUeventDiscoveryRescans(t *testing.T) {
+	defer func(listen func(context.Context, int) (<-chan uevent.Event, error)) { uevent.Listen = listen }(uevent.Listen)
+	// the socket works but no uevent arrives, as in a container without host networking
+	uevent.Listen = func(ctx context.Context, group int) (<-chan uevent.Event, error) {
+		return make(chan uevent.Event), nil
+	}
+	fs := &scanCountingSysfs{fakeSysfs: newFakeSysfs()}
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+
+	_, err := Attach(c, fs, WithUeventDiscovery(), WithTimeout(time.Minute), WithMaxRescans(3), WithTimeouts(Timeouts{RescanWait: time.Millisecond}))
+	if !errors.Is(err, ErrDiskNotFound) {
+		t.Errorf("expected ErrDiskNotFound, got %v", err)
+	}
+	if fs.scans != 3 {
+		t.Errorf("expected every rescan to run, got %d", fs.scans)
+	}
+}
+
+func TestUeventDiscoveryFallback(t *testing.T) {
+	defer func(listen func(context.Context, int) (<-chan uevent.Event, error)) { uevent.Listen = listen }(uevent.Listen)
+	uevent.Listen = func(ctx context.Context, group int) (<-chan uevent.Event, error) {
+		return nil, errors.New("no netlink")
+	}
+	fs := &scanCountingSysfs{fakeSysfs: newFakeSysfs()}
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "1"}
+
+	if _, err := Attach(c, fs, WithUeventDiscovery()); !errors.Is(err, ErrDiskNotFound) {
+		t.Errorf("expected ErrDiskNotFound, got %v", err)
+	}
+	if fs.scans != 1 {
+		t.Errorf("expected the rescan without uevents, got %d", fs.scans)
+	}
+}
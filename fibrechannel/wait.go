@@ -0,0 +1,102 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/wwn"
+)
+
+const symlinkPollInterval = 250 * time.Millisecond
+
+// waitForDeviceBackoff spaces the searches of WaitForDevice, its Steps are unused as the timeout
+// ends the wait
+var waitForDeviceBackoff = poll.Backoff{Initial: time.Second, Factor: 2, Max: 16 * time.Second}
+
+// WaitForWWIDSymlink waits until udev has created /dev/disk/by-id/scsi-<wwid> and returns it.
+// The by-id link can show up noticeably later than the sd node, so callers that need the
+// stable path (e.g. for raw block publish) should wait for it instead of sleeping. wwid is spelled
+// as scsi_id does or as array APIs report it (naa.600A...). It waits until ctx is done, or for the
+// UdevSettle of WithTimeouts. UdevSettle is unset by default, a ctx without a deadline then waits
+// without bound for a link that never appears.
+func WaitForWWIDSymlink(ctx context.Context, wwid string, io ioHandler, opts ...Option) (link string, err error) {
+	defer recoverPanic("WaitForWWIDSymlink", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	// udev replaces white space in the wwid with underscores
+	link = "/dev/disk/by-id/scsi-" + strings.Replace(wwn.FromIdentifier(wwid), " ", "_", -1)
+	o := newOptions(opts)
+	deadline := o.clock.Now().Add(o.udevSettle)
+	err = poll.Until(ctx, o.clock, symlinkPollInterval, func() (bool, error) {
+		if _, err := io.Lstat(link); err == nil {
+			return true, nil
+		}
+		if o.udevSettle > 0 && !o.clock.Now().Before(deadline) {
+			return false, errTimeout
+		}
+		return false, nil
+	})
+	if err == errTimeout {
+		return "", fmt.Errorf("fc: %s did not appear within %v", link, o.udevSettle)
+	}
+	if err != nil {
+		return "", err
+	}
+	return link, nil
+}
+
+// WaitForDevice searches for the volume's device, rescanning, until it appears or timeout has
+// passed, and returns its path. Zoning and LUN masking changes can take several seconds to reach
+// the node, so a driver that just asked the array to map a volume should wait for it here rather
+// than fail on the first search. Searches are spaced with a growing delay to keep the rescans of
+// a long wait from disturbing the node. It returns ErrDiskNotFound when the device didn't appear,
+// other errors, e.g. ErrInvalidConnector, immediately.
+func WaitForDevice(c Connector, timeout time.Duration, io ioHandler, opts ...Option) (devicePath string, err error) {
+	defer recoverPanic("WaitForDevice", &err)
+
+	if io == nil {
+		io = &OSioHandler{}
+	}
+
+	o := newOptions(opts)
+	deadline := o.clock.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		devicePath, err = searchDisk(c, io, o)
+		if err == nil || !errors.Is(err, ErrDiskNotFound) {
+			return devicePath, err
+		}
+		remaining := deadline.Sub(o.clock.Now())
+		if remaining <= 0 {
+			return "", errorf(ErrDiskNotFound, "fc: no device of volume %s appeared within %v", c.VolumeName, timeout)
+		}
+		delay := waitForDeviceBackoff.Delay(attempt)
+		if delay > remaining {
+			delay = remaining
+		}
+		if err := poll.Sleep(o.ctx, o.clock, delay); err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	polltesting "github.com/kubernetes-csi/csi-lib-fc/fibrechannel/poll/testing"
+)
+
+func TestWaitForWWIDSymlink(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.links["/dev/disk/by-id/scsi-3600508b400105e210000900000490000"] = "/dev/sdb"
+
+	link, err := WaitForWWIDSymlink(context.Background(), "3600508b400105e210000900000490000", fs)
+	if err != nil || link != "/dev/disk/by-id/scsi-3600508b400105e210000900000490000" {
+		t.Errorf("unexpected result %q, %v", link, err)
+	}
+	// the identifier arrays report names the same link
+	link, err = WaitForWWIDSymlink(context.Background(), "naa.600508B400105E210000900000490000", fs)
+	if err != nil || link != "/dev/disk/by-id/scsi-3600508b400105e210000900000490000" {
+		t.Errorf("unexpected result %q, %v", link, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WaitForWWIDSymlink(ctx, "3600508b400105e21000090000049ffff", fs); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWaitForDevice(t *testing.T) {
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	if devicePath, err := WaitForDevice(c, time.Minute, &fakeIOHandler{}); err != nil || devicePath == "" {
+		t.Errorf("unexpected result %q, %v", devicePath, err)
+	}
+	if _, err := WaitForDevice(Connector{}, time.Minute, newFakeSysfs()); !errors.Is(err, ErrInvalidConnector) {
+		t.Errorf("expected ErrInvalidConnector without waiting, got %v", err)
+	}
+}
+
+func TestWaitForDeviceTimeout(t *testing.T) {
+	c := Connector{VolumeName: "fakeVol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	fs := &scanCountingSysfs{fakeSysfs: newFakeSysfs()}
+	fs.files["/sys/class/scsi_host/host5/proc_name"] = "lpfc\n"
+	clock := polltesting.NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go clock.StepUntilDone(time.Second, done)
+	defer close(done)
+
+	// searches at 0s, 1s, 3s and, cut short, 5s
+	if _, err := WaitForDevice(c, 5*time.Second, fs, WithClock(clock)); !errors.Is(err, ErrDiskNotFound) {
+		t.Errorf("expected ErrDiskNotFound, got %v", err)
+	}
+	if fs.scans != 4 {
+		t.Errorf("expected 4 searches, got %d", fs.scans)
+	}
+}
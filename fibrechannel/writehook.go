@@ -0,0 +1,80 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+//WriteHook is invoked around every write the library makes to the kernel through sysfs, procfs or
+//cgroupfs: scsi rescans and deletes, queue tuning, host port state changes, I/O limits. BeforeWrite
+//can veto a write by returning an error, which is then returned as the write's error. AfterWrite is
+//called with the result of every write that was attempted.
+type WriteHook interface {
+	BeforeWrite(filename string, data []byte) error
+	AfterWrite(filename string, data []byte, err error)
+}
+
+// hookedIO passes every WriteFile of the wrapped handler through a WriteHook
+type hookedIO struct {
+	ioHandler
+	hook WriteHook
+}
+
+// HookWrites returns a sysfs.IO that behaves like io but passes every write through hook, so
+// operators can gate or log all storage affecting kernel interactions of a plugin in one place.
+// Pass the result to NewClient or the free functions in place of io.
+func HookWrites(io sysfs.IO, hook WriteHook) sysfs.IO {
+	if io == nil {
+		io = &OSioHandler{}
+	}
+	return &hookedIO{ioHandler: io, hook: hook}
+}
+
+func (h *hookedIO) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	if err := h.hook.BeforeWrite(filename, data); err != nil {
+		return fmt.Errorf("fc: write of %q to %s refused: %v", data, filename, err)
+	}
+	err := h.ioHandler.WriteFile(filename, data, perm)
+	h.hook.AfterWrite(filename, data, err)
+	return err
+}
+
+// the securityHandler methods are forwarded so wrapping doesn't take them away
+
+func (h *hookedIO) Chown(name string, uid, gid int) error {
+	if sh, ok := h.ioHandler.(securityHandler); ok {
+		return sh.Chown(name, uid, gid)
+	}
+	return fmt.Errorf("fc: io handler can't change ownership of %s", name)
+}
+
+func (h *hookedIO) Chmod(name string, mode os.FileMode) error {
+	if sh, ok := h.ioHandler.(securityHandler); ok {
+		return sh.Chmod(name, mode)
+	}
+	return fmt.Errorf("fc: io handler can't change mode of %s", name)
+}
+
+func (h *hookedIO) Setxattr(path, attr string, data []byte) error {
+	if sh, ok := h.ioHandler.(securityHandler); ok {
+		return sh.Setxattr(path, attr, data)
+	}
+	return fmt.Errorf("fc: io handler can't set %s on %s", attr, path)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingHook refuses writes below deny and records what it saw
+type recordingHook struct {
+	deny   string
+	before []string
+	after  []string
+}
+
+func (h *recordingHook) BeforeWrite(filename string, data []byte) error {
+	h.before = append(h.before, filename)
+	if h.deny != "" && strings.HasPrefix(filename, h.deny) {
+		return errors.New("denied by policy")
+	}
+	return nil
+}
+
+func (h *recordingHook) AfterWrite(filename string, data []byte, err error) {
+	h.after = append(h.after, fmt.Sprintf("%s=%s %v", filename, data, err))
+}
+
+func TestHookWrites(t *testing.T) {
+	fs := newFakeSysfs()
+	fs.files["/sys/block/sdb/queue/nr_requests"] = "128\n"
+	fs.files["/sys/block/sdc/queue/nr_requests"] = "128\n"
+	hook := &recordingHook{deny: "/sys/block/sdc/"}
+	io := HookWrites(fs, hook)
+
+	if err := writeQueueAttr("sdb", "nr_requests", "256", io); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := writeQueueAttr("sdc", "nr_requests", "256", io); err == nil {
+		t.Error("expected the hook to refuse the write")
+	}
+	if _, ok := fs.writes["/sys/block/sdc/queue/nr_requests"]; ok {
+		t.Error("refused write reached sysfs")
+	}
+	if len(hook.before) != 2 || len(hook.after) != 1 || hook.after[0] != "/sys/block/sdb/queue/nr_requests=256 <nil>" {
+		t.Errorf("unexpected hook calls: before %v after %v", hook.before, hook.after)
+	}
+
+	// ownership changes still reach the wrapped handler
+	sfs := &securitySysfs{fakeSysfs: newFakeSysfs()}
+	uid := int64(1000)
+	if err := SetDeviceSecurity("/dev/sdb", DeviceSecurity{UID: &uid}, HookWrites(sfs, hook)); err != nil || len(sfs.changes) != 1 {
+		t.Errorf("expected chown to be forwarded, got %v, %v", sfs.changes, err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package wwn compares the world wide names and world wide identifiers fibre channel storage is
+// addressed by, in the different spellings sysfs, udev and multipath use for them.
+package wwn
+
+import (
+	"strings"
+)
+
+// Equal compares two port or node names in any of the spellings Normalize accepts
+func Equal(a, b string) bool {
+	return Normalize(a) == Normalize(b)
+}
+
+// Valid reports whether name is a port or node name: 16 hex digits in any of the spellings
+// Normalize accepts
+func Valid(name string) bool {
+	name = Normalize(name)
+	return len(name) == 16 && hex(name)
+}
+
+func hex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Placeholder reports whether name, a valid port or node name, can't be the name of a port: all
+// zeros, what unset fields are often filled with, or all ones, the broadcast address
+func Placeholder(name string) bool {
+	switch Normalize(name) {
+	case "0000000000000000", "ffffffffffffffff":
+		return true
+	}
+	return false
+}
+
+// Normalize returns a port or node name the way /dev/disk/by-path spells it: 16 lower case hex
+// digits. Arrays, switches and admins write the same name as 0x500A0981891B8DC5, as
+// 50:0a:09:81:89:1b:8d:c5 or with dashes, all of which are accepted.
+func Normalize(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "0x") || strings.HasPrefix(name, "0X") {
+		name = name[2:]
+	}
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(name))
+}
+
+// the designator types of a sysfs wwid and the digit scsi_id prefixes them with
+var wwidTypes = map[string]string{"naa.": "3", "eui.": "2", "t10.": "1"}
+
+// SameWWID compares a wwid in the kernel's sysfs form (naa.600a..., eui.00..., t10.ATA...) with
+// one in the form scsi_id and multipath use (3600a..., 200..., 1ATA...), or an identifier
+// FromIdentifier accepts
+func SameWWID(sysfsWWID, wwid string) bool {
+	if sysfsWWID == "" || wwid == "" {
+		return false
+	}
+	return strings.EqualFold(SCSIID(sysfsWWID), strings.Replace(FromIdentifier(wwid), " ", "_", -1))
+}
+
+// SCSIID converts a wwid from the kernel's sysfs form to the one scsi_id and multipath use, e.g.
+// naa.600a... to 3600a.... Like udev and multipath it replaces white space with underscores.
+func SCSIID(sysfsWWID string) string {
+	for prefix, idType := range wwidTypes {
+		if strings.HasPrefix(sysfsWWID, prefix) {
+			sysfsWWID = idType + strings.TrimPrefix(sysfsWWID, prefix)
+			break
+		}
+	}
+	return strings.Replace(sysfsWWID, " ", "_", -1)
+}
+
+// identifierDigits are the lengths in hex digits of the NAA (8 or 16 bytes) and EUI-64 (8, 12 or
+// 16 bytes) designators
+var identifierDigits = map[string][]int{"naa.": {16, 32}, "eui.": {16, 24, 32}}
+
+// FromIdentifier converts a LUN identifier in the textual form array APIs report, e.g.
+// naa.6000D31000A1B2000000000000000012 or eui.0025385B71B0F9A2, in any case and with colons or
+// dashes between the digits, to the wwid scsi_id and multipath use and udev names the
+// /dev/disk/by-id/scsi-<wwid> link after: 36000d31000a1b2000000000000000012 or
+// 20025385b71b0f9a2. Any other wwid is returned unchanged.
+func FromIdentifier(id string) string {
+	lower := strings.ToLower(strings.TrimSpace(id))
+	for prefix := range identifierDigits {
+		if strings.HasPrefix(lower, prefix) {
+			return wwidTypes[prefix] + strings.NewReplacer(":", "", "-", "").Replace(lower[len(prefix):])
+		}
+	}
+	return id
+}
+
+// ValidIdentifier reports whether id, if it is an identifier in the naa. or eui. form
+// FromIdentifier converts, has as many hex digits as such a designator. Other wwids aren't
+// checked.
+func ValidIdentifier(id string) bool {
+	lower := strings.ToLower(strings.TrimSpace(id))
+	for prefix, lengths := range identifierDigits {
+		if !strings.HasPrefix(lower, prefix) {
+			continue
+		}
+		digits := FromIdentifier(id)[1:]
+		for _, n := range lengths {
+			if len(digits) == n && hex(digits) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wwn
+
+import (
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"0x500a0981891b8dc5", "500a0981891b8dc5", true},
+		{"500A0981891B8DC5", "0x500a0981891b8dc5", true},
+		{"500a0981891b8dc5", "500a0981891b8dc50", false},
+		{"50:0A:09:81:89:1B:8D:C5", "0x500a0981891b8dc5", true},
+		{"50-0a-09-81-89-1b-8d-c5", "500a0981891b8dc5", true},
+		{"50:0a:09:81:89:1b:8d:c6", "500a0981891b8dc5", false},
+	}
+	for _, test := range tests {
+		if Equal(test.a, test.b) != test.expected {
+			t.Errorf("Equal(%s, %s): expected %v", test.a, test.b, test.expected)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, name := range []string{"500a0981891b8dc5", "0x500A0981891B8DC5", "50:0a:09:81:89:1b:8d:c5", "50-0A-09-81-89-1B-8D-C5", " 0x500a0981891b8dc5\n"} {
+		if n := Normalize(name); n != "500a0981891b8dc5" {
+			t.Errorf("%q: expected 500a0981891b8dc5, got %s", name, n)
+		}
+		if !Valid(name) {
+			t.Errorf("%q: expected a valid wwn", name)
+		}
+	}
+	for _, name := range []string{"", "500a0981891b8dc", "500a0981891b8dcz", "50::0a09"} {
+		if Valid(name) {
+			t.Errorf("%q: expected an invalid wwn", name)
+		}
+	}
+	for _, name := range []string{"0000000000000000", "0x0000000000000000", "FF:FF:FF:FF:FF:FF:FF:FF"} {
+		if !Placeholder(name) {
+			t.Errorf("%q: expected a placeholder", name)
+		}
+	}
+	if Placeholder("500a0981891b8dc5") {
+		t.Error("500a0981891b8dc5: expected a port name")
+	}
+}
+
+func TestSameWWID(t *testing.T) {
+	tests := []struct {
+		sysfsWWID, wwid string
+		expected        bool
+	}{
+		{"naa.600a098038303053453f463045727a44", "3600a098038303053453f463045727a44", true},
+		{"eui.0025385b71b0f9a2", "20025385b71b0f9a2", true},
+		{"t10.ATA     QEMU HARDDISK", "1ATA_____QEMU_HARDDISK", true},
+		{"naa.600a098038303053453f463045727a44", "3600a098038303053453f463045727a45", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if SameWWID(test.sysfsWWID, test.wwid) != test.expected {
+			t.Errorf("SameWWID(%s, %s): expected %v", test.sysfsWWID, test.wwid, test.expected)
+		}
+	}
+}
+
+func TestFromIdentifier(t *testing.T) {
+	tests := []struct {
+		id, expected string
+		valid        bool
+	}{
+		{"naa.600A098038303053453F463045727A44", "3600a098038303053453f463045727a44", true},
+		{"NAA.60:0a:09:80:38:30:30:53:45:3f:46:30:45:72:7a:44", "3600a098038303053453f463045727a44", true},
+		{"naa.5000c500a1b2c3d4", "35000c500a1b2c3d4", true},
+		{"eui.0025385B71B0F9A2", "20025385b71b0f9a2", true},
+		{"3600a098038303053453f463045727a44", "3600a098038303053453f463045727a44", true},
+		{"naa.600a0980383030", "3600a0980383030", false},
+		{"eui.0025385b71b0f9zz", "20025385b71b0f9zz", false},
+	}
+	for _, test := range tests {
+		if id := FromIdentifier(test.id); id != test.expected {
+			t.Errorf("FromIdentifier(%s): expected %s, got %s", test.id, test.expected, id)
+		}
+		if ValidIdentifier(test.id) != test.valid {
+			t.Errorf("ValidIdentifier(%s): expected %v", test.id, test.valid)
+		}
+	}
+	if !SameWWID("naa.600a098038303053453f463045727a44", "naa.600A098038303053453F463045727A44") {
+		t.Error("expected an identifier to match its sysfs wwid")
+	}
+}
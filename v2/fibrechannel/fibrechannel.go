@@ -0,0 +1,129 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fibrechannel is the v2 API of the library: a Client whose operations take the CSI
+// call's context first and return structured results. It is a wrapper package in the same module,
+// not a module of its own: it runs the Client of the original package, whose types, options and
+// errors it shares, so both can be used side by side while a driver migrates.
+package fibrechannel
+
+import (
+	"context"
+
+	fc "github.com/kubernetes-csi/csi-lib-fc/fibrechannel"
+	"github.com/kubernetes-csi/csi-lib-fc/fibrechannel/sysfs"
+)
+
+// The types of the original package, values pass between code using either API unchanged
+type (
+	Connector       = fc.Connector
+	DeviceInfo      = fc.DeviceInfo
+	DeviceResult    = fc.DeviceResult
+	DetachResult    = fc.DetachResult
+	AttachResult    = fc.AttachResult
+	ConflictError   = fc.ConflictError
+	OperationRecord = fc.OperationRecord
+	Load            = fc.Load
+	Option          = fc.Option
+)
+
+// The errors of the original package, errors.Is matches the errors of either API against them
+var (
+	ErrDiskNotFound      = fc.ErrDiskNotFound
+	ErrNoMultipathDevice = fc.ErrNoMultipathDevice
+	ErrInvalidConnector  = fc.ErrInvalidConnector
+	ErrNoFCHosts         = fc.ErrNoFCHosts
+	ErrDeviceBusy        = fc.ErrDeviceBusy
+	ErrIdentityMismatch  = fc.ErrIdentityMismatch
+	ErrSizeMismatch      = fc.ErrSizeMismatch
+)
+
+//Client attaches and detaches volumes with the serialization, retry journal and history of the
+//original Client, see its documentation for the concurrency contract
+type Client struct {
+	cl *fc.Client
+}
+
+// NewClient returns a Client doing its io through io, nil means the OS. opts apply to every
+// operation of the Client, before the options passed to the operation itself.
+func NewClient(io sysfs.IO, opts ...Option) *Client {
+	return &Client{cl: fc.NewClient(io, opts...)}
+}
+
+// V1 returns the original Client this Client runs, sharing its locks and state, for code not
+// migrated yet
+func (c *Client) V1() *fc.Client {
+	return c.cl
+}
+
+// Attach attaches the volume of conn and describes the device it found, giving up when ctx is
+// done. It is the original Client's AttachDevice, DeviceInfo.Path is the device path its Attach
+// returns.
+func (c *Client) Attach(ctx context.Context, conn Connector, opts ...Option) (DeviceInfo, error) {
+	return c.cl.AttachDeviceContext(ctx, conn, opts...)
+}
+
+// AttachMulti attaches the volumes of conns with one rescan, giving up when ctx is done, see the
+// original Client's AttachMulti
+func (c *Client) AttachMulti(ctx context.Context, conns []Connector, opts ...Option) ([]AttachResult, error) {
+	return c.cl.AttachMultiContext(ctx, conns, opts...)
+}
+
+// Prefetch rescans for the volume of conn ahead of its Attach, giving up when ctx is done
+func (c *Client) Prefetch(ctx context.Context, conn Connector, opts ...Option) error {
+	return c.cl.PrefetchContext(ctx, conn, opts...)
+}
+
+// Detach detaches devicePath, attached for volumeName, and reports what happened to each of its
+// devices. Once the removal started it is completed regardless of ctx.
+func (c *Client) Detach(ctx context.Context, volumeName, devicePath string, opts ...Option) (DetachResult, error) {
+	var result DetachResult
+	err := c.cl.DetachContext(ctx, volumeName, devicePath, withDetachResult(opts, &result)...)
+	return result, err
+}
+
+// DetachVolume is Detach finding the device from conn
+func (c *Client) DetachVolume(ctx context.Context, conn Connector, opts ...Option) (DetachResult, error) {
+	var result DetachResult
+	err := c.cl.DetachVolumeContext(ctx, conn, withDetachResult(opts, &result)...)
+	return result, err
+}
+
+// Restore claims the volumes of saved connector files when the plugin starts, giving up when ctx
+// is done, see the original Client's Restore
+func (c *Client) Restore(ctx context.Context, filenames ...string) error {
+	return c.cl.RestoreContext(ctx, filenames...)
+}
+
+// AttachedDevice returns the device path this Client attached for volumeName and hasn't detached since
+func (c *Client) AttachedDevice(volumeName string) (string, bool) {
+	return c.cl.AttachedDevice(volumeName)
+}
+
+// History returns the last operations of the Client, oldest first
+func (c *Client) History() []OperationRecord {
+	return c.cl.History()
+}
+
+// Load returns the operations of the Client running and waiting right now
+func (c *Client) Load() Load {
+	return c.cl.Load()
+}
+
+// withDetachResult appends the option storing the detach result in result to a copy of opts
+func withDetachResult(opts []Option, result *DetachResult) []Option {
+	return append(append([]Option{}, opts...), fc.WithDetachResult(result))
+}
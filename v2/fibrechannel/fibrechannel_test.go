@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fibrechannel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	fc "github.com/kubernetes-csi/csi-lib-fc/fibrechannel"
+)
+
+// emptyIO is a node without any fc host or device
+type emptyIO struct{}
+
+func (emptyIO) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return nil, os.ErrNotExist
+}
+
+func (emptyIO) Lstat(name string) (os.FileInfo, error) {
+	return nil, os.ErrNotExist
+}
+
+func (emptyIO) EvalSymlinks(path string) (string, error) {
+	return "", os.ErrNotExist
+}
+
+func (emptyIO) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	return os.ErrNotExist
+}
+
+func (emptyIO) ReadFile(filename string) ([]byte, error) {
+	return nil, os.ErrNotExist
+}
+
+func (emptyIO) Remove(name string) error {
+	return os.ErrNotExist
+}
+
+func (emptyIO) Rename(oldpath, newpath string) error {
+	return os.ErrNotExist
+}
+
+func TestClient(t *testing.T) {
+	client := NewClient(emptyIO{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := Connector{VolumeName: "vol", TargetWWNs: []string{"500a0981891b8dc5"}, Lun: "0"}
+	if _, err := client.Attach(ctx, c); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled context to stop attach, got %v", err)
+	}
+	if results, err := client.AttachMulti(ctx, []Connector{c}); err == nil || len(results) != 1 || !errors.Is(results[0].Err, context.Canceled) {
+		t.Errorf("expected the canceled context to stop the multi attach, got %+v, %v", results, err)
+	}
+	if err := client.Prefetch(ctx, c); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled context to stop prefetch, got %v", err)
+	}
+	if err := client.Restore(ctx, "/var/lib/kubelet/plugins/fc/vol.json"); err == nil {
+		t.Error("expected the canceled context to stop restore")
+	}
+
+	result, err := client.Detach(context.Background(), "vol", "/dev/sdz", fc.WithWWID("3600a098038303634722b4d59614b6a6d"))
+	if err != nil || !result.Complete() {
+		t.Errorf("expected the detach of a gone device to be complete, got %+v, %v", result, err)
+	}
+
+	// the errors are those of the original package
+	if ErrDiskNotFound != fc.ErrDiskNotFound || ErrDeviceBusy != fc.ErrDeviceBusy {
+		t.Error("expected the errors of the original package")
+	}
+	if client.V1() == nil {
+		t.Error("expected the original Client")
+	}
+}